@@ -0,0 +1,16 @@
+-- Migration: Add node_config_histories table
+-- This migration adds an audit log of config pushes to nodes in multi-node mode
+
+-- Node config history table
+CREATE TABLE IF NOT EXISTS node_config_histories (
+    id SERIAL PRIMARY KEY,
+    node_id INTEGER NOT NULL,
+    config_hash TEXT NOT NULL DEFAULT '',
+    applied_at BIGINT NOT NULL DEFAULT 0,
+    success BOOLEAN NOT NULL DEFAULT false,
+    error TEXT NOT NULL DEFAULT '',
+    FOREIGN KEY (node_id) REFERENCES nodes(id) ON DELETE CASCADE
+);
+
+-- Create index for node_config_histories
+CREATE INDEX IF NOT EXISTS idx_node_config_histories_node_id ON node_config_histories(node_id, applied_at);
@@ -0,0 +1,10 @@
+-- Migration: Add last_traffic_reset_time field to client_entities
+-- This migration adds the timestamp used by the per-client traffic reset schedule
+-- (ClientEntity.Reset, in days). A value of 0 means the client has never been reset
+-- and the schedule starts counting from the next run of the reset job.
+--
+-- This migration is idempotent and safe to run multiple times.
+
+-- Add last_traffic_reset_time column to client_entities table
+ALTER TABLE client_entities
+ADD COLUMN IF NOT EXISTS last_traffic_reset_time BIGINT NOT NULL DEFAULT 0;
@@ -0,0 +1,22 @@
+-- Migration: Add api_tokens table
+-- This migration adds bearer tokens for scripted access to the panel API.
+-- Only the SHA-256 hash of each token is stored.
+--
+-- This migration is idempotent and safe to run multiple times.
+
+-- API tokens table
+CREATE TABLE IF NOT EXISTS api_tokens (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL,
+    name VARCHAR(255) NOT NULL DEFAULT '',
+    token_hash VARCHAR(64) NOT NULL,
+    scope VARCHAR(16) NOT NULL DEFAULT 'read',
+    revoked BOOLEAN NOT NULL DEFAULT false,
+    created_at BIGINT NOT NULL DEFAULT 0,
+    last_used_at BIGINT NOT NULL DEFAULT 0,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- Create indexes for api_tokens
+CREATE UNIQUE INDEX IF NOT EXISTS idx_api_tokens_token_hash ON api_tokens(token_hash);
+CREATE INDEX IF NOT EXISTS idx_api_tokens_user_id ON api_tokens(user_id);
@@ -0,0 +1,18 @@
+-- Migration: Add client_node_mappings table
+-- This migration allows restricting a client to specific nodes in multi-node mode.
+-- A client without mappings is served by every node of its inbounds.
+--
+-- This migration is idempotent and safe to run multiple times.
+
+-- Client node mappings table
+CREATE TABLE IF NOT EXISTS client_node_mappings (
+    id SERIAL PRIMARY KEY,
+    client_id INTEGER NOT NULL,
+    node_id INTEGER NOT NULL,
+    FOREIGN KEY (client_id) REFERENCES client_entities(id) ON DELETE CASCADE,
+    FOREIGN KEY (node_id) REFERENCES nodes(id) ON DELETE CASCADE
+);
+
+-- Create indexes for client_node_mappings
+CREATE UNIQUE INDEX IF NOT EXISTS idx_client_node ON client_node_mappings(client_id, node_id);
+CREATE INDEX IF NOT EXISTS idx_client_node_mappings_node_id ON client_node_mappings(node_id);
@@ -0,0 +1,18 @@
+-- Migration: Add node_traffic_samples table
+-- This migration adds a traffic time series per node for bandwidth charts in multi-node mode.
+-- Each row holds the traffic of one node within one time slot (a minute, or an hour once compacted).
+--
+-- This migration is idempotent and safe to run multiple times.
+
+-- Node traffic samples table
+CREATE TABLE IF NOT EXISTS node_traffic_samples (
+    id SERIAL PRIMARY KEY,
+    node_id INTEGER NOT NULL,
+    up BIGINT NOT NULL DEFAULT 0,
+    down BIGINT NOT NULL DEFAULT 0,
+    ts BIGINT NOT NULL DEFAULT 0,
+    FOREIGN KEY (node_id) REFERENCES nodes(id) ON DELETE CASCADE
+);
+
+-- Create index for node_traffic_samples
+CREATE UNIQUE INDEX IF NOT EXISTS idx_node_traffic_samples_node_ts ON node_traffic_samples(node_id, ts);
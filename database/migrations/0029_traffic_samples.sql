@@ -0,0 +1,20 @@
+-- Migration: Add traffic_samples table
+-- This migration adds a traffic time series per inbound and per client for bandwidth charts.
+-- Each row holds the traffic of one inbound (scope 'inbound', key = inbound tag) or one client
+-- (scope 'client', key = lowercased email) within one time slot (a minute, or an hour once compacted).
+--
+-- This migration is idempotent and safe to run multiple times.
+
+-- Traffic samples table
+CREATE TABLE IF NOT EXISTS traffic_samples (
+    id SERIAL PRIMARY KEY,
+    scope VARCHAR(16) NOT NULL,
+    key VARCHAR(255) NOT NULL,
+    up BIGINT NOT NULL DEFAULT 0,
+    down BIGINT NOT NULL DEFAULT 0,
+    ts BIGINT NOT NULL DEFAULT 0
+);
+
+-- Create indexes for traffic_samples
+CREATE UNIQUE INDEX IF NOT EXISTS idx_traffic_samples_scope_key_ts ON traffic_samples(scope, key, ts);
+CREATE INDEX IF NOT EXISTS idx_traffic_samples_ts ON traffic_samples(ts);
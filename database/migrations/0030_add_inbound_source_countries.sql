@@ -0,0 +1,12 @@
+-- Migration: Add source country restriction fields to inbounds
+-- source_country_mode is 'allow' or 'deny' (empty = no restriction) and source_countries
+-- a comma-separated list of geoip country codes. The restriction is applied as a routing
+-- rule scoped to the inbound tag when the core config is built.
+--
+-- This migration is idempotent and safe to run multiple times.
+
+ALTER TABLE inbounds
+ADD COLUMN IF NOT EXISTS source_country_mode VARCHAR(10) NOT NULL DEFAULT '';
+
+ALTER TABLE inbounds
+ADD COLUMN IF NOT EXISTS source_countries TEXT NOT NULL DEFAULT '';
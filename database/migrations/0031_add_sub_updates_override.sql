@@ -0,0 +1,12 @@
+-- Migration: Add subscription update interval overrides to clients and groups
+-- sub_updates is the Profile-Update-Interval (in hours) sent in the subscription of a client.
+-- A value of 0 means no override: the client falls back to its group, then to the global
+-- subUpdates setting.
+--
+-- This migration is idempotent and safe to run multiple times.
+
+ALTER TABLE client_entities
+ADD COLUMN IF NOT EXISTS sub_updates INTEGER NOT NULL DEFAULT 0;
+
+ALTER TABLE client_groups
+ADD COLUMN IF NOT EXISTS sub_updates INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,9 @@
+-- Migration: Add a CA certificate path to nodes
+-- ca_path is the CA bundle the panel verifies the node API certificate against. It lets
+-- cert_path/key_path hold a client certificate for mutual TLS. When ca_path is empty,
+-- cert_path is used as the CA as before.
+--
+-- This migration is idempotent and safe to run multiple times.
+
+ALTER TABLE nodes
+ADD COLUMN IF NOT EXISTS ca_path VARCHAR(255) NOT NULL DEFAULT '';
@@ -0,0 +1,8 @@
+-- Migration: Add a role to users
+-- role is 'admin' (full access) or 'readonly' (may view but not change anything).
+-- Existing users keep full access.
+--
+-- This migration is idempotent and safe to run multiple times.
+
+ALTER TABLE users
+ADD COLUMN IF NOT EXISTS role VARCHAR(16) NOT NULL DEFAULT 'admin';
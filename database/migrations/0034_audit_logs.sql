@@ -0,0 +1,24 @@
+-- Migration: Add audit_logs table
+-- This migration adds a record of mutating requests to the panel (who changed what and when).
+-- Client and setting changes store a redacted summary of the changed fields.
+--
+-- This migration is idempotent and safe to run multiple times.
+
+-- Audit log table
+CREATE TABLE IF NOT EXISTS audit_logs (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL DEFAULT 0,
+    username VARCHAR(255) NOT NULL DEFAULT '',
+    action VARCHAR(255) NOT NULL DEFAULT '',
+    target_id VARCHAR(255) NOT NULL DEFAULT '',
+    ip VARCHAR(64) NOT NULL DEFAULT '',
+    success BOOLEAN NOT NULL DEFAULT false,
+    before TEXT NOT NULL DEFAULT '',
+    after TEXT NOT NULL DEFAULT '',
+    created_at BIGINT NOT NULL DEFAULT 0
+);
+
+-- Create indexes for audit_logs
+CREATE INDEX IF NOT EXISTS idx_audit_logs_created_at ON audit_logs(created_at);
+CREATE INDEX IF NOT EXISTS idx_audit_logs_user_id ON audit_logs(user_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_audit_logs_action ON audit_logs(action);
@@ -3,6 +3,7 @@ package model
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/konstpic/sharx-code/v2/util/json_util"
 	"github.com/konstpic/sharx-code/v2/xray"
@@ -23,13 +24,26 @@ const (
 	WireGuard   Protocol = "wireguard"
 )
 
+// Source country modes of an inbound (see Inbound.SourceCountryMode)
+const (
+	SourceCountryAllow = "allow" // only clients connecting from the listed countries are accepted
+	SourceCountryDeny  = "deny"  // clients connecting from the listed countries are rejected
+)
+
 // User represents a user account in the SharX panel.
 type User struct {
 	Id       int    `json:"id" gorm:"primaryKey;autoIncrement"`
 	Username string `json:"username"`
 	Password string `json:"password"`
+	Role     string `json:"role" gorm:"default:admin"` // UserRoleAdmin or UserRoleReadOnly
 }
 
+// User roles (see User.Role)
+const (
+	UserRoleAdmin    = "admin"    // may view and change everything
+	UserRoleReadOnly = "readonly" // may view clients, inbounds and traffic but not change anything
+)
+
 // Inbound represents an Xray inbound configuration with traffic statistics and settings.
 type Inbound struct {
 	Id                   int                  `json:"id" form:"id" gorm:"primaryKey;autoIncrement"`                                                    // Unique identifier
@@ -55,6 +69,15 @@ type Inbound struct {
 	Sniffing       string   `json:"sniffing" form:"sniffing"`
 	NodeId         *int     `json:"nodeId,omitempty" form:"-" gorm:"-"` // Node ID (not stored in Inbound table, from mapping) - DEPRECATED: kept only for backward compatibility with old clients, use NodeIds instead
 	NodeIds        []int    `json:"nodeIds,omitempty" form:"-" gorm:"-"` // Node IDs array (not stored in Inbound table, from mapping) - use this for multi-node support
+
+	// Source country restriction, enforced by a routing rule scoped to the inbound
+	SourceCountryMode string `json:"sourceCountryMode" form:"sourceCountryMode"` // allow, deny or empty for no restriction
+	SourceCountries   string `json:"sourceCountries" form:"sourceCountries"`     // comma-separated geoip country codes
+
+	// Aggregates over the assigned clients (not stored in Inbound table, filled by the inbound list)
+	ActiveClientCount int   `json:"activeClientCount" form:"-" gorm:"-"` // enabled clients with active status
+	TotalUp           int64 `json:"totalUp" form:"-" gorm:"-"`           // sum of the clients' upload traffic in bytes
+	TotalDown         int64 `json:"totalDown" form:"-" gorm:"-"`         // sum of the clients' download traffic in bytes
 }
 
 // OutboundTraffics tracks traffic statistics for Xray outbound connections.
@@ -80,8 +103,64 @@ type HistoryOfSeeders struct {
 }
 
 // GenXrayInboundConfig generates an Xray inbound configuration from the Inbound model.
+// For an inbound with several listen addresses it only covers the first one; use GenXrayInboundConfigs
+// to build the inbounds of all addresses.
 func (i *Inbound) GenXrayInboundConfig() *xray.InboundConfig {
-	listen := i.Listen
+	listen := ""
+	if addresses := i.ListenAddresses(); len(addresses) > 0 {
+		listen = addresses[0]
+	}
+	return i.genXrayInboundConfig(listen, i.Tag)
+}
+
+// GenXrayInboundConfigs generates one Xray inbound per listen address. The first keeps the inbound tag,
+// the others get distinct alias tags (see xray.ListenAliasTag).
+func (i *Inbound) GenXrayInboundConfigs() []*xray.InboundConfig {
+	addresses := i.ListenAddresses()
+	if len(addresses) <= 1 {
+		return []*xray.InboundConfig{i.GenXrayInboundConfig()}
+	}
+	configs := make([]*xray.InboundConfig, 0, len(addresses))
+	for index, address := range addresses {
+		configs = append(configs, i.genXrayInboundConfig(address, xray.ListenAliasTag(i.Tag, index)))
+	}
+	return configs
+}
+
+// ListenAddresses returns the listen addresses of the inbound. Listen may hold a
+// comma-separated list; an empty Listen means all interfaces and yields no address.
+func (i *Inbound) ListenAddresses() []string {
+	addresses := make([]string, 0, 1)
+	for _, address := range strings.Split(i.Listen, ",") {
+		if address = strings.TrimSpace(address); address != "" {
+			addresses = append(addresses, address)
+		}
+	}
+	return addresses
+}
+
+// HasMultipleListen reports whether the inbound is bound to more than one listen address.
+func (i *Inbound) HasMultipleListen() bool {
+	return len(i.ListenAddresses()) > 1
+}
+
+// SourceCountryList returns the country codes of SourceCountries.
+func (i *Inbound) SourceCountryList() []string {
+	countries := make([]string, 0)
+	for _, country := range strings.Split(i.SourceCountries, ",") {
+		if country = strings.TrimSpace(country); country != "" {
+			countries = append(countries, country)
+		}
+	}
+	return countries
+}
+
+// RestrictsSourceCountries reports whether the inbound accepts clients only from some countries.
+func (i *Inbound) RestrictsSourceCountries() bool {
+	return i.SourceCountryMode != "" && len(i.SourceCountryList()) > 0
+}
+
+func (i *Inbound) genXrayInboundConfig(listen string, tag string) *xray.InboundConfig {
 	if listen != "" {
 		listen = fmt.Sprintf("\"%v\"", listen)
 	}
@@ -91,7 +170,7 @@ func (i *Inbound) GenXrayInboundConfig() *xray.InboundConfig {
 		Protocol:       string(i.Protocol),
 		Settings:       json_util.RawMessage(i.Settings),
 		StreamSettings: json_util.RawMessage(i.StreamSettings),
-		Tag:            i.Tag,
+		Tag:            tag,
 		Sniffing:       json_util.RawMessage(i.Sniffing),
 	}
 }
@@ -148,6 +227,7 @@ type ClientEntity struct {
 	
 	// Relations (not stored in DB, loaded via joins)
 	InboundIds []int `json:"inboundIds,omitempty" form:"-" gorm:"-"` // Inbound IDs this client is assigned to
+	NodeIds    []int `json:"nodeIds,omitempty" form:"-" gorm:"-"`    // Node IDs this client is restricted to in multi-node mode (empty = all nodes of its inbounds)
 	
 	// Group assignment
 	GroupId *int `json:"groupId,omitempty" form:"groupId" gorm:"column:group_id;index"` // Group ID (nullable, client can belong to one group)
@@ -156,6 +236,7 @@ type ClientEntity struct {
 	Up         int64 `json:"up,omitempty" form:"-" gorm:"default:0"`         // Upload traffic in bytes
 	Down       int64 `json:"down,omitempty" form:"-" gorm:"default:0"`       // Download traffic in bytes
 	AllTime    int64 `json:"allTime,omitempty" form:"-" gorm:"default:0"`    // All-time traffic usage
+	LastTrafficResetTime int64 `json:"lastTrafficResetTime,omitempty" form:"-" gorm:"default:0"` // Last traffic reset timestamp (ms), used by the Reset schedule
 	
 	// Speed statistics (calculated on backend, not stored in DB)
 	UpSpeed    int64 `json:"upSpeed,omitempty" form:"-" gorm:"-"`            // Upload speed in bits per second (calculated)
@@ -169,6 +250,34 @@ type ClientEntity struct {
 	
 	// Subscription customization
 	Announce string `json:"announce,omitempty" form:"announce" gorm:"column:announce"` // Custom announcement text for this client (overrides subscription header, max 200 chars, supports base64)
+	SubUpdates int `json:"subUpdates" form:"subUpdates" gorm:"column:sub_updates;default:0"` // Subscription update interval in hours (0 = use the group's, then the global subUpdates setting)
+
+	// Remaining quota (calculated on backend, not stored in DB, see ComputeRemaining)
+	RemainingBytes   int64 `json:"remainingBytes" form:"-" gorm:"-"`   // Remaining traffic in bytes (-1 = unlimited)
+	RemainingSeconds int64 `json:"remainingSeconds" form:"-" gorm:"-"` // Remaining time in seconds (-1 = never expires)
+}
+
+// RemainingUnlimited is the value of ClientEntity.RemainingBytes and RemainingSeconds
+// for a client without a traffic limit or expiry.
+const RemainingUnlimited = -1
+
+// ComputeRemaining sets RemainingBytes and RemainingSeconds from the traffic limit, the used
+// traffic and the expiry time at nowMs (unix milliseconds). Exhausted quotas are 0, never negative.
+// A client whose countdown starts on first use (negative ExpiryTime) has its full duration left.
+func (c *ClientEntity) ComputeRemaining(nowMs int64) {
+	c.RemainingBytes = RemainingUnlimited
+	if c.TotalGB > 0 {
+		c.RemainingBytes = max(int64(c.TotalGB*1024*1024*1024)-c.Up-c.Down, 0)
+	}
+
+	switch {
+	case c.ExpiryTime == 0:
+		c.RemainingSeconds = RemainingUnlimited
+	case c.ExpiryTime < 0:
+		c.RemainingSeconds = -c.ExpiryTime / 1000
+	default:
+		c.RemainingSeconds = max(c.ExpiryTime-nowMs, 0) / 1000
+	}
 }
 
 // Node represents a worker node in multi-node architecture.
@@ -183,6 +292,7 @@ type Node struct {
 	UseTLS       bool   `json:"useTls" form:"useTls" gorm:"column:use_tls;default:false"` // Whether to use TLS/HTTPS for API calls
 	CertPath    string `json:"certPath" form:"certPath" gorm:"column:cert_path"`       // Path to certificate file (optional, for custom CA)
 	KeyPath     string `json:"keyPath" form:"keyPath" gorm:"column:key_path"`          // Path to private key file (optional, for custom CA)
+	CaPath      string `json:"caPath" form:"caPath" gorm:"column:ca_path"`             // Path to CA certificate the node certificate is verified against (optional, lets CertPath/KeyPath be a client certificate for mTLS)
 	InsecureTLS bool   `json:"insecureTls" form:"insecureTls" gorm:"column:insecure_tls;default:false"` // Skip certificate verification (not recommended)
 	CreatedAt    int64  `json:"createdAt" gorm:"autoCreateTime"`  // Creation timestamp
 	UpdatedAt   int64  `json:"updatedAt" gorm:"autoUpdateTime"`   // Last update timestamp
@@ -201,6 +311,65 @@ type InboundNodeMapping struct {
 	NodeId    int `json:"nodeId" form:"nodeId" gorm:"uniqueIndex:idx_inbound_node"`        // Node ID
 }
 
+// NodeConfigHistory records a single config push to a node in multi-node mode.
+type NodeConfigHistory struct {
+	Id         int    `json:"id" gorm:"primaryKey;autoIncrement"` // Unique identifier
+	NodeId     int    `json:"nodeId" gorm:"index"`                // Node ID
+	ConfigHash string `json:"configHash"`                         // SHA-256 hash of the pushed config JSON
+	AppliedAt  int64  `json:"appliedAt"`                          // Push timestamp (unix milliseconds)
+	Success    bool   `json:"success"`                            // Whether the node accepted the config
+	Error      string `json:"error"`                              // Error message if the push failed
+}
+
+// NodeTrafficSample is the traffic of a node within one time slot, used for bandwidth charts.
+// Slots are a minute long and compacted to an hour once they get old.
+type NodeTrafficSample struct {
+	Id     int   `json:"id" gorm:"primaryKey;autoIncrement"`                         // Unique identifier
+	NodeId int   `json:"nodeId" gorm:"uniqueIndex:idx_node_traffic_samples_node_ts"` // Node ID
+	Up     int64 `json:"up"`                                                         // Upload traffic in the slot (bytes)
+	Down   int64 `json:"down"`                                                       // Download traffic in the slot (bytes)
+	Ts     int64 `json:"ts" gorm:"uniqueIndex:idx_node_traffic_samples_node_ts"`     // Slot start (unix milliseconds)
+}
+
+// TrafficSample is the traffic of an inbound or a client within one time slot, used for bandwidth charts.
+// Slots are a minute long and compacted to an hour once they get old.
+type TrafficSample struct {
+	Id    int    `json:"id" gorm:"primaryKey;autoIncrement"`                           // Unique identifier
+	Scope string `json:"scope" gorm:"uniqueIndex:idx_traffic_samples_scope_key_ts"`    // "inbound" or "client"
+	Key   string `json:"key" gorm:"uniqueIndex:idx_traffic_samples_scope_key_ts"`      // Inbound tag or lowercased client email
+	Up    int64  `json:"up"`                                                           // Upload traffic in the slot (bytes)
+	Down  int64  `json:"down"`                                                         // Download traffic in the slot (bytes)
+	Ts    int64  `json:"ts" gorm:"uniqueIndex:idx_traffic_samples_scope_key_ts;index"` // Slot start (unix milliseconds)
+}
+
+// ApiToken is a bearer token for scripted access to the panel API.
+// Only the SHA-256 hash of the token is stored.
+type ApiToken struct {
+	Id         int    `json:"id" gorm:"primaryKey;autoIncrement"` // Unique identifier
+	UserId     int    `json:"userId" gorm:"index"`                // Owner user ID
+	Name       string `json:"name"`                               // Human readable token name
+	TokenHash  string `json:"-" gorm:"uniqueIndex"`               // SHA-256 hash of the token (hex)
+	Scope      string `json:"scope"`                              // Token scope: "read" (the read routes of read-only users) or "full"
+	Revoked    bool   `json:"revoked"`                            // Whether the token has been revoked
+	CreatedAt  int64  `json:"createdAt"`                          // Creation timestamp (unix milliseconds)
+	LastUsedAt int64  `json:"lastUsedAt"`                         // Last successful use (unix milliseconds)
+}
+
+// AuditLog records a mutating request to the panel: who made it, on what and whether it succeeded.
+// Client and setting changes also record a summary of the fields before and after the change.
+type AuditLog struct {
+	Id        int    `json:"id" gorm:"primaryKey;autoIncrement"` // Unique identifier
+	UserId    int    `json:"userId" gorm:"index"`                // User that made the request
+	Username  string `json:"username"`                           // Username at the time of the request
+	Action    string `json:"action" gorm:"index"`                // Route relative to the base path, e.g. "panel/client/del/:id"
+	TargetId  string `json:"targetId"`                           // Path parameters of the request, e.g. "id=12"
+	Ip        string `json:"ip"`                                 // Remote IP of the request
+	Success   bool   `json:"success"`                            // Whether the request succeeded
+	Before    string `json:"before"`                             // JSON of the changed fields before the change, redacted
+	After     string `json:"after"`                              // JSON of the changed fields after the change, redacted
+	CreatedAt int64  `json:"createdAt" gorm:"index"`             // Request timestamp (unix milliseconds)
+}
+
 // Outbound represents an Xray outbound configuration.
 // Outbounds can be assigned to specific nodes in multi-node mode.
 type Outbound struct {
@@ -263,6 +432,14 @@ type ClientInboundMapping struct {
 	InboundId int `json:"inboundId" form:"inboundId" gorm:"uniqueIndex:idx_client_inbound"` // Inbound ID
 }
 
+// ClientNodeMapping restricts a client to specific nodes in multi-node mode.
+// A client without mappings is served by every node its inbounds are assigned to.
+type ClientNodeMapping struct {
+	Id       int `json:"id" gorm:"primaryKey;autoIncrement"`                                // Unique identifier
+	ClientId int `json:"clientId" form:"clientId" gorm:"uniqueIndex:idx_client_node"` // Client ID
+	NodeId   int `json:"nodeId" form:"nodeId" gorm:"uniqueIndex:idx_client_node"`     // Node ID
+}
+
 // Host represents a proxy/balancer host configuration for multi-node mode.
 // Hosts can override the node address when generating subscription links.
 type Host struct {
@@ -327,6 +504,7 @@ type ClientGroup struct {
 	UserId      int    `json:"userId" gorm:"index"`                // Associated user ID
 	Name        string `json:"name" form:"name"`                    // Group name
 	Description string `json:"description" form:"description"`     // Group description
+	SubUpdates  int    `json:"subUpdates" form:"subUpdates" gorm:"column:sub_updates;default:0"` // Subscription update interval in hours for the group's clients (0 = global subUpdates setting)
 	CreatedAt   int64  `json:"createdAt" gorm:"autoCreateTime"`    // Creation timestamp
 	UpdatedAt   int64  `json:"updatedAt" gorm:"autoUpdateTime"`    // Last update timestamp
 	
@@ -0,0 +1,122 @@
+package model
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestListenAddresses(t *testing.T) {
+	tests := []struct {
+		listen string
+		want   []string
+	}{
+		{"", []string{}},
+		{"192.0.2.10", []string{"192.0.2.10"}},
+		{"192.0.2.10, 2001:db8::10", []string{"192.0.2.10", "2001:db8::10"}},
+		{" 192.0.2.10 ,, ", []string{"192.0.2.10"}},
+	}
+	for _, test := range tests {
+		inbound := &Inbound{Listen: test.listen}
+		if got := inbound.ListenAddresses(); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("ListenAddresses(%q) = %q, want %q", test.listen, got, test.want)
+		}
+		if got, want := inbound.HasMultipleListen(), len(test.want) > 1; got != want {
+			t.Errorf("HasMultipleListen(%q) = %v, want %v", test.listen, got, want)
+		}
+	}
+}
+
+func TestGenXrayInboundConfigsSingleAddress(t *testing.T) {
+	for _, listen := range []string{"", "192.0.2.10"} {
+		inbound := &Inbound{Listen: listen, Port: 443, Protocol: VLESS, Tag: "inbound-443"}
+		configs := inbound.GenXrayInboundConfigs()
+		if len(configs) != 1 {
+			t.Fatalf("listen %q expanded to %d inbounds, want 1", listen, len(configs))
+		}
+		if !reflect.DeepEqual(configs[0], inbound.GenXrayInboundConfig()) {
+			t.Errorf("listen %q: GenXrayInboundConfigs() = %+v, want the GenXrayInboundConfig() inbound", listen, configs[0])
+		}
+		if configs[0].Tag != "inbound-443" {
+			t.Errorf("listen %q: tag = %q, want inbound-443", listen, configs[0].Tag)
+		}
+	}
+}
+
+func TestGenXrayInboundConfigsMultipleAddresses(t *testing.T) {
+	inbound := &Inbound{
+		Listen:   "192.0.2.10, 192.0.2.11,2001:db8::10",
+		Port:     443,
+		Protocol: VLESS,
+		Settings: `{"clients":[]}`,
+		Tag:      "inbound-443",
+	}
+	configs := inbound.GenXrayInboundConfigs()
+
+	want := []struct{ listen, tag string }{
+		{`"192.0.2.10"`, "inbound-443"},
+		{`"192.0.2.11"`, "inbound-443-listen2"},
+		{`"2001:db8::10"`, "inbound-443-listen3"},
+	}
+	if len(configs) != len(want) {
+		t.Fatalf("expanded to %d inbounds, want %d", len(configs), len(want))
+	}
+	for i, config := range configs {
+		if string(config.Listen) != want[i].listen || config.Tag != want[i].tag {
+			t.Errorf("inbound %d = listen %s tag %q, want listen %s tag %q", i, config.Listen, config.Tag, want[i].listen, want[i].tag)
+		}
+		if config.Port != 443 || config.Protocol != "vless" || string(config.Settings) != `{"clients":[]}` {
+			t.Errorf("inbound %d = %+v, want the port, protocol and settings of the panel inbound", i, config)
+		}
+	}
+}
+
+func TestComputeRemaining(t *testing.T) {
+	now := time.Date(2026, time.January, 1, 0, 0, 0, 0, time.UTC).UnixMilli()
+	tests := []struct {
+		name        string
+		client      ClientEntity
+		wantBytes   int64
+		wantSeconds int64
+	}{
+		{"limited and expiring", ClientEntity{TotalGB: 10, Up: 1 << 30, Down: 2 << 30, ExpiryTime: now + 3*86400*1000}, 7 << 30, 3 * 86400},
+		{"unlimited and never expiring", ClientEntity{Up: 1 << 30, Down: 2 << 30}, RemainingUnlimited, RemainingUnlimited},
+		{"fractional limit", ClientEntity{TotalGB: 0.5, Up: 1 << 20}, 512<<20 - 1<<20, RemainingUnlimited},
+		// Exhausted quotas are 0, never negative
+		{"over quota and expired", ClientEntity{TotalGB: 1, Up: 1 << 30, Down: 1, ExpiryTime: now - 1000}, 0, 0},
+		// The countdown starts on first use
+		{"expiry after first use", ClientEntity{ExpiryTime: -7 * 86400 * 1000}, RemainingUnlimited, 7 * 86400},
+	}
+	for _, test := range tests {
+		client := test.client
+		client.ComputeRemaining(now)
+		if client.RemainingBytes != test.wantBytes || client.RemainingSeconds != test.wantSeconds {
+			t.Errorf("%s: remaining = %d bytes, %d seconds, want %d bytes, %d seconds", test.name, client.RemainingBytes, client.RemainingSeconds, test.wantBytes, test.wantSeconds)
+		}
+	}
+}
+
+func TestComputeRemainingJSON(t *testing.T) {
+	now := time.Date(2026, time.January, 1, 0, 0, 0, 0, time.UTC).UnixMilli()
+	limited := &ClientEntity{Email: "limited", TotalGB: 1, Up: 1 << 29, ExpiryTime: now + 60*1000}
+	unlimited := &ClientEntity{Email: "unlimited"}
+	for _, client := range []*ClientEntity{limited, unlimited} {
+		client.ComputeRemaining(now)
+	}
+
+	data, err := json.Marshal([]*ClientEntity{limited, unlimited})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var clients []map[string]any
+	if err := json.Unmarshal(data, &clients); err != nil {
+		t.Fatal(err)
+	}
+	want := []struct{ bytes, seconds float64 }{{1 << 29, 60}, {-1, -1}}
+	for i, client := range clients {
+		if client["remainingBytes"] != want[i].bytes || client["remainingSeconds"] != want[i].seconds {
+			t.Errorf("%s: remainingBytes = %v, remainingSeconds = %v, want %v, %v", client["email"], client["remainingBytes"], client["remainingSeconds"], want[i].bytes, want[i].seconds)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package database
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"github.com/konstpic/sharx-code/v2/config"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// transientWriteErrorCodes are the PostgreSQL error codes of writes that can succeed when retried.
+var transientWriteErrorCodes = map[string]bool{
+	"40001": true, // serialization_failure
+	"40P01": true, // deadlock_detected
+	"55P03": true, // lock_not_available (lock_timeout reached, e.g. during a backup)
+	"25006": true, // read_only_sql_transaction (connected to a replica during a failover)
+	"57P03": true, // cannot_connect_now (the server is starting up)
+}
+
+// writeRetryBaseDelay is the delay before the first retry; it doubles with each further attempt.
+const writeRetryBaseDelay = 100 * time.Millisecond
+
+// IsTransientWriteError reports whether err is a database error that may go away when the write is retried.
+func IsTransientWriteError(err error) bool {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return transientWriteErrorCodes[pgErr.Code]
+	}
+	return false
+}
+
+// RetryWrite runs write and retries it with exponential backoff while it fails with a transient
+// database error, up to XUI_DB_WRITE_RETRIES times and XUI_DB_WRITE_RETRY_TIMEOUT in total.
+// write must be safe to run again, so a retried transaction has to be started inside it.
+func RetryWrite(write func() error) error {
+	retries := config.GetDBWriteRetries()
+	deadline := time.Now().Add(config.GetDBWriteRetryTimeout())
+	delay := writeRetryBaseDelay
+
+	err := write()
+	for attempt := 1; attempt <= retries && err != nil && IsTransientWriteError(err); attempt++ {
+		if remaining := time.Until(deadline); remaining <= 0 {
+			break
+		} else if delay > remaining {
+			delay = remaining
+		}
+		log.Printf("Database write failed with a transient error, retrying (attempt %d/%d) in %v: %v", attempt, retries, delay, err)
+		time.Sleep(delay)
+		delay *= 2
+		err = write()
+	}
+	return err
+}
@@ -0,0 +1,90 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// lockTimeout is the error PostgreSQL returns when a write waits longer than lock_timeout.
+var lockTimeout = &pgconn.PgError{Code: "55P03", Message: "canceling statement due to lock timeout"}
+
+func TestIsTransientWriteError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{lockTimeout, true},
+		{fmt.Errorf("save setting: %w", &pgconn.PgError{Code: "40P01"}), true},
+		{&pgconn.PgError{Code: "25006"}, true},
+		// unique_violation fails again on every retry
+		{&pgconn.PgError{Code: "23505"}, false},
+		{errors.New("database is locked"), false},
+		{nil, false},
+	}
+	for _, test := range tests {
+		if got := IsTransientWriteError(test.err); got != test.want {
+			t.Errorf("IsTransientWriteError(%v) = %v, want %v", test.err, got, test.want)
+		}
+	}
+}
+
+func TestRetryWriteSucceedsAfterTransientError(t *testing.T) {
+	t.Setenv("XUI_DB_WRITE_RETRIES", "3")
+	attempts := 0
+	err := RetryWrite(func() error {
+		attempts++
+		if attempts <= 2 {
+			return lockTimeout
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("RetryWrite() = %v, want the write to succeed on the third attempt", err)
+	}
+	if attempts != 3 {
+		t.Fatalf("write ran %d times, want 3", attempts)
+	}
+}
+
+func TestRetryWriteGivesUp(t *testing.T) {
+	t.Setenv("XUI_DB_WRITE_RETRIES", "2")
+	attempts := 0
+	err := RetryWrite(func() error {
+		attempts++
+		return lockTimeout
+	})
+	if !errors.Is(err, lockTimeout) {
+		t.Fatalf("RetryWrite() = %v, want the last lock timeout", err)
+	}
+	if attempts != 3 {
+		t.Fatalf("write ran %d times, want the first attempt and 2 retries", attempts)
+	}
+}
+
+func TestRetryWriteDoesNotRetryOtherErrors(t *testing.T) {
+	t.Setenv("XUI_DB_WRITE_RETRIES", "3")
+	failure := &pgconn.PgError{Code: "23505", Message: "duplicate key value violates unique constraint"}
+	attempts := 0
+	err := RetryWrite(func() error {
+		attempts++
+		return failure
+	})
+	if !errors.Is(err, failure) || attempts != 1 {
+		t.Fatalf("RetryWrite() = %v after %d attempts, want the error after a single attempt", err, attempts)
+	}
+}
+
+func TestRetryWriteWithRetriesDisabled(t *testing.T) {
+	t.Setenv("XUI_DB_WRITE_RETRIES", "0")
+	attempts := 0
+	RetryWrite(func() error {
+		attempts++
+		return lockTimeout
+	})
+	if attempts != 1 {
+		t.Fatalf("write ran %d times with XUI_DB_WRITE_RETRIES=0, want 1", attempts)
+	}
+}
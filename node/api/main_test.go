@@ -0,0 +1,26 @@
+package api
+
+import (
+	"os"
+	"testing"
+
+	"github.com/konstpic/sharx-code/v2/logger"
+
+	"github.com/gin-gonic/gin"
+	"github.com/op/go-logging"
+)
+
+func TestMain(m *testing.M) {
+	// Handlers log through the package logger, which only exists after InitLogger
+	logFolder, err := os.MkdirTemp("", "sharx-node-api-test")
+	if err != nil {
+		panic(err)
+	}
+	os.Setenv("XUI_LOG_FOLDER", logFolder)
+	logger.InitLogger(logging.ERROR)
+	gin.SetMode(gin.TestMode)
+
+	code := m.Run()
+	os.RemoveAll(logFolder)
+	os.Exit(code)
+}
@@ -35,6 +35,7 @@ type Server struct {
 	httpServer *http.Server
 	certFile   string
 	keyFile    string
+	subCache   *SubCache
 }
 
 // NewServer creates a new API server instance.
@@ -79,6 +80,11 @@ func (s *Server) Start() error {
 	// Registration endpoint (no auth required, used for initial setup)
 	router.POST("/api/v1/register", s.register)
 
+	// Node-local subscription endpoint (no auth required, like the panel's subscription server)
+	if s.subCache != nil {
+		router.GET("/sub/:subid", s.getSubscription)
+	}
+
 	// API endpoints (require auth)
 	api := router.Group("/api/v1")
 	{
@@ -94,6 +100,7 @@ func (s *Server) Start() error {
 		api.POST("/remove-user", s.removeUser)
 		api.POST("/update-inbound", s.updateInbound)
 		api.POST("/remove-inbound", s.removeInbound)
+		api.POST("/rotate-api-key", s.rotateApiKey)
 	}
 
 	s.httpServer = &http.Server{
@@ -125,7 +132,8 @@ func (s *Server) Stop() error {
 func (s *Server) authMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// Skip auth for health and registration endpoints
-		if c.Request.URL.Path == "/health" || c.Request.URL.Path == "/api/v1/register" {
+		if c.Request.URL.Path == "/health" || c.Request.URL.Path == "/api/v1/register" ||
+			(s.subCache != nil && strings.HasPrefix(c.Request.URL.Path, "/sub/")) {
 			c.Next()
 			return
 		}
@@ -420,6 +428,41 @@ func (s *Server) register(c *gin.Context) {
 	logger.Infof("Log pusher initialization started (non-blocking)")
 }
 
+// rotateApiKey replaces the API key of a registered node. The request is authenticated with the
+// current key; the new key is saved to the config file and used right away, also by the log pusher.
+// Keys set with -api-key or NODE_API_KEY cannot be rotated, they would come back on restart.
+func (s *Server) rotateApiKey(c *gin.Context) {
+	var req struct {
+		ApiKey string `json:"apiKey" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+		return
+	}
+	if len(req.ApiKey) < 16 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "API key must be at least 16 characters"})
+		return
+	}
+	if nodeConfig.GetConfig().ApiKey != s.apiKey {
+		logger.Warningf("API key rotation rejected: the key is not from registration (set with -api-key or NODE_API_KEY)")
+		c.JSON(http.StatusConflict, gin.H{"error": "API key is set with -api-key or NODE_API_KEY and cannot be rotated"})
+		return
+	}
+
+	if err := nodeConfig.SetApiKey(req.ApiKey, true); err != nil {
+		logger.Errorf("Failed to save rotated API key: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save API key: " + err.Error()})
+		return
+	}
+	s.apiKey = req.ApiKey
+	go try(func() {
+		nodeLogs.UpdateApiKey(req.ApiKey)
+	})
+
+	logger.Infof("API key rotated (length: %d)", len(req.ApiKey))
+	c.JSON(http.StatusOK, gin.H{"message": "API key rotated successfully"})
+}
+
 // installXray installs or updates Xray to the specified version.
 func (s *Server) installXray(c *gin.Context) {
 	version := c.Param("version")
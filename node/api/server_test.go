@@ -0,0 +1,84 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	nodeConfig "github.com/konstpic/sharx-code/v2/node/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+// rotateEngine serves the authenticated rotate-api-key endpoint of s.
+func rotateEngine(s *Server) *gin.Engine {
+	engine := gin.New()
+	engine.Use(s.authMiddleware())
+	engine.POST("/api/v1/rotate-api-key", s.rotateApiKey)
+	return engine
+}
+
+func rotate(engine *gin.Engine, currentKey, newKey string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/rotate-api-key", strings.NewReader(`{"apiKey":"`+newKey+`"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+currentKey)
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, req)
+	return w
+}
+
+// useNodeConfig keeps the node config in a temporary directory, registered with apiKey.
+func useNodeConfig(t *testing.T, apiKey string) {
+	t.Helper()
+	if err := nodeConfig.InitConfig(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	if err := nodeConfig.SetApiKey(apiKey, true); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRotateApiKey(t *testing.T) {
+	useNodeConfig(t, "old-key-0123456789")
+	s := NewServer(0, "old-key-0123456789", nil)
+	engine := rotateEngine(s)
+
+	if w := rotate(engine, "old-key-0123456789", "new-key-0123456789"); w.Code != http.StatusOK {
+		t.Fatalf("rotation answered %d: %s", w.Code, w.Body.String())
+	}
+	// The new key is used right away and survives a restart
+	if w := rotate(engine, "old-key-0123456789", "other-key-0123456789"); w.Code != http.StatusUnauthorized {
+		t.Fatalf("request with the old key answered %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+	data, err := os.ReadFile(nodeConfig.GetConfigPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var saved nodeConfig.NodeConfig
+	if err := json.Unmarshal(data, &saved); err != nil || saved.ApiKey != "new-key-0123456789" {
+		t.Fatalf("saved config = %s, want the new key", data)
+	}
+	if w := rotate(engine, "new-key-0123456789", "old-key-0123456789"); w.Code != http.StatusOK {
+		t.Fatalf("rotation back with the new key answered %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestRotateApiKeyRejects(t *testing.T) {
+	useNodeConfig(t, "old-key-0123456789")
+	engine := rotateEngine(NewServer(0, "old-key-0123456789", nil))
+	if w := rotate(engine, "old-key-0123456789", "short"); w.Code != http.StatusBadRequest {
+		t.Fatalf("rotation to a short key answered %d, want %d", w.Code, http.StatusBadRequest)
+	}
+
+	// A key from -api-key or NODE_API_KEY would come back on restart
+	engine = rotateEngine(NewServer(0, "env-key-0123456789", nil))
+	if w := rotate(engine, "env-key-0123456789", "new-key-0123456789"); w.Code != http.StatusConflict {
+		t.Fatalf("rotation of a key from the environment answered %d, want %d", w.Code, http.StatusConflict)
+	}
+	if nodeConfig.GetConfig().ApiKey != "old-key-0123456789" {
+		t.Fatal("refused rotation changed the saved key")
+	}
+}
@@ -0,0 +1,208 @@
+package api
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/konstpic/sharx-code/v2/logger"
+	"github.com/gin-gonic/gin"
+	"golang.org/x/sync/singleflight"
+)
+
+// subStaleMaxAge is how long a cached subscription may still be served while the panel is unreachable.
+const subStaleMaxAge = 24 * time.Hour
+
+// maxSubCacheEntries bounds the number of cached subscriptions; the oldest entry is dropped beyond it.
+const maxSubCacheEntries = 10000
+
+// subDeviceHeaders are the request headers identifying the client device, passed on to the panel
+// so it can register the HWID and enforce the device limit of the client.
+var subDeviceHeaders = []string{
+	"X-HWID",
+	"X-Device-OS",
+	"X-Device-Model",
+	"X-Ver-OS",
+}
+
+// subForwardHeaders are the response headers of the panel's subscription server passed on to clients.
+var subForwardHeaders = []string{
+	"Content-Type",
+	"Content-Disposition",
+	"Subscription-Userinfo",
+	"Profile-Update-Interval",
+	"Profile-Title",
+	"Profile-Web-Page-Url",
+	"Support-Url",
+	"Announce",
+	"Routing",
+}
+
+// subCacheEntry is a subscription body fetched from the panel along with the headers to replay.
+type subCacheEntry struct {
+	status    int
+	header    http.Header
+	body      []byte
+	fetchedAt time.Time
+}
+
+// SubCache serves subscriptions on the node from a cache filled from the panel's subscription
+// server, so clients close to the node fetch them faster and keep getting them during a panel outage.
+type SubCache struct {
+	upstream string // subscription URL prefix on the panel, e.g. https://panel.example.com:2096/sub/
+	ttl      time.Duration
+	client   *http.Client
+
+	mu      sync.Mutex
+	entries map[string]*subCacheEntry
+	fetches singleflight.Group // collapses concurrent misses of the same key into one panel request
+}
+
+// NewSubCache creates a subscription cache in front of the panel's subscription URL prefix.
+func NewSubCache(upstream string, ttl time.Duration) *SubCache {
+	if !strings.HasSuffix(upstream, "/") {
+		upstream += "/"
+	}
+	return &SubCache{
+		upstream: upstream,
+		ttl:      ttl,
+		client:   &http.Client{Timeout: 10 * time.Second},
+		entries:  make(map[string]*subCacheEntry),
+	}
+}
+
+// SetSubCache enables the node-local subscription endpoint.
+func (s *Server) SetSubCache(cache *SubCache) {
+	s.subCache = cache
+}
+
+// getSubscription returns the subscription of a subId: from the cache while it is fresh, otherwise
+// from the panel, falling back to the stale cached copy when the panel cannot be reached.
+func (s *Server) getSubscription(c *gin.Context) {
+	subId := c.Param("subid")
+	if subId == "" {
+		c.String(http.StatusBadRequest, "missing subscription id")
+		return
+	}
+
+	// Panels serve a different format per client app, so the user agent is part of the key.
+	// The panel registers and limits devices by HWID, so each device is cached on its own.
+	key := subId + "\x00" + c.Request.URL.RawQuery + "\x00" + c.GetHeader("User-Agent") + "\x00" + c.GetHeader("X-HWID")
+	entry, fresh := s.subCache.get(key)
+	if !fresh {
+		fetched, err, _ := s.subCache.fetches.Do(key, func() (any, error) {
+			fetched, err := s.subCache.fetch(subId, c.Request)
+			if err != nil {
+				return nil, err
+			}
+			s.subCache.put(key, fetched)
+			return fetched, nil
+		})
+		if err == nil {
+			entry = fetched.(*subCacheEntry)
+		} else if entry != nil && time.Since(entry.fetchedAt) <= subStaleMaxAge {
+			logger.Warningf("Subscription %s: panel unreachable, serving cached copy from %s: %v",
+				subId, entry.fetchedAt.Format(time.RFC3339), err)
+		} else {
+			logger.Warningf("Subscription %s: failed to fetch from panel: %v", subId, err)
+			c.String(http.StatusBadGateway, "subscription is temporarily unavailable")
+			return
+		}
+	}
+
+	for name, values := range entry.header {
+		for _, value := range values {
+			c.Writer.Header().Add(name, value)
+		}
+	}
+	c.Data(entry.status, entry.header.Get("Content-Type"), entry.body)
+}
+
+// get returns the cached entry for key and whether it is still within the TTL.
+func (sc *SubCache) get(key string) (*subCacheEntry, bool) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	entry, ok := sc.entries[key]
+	if !ok {
+		return nil, false
+	}
+	return entry, time.Since(entry.fetchedAt) < sc.ttl
+}
+
+// put stores entry under key and drops entries too old to be served even as a fallback.
+// When the cache is full, the oldest entry makes room.
+func (sc *SubCache) put(key string, entry *subCacheEntry) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	oldestKey := ""
+	var oldest time.Time
+	for k, e := range sc.entries {
+		if time.Since(e.fetchedAt) > subStaleMaxAge {
+			delete(sc.entries, k)
+			continue
+		}
+		if oldestKey == "" || e.fetchedAt.Before(oldest) {
+			oldestKey, oldest = k, e.fetchedAt
+		}
+	}
+	if _, ok := sc.entries[key]; !ok && len(sc.entries) >= maxSubCacheEntries {
+		delete(sc.entries, oldestKey)
+	}
+	sc.entries[key] = entry
+}
+
+// fetch downloads the subscription of subId from the panel, forwarding the client's user agent,
+// device headers and query.
+// Only successful responses are returned, so a panel error never replaces a good cached copy.
+func (sc *SubCache) fetch(subId string, in *http.Request) (*subCacheEntry, error) {
+	target := sc.upstream + url.PathEscape(subId)
+	if in.URL.RawQuery != "" {
+		target += "?" + in.URL.RawQuery
+	}
+	req, err := http.NewRequest(http.MethodGet, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	if ua := in.UserAgent(); ua != "" {
+		req.Header.Set("User-Agent", ua)
+	}
+	if accept := in.Header.Get("Accept"); accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	for _, name := range subDeviceHeaders {
+		if value := in.Header.Get(name); value != "" {
+			req.Header.Set(name, value)
+		}
+	}
+
+	resp, err := sc.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("panel returned status %d", resp.StatusCode)
+	}
+
+	header := make(http.Header)
+	for _, name := range subForwardHeaders {
+		if values := resp.Header.Values(name); len(values) > 0 {
+			header[http.CanonicalHeaderKey(name)] = values
+		}
+	}
+	return &subCacheEntry{
+		status:    resp.StatusCode,
+		header:    header,
+		body:      body,
+		fetchedAt: time.Now(),
+	}, nil
+}
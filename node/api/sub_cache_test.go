@@ -0,0 +1,121 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// stubSubPanel is a panel subscription server counting its requests; it fails while down is set.
+type stubSubPanel struct {
+	requests atomic.Int32
+	down     atomic.Bool
+	hwid     atomic.Value // X-HWID of the last request
+}
+
+func (p *stubSubPanel) start(t *testing.T) string {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p.requests.Add(1)
+		p.hwid.Store(r.Header.Get("X-HWID"))
+		if p.down.Load() {
+			http.Error(w, "maintenance", http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Header().Set("Subscription-Userinfo", "upload=1; download=2; total=3")
+		w.Header().Set("X-Panel-Internal", "1")
+		w.Write([]byte("sub of " + r.URL.Path + "?" + r.URL.RawQuery))
+	}))
+	t.Cleanup(server.Close)
+	return server.URL + "/sub"
+}
+
+// serveSub requests a subscription from a node serving cache.
+func serveSub(cache *SubCache, path string, hwid string) *httptest.ResponseRecorder {
+	router := gin.New()
+	router.GET("/sub/:subid", (&Server{subCache: cache}).getSubscription)
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	req.Header.Set("User-Agent", "v2rayNG/1.8")
+	if hwid != "" {
+		req.Header.Set("X-HWID", hwid)
+	}
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestSubCacheHit(t *testing.T) {
+	panel := &stubSubPanel{}
+	cache := NewSubCache(panel.start(t), time.Minute)
+
+	for range 2 {
+		rec := serveSub(cache, "/sub/abc?format=json", "device-1")
+		if rec.Code != http.StatusOK || rec.Body.String() != "sub of /sub/abc?format=json" {
+			t.Fatalf("response = %d %q", rec.Code, rec.Body.String())
+		}
+		if rec.Header().Get("Subscription-Userinfo") != "upload=1; download=2; total=3" || rec.Header().Get("X-Panel-Internal") != "" {
+			t.Fatalf("headers = %v, want only the subscription headers of the panel", rec.Header())
+		}
+	}
+	if n := panel.requests.Load(); n != 1 {
+		t.Fatalf("panel fetched %d times, want the second request served from the cache", n)
+	}
+	if hwid := panel.hwid.Load(); hwid != "device-1" {
+		t.Fatalf("panel got X-HWID %q, want the device header forwarded", hwid)
+	}
+
+	// Another device is registered with the panel on its own
+	serveSub(cache, "/sub/abc?format=json", "device-2")
+	if n := panel.requests.Load(); n != 2 {
+		t.Fatalf("panel fetched %d times, want one fetch per device", n)
+	}
+}
+
+func TestSubCacheStaleMiss(t *testing.T) {
+	panel := &stubSubPanel{}
+	cache := NewSubCache(panel.start(t), time.Millisecond)
+
+	if rec := serveSub(cache, "/sub/abc", ""); rec.Code != http.StatusOK {
+		t.Fatalf("first fetch = %d", rec.Code)
+	}
+	time.Sleep(5 * time.Millisecond)
+
+	// Past the TTL the panel is asked again and the new copy served
+	if rec := serveSub(cache, "/sub/abc", ""); rec.Code != http.StatusOK || panel.requests.Load() != 2 {
+		t.Fatalf("stale entry not refreshed: %d after %d panel requests", rec.Code, panel.requests.Load())
+	}
+	time.Sleep(5 * time.Millisecond)
+
+	// While the panel fails, the stale copy is served
+	panel.down.Store(true)
+	rec := serveSub(cache, "/sub/abc", "")
+	if rec.Code != http.StatusOK || rec.Body.String() != "sub of /sub/abc?" || panel.requests.Load() != 3 {
+		t.Fatalf("response with the panel down = %d %q, want the cached copy", rec.Code, rec.Body.String())
+	}
+}
+
+func TestSubCacheMissWithoutFallback(t *testing.T) {
+	panel := &stubSubPanel{}
+	cache := NewSubCache(panel.start(t), time.Minute)
+	panel.down.Store(true)
+
+	if rec := serveSub(cache, "/sub/abc", ""); rec.Code != http.StatusBadGateway {
+		t.Fatalf("uncached subscription with the panel down = %d, want %d", rec.Code, http.StatusBadGateway)
+	}
+
+	// A copy older than subStaleMaxAge is not served either
+	panel.down.Store(false)
+	serveSub(cache, "/sub/abc", "")
+	for _, entry := range cache.entries {
+		entry.fetchedAt = time.Now().Add(-subStaleMaxAge - time.Minute)
+	}
+	panel.down.Store(true)
+	if rec := serveSub(cache, "/sub/abc", ""); rec.Code != http.StatusBadGateway {
+		t.Fatalf("expired copy with the panel down = %d, want %d", rec.Code, http.StatusBadGateway)
+	}
+}
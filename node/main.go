@@ -8,7 +8,9 @@ import (
 	"log"
 	"os"
 	"os/signal"
+	"strconv"
 	"syscall"
+	"time"
 
 	"github.com/konstpic/sharx-code/v2/logger"
 	"github.com/konstpic/sharx-code/v2/node/api"
@@ -106,6 +108,20 @@ func main() {
 		log.Printf("HTTPS enabled: cert=%s, key=%s", certFile, keyFile)
 	}
 
+	// Serve subscriptions from the node when the panel's subscription URL is configured
+	if subUpstream := os.Getenv("SUB_UPSTREAM_URL"); subUpstream != "" {
+		ttl := 5 * time.Minute
+		if ttlStr := os.Getenv("SUB_CACHE_TTL"); ttlStr != "" {
+			if seconds, err := strconv.Atoi(ttlStr); err == nil && seconds > 0 {
+				ttl = time.Duration(seconds) * time.Second
+			} else {
+				log.Printf("WARNING: invalid SUB_CACHE_TTL %q, using %s", ttlStr, ttl)
+			}
+		}
+		server.SetSubCache(api.NewSubCache(subUpstream, ttl))
+		log.Printf("Subscription cache enabled: upstream=%s, ttl=%s", subUpstream, ttl)
+	}
+
 	log.Printf("Starting SharX Node Service on port %d", port)
 	if err := server.Start(); err != nil {
 		log.Fatalf("Failed to start server: %v", err)
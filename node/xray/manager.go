@@ -94,17 +94,31 @@ func (m *Manager) downloadGeoFiles() {
 			return fmt.Errorf("bad status: %d", resp.StatusCode)
 		}
 
-		file, err := os.Create(destPath)
+		// Download into a temporary file first so a bad body never replaces the target
+		tmpPath := destPath + ".tmp"
+		file, err := os.Create(tmpPath)
 		if err != nil {
 			return fmt.Errorf("failed to create file: %w", err)
 		}
-		defer file.Close()
 
 		_, err = io.Copy(file, resp.Body)
+		file.Close()
 		if err != nil {
+			os.Remove(tmpPath)
 			return fmt.Errorf("failed to write file: %w", err)
 		}
 
+		// Reject captive-portal pages, truncated downloads and other garbage
+		if err := xray.ValidateGeoFile(tmpPath); err != nil {
+			os.Remove(tmpPath)
+			return fmt.Errorf("downloaded file is corrupt: %w", err)
+		}
+
+		if err := os.Rename(tmpPath, destPath); err != nil {
+			os.Remove(tmpPath)
+			return fmt.Errorf("failed to move file into place: %w", err)
+		}
+
 		return nil
 	}
 
@@ -266,8 +266,12 @@ func (a *SUBController) subs(c *gin.Context) {
 		if err == nil && clientEntity != nil && clientEntity.Announce != "" {
 			clientAnnounce = clientEntity.Announce
 		}
+		updateInterval := a.updateInterval
+		if err == nil && clientEntity != nil {
+			updateInterval = a.clientUpdateInterval(clientEntity)
+		}
 		
-		a.ApplyCommonHeaders(c, header, a.updateInterval, a.subTitle, subId, clientAnnounce)
+		a.ApplyCommonHeaders(c, header, updateInterval, a.subTitle, subId, clientAnnounce)
 
 		if a.subEncrypt {
 			c.String(200, base64.StdEncoding.EncodeToString([]byte(result)))
@@ -308,14 +312,42 @@ func (a *SUBController) subJsons(c *gin.Context) {
 		if err == nil && clientEntity != nil && clientEntity.Announce != "" {
 			clientAnnounce = clientEntity.Announce
 		}
+		updateInterval := a.updateInterval
+		if err == nil && clientEntity != nil {
+			updateInterval = a.clientUpdateInterval(clientEntity)
+		}
 
 		// Add headers
-		a.ApplyCommonHeaders(c, header, a.updateInterval, a.subTitle, subId, clientAnnounce)
+		a.ApplyCommonHeaders(c, header, updateInterval, a.subTitle, subId, clientAnnounce)
 
 		c.String(200, jsonSub)
 	}
 }
 
+// clientUpdateInterval returns the Profile-Update-Interval (in hours) for a client: its own subUpdates
+// override, otherwise the override of its group, otherwise the global subUpdates setting.
+func (a *SUBController) clientUpdateInterval(client *model.ClientEntity) string {
+	groupSubUpdates := 0
+	if client.SubUpdates <= 0 && client.GroupId != nil && *client.GroupId > 0 {
+		var group model.ClientGroup
+		if err := database.GetDB().Select("sub_updates").Where("id = ?", *client.GroupId).First(&group).Error; err == nil {
+			groupSubUpdates = group.SubUpdates
+		}
+	}
+	return subUpdateInterval(client.SubUpdates, groupSubUpdates, a.updateInterval)
+}
+
+// subUpdateInterval picks the first set subUpdates value (in hours): the client's, the group's, then the global one.
+func subUpdateInterval(clientSubUpdates int, groupSubUpdates int, global string) string {
+	if clientSubUpdates > 0 {
+		return fmt.Sprintf("%d", clientSubUpdates)
+	}
+	if groupSubUpdates > 0 {
+		return fmt.Sprintf("%d", groupSubUpdates)
+	}
+	return global
+}
+
 // ApplyCommonHeaders sets common HTTP headers for subscription responses including user info, update interval, and profile title.
 // Also adds X-Subscription-ID header so clients can use it as HWID if needed.
 // Custom headers from settings are applied if available.
@@ -372,7 +404,8 @@ func (a *SUBController) applyCustomHeaders(c *gin.Context, headers *entity.Subsc
 		c.Writer.Header().Set("Subscription-Userinfo", headers.SubscriptionUserinfo)
 	}
 	
-	if headers.ProfileUpdateInterval != "" {
+	// A per-client or per-group interval takes precedence over the custom header
+	if headers.ProfileUpdateInterval != "" && defaultUpdateInterval == a.updateInterval {
 		c.Writer.Header().Set("Profile-Update-Interval", headers.ProfileUpdateInterval)
 	}
 	
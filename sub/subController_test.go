@@ -0,0 +1,52 @@
+package sub
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/konstpic/sharx-code/v2/web/entity"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestSubUpdateInterval(t *testing.T) {
+	tests := []struct {
+		name   string
+		client int
+		group  int
+		want   string
+	}{
+		{"client override", 6, 24, "6"},
+		{"group override", 0, 24, "24"},
+		{"global", 0, 0, "12"},
+	}
+	for _, test := range tests {
+		if got := subUpdateInterval(test.client, test.group, "12"); got != test.want {
+			t.Errorf("%s: subUpdateInterval(%d, %d) = %q, want %q", test.name, test.client, test.group, got, test.want)
+		}
+	}
+}
+
+func TestApplyCustomHeadersUpdateInterval(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	a := &SUBController{updateInterval: "12"}
+	headers := &entity.SubscriptionHeaders{ProfileUpdateInterval: "48"}
+
+	// A client using the global interval gets the custom header's value
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Writer.Header().Set("Profile-Update-Interval", "12")
+	a.applyCustomHeaders(c, headers, "", "12", "", "")
+	if got := recorder.Header().Get("Profile-Update-Interval"); got != "48" {
+		t.Fatalf("Profile-Update-Interval = %q, want the custom header's 48", got)
+	}
+
+	// A client with its own interval keeps it
+	recorder = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(recorder)
+	c.Writer.Header().Set("Profile-Update-Interval", "6")
+	a.applyCustomHeaders(c, headers, "", "6", "", "")
+	if got := recorder.Header().Get("Profile-Update-Interval"); got != "6" {
+		t.Fatalf("Profile-Update-Interval = %q, want the client's 6", got)
+	}
+}
@@ -20,6 +20,49 @@ func NewError(a ...any) error {
 	return errors.New(msg)
 }
 
+// ErrorCode is a machine-readable kind of error, returned to API clients alongside the message.
+type ErrorCode string
+
+// Error codes of API responses.
+const (
+	ErrCodeUnknown             ErrorCode = "UNKNOWN"               // Error without a specific code
+	ErrCodeNotFound            ErrorCode = "NOT_FOUND"             // Record does not exist or belongs to another user
+	ErrCodeInvalidPort         ErrorCode = "INVALID_PORT"          // Port out of range
+	ErrCodeInboundPortConflict ErrorCode = "INBOUND_PORT_CONFLICT" // Port already used by another inbound
+	ErrCodeInboundTagExists    ErrorCode = "INBOUND_TAG_EXISTS"    // Inbound tag already used by another inbound
+	ErrCodeOutboundTagExists   ErrorCode = "OUTBOUND_TAG_EXISTS"   // Outbound tag already used by another outbound
+	ErrCodeClientEmailExists   ErrorCode = "CLIENT_EMAIL_EXISTS"   // Client email already used by another client
+)
+
+// codedError is an error with an ErrorCode.
+type codedError struct {
+	code ErrorCode
+	err  error
+}
+
+func (e *codedError) Error() string { return e.err.Error() }
+
+func (e *codedError) Unwrap() error { return e.err }
+
+// NewCodedError creates a new error with an ErrorCode from the given arguments, like NewError.
+func NewCodedError(code ErrorCode, a ...any) error {
+	return &codedError{code: code, err: NewError(a...)}
+}
+
+// NewCodedErrorf creates a new error with an ErrorCode and formatted message, like NewErrorf.
+func NewCodedErrorf(code ErrorCode, format string, a ...any) error {
+	return &codedError{code: code, err: NewErrorf(format, a...)}
+}
+
+// ErrorCodeOf returns the ErrorCode of err or of an error it wraps, ErrCodeUnknown if there is none.
+func ErrorCodeOf(err error) ErrorCode {
+	var coded *codedError
+	if errors.As(err, &coded) {
+		return coded.code
+	}
+	return ErrCodeUnknown
+}
+
 // Recover handles panic recovery and logs the panic error if a message is provided.
 func Recover(msg string) any {
 	panicErr := recover()
@@ -0,0 +1,45 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestErrorCodeOf(t *testing.T) {
+	coded := NewCodedErrorf(ErrCodeInboundTagExists, "tag %s already exists", "inbound-443")
+	if coded.Error() != "tag inbound-443 already exists" {
+		t.Fatalf("message = %q, want the formatted message", coded.Error())
+	}
+
+	tests := []struct {
+		name string
+		err  error
+		want ErrorCode
+	}{
+		{"coded", coded, ErrCodeInboundTagExists},
+		{"coded from arguments", NewCodedError(ErrCodeInvalidPort, "invalid port", 70000), ErrCodeInvalidPort},
+		// Codes survive wrapping on the way up to the controller
+		{"wrapped", fmt.Errorf("add inbound: %w", coded), ErrCodeInboundTagExists},
+		{"wrapped twice", fmt.Errorf("import: %w", fmt.Errorf("add inbound: %w", coded)), ErrCodeInboundTagExists},
+		{"joined", errors.Join(errors.New("rollback failed"), coded), ErrCodeInboundTagExists},
+		{"plain", NewError("something failed"), ErrCodeUnknown},
+		{"nil", nil, ErrCodeUnknown},
+	}
+	for _, test := range tests {
+		if got := ErrorCodeOf(test.err); got != test.want {
+			t.Errorf("%s: ErrorCodeOf() = %s, want %s", test.name, got, test.want)
+		}
+	}
+}
+
+func TestCodedErrorUnwrap(t *testing.T) {
+	coded := NewCodedError(ErrCodeNotFound, "client not found")
+	var target *codedError
+	if !errors.As(fmt.Errorf("get client: %w", coded), &target) || target != coded {
+		t.Fatal("coded error not found through a wrapping error")
+	}
+	if errors.Unwrap(coded) == nil {
+		t.Fatal("coded error does not unwrap to its message error")
+	}
+}
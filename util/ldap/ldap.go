@@ -21,8 +21,9 @@ type Config struct {
 	Invert     bool
 }
 
-// FetchVlessFlags returns map[email]enabled
-func FetchVlessFlags(cfg Config) (map[string]bool, error) {
+// connect dials the configured LDAP server (ldaps:// when UseTLS is set)
+// and binds with BindDN/Password when a bind DN is configured.
+func connect(cfg Config) (*ldap.Conn, error) {
 	addr := fmt.Sprintf("%s:%d", cfg.Host, cfg.Port)
 
 	scheme := "ldap"
@@ -43,13 +44,50 @@ func FetchVlessFlags(cfg Config) (map[string]bool, error) {
 	if err != nil {
 		return nil, err
 	}
-	defer conn.Close()
 
 	if cfg.BindDN != "" {
 		if err := conn.Bind(cfg.BindDN, cfg.Password); err != nil {
+			conn.Close()
 			return nil, err
 		}
 	}
+	return conn, nil
+}
+
+// TestConnection dials and binds with cfg, then runs cfg.UserFilter under cfg.BaseDN.
+// It returns the number of matched entries.
+func TestConnection(cfg Config) (int, error) {
+	conn, err := connect(cfg)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+
+	if cfg.UserFilter == "" {
+		cfg.UserFilter = "(objectClass=person)"
+	}
+
+	req := ldap.NewSearchRequest(
+		cfg.BaseDN,
+		ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, 0, false,
+		cfg.UserFilter,
+		[]string{"dn"},
+		nil,
+	)
+	res, err := conn.Search(req)
+	if err != nil {
+		return 0, err
+	}
+	return len(res.Entries), nil
+}
+
+// FetchVlessFlags returns map[email]enabled
+func FetchVlessFlags(cfg Config) (map[string]bool, error) {
+	conn, err := connect(cfg)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
 
 	if cfg.UserFilter == "" {
 		cfg.UserFilter = "(objectClass=person)"
@@ -99,35 +137,13 @@ func FetchVlessFlags(cfg Config) (map[string]bool, error) {
 
 // AuthenticateUser searches user by cfg.UserAttr and attempts to bind with provided password.
 func AuthenticateUser(cfg Config, username, password string) (bool, error) {
-	addr := fmt.Sprintf("%s:%d", cfg.Host, cfg.Port)
-
-	scheme := "ldap"
-	if cfg.UseTLS {
-		scheme = "ldaps"
-	}
-
-	ldapURL := fmt.Sprintf("%s://%s", scheme, addr)
-
-	var opts []ldap.DialOpt
-	if cfg.UseTLS {
-		opts = append(opts, ldap.DialWithTLSConfig(&tls.Config{
-			InsecureSkipVerify: false,
-		}))
-	}
-
-	conn, err := ldap.DialURL(ldapURL, opts...)
+	// Optional initial bind for search is done by connect
+	conn, err := connect(cfg)
 	if err != nil {
 		return false, err
 	}
 	defer conn.Close()
 
-	// Optional initial bind for search
-	if cfg.BindDN != "" {
-		if err := conn.Bind(cfg.BindDN, cfg.Password); err != nil {
-			return false, err
-		}
-	}
-
 	if cfg.UserFilter == "" {
 		cfg.UserFilter = "(objectClass=person)"
 	}
@@ -0,0 +1,191 @@
+package ldaputil
+
+import (
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/go-ldap/ldap/v3"
+)
+
+// stubEntry is a directory entry served by stubDirectory.
+type stubEntry struct {
+	dn    string
+	attrs map[string]string
+}
+
+// stubDirectory is a minimal LDAP server accepting simple binds with one DN and password
+// and answering every search with all of its entries.
+type stubDirectory struct {
+	bindDN   string
+	password string
+	entries  []stubEntry
+
+	mu       sync.Mutex
+	searches []string // "baseDN filter" of each search
+}
+
+// start serves the directory on a local port until the test ends and returns its config.
+func (d *stubDirectory) start(t *testing.T) Config {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go d.serve(conn)
+		}
+	}()
+	addr := listener.Addr().(*net.TCPAddr)
+	return Config{Host: addr.IP.String(), Port: addr.Port, BindDN: d.bindDN, Password: d.password, BaseDN: "dc=example,dc=com"}
+}
+
+func (d *stubDirectory) serve(conn net.Conn) {
+	defer conn.Close()
+	for {
+		packet, err := ber.ReadPacket(conn)
+		if err != nil || len(packet.Children) < 2 {
+			return
+		}
+		id := packet.Children[0].Value.(int64)
+		op := packet.Children[1]
+		switch op.Tag {
+		case ldap.ApplicationBindRequest:
+			code := uint16(ldap.LDAPResultSuccess)
+			if op.Children[1].Value.(string) != d.bindDN || op.Children[2].Data.String() != d.password {
+				code = ldap.LDAPResultInvalidCredentials
+			}
+			d.reply(conn, id, ldapResult(ldap.ApplicationBindResponse, code))
+		case ldap.ApplicationSearchRequest:
+			filter, _ := ldap.DecompileFilter(op.Children[6])
+			d.mu.Lock()
+			d.searches = append(d.searches, op.Children[0].Value.(string)+" "+filter)
+			d.mu.Unlock()
+			for _, entry := range d.entries {
+				d.reply(conn, id, searchEntry(entry))
+			}
+			d.reply(conn, id, ldapResult(ldap.ApplicationSearchResultDone, ldap.LDAPResultSuccess))
+		default:
+			// Unbind and anything else ends the connection
+			return
+		}
+	}
+}
+
+func (d *stubDirectory) reply(conn net.Conn, id int64, op *ber.Packet) {
+	message := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "LDAP Response")
+	message.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, id, "MessageID"))
+	message.AppendChild(op)
+	conn.Write(message.Bytes())
+}
+
+func ldapResult(tag ber.Tag, code uint16) *ber.Packet {
+	op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, tag, nil, "Result")
+	op.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, int64(code), "resultCode"))
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "matchedDN"))
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "diagnosticMessage"))
+	return op
+}
+
+func searchEntry(entry stubEntry) *ber.Packet {
+	op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldap.ApplicationSearchResultEntry, nil, "Search Result Entry")
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, entry.dn, "objectName"))
+	attrs := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "attributes")
+	for name, value := range entry.attrs {
+		attr := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "attribute")
+		attr.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, name, "type"))
+		values := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "vals")
+		values.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, value, "value"))
+		attr.AppendChild(values)
+		attrs.AppendChild(attr)
+	}
+	op.AppendChild(attrs)
+	return op
+}
+
+func testDirectory() *stubDirectory {
+	directory := &stubDirectory{bindDN: "cn=admin,dc=example,dc=com", password: "secret"}
+	for i, flag := range []string{"true", "false", "yes", ""} {
+		user := "user" + strconv.Itoa(i)
+		directory.entries = append(directory.entries, stubEntry{
+			dn:    "uid=" + user + ",dc=example,dc=com",
+			attrs: map[string]string{"mail": user + "@example.com", "vless_enabled": flag},
+		})
+	}
+	return directory
+}
+
+func TestTestConnection(t *testing.T) {
+	directory := testDirectory()
+	cfg := directory.start(t)
+	cfg.UserFilter = "(objectClass=inetOrgPerson)"
+
+	count, err := TestConnection(cfg)
+	if err != nil {
+		t.Fatalf("TestConnection() failed: %v", err)
+	}
+	if count != 4 {
+		t.Fatalf("TestConnection() = %d entries, want 4", count)
+	}
+	if want := "dc=example,dc=com (objectClass=inetOrgPerson)"; len(directory.searches) != 1 || directory.searches[0] != want {
+		t.Fatalf("searches = %q, want [%q]", directory.searches, want)
+	}
+}
+
+func TestTestConnectionRejectsWrongPassword(t *testing.T) {
+	directory := testDirectory()
+	cfg := directory.start(t)
+	cfg.Password = "wrong"
+
+	if _, err := TestConnection(cfg); !ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+		t.Fatalf("TestConnection() error = %v, want invalid credentials", err)
+	}
+	if len(directory.searches) != 0 {
+		t.Fatalf("searched after a failed bind: %q", directory.searches)
+	}
+}
+
+func TestTestConnectionUnreachable(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+
+	if _, err := TestConnection(Config{Host: "127.0.0.1", Port: port}); err == nil {
+		t.Fatal("TestConnection() succeeded without a server")
+	}
+}
+
+func TestFetchVlessFlags(t *testing.T) {
+	cfg := testDirectory().start(t)
+	cfg.TruthyVals = []string{"true", "yes"}
+
+	flags, err := FetchVlessFlags(cfg)
+	if err != nil {
+		t.Fatalf("FetchVlessFlags() failed: %v", err)
+	}
+	want := map[string]bool{
+		"user0@example.com": true,
+		"user1@example.com": false,
+		"user2@example.com": true,
+		"user3@example.com": false,
+	}
+	if len(flags) != len(want) {
+		t.Fatalf("FetchVlessFlags() = %v, want %v", flags, want)
+	}
+	for user, enabled := range want {
+		if flags[user] != enabled {
+			t.Errorf("flag of %s = %v, want %v", user, flags[user], enabled)
+		}
+	}
+}
@@ -20,6 +20,8 @@ class DBInbound {
         this.streamSettings = "";
         this.tag = "";
         this.sniffing = "";
+        this.sourceCountryMode = ""; // "allow", "deny" or "" for no restriction
+        this.sourceCountries = ""; // comma-separated geoip country codes
         this.clientStats = "";
         this.nodeId = null; // Node ID for multi-node mode - DEPRECATED: kept only for backward compatibility, use nodeIds instead
         this.nodeIds = []; // Node IDs array for multi-node mode - use this for multi-node support
@@ -22,9 +22,12 @@ class AllSetting {
         this.tgBotBackup = false;
         this.tgBotLoginNotify = true;
         this.tgCpu = 80;
+        this.tgExpiringDigestDays = 0;
         this.tgLang = "en-US";
         this.twoFactorEnable = false;
         this.twoFactorToken = "";
+        this.loginMaxAttempts = 5;
+        this.loginLockoutMinutes = 15;
         this.xrayTemplateConfig = "";
         this.subEnable = true;
         this.subJsonEnable = false;
@@ -36,6 +39,7 @@ class AllSetting {
         this.subDomain = "";
         this.externalTrafficInformEnable = false;
         this.externalTrafficInformURI = "";
+        this.externalTrafficInformSecret = "";
         this.subCertFile = "";
         this.subKeyFile = "";
         this.subUpdates = 12;
@@ -86,6 +90,7 @@ class AllSetting {
 
         // Multi-node mode settings
         this.multiNodeMode = false; // Multi-node mode setting
+        this.nodePushConcurrency = 10; // Max nodes receiving a config push at the same time
         
         // HWID tracking mode
         // "off" = HWID tracking disabled
@@ -98,6 +103,14 @@ class AllSetting {
         this.grafanaVictoriaMetricsUrl = ""; // VictoriaMetrics API URL
         this.grafanaEnable = false; // Enable Grafana integration
 
+        // Default sniffing JSON for new inbounds (empty = no default)
+        this.defaultSniffing = "";
+        this.xrayBinaryPath = "";
+        this.coreLogLevel = "";
+        this.coreApiPort = 0;
+        this.trafficHistoryDays = 30;
+        this.clientOfflineTimeout = 60;
+
         if (data == null) {
             return
         }
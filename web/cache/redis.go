@@ -85,6 +85,15 @@ func Set(key string, value interface{}, expiration time.Duration) error {
 	return client.Set(ctx, key, value, expiration).Err()
 }
 
+// SetNX stores a value in Redis with expiration only if the key does not exist yet.
+// Returns whether the value was stored.
+func SetNX(key string, value interface{}, expiration time.Duration) (bool, error) {
+	if client == nil {
+		return false, fmt.Errorf("Redis client not initialized")
+	}
+	return client.SetNX(ctx, key, value, expiration).Result()
+}
+
 // Get retrieves a value from Redis.
 func Get(key string) (string, error) {
 	if client == nil {
@@ -45,7 +45,18 @@ func (a *APIController) checkAPIAuth(c *gin.Context) {
 		logger.Debugf("[DEBUG-AGENT] checkAPIAuth: inbound request, path=%s, method=%s", c.Request.URL.Path, c.Request.Method)
 	}
 	// #endregion
-	if !session.IsLogin(c) {
+	if token, ok := bearerToken(c); ok {
+		switch checkApiToken(c, token) {
+		case http.StatusOK:
+			c.Next()
+		case http.StatusForbidden:
+			c.AbortWithStatus(http.StatusForbidden)
+		default:
+			c.AbortWithStatus(http.StatusNotFound)
+		}
+		return
+	}
+	if !isLoggedIn(c) {
 		// #region agent log
 		if strings.HasPrefix(c.Request.URL.Path, "/panel/api/inbounds") {
 			logger.Debugf("[DEBUG-AGENT] checkAPIAuth: UNAUTHORIZED, path=%s, method=%s", c.Request.URL.Path, c.Request.Method)
@@ -54,6 +65,15 @@ func (a *APIController) checkAPIAuth(c *gin.Context) {
 		c.AbortWithStatus(http.StatusNotFound)
 		return
 	}
+	switch authorizeUser(c, session.GetLoginUser(c)) {
+	case http.StatusOK:
+	case http.StatusForbidden:
+		c.AbortWithStatus(http.StatusForbidden)
+		return
+	default:
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
 	// #region agent log
 	if strings.HasPrefix(c.Request.URL.Path, "/panel/api/inbounds") {
 		user := session.GetLoginUser(c)
@@ -72,7 +92,7 @@ func (a *APIController) initRouter(g *gin.RouterGroup) {
 	
 	// Main API group with session auth
 	api := g.Group("/panel/api")
-	api.Use(a.checkAPIAuth)
+	api.Use(a.checkAPIAuth, auditMutations)
 
 	// Inbounds API
 	inbounds := api.Group("/inbounds")
@@ -0,0 +1,77 @@
+package controller
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/konstpic/sharx-code/v2/database/model"
+	"github.com/konstpic/sharx-code/v2/web/service"
+	"github.com/konstpic/sharx-code/v2/web/session"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	auditUserKey    = "AUDIT_USER"    // *model.User that made the request, set by authorizeUser
+	auditBeforeKey  = "AUDIT_BEFORE"  // State before the change, set by setAuditChange
+	auditAfterKey   = "AUDIT_AFTER"   // State after the change, set by setAuditChange
+	auditSuccessKey = "AUDIT_SUCCESS" // Success flag of the JSON response, set by jsonMsgObj
+)
+
+// auditMutations is a middleware that records every request other than GET and HEAD in the
+// audit log once the handler has run. POST requests that only read (see readRoutes) are not
+// recorded. It must follow the authentication middleware of a group.
+func auditMutations(c *gin.Context) {
+	if c.Request.Method == http.MethodGet || c.Request.Method == http.MethodHead || isReadRoute(c) {
+		c.Next()
+		return
+	}
+	c.Next()
+
+	user, _ := c.Get(auditUserKey)
+	actor, ok := user.(*model.User)
+	if !ok {
+		if actor = session.GetLoginUser(c); actor == nil {
+			return
+		}
+	}
+	params := make([]string, 0, len(c.Params))
+	for _, param := range c.Params {
+		params = append(params, param.Key+"="+param.Value)
+	}
+	success := c.Writer.Status() < http.StatusBadRequest
+	if responseSuccess, ok := c.Get(auditSuccessKey); ok {
+		success = success && responseSuccess.(bool)
+	}
+	entry := &model.AuditLog{
+		UserId:   actor.Id,
+		Username: actor.Username,
+		Action:   strings.TrimPrefix(c.FullPath(), c.GetString("base_path")),
+		TargetId: strings.Join(params, ","),
+		Ip:       getRemoteIp(c),
+		Success:  success,
+	}
+	if success {
+		before, _ := c.Get(auditBeforeKey)
+		after, _ := c.Get(auditAfterKey)
+		entry.Before, entry.After = service.AuditSummary(before, after)
+	}
+	recordAuditLog(entry)
+}
+
+// recordAuditLog stores an audit log entry; tests replace it to capture entries.
+var recordAuditLog = func(entry *model.AuditLog) {
+	auditLogService := service.AuditLogService{}
+	auditLogService.Record(entry)
+}
+
+// setAuditChange attaches the state of the request target before and after the change to the
+// audit log entry of the request; nil stands for a created or deleted target.
+func setAuditChange(c *gin.Context, before any, after any) {
+	if before != nil {
+		c.Set(auditBeforeKey, before)
+	}
+	if after != nil {
+		c.Set(auditAfterKey, after)
+	}
+}
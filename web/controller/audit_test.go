@@ -0,0 +1,100 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/konstpic/sharx-code/v2/database/model"
+	"github.com/konstpic/sharx-code/v2/web/entity"
+
+	"github.com/gin-gonic/gin"
+)
+
+// captureAuditLog collects the audit log entries recorded during the test.
+func captureAuditLog(t *testing.T) *[]*model.AuditLog {
+	t.Helper()
+	entries := &[]*model.AuditLog{}
+	saved := recordAuditLog
+	recordAuditLog = func(entry *model.AuditLog) { *entries = append(*entries, entry) }
+	t.Cleanup(func() { recordAuditLog = saved })
+	return entries
+}
+
+// serveAudited serves a request to path through auditMutations as user, with handler registered
+// for method and route under the base path /sharx/.
+func serveAudited(user *model.User, method string, route string, path string, handler gin.HandlerFunc) {
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	group := engine.Group("/sharx/", func(c *gin.Context) {
+		c.Set("base_path", "/sharx/")
+		// As authorizeUser does after authentication
+		c.Set(auditUserKey, user)
+	}, auditMutations)
+	group.Handle(method, route, handler)
+
+	req := httptest.NewRequest(method, path, nil)
+	req.RemoteAddr = "198.51.100.7:51234"
+	engine.ServeHTTP(httptest.NewRecorder(), req)
+}
+
+func TestAuditClientDeletion(t *testing.T) {
+	entries := captureAuditLog(t)
+	admin := &model.User{Id: 1, Username: "admin"}
+	serveAudited(admin, http.MethodPost, "panel/client/del/:id", "/sharx/panel/client/del/7", func(c *gin.Context) {
+		setAuditChange(c, &model.ClientEntity{Id: 7, Email: "alice", UUID: "b831381d-6324-4d53-ad4f-8cda48b30811"}, nil)
+		jsonMsg(c, "deleted", nil)
+	})
+
+	if len(*entries) != 1 {
+		t.Fatalf("%d audit entries, want 1", len(*entries))
+	}
+	entry := (*entries)[0]
+	if entry.UserId != 1 || entry.Username != "admin" || entry.Action != "panel/client/del/:id" || entry.TargetId != "id=7" || entry.Ip != "198.51.100.7" || !entry.Success {
+		t.Fatalf("entry = %+v, want a successful deletion of client 7 by admin", entry)
+	}
+	if !strings.Contains(entry.Before, `"email":"alice"`) || strings.Contains(entry.Before, "b831381d") || entry.After != "" {
+		t.Fatalf("entry change = %s -> %q, want the deleted client with its UUID redacted", entry.Before, entry.After)
+	}
+}
+
+func TestAuditSettingChange(t *testing.T) {
+	entries := captureAuditLog(t)
+	admin := &model.User{Id: 1, Username: "admin"}
+	serveAudited(admin, http.MethodPost, "panel/setting/update", "/sharx/panel/setting/update", func(c *gin.Context) {
+		setAuditChange(c, &entity.AllSetting{WebPort: 2053, TgBotToken: "old-token"}, &entity.AllSetting{WebPort: 2054, TgBotToken: "new-token"})
+		jsonMsg(c, "updated", nil)
+	})
+
+	if len(*entries) != 1 {
+		t.Fatalf("%d audit entries, want 1", len(*entries))
+	}
+	entry := (*entries)[0]
+	if entry.UserId != 1 || entry.Action != "panel/setting/update" || entry.TargetId != "" || !entry.Success {
+		t.Fatalf("entry = %+v, want a successful setting update by admin", entry)
+	}
+	if entry.Before != `{"tgBotToken":"[redacted]","webPort":2053}` || entry.After != `{"tgBotToken":"[redacted]","webPort":2054}` {
+		t.Fatalf("entry change = %s -> %s, want the changed port and a redacted token", entry.Before, entry.After)
+	}
+}
+
+func TestAuditFailedAndReadRequests(t *testing.T) {
+	entries := captureAuditLog(t)
+	admin := &model.User{Id: 1, Username: "admin"}
+	serveAudited(admin, http.MethodPost, "panel/client/del/:id", "/sharx/panel/client/del/7", func(c *gin.Context) {
+		setAuditChange(c, &model.ClientEntity{Id: 7, Email: "alice"}, nil)
+		jsonMsg(c, "delete", errors.New("client not found"))
+	})
+	if len(*entries) != 1 || (*entries)[0].Success || (*entries)[0].Before != "" {
+		t.Fatalf("entries = %+v, want one failed deletion without a change", *entries)
+	}
+
+	// Reads, including the POST reads of readRoutes, are not recorded
+	serveAudited(admin, http.MethodGet, "panel/client/list", "/sharx/panel/client/list", func(c *gin.Context) { jsonObj(c, nil, nil) })
+	serveAudited(admin, http.MethodPost, "panel/client/search", "/sharx/panel/client/search", func(c *gin.Context) { jsonObj(c, nil, nil) })
+	if len(*entries) != 1 {
+		t.Fatalf("%d audit entries after reads, want 1", len(*entries))
+	}
+}
@@ -4,9 +4,11 @@ package controller
 
 import (
 	"net/http"
+	"strings"
 
 	"github.com/konstpic/sharx-code/v2/logger"
 	"github.com/konstpic/sharx-code/v2/web/locale"
+	"github.com/konstpic/sharx-code/v2/web/service"
 	"github.com/konstpic/sharx-code/v2/web/session"
 
 	"github.com/gin-gonic/gin"
@@ -17,16 +19,113 @@ type BaseController struct{}
 
 // checkLogin is a middleware that verifies user authentication and handles unauthorized access.
 func (a *BaseController) checkLogin(c *gin.Context) {
-	if !session.IsLogin(c) {
+	if token, ok := bearerToken(c); ok {
+		switch checkApiToken(c, token) {
+		case http.StatusOK:
+			c.Next()
+		case http.StatusForbidden:
+			pureJsonMsg(c, http.StatusForbidden, false, I18nWeb(c, "pages.login.toasts.apiTokenScopeDenied"))
+			c.Abort()
+		default:
+			pureJsonMsg(c, http.StatusUnauthorized, false, I18nWeb(c, "pages.login.toasts.invalidApiToken"))
+			c.Abort()
+		}
+		return
+	}
+	if !isLoggedIn(c) {
 		if isAjax(c) {
 			pureJsonMsg(c, http.StatusUnauthorized, false, I18nWeb(c, "pages.login.loginAgain"))
 		} else {
 			c.Redirect(http.StatusTemporaryRedirect, c.GetString("base_path"))
 		}
 		c.Abort()
-	} else {
+		return
+	}
+	switch authorizeUser(c, session.GetLoginUser(c)) {
+	case http.StatusOK:
 		c.Next()
+	case http.StatusForbidden:
+		pureJsonMsg(c, http.StatusForbidden, false, "This request is not available to read-only users")
+		c.Abort()
+	default:
+		session.ClearSession(c)
+		if isAjax(c) {
+			pureJsonMsg(c, http.StatusUnauthorized, false, I18nWeb(c, "pages.login.loginAgain"))
+		} else {
+			c.Redirect(http.StatusTemporaryRedirect, c.GetString("base_path"))
+		}
+		c.Abort()
+	}
+}
+
+// isLoggedIn reports whether the request carries a login session issued in the current session epoch.
+// Bumping the epoch ("log out everywhere") invalidates all older sessions.
+func isLoggedIn(c *gin.Context) bool {
+	if !session.IsLogin(c) {
+		return false
+	}
+	settingService := service.SettingService{}
+	epoch, err := settingService.GetSessionEpoch()
+	if err != nil {
+		// Without the epoch the session may have been logged out everywhere, so it is refused
+		logger.Warning("Unable to get session epoch:", err)
+		return false
+	}
+	return isSessionInEpoch(c, epoch)
+}
+
+// isSessionInEpoch reports whether the request carries a login session issued in epoch.
+func isSessionInEpoch(c *gin.Context, epoch int) bool {
+	return session.IsLogin(c) && session.GetSessionEpoch(c) == epoch
+}
+
+// bearerToken returns the token of an "Authorization: Bearer <token>" header, if present.
+func bearerToken(c *gin.Context) (string, bool) {
+	header := c.GetHeader("Authorization")
+	if len(header) < 7 || !strings.EqualFold(header[:7], "Bearer ") {
+		return "", false
+	}
+	return strings.TrimSpace(header[7:]), true
+}
+
+// checkApiToken authenticates the request with an API token and returns the resulting HTTP status.
+// On http.StatusOK the token owner becomes the request user; token requests skip two-factor
+// authentication but are limited by the token scope and the role of the owner.
+func checkApiToken(c *gin.Context, token string) int {
+	apiTokenService := service.ApiTokenService{}
+	apiToken, user, err := apiTokenService.Authenticate(token)
+	if err != nil {
+		logger.Warningf("API token rejected, IP: \"%s\": %v", getRemoteIp(c), err)
+		return http.StatusUnauthorized
+	}
+	if status := authorizeApiTokenScope(c, apiToken.Scope); status != http.StatusOK {
+		return status
+	}
+	session.SetRequestUser(c, user)
+	return authorizeUser(c, user)
+}
+
+// authorizeApiTokenScope applies the scope of an API token to the request and returns the
+// resulting HTTP status. Read tokens follow the policy of read-only users.
+func authorizeApiTokenScope(c *gin.Context, scope string) int {
+	if scope != service.ApiTokenScopeFull {
+		if !isReadRoute(c) {
+			return http.StatusForbidden
+		}
+		c.Set(readOnlyKey, true)
+	}
+	return http.StatusOK
+}
+
+// requireSession rejects requests that are not authenticated by a login session,
+// keeping credential and token management out of reach of API tokens.
+func requireSession(c *gin.Context) {
+	if session.IsRequestUser(c) {
+		pureJsonMsg(c, http.StatusForbidden, false, I18nWeb(c, "pages.login.toasts.loginSessionRequired"))
+		c.Abort()
+		return
 	}
+	c.Next()
 }
 
 // I18nWeb retrieves an internationalized message for the web interface based on the current locale.
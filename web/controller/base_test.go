@@ -0,0 +1,194 @@
+package controller
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/konstpic/sharx-code/v2/database/model"
+	"github.com/konstpic/sharx-code/v2/web/cache"
+	"github.com/konstpic/sharx-code/v2/web/service"
+	"github.com/konstpic/sharx-code/v2/web/session"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-contrib/sessions/cookie"
+	"github.com/gin-gonic/gin"
+)
+
+func TestIsSessionInEpoch(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	epoch := 0
+	engine := gin.New()
+	engine.Use(sessions.Sessions("sharx", cookie.NewStore([]byte("0123456789abcdef0123456789abcdef"))))
+	engine.POST("/login", func(c *gin.Context) {
+		session.SetLoginUser(c, &model.User{Id: 1, Username: "admin"})
+		session.SetSessionEpoch(c, epoch)
+		sessions.Default(c).Save()
+	})
+	engine.GET("/check", func(c *gin.Context) {
+		if !isSessionInEpoch(c, epoch) {
+			c.Status(http.StatusUnauthorized)
+			return
+		}
+		c.Status(http.StatusOK)
+	})
+
+	login := func() *http.Cookie {
+		w := httptest.NewRecorder()
+		engine.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/login", nil))
+		cookies := w.Result().Cookies()
+		if len(cookies) == 0 {
+			t.Fatal("login issued no session cookie")
+		}
+		return cookies[0]
+	}
+	check := func(cookie *http.Cookie) int {
+		req := httptest.NewRequest(http.MethodGet, "/check", nil)
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		w := httptest.NewRecorder()
+		engine.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	old := login()
+	if code := check(old); code != http.StatusOK {
+		t.Fatalf("session of the current epoch rejected with %d", code)
+	}
+	if code := check(nil); code != http.StatusUnauthorized {
+		t.Fatalf("request without a session got %d", code)
+	}
+
+	// Log out everywhere
+	epoch++
+	if code := check(old); code != http.StatusUnauthorized {
+		t.Fatalf("session of an old epoch got %d, want %d", code, http.StatusUnauthorized)
+	}
+	if code := check(login()); code != http.StatusOK {
+		t.Fatalf("session issued after the bump rejected with %d", code)
+	}
+}
+
+func TestIsLoggedInFailsClosed(t *testing.T) {
+	if err := cache.InitRedis(""); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { cache.Close() })
+	// Settings are read from the cache before the database
+	setEpoch := func(value string) {
+		setting := &model.Setting{Key: "sessionEpoch", Value: value}
+		if err := cache.SetJSON(cache.KeySettingPrefix+"sessionEpoch", setting, time.Hour); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	engine.Use(sessions.Sessions("sharx", cookie.NewStore([]byte("0123456789abcdef0123456789abcdef"))))
+	engine.POST("/login", func(c *gin.Context) {
+		session.SetLoginUser(c, &model.User{Id: 1, Username: "admin"})
+		session.SetSessionEpoch(c, 3)
+		sessions.Default(c).Save()
+	})
+	engine.GET("/check", func(c *gin.Context) {
+		if !isLoggedIn(c) {
+			c.Status(http.StatusUnauthorized)
+			return
+		}
+		c.Status(http.StatusOK)
+	})
+
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/login", nil))
+	cookies := w.Result().Cookies()
+	if len(cookies) == 0 {
+		t.Fatal("login issued no session cookie")
+	}
+	check := func() int {
+		req := httptest.NewRequest(http.MethodGet, "/check", nil)
+		req.AddCookie(cookies[0])
+		w := httptest.NewRecorder()
+		engine.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	setEpoch("3")
+	if code := check(); code != http.StatusOK {
+		t.Fatalf("session of the current epoch rejected with %d", code)
+	}
+	// An epoch that cannot be read must not let sessions of an older epoch back in
+	setEpoch("not a number")
+	if code := check(); code != http.StatusUnauthorized {
+		t.Fatalf("session accepted with %d while the epoch could not be read", code)
+	}
+}
+
+// serveRoute registers handler for method and route under basePath, as the panel router does,
+// and serves a request to path through it.
+func serveRoute(t *testing.T, basePath string, method string, route string, path string, handler gin.HandlerFunc) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	group := engine.Group(basePath, func(c *gin.Context) { c.Set("base_path", basePath) })
+	group.Handle(method, route, handler)
+
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+	if w.Code == http.StatusNotFound {
+		t.Fatalf("%s %s did not match route %s", method, path, route)
+	}
+}
+
+func TestAuthorizeApiTokenScope(t *testing.T) {
+	tests := []struct {
+		name         string
+		scope        string
+		method       string
+		route        string
+		path         string
+		wantStatus   int
+		wantReadOnly bool
+	}{
+		{"full token writes", service.ApiTokenScopeFull, http.MethodPost, "panel/api/inbounds/del/:id", "/sharx/panel/api/inbounds/del/1", http.StatusOK, false},
+		{"read token lists", service.ApiTokenScopeRead, http.MethodGet, "panel/api/inbounds/list", "/sharx/panel/api/inbounds/list", http.StatusOK, true},
+		{"read token writes", service.ApiTokenScopeRead, http.MethodPost, "panel/api/inbounds/del/:id", "/sharx/panel/api/inbounds/del/1", http.StatusForbidden, false},
+		{"read token adds a client", service.ApiTokenScopeRead, http.MethodPost, "panel/api/inbounds/addClient", "/sharx/panel/api/inbounds/addClient", http.StatusForbidden, false},
+		{"unknown scope writes", "", http.MethodPost, "panel/api/inbounds/del/:id", "/sharx/panel/api/inbounds/del/1", http.StatusForbidden, false},
+	}
+	for _, test := range tests {
+		serveRoute(t, "/sharx/", test.method, test.route, test.path, func(c *gin.Context) {
+			if status := authorizeApiTokenScope(c, test.scope); status != test.wantStatus {
+				t.Errorf("%s: status = %d, want %d", test.name, status, test.wantStatus)
+			}
+			if isReadOnly(c) != test.wantReadOnly {
+				t.Errorf("%s: read-only = %v, want %v", test.name, isReadOnly(c), test.wantReadOnly)
+			}
+		})
+	}
+}
+
+func TestBearerToken(t *testing.T) {
+	tests := []struct {
+		header string
+		token  string
+		ok     bool
+	}{
+		{"Bearer sx_0123", "sx_0123", true},
+		{"bearer sx_0123 ", "sx_0123", true},
+		{"Basic YWRtaW46YWRtaW4=", "", false},
+		{"Bearer", "", false},
+		{"", "", false},
+	}
+	for _, test := range tests {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+		if test.header != "" {
+			c.Request.Header.Set("Authorization", test.header)
+		}
+		if token, ok := bearerToken(c); token != test.token || ok != test.ok {
+			t.Errorf("bearerToken(%q) = %q, %v, want %q, %v", test.header, token, ok, test.token, test.ok)
+		}
+	}
+}
@@ -6,10 +6,13 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/konstpic/sharx-code/v2/database/model"
 	"github.com/konstpic/sharx-code/v2/logger"
+	"github.com/konstpic/sharx-code/v2/util/common"
 	"github.com/konstpic/sharx-code/v2/web/service"
 	"github.com/konstpic/sharx-code/v2/web/session"
 	"github.com/konstpic/sharx-code/v2/web/websocket"
@@ -17,6 +20,9 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
+// maxClientImportSize is the largest CSV file accepted by the client import.
+const maxClientImportSize = 10 << 20
+
 // ClientController handles HTTP requests related to client management.
 type ClientController struct {
 	clientService service.ClientService
@@ -36,15 +42,22 @@ func NewClientController(g *gin.RouterGroup) *ClientController {
 // initRouter initializes the routes for client-related operations.
 func (a *ClientController) initRouter(g *gin.RouterGroup) {
 	g.GET("/list", a.getClients)
+	g.POST("/search", a.searchClients)
+	g.GET("/expiring", a.getExpiringClients)
 	g.GET("/get/:id", a.getClient)
+	g.GET("/diagnose/:id", a.diagnoseClient)
+	g.GET("/trafficSeries/:id", a.getClientTrafficSeries)
 	g.POST("/add", a.addClient)
 	g.POST("/update/:id", a.updateClient)
 	g.POST("/del/:id", a.deleteClient)
 	g.POST("/resetAllTraffics", a.resetAllClientTraffics)
 	g.POST("/resetTraffic/:id", a.resetClientTraffic)
 	g.POST("/delDepletedClients", a.delDepletedClients)
+	g.POST("/import", a.importClients)
+	g.GET("/export", a.exportClients)
 	// HWID operations
 	g.POST("/clearHwid/:id", a.clearClientHWIDs)
+	g.POST("/:id/clearHwid", a.clearClientHWIDs)
 	g.POST("/clearAllHwids", a.clearAllClientHWIDs)
 	g.POST("/setHwidLimitAll", a.setHWIDLimitForAllClients)
 	// Bulk operations
@@ -53,6 +66,7 @@ func (a *ClientController) initRouter(g *gin.RouterGroup) {
 	g.POST("/bulk/delete", a.bulkDelete)
 	g.POST("/bulk/enable", a.bulkEnable)
 	g.POST("/bulk/setHwidLimit", a.bulkSetHwidLimit)
+	g.POST("/bulk/extendExpiry", a.bulkExtendExpiry)
 }
 
 // getClients retrieves the list of all clients for the current user.
@@ -66,6 +80,38 @@ func (a *ClientController) getClients(c *gin.Context) {
 	jsonObj(c, clients, nil)
 }
 
+// searchClients finds clients by email/comment, status, group, inbound and expiry, one page at a time.
+func (a *ClientController) searchClients(c *gin.Context) {
+	user := session.GetLoginUser(c)
+	var filter service.ClientSearchFilter
+	if err := c.ShouldBind(&filter); err != nil {
+		jsonMsg(c, "Invalid request data", err)
+		return
+	}
+	result, err := a.clientService.SearchClients(user.Id, filter)
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "somethingWentWrong"), err)
+		return
+	}
+	jsonObj(c, result, nil)
+}
+
+// getExpiringClients lists the clients expiring within the given number of days, soonest first.
+func (a *ClientController) getExpiringClients(c *gin.Context) {
+	days, err := strconv.Atoi(c.DefaultQuery("days", "7"))
+	if err != nil {
+		jsonMsg(c, "Invalid number of days", err)
+		return
+	}
+	user := session.GetLoginUser(c)
+	clients, err := a.clientService.GetExpiringClients(user.Id, days)
+	if err != nil {
+		jsonMsg(c, "Failed to get expiring clients", err)
+		return
+	}
+	jsonObj(c, clients, nil)
+}
+
 // getClient retrieves a specific client by its ID.
 func (a *ClientController) getClient(c *gin.Context) {
 	id, err := strconv.Atoi(c.Param("id"))
@@ -86,6 +132,27 @@ func (a *ClientController) getClient(c *gin.Context) {
 	jsonObj(c, client, nil)
 }
 
+// diagnoseClient checks whether a client is usable on each of its inbounds.
+func (a *ClientController) diagnoseClient(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		jsonMsg(c, "Invalid client ID", err)
+		return
+	}
+	user := session.GetLoginUser(c)
+	client, err := a.clientService.GetClient(id)
+	if err != nil || client == nil || client.UserId != user.Id {
+		jsonMsg(c, "Client not found or access denied", nil)
+		return
+	}
+	diagnosis, err := a.clientService.DiagnoseClient(id)
+	if err != nil {
+		jsonMsg(c, "Failed to diagnose client", err)
+		return
+	}
+	jsonObj(c, diagnosis, nil)
+}
+
 // addClient creates a new client.
 func (a *ClientController) addClient(c *gin.Context) {
 	user := session.GetLoginUser(c)
@@ -185,18 +252,30 @@ func (a *ClientController) addClient(c *gin.Context) {
 		}
 	}
 
-	needRestart, err := a.clientService.AddClient(user.Id, client)
+	var needRestart bool
+	if idempotencyKey := c.GetHeader("Idempotency-Key"); idempotencyKey != "" {
+		var replayed bool
+		client, replayed, needRestart, err = a.clientService.AddClientIdempotent(user.Id, client, idempotencyKey)
+		if err == nil && replayed {
+			// Created by an earlier request with the same key, nothing changed
+			jsonMsgObj(c, I18nWeb(c, "pages.clients.toasts.clientCreateSuccess"), client, nil)
+			return
+		}
+	} else {
+		needRestart, err = a.clientService.AddClient(user.Id, client)
+	}
 	if err != nil {
 		logger.Errorf("Failed to add client: %v", err)
 		jsonMsg(c, I18nWeb(c, "somethingWentWrong"), err)
 		return
 	}
 
+	setAuditChange(c, nil, client)
 	jsonMsgObj(c, I18nWeb(c, "pages.clients.toasts.clientCreateSuccess"), client, nil)
 	if needRestart {
-		// In multi-node mode, this will send config to nodes immediately
-		// In single mode, this will restart local Xray
-		// Restart asynchronously to avoid blocking the response
+		// In multi-node mode, this will send config to nodes; in single mode, this will restart local Xray
+		// The restart is debounced and runs in the background, so the response is not blocked and
+		// changes made in quick succession are applied together
 		a.xrayService.RestartXrayAsync(false)
 	}
 	// Broadcast clients and inbounds update via WebSocket
@@ -227,6 +306,8 @@ func (a *ClientController) updateClient(c *gin.Context) {
 		jsonMsg(c, "Client not found or access denied", nil)
 		return
 	}
+	// existing is updated in place below, keep its state for the audit log
+	before := *existing
 	
 	// Extract inboundIds from JSON or form data
 	var inboundIdsFromJSON []int = nil // nil means not provided, empty array means remove all
@@ -390,6 +471,12 @@ func (a *ClientController) updateClient(c *gin.Context) {
 					client.GroupId = &groupId
 				}
 			}
+			// Handle subUpdates - can be 0 (use the group or global interval), so check if key exists
+			if subUpdatesVal, exists := updateData["subUpdates"]; exists {
+				if subUpdates, ok := subUpdatesVal.(float64); ok {
+					client.SubUpdates = int(subUpdates)
+				}
+			}
 		}
 	} else {
 		// For form data, use ShouldBind
@@ -480,6 +567,12 @@ func (a *ClientController) updateClient(c *gin.Context) {
 				// Explicitly set to null (remove from group)
 				client.GroupId = nil
 			}
+			// Handle subUpdates - can be 0 (use the group or global interval)
+			if subUpdatesStr := c.PostForm("subUpdates"); subUpdatesStr != "" {
+				if subUpdates, err := strconv.Atoi(subUpdatesStr); err == nil {
+					client.SubUpdates = subUpdates
+				}
+			}
 		}
 	}
 	
@@ -530,11 +623,12 @@ func (a *ClientController) updateClient(c *gin.Context) {
 		return
 	}
 
+	setAuditChange(c, &before, client)
 	jsonMsgObj(c, I18nWeb(c, "pages.clients.toasts.clientUpdateSuccess"), client, nil)
 	if needRestart {
-		// In multi-node mode, this will send config to nodes asynchronously (non-blocking)
-		// In single mode, this will restart local Xray asynchronously
-		// This allows the user to get an immediate response while configs are being sent
+		// In multi-node mode, this will send config to nodes; in single mode, this will restart local Xray
+		// The restart is debounced and runs in the background, so the response is not blocked and
+		// changes made in quick succession are applied together
 		a.xrayService.RestartXrayAsync(false)
 	}
 	// Broadcast clients and inbounds update via WebSocket
@@ -554,6 +648,7 @@ func (a *ClientController) deleteClient(c *gin.Context) {
 	}
 
 	user := session.GetLoginUser(c)
+	existing, _ := a.clientService.GetClient(id)
 	needRestart, err := a.clientService.DeleteClient(user.Id, id)
 	if err != nil {
 		logger.Errorf("Failed to delete client: %v", err)
@@ -561,11 +656,12 @@ func (a *ClientController) deleteClient(c *gin.Context) {
 		return
 	}
 
+	setAuditChange(c, existing, nil)
 	jsonMsg(c, I18nWeb(c, "pages.clients.toasts.clientDeleteSuccess"), nil)
 	if needRestart {
-		// In multi-node mode, this will send config to nodes asynchronously (non-blocking)
-		// In single mode, this will restart local Xray asynchronously
-		// This allows the user to get an immediate response while configs are being sent
+		// In multi-node mode, this will send config to nodes; in single mode, this will restart local Xray
+		// The restart is debounced and runs in the background, so the response is not blocked and
+		// changes made in quick succession are applied together
 		a.xrayService.RestartXrayAsync(false)
 	}
 	// Broadcast clients and inbounds update via WebSocket
@@ -587,9 +683,9 @@ func (a *ClientController) resetAllClientTraffics(c *gin.Context) {
 	}
 	jsonMsg(c, I18nWeb(c, "pages.inbounds.toasts.resetAllClientTrafficSuccess"), nil)
 	if needRestart {
-		// In multi-node mode, this will send config to nodes immediately
-		// In single mode, this will restart local Xray
-		// Restart asynchronously to avoid blocking the response
+		// In multi-node mode, this will send config to nodes; in single mode, this will restart local Xray
+		// The restart is debounced and runs in the background, so the response is not blocked and
+		// changes made in quick succession are applied together
 		a.xrayService.RestartXrayAsync(false)
 	}
 }
@@ -612,9 +708,9 @@ func (a *ClientController) resetClientTraffic(c *gin.Context) {
 
 	jsonMsg(c, I18nWeb(c, "pages.inbounds.toasts.resetInboundClientTrafficSuccess"), nil)
 	if needRestart {
-		// In multi-node mode, this will send config to nodes immediately
-		// In single mode, this will restart local Xray
-		// Restart asynchronously to avoid blocking the response
+		// In multi-node mode, this will send config to nodes; in single mode, this will restart local Xray
+		// The restart is debounced and runs in the background, so the response is not blocked and
+		// changes made in quick succession are applied together
 		a.xrayService.RestartXrayAsync(false)
 	}
 }
@@ -632,9 +728,9 @@ func (a *ClientController) delDepletedClients(c *gin.Context) {
 	if count > 0 {
 		jsonMsg(c, I18nWeb(c, "pages.inbounds.toasts.delDepletedClientsSuccess"), nil)
 		if needRestart {
-			// In multi-node mode, this will send config to nodes immediately
-			// In single mode, this will restart local Xray
-			// Restart asynchronously to avoid blocking the response
+			// In multi-node mode, this will send config to nodes; in single mode, this will restart local Xray
+			// The restart is debounced and runs in the background, so the response is not blocked and
+			// changes made in quick succession are applied together
 			a.xrayService.RestartXrayAsync(false)
 		}
 	} else {
@@ -651,22 +747,14 @@ func (a *ClientController) clearClientHWIDs(c *gin.Context) {
 	}
 
 	user := session.GetLoginUser(c)
-	// Verify client belongs to user
-	client, err := a.clientService.GetClient(id)
-	if err != nil || client == nil || client.UserId != user.Id {
-		jsonMsg(c, "Client not found or access denied", nil)
-		return
-	}
-
-	hwidService := service.ClientHWIDService{}
-	err = hwidService.ClearHWIDsForClient(id)
+	count, err := a.clientService.ClearClientHWIDs(user.Id, id)
 	if err != nil {
 		logger.Errorf("Failed to clear HWIDs for client %d: %v", id, err)
 		jsonMsg(c, I18nWeb(c, "somethingWentWrong"), err)
 		return
 	}
 
-	jsonMsg(c, "HWIDs cleared successfully", nil)
+	jsonMsgObj(c, I18nWeb(c, "pages.clients.hwidsClearedCount", "Count=="+strconv.FormatInt(count, 10)), count, nil)
 }
 
 // clearAllClientHWIDs clears all HWIDs for all clients of the current user.
@@ -681,7 +769,7 @@ func (a *ClientController) clearAllClientHWIDs(c *gin.Context) {
 		return
 	}
 
-	jsonMsg(c, fmt.Sprintf("Cleared %d HWIDs successfully", count), nil)
+	jsonMsg(c, I18nWeb(c, "pages.clients.hwidsClearedCount", "Count=="+strconv.FormatInt(count, 10)), nil)
 }
 
 // setHWIDLimitForAllClients sets HWID limit for all clients of the current user.
@@ -720,13 +808,13 @@ func (a *ClientController) bulkResetTraffic(c *gin.Context) {
 		jsonMsg(c, "Invalid request data", err)
 		return
 	}
-	needRestart, err := a.clientService.BulkResetTraffic(user.Id, req.ClientIds)
+	result, needRestart, err := a.clientService.BulkResetTraffic(user.Id, req.ClientIds)
 	if err != nil {
 		logger.Errorf("Failed to reset traffic for clients: %v", err)
 		jsonMsg(c, I18nWeb(c, "somethingWentWrong"), err)
 		return
 	}
-	jsonMsg(c, "Traffic reset successfully", nil)
+	jsonBulkResult(c, "pages.clients.bulkTrafficReset", result)
 	if needRestart {
 		// Restart asynchronously to avoid blocking the response
 		a.xrayService.RestartXrayAsync(false)
@@ -744,13 +832,13 @@ func (a *ClientController) bulkClearHwid(c *gin.Context) {
 		jsonMsg(c, "Invalid request data", err)
 		return
 	}
-	err = a.clientService.BulkClearHWIDs(user.Id, req.ClientIds)
+	result, err := a.clientService.BulkClearHWIDs(user.Id, req.ClientIds)
 	if err != nil {
 		logger.Errorf("Failed to clear HWIDs for clients: %v", err)
 		jsonMsg(c, I18nWeb(c, "somethingWentWrong"), err)
 		return
 	}
-	jsonMsg(c, "HWIDs cleared successfully", nil)
+	jsonBulkResult(c, "pages.clients.bulkHwidsCleared", result)
 }
 
 // bulkDelete deletes selected clients.
@@ -764,13 +852,13 @@ func (a *ClientController) bulkDelete(c *gin.Context) {
 		jsonMsg(c, "Invalid request data", err)
 		return
 	}
-	needRestart, err := a.clientService.BulkDelete(user.Id, req.ClientIds)
+	result, needRestart, err := a.clientService.BulkDelete(user.Id, req.ClientIds)
 	if err != nil {
 		logger.Errorf("Failed to delete clients: %v", err)
 		jsonMsg(c, I18nWeb(c, "somethingWentWrong"), err)
 		return
 	}
-	jsonMsg(c, "Clients deleted successfully", nil)
+	jsonBulkResult(c, "pages.clients.bulkDeleted", result)
 	if needRestart {
 		// Restart asynchronously to avoid blocking the response
 		a.xrayService.RestartXrayAsync(false)
@@ -789,13 +877,13 @@ func (a *ClientController) bulkEnable(c *gin.Context) {
 		jsonMsg(c, "Invalid request data", err)
 		return
 	}
-	needRestart, err := a.clientService.BulkEnable(user.Id, req.ClientIds, req.Enable)
+	result, needRestart, err := a.clientService.BulkEnable(user.Id, req.ClientIds, req.Enable)
 	if err != nil {
 		logger.Errorf("Failed to enable/disable clients: %v", err)
 		jsonMsg(c, I18nWeb(c, "somethingWentWrong"), err)
 		return
 	}
-	jsonMsg(c, "Clients updated successfully", nil)
+	jsonBulkResult(c, "pages.clients.bulkUpdated", result)
 	if needRestart {
 		// Restart asynchronously to avoid blocking the response
 		a.xrayService.RestartXrayAsync(false)
@@ -815,11 +903,163 @@ func (a *ClientController) bulkSetHwidLimit(c *gin.Context) {
 		jsonMsg(c, "Invalid request data", err)
 		return
 	}
-	err = a.clientService.BulkSetHWIDLimit(user.Id, req.ClientIds, req.MaxHwid, req.Enabled)
+	result, err := a.clientService.BulkSetHWIDLimit(user.Id, req.ClientIds, req.MaxHwid, req.Enabled)
 	if err != nil {
 		logger.Errorf("Failed to set HWID limit for clients: %v", err)
 		jsonMsg(c, I18nWeb(c, "somethingWentWrong"), err)
 		return
 	}
-	jsonMsg(c, "HWID limit set successfully", nil)
+	jsonBulkResult(c, "pages.clients.bulkHwidLimitSet", result)
+}
+
+// bulkExtendExpiry extends the expiry time of selected clients by a number of days.
+func (a *ClientController) bulkExtendExpiry(c *gin.Context) {
+	user := session.GetLoginUser(c)
+	var req struct {
+		ClientIds []int `json:"clientIds" form:"clientIds"`
+		Days      int   `json:"days" form:"days"`
+	}
+	err := c.ShouldBind(&req)
+	if err != nil {
+		jsonMsg(c, "Invalid request data", err)
+		return
+	}
+	result, needRestart, err := a.clientService.BulkSetExpiryRelative(user.Id, req.ClientIds, req.Days)
+	if err != nil {
+		logger.Errorf("Failed to extend expiry for clients: %v", err)
+		jsonMsg(c, I18nWeb(c, "somethingWentWrong"), err)
+		return
+	}
+	jsonBulkResult(c, "pages.clients.bulkExpiryExtended", result)
+	if needRestart {
+		// Restart asynchronously to avoid blocking the response
+		a.xrayService.RestartXrayAsync(false)
+	}
+}
+
+// importClients creates clients from an uploaded CSV file and assigns them to the given inbounds.
+func (a *ClientController) importClients(c *gin.Context) {
+	user := session.GetLoginUser(c)
+	file, err := c.FormFile("file")
+	if err != nil {
+		jsonMsg(c, "Invalid request data", err)
+		return
+	}
+	if file.Size > maxClientImportSize {
+		jsonMsg(c, "Invalid request data", common.NewErrorf("CSV file is larger than %d MB", maxClientImportSize>>20))
+		return
+	}
+	src, err := file.Open()
+	if err != nil {
+		jsonMsg(c, "Invalid request data", err)
+		return
+	}
+	defer src.Close()
+	data, err := io.ReadAll(src)
+	if err != nil {
+		jsonMsg(c, "Invalid request data", err)
+		return
+	}
+
+	var inboundIds []int
+	for _, idStr := range c.PostFormArray("inboundIds") {
+		id, err := strconv.Atoi(idStr)
+		if err != nil || id <= 0 {
+			jsonMsg(c, "Invalid inbound ID", common.NewErrorf("invalid inbound ID %q", idStr))
+			return
+		}
+		inboundIds = append(inboundIds, id)
+	}
+
+	result, needRestart, err := a.clientService.ImportClientsCSV(user.Id, data, inboundIds)
+	if err != nil {
+		logger.Errorf("Failed to import clients: %v", err)
+		jsonMsg(c, I18nWeb(c, "somethingWentWrong"), err)
+		return
+	}
+	err = nil
+	if len(result.Created) == 0 && len(result.Failed) > 0 {
+		err = common.NewError(result.Failed[0].Reason)
+	}
+	jsonMsgObj(c, result.Summary(), result, err)
+	if needRestart {
+		// Restart asynchronously to avoid blocking the response
+		a.xrayService.RestartXrayAsync(false)
+	}
+	if len(result.Created) > 0 {
+		// Broadcast clients and inbounds update via WebSocket
+		clients, _ := a.clientService.GetClients(user.Id)
+		websocket.BroadcastClients(clients)
+		inboundService := service.InboundService{}
+		inbounds, _ := inboundService.GetInbounds(user.Id)
+		websocket.BroadcastInbounds(inbounds)
+	}
+}
+
+// exportClients streams the clients matching the search filters of the query string as a CSV file.
+func (a *ClientController) exportClients(c *gin.Context) {
+	user := session.GetLoginUser(c)
+	var filter service.ClientSearchFilter
+	if err := c.ShouldBindQuery(&filter); err != nil {
+		jsonMsg(c, "Invalid request data", err)
+		return
+	}
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=clients-%s.csv", time.Now().Format("20060102-150405")))
+	c.Status(http.StatusOK)
+	if err := a.clientService.ExportClientsCSV(user.Id, filter, c.Writer); err != nil {
+		// The response has already started, so the error can only be logged
+		logger.Errorf("Failed to export clients: %v", err)
+	}
+}
+
+// jsonBulkResult responds with the per-client result of a bulk operation.
+// The request only fails when the operation was applied to none of the clients.
+func jsonBulkResult(c *gin.Context, actionKey string, result *service.BulkResult) {
+	var err error
+	if len(result.Succeeded) == 0 && len(result.Failed) > 0 {
+		err = common.NewError(result.Failed[0].Reason)
+	}
+	jsonMsgObj(c, bulkResultSummary(c, actionKey, result), result, err)
+}
+
+// bulkResultSummary describes a bulk result with the translated action, e.g. "HWID limit set for 48 of 50 clients".
+func bulkResultSummary(c *gin.Context, actionKey string, result *service.BulkResult) string {
+	action := I18nWeb(c, actionKey)
+	total := strconv.Itoa(len(result.Succeeded) + len(result.Failed))
+	if len(result.Failed) == 0 {
+		return I18nWeb(c, "pages.clients.bulkResult", "Action=="+action, "Total=="+total)
+	}
+	return I18nWeb(c, "pages.clients.bulkResultPartial", "Action=="+action,
+		"Succeeded=="+strconv.Itoa(len(result.Succeeded)), "Total=="+total, "Failed=="+strconv.Itoa(len(result.Failed)))
+}
+
+// getClientTrafficSeries retrieves the traffic history of a client bucketed for charts.
+func (a *ClientController) getClientTrafficSeries(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		jsonMsg(c, "Invalid client ID", err)
+		return
+	}
+	user := session.GetLoginUser(c)
+	client, err := a.clientService.GetClient(id)
+	if err != nil {
+		jsonMsg(c, "Failed to get client", err)
+		return
+	}
+	if client.UserId != user.Id {
+		jsonMsg(c, "Client not found or access denied", nil)
+		return
+	}
+	from, to, bucket, err := parseTrafficSeriesQuery(c)
+	if err != nil {
+		jsonMsg(c, "Invalid traffic series query", err)
+		return
+	}
+	series, err := a.clientService.GetClientTrafficSeries(client.Email, from, to, bucket)
+	if err != nil {
+		jsonMsg(c, "Failed to get client traffic series", err)
+		return
+	}
+	jsonObj(c, series, nil)
 }
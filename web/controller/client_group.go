@@ -47,6 +47,7 @@ func (a *ClientGroupController) initRouter(g *gin.RouterGroup) {
 	g.POST("/:id/bulk/enable", a.bulkEnable)
 	g.POST("/:id/bulk/setHwidLimit", a.bulkSetHwidLimit)
 	g.POST("/:id/bulk/assignInbounds", a.bulkAssignInbounds)
+	g.POST("/:id/bulk/extendExpiry", a.bulkExtendExpiry)
 }
 
 // getGroups retrieves all groups for the current user.
@@ -230,13 +231,13 @@ func (a *ClientGroupController) bulkResetTraffic(c *gin.Context) {
 	for i, client := range clients {
 		clientIds[i] = client.Id
 	}
-	needRestart, err := a.clientService.BulkResetTraffic(user.Id, clientIds)
+	result, needRestart, err := a.clientService.BulkResetTraffic(user.Id, clientIds)
 	if err != nil {
 		logger.Errorf("Failed to reset traffic for group: %v", err)
 		jsonMsg(c, I18nWeb(c, "somethingWentWrong"), err)
 		return
 	}
-	jsonMsg(c, "Traffic reset successfully", nil)
+	jsonBulkResult(c, "pages.clients.bulkTrafficReset", result)
 	if needRestart {
 		// Restart asynchronously to avoid blocking the response
 		a.xrayService.RestartXrayAsync(false)
@@ -265,13 +266,13 @@ func (a *ClientGroupController) bulkClearHwid(c *gin.Context) {
 	for i, client := range clients {
 		clientIds[i] = client.Id
 	}
-	err = a.clientService.BulkClearHWIDs(user.Id, clientIds)
+	result, err := a.clientService.BulkClearHWIDs(user.Id, clientIds)
 	if err != nil {
 		logger.Errorf("Failed to clear HWIDs for group: %v", err)
 		jsonMsg(c, I18nWeb(c, "somethingWentWrong"), err)
 		return
 	}
-	jsonMsg(c, "HWIDs cleared successfully", nil)
+	jsonBulkResult(c, "pages.clients.bulkHwidsCleared", result)
 }
 
 // bulkDelete deletes all clients in a group.
@@ -296,13 +297,13 @@ func (a *ClientGroupController) bulkDelete(c *gin.Context) {
 	for i, client := range clients {
 		clientIds[i] = client.Id
 	}
-	needRestart, err := a.clientService.BulkDelete(user.Id, clientIds)
+	result, needRestart, err := a.clientService.BulkDelete(user.Id, clientIds)
 	if err != nil {
 		logger.Errorf("Failed to delete clients in group: %v", err)
 		jsonMsg(c, I18nWeb(c, "somethingWentWrong"), err)
 		return
 	}
-	jsonMsg(c, "Clients deleted successfully", nil)
+	jsonBulkResult(c, "pages.clients.bulkDeleted", result)
 	if needRestart {
 		// Restart asynchronously to avoid blocking the response
 		a.xrayService.RestartXrayAsync(false)
@@ -346,7 +347,7 @@ func (a *ClientGroupController) bulkEnable(c *gin.Context) {
 	for i, client := range clients {
 		clientIds[i] = client.Id
 	}
-	needRestart, err := a.clientService.BulkEnable(user.Id, clientIds, req.Enable)
+	result, needRestart, err := a.clientService.BulkEnable(user.Id, clientIds, req.Enable)
 	if err != nil {
 		logger.Errorf("Failed to enable/disable clients in group: %v", err)
 		jsonMsg(c, I18nWeb(c, "somethingWentWrong"), err)
@@ -361,7 +362,7 @@ func (a *ClientGroupController) bulkEnable(c *gin.Context) {
 		tgbotService.NotifyGroupChanged(group.Name, req.Enable, updatedClients)
 	}
 	
-	jsonMsg(c, "Clients updated successfully", nil)
+	jsonBulkResult(c, "pages.clients.bulkUpdated", result)
 	if needRestart {
 		// Restart asynchronously to avoid blocking the response
 		a.xrayService.RestartXrayAsync(false)
@@ -399,13 +400,13 @@ func (a *ClientGroupController) bulkSetHwidLimit(c *gin.Context) {
 	for i, client := range clients {
 		clientIds[i] = client.Id
 	}
-	err = a.clientService.BulkSetHWIDLimit(user.Id, clientIds, req.MaxHwid, req.Enabled)
+	result, err := a.clientService.BulkSetHWIDLimit(user.Id, clientIds, req.MaxHwid, req.Enabled)
 	if err != nil {
 		logger.Errorf("Failed to set HWID limit for group: %v", err)
 		jsonMsg(c, I18nWeb(c, "somethingWentWrong"), err)
 		return
 	}
-	jsonMsg(c, "HWID limit set successfully", nil)
+	jsonBulkResult(c, "pages.clients.bulkHwidLimitSet", result)
 }
 
 // bulkAssignInbounds assigns inbounds to all clients in a group.
@@ -442,13 +443,56 @@ func (a *ClientGroupController) bulkAssignInbounds(c *gin.Context) {
 	for i, client := range clients {
 		clientIds[i] = client.Id
 	}
-	needRestart, err := a.clientService.BulkAssignInbounds(user.Id, clientIds, req.InboundIds)
+	result, needRestart, err := a.clientService.BulkAssignInbounds(user.Id, clientIds, req.InboundIds)
 	if err != nil {
 		logger.Errorf("Failed to assign inbounds for group: %v", err)
 		jsonMsg(c, I18nWeb(c, "somethingWentWrong"), err)
 		return
 	}
-	jsonMsg(c, "Inbounds assigned successfully", nil)
+	jsonBulkResult(c, "pages.clients.bulkInboundsAssigned", result)
+	if needRestart {
+		// Restart asynchronously to avoid blocking the response
+		a.xrayService.RestartXrayAsync(false)
+	}
+}
+
+// bulkExtendExpiry extends the expiry time of all clients in a group by a number of days.
+func (a *ClientGroupController) bulkExtendExpiry(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		jsonMsg(c, "Invalid group ID", err)
+		return
+	}
+	user := session.GetLoginUser(c)
+	var req struct {
+		Days int `json:"days" form:"days"`
+	}
+	err = c.ShouldBind(&req)
+	if err != nil {
+		jsonMsg(c, "Invalid request data", err)
+		return
+	}
+	// Get all clients in group
+	clients, err := a.groupService.GetClientsInGroup(id, user.Id)
+	if err != nil {
+		jsonMsg(c, "Failed to get clients in group", err)
+		return
+	}
+	if len(clients) == 0 {
+		jsonMsg(c, "No clients in group", nil)
+		return
+	}
+	clientIds := make([]int, len(clients))
+	for i, client := range clients {
+		clientIds[i] = client.Id
+	}
+	result, needRestart, err := a.clientService.BulkSetExpiryRelative(user.Id, clientIds, req.Days)
+	if err != nil {
+		logger.Errorf("Failed to extend expiry for group: %v", err)
+		jsonMsg(c, I18nWeb(c, "somethingWentWrong"), err)
+		return
+	}
+	jsonBulkResult(c, "pages.clients.bulkExpiryExtended", result)
 	if needRestart {
 		// Restart asynchronously to avoid blocking the response
 		a.xrayService.RestartXrayAsync(false)
@@ -9,6 +9,7 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/konstpic/sharx-code/v2/web/service"
+	"github.com/konstpic/sharx-code/v2/web/session"
 )
 
 // ClientHWIDController handles HTTP requests for client HWID management.
@@ -32,6 +33,7 @@ func (a *ClientHWIDController) initRouter(g *gin.RouterGroup) {
 	g = g.Group("/hwid")
 	{
 		g.GET("/list/:clientId", a.getHWIDs)
+		g.POST("/search", a.searchHWIDs)
 		g.POST("/add", a.addHWID)
 		g.POST("/del/:id", a.removeHWID) // Changed to /del/:id to match API style
 		g.POST("/deactivate/:id", a.deactivateHWID)
@@ -59,6 +61,23 @@ func (a *ClientHWIDController) getHWIDs(c *gin.Context) {
 	jsonObj(c, hwids, nil)
 }
 
+// searchHWIDs lists the HWIDs of all clients of the current user by state, device OS and
+// last seen time, one page at a time.
+func (a *ClientHWIDController) searchHWIDs(c *gin.Context) {
+	user := session.GetLoginUser(c)
+	var filter service.HWIDListFilter
+	if err := c.ShouldBind(&filter); err != nil {
+		jsonMsg(c, "Invalid request", err)
+		return
+	}
+	result, err := a.clientService.ListHWIDs(user.Id, filter)
+	if err != nil {
+		jsonMsg(c, "Failed to get HWIDs", err)
+		return
+	}
+	jsonObj(c, result, nil)
+}
+
 // addHWID adds a new HWID for a client (manual addition by admin).
 func (a *ClientHWIDController) addHWID(c *gin.Context) {
 	var req struct {
@@ -0,0 +1,45 @@
+package controller
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/konstpic/sharx-code/v2/web/locale"
+	"github.com/konstpic/sharx-code/v2/web/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestBulkResultSummary(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	// Render the key and its parameters, so the test sees which message is built
+	c.Set("I18n", func(_ locale.I18nType, key string, params ...string) string {
+		return strings.Join(append([]string{key}, params...), " ")
+	})
+
+	tests := []struct {
+		name   string
+		result *service.BulkResult
+		want   string
+	}{
+		{
+			name:   "all succeeded",
+			result: &service.BulkResult{Succeeded: []int{1, 2}},
+			want:   "pages.clients.bulkResult Action==pages.clients.bulkDeleted Total==2",
+		},
+		{
+			name:   "some failed",
+			result: &service.BulkResult{Succeeded: []int{1}, Failed: []service.BulkFailure{{ClientId: 2}, {ClientId: 3}}},
+			want:   "pages.clients.bulkResultPartial Action==pages.clients.bulkDeleted Succeeded==1 Total==3 Failed==2",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := bulkResultSummary(c, "pages.clients.bulkDeleted", tt.result); got != tt.want {
+				t.Fatalf("bulkResultSummary() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"net"
 	"strconv"
 
 	"github.com/konstpic/sharx-code/v2/database/model"
@@ -50,6 +51,8 @@ func (a *InboundController) initRouter(g *gin.RouterGroup) {
 	g.POST("/add", a.addInbound)
 	g.POST("/del/:id", a.delInbound)
 	g.POST("/update/:id", a.updateInbound)
+	g.POST("/setEnable/:id", a.setInboundEnable)
+	g.POST("/bulk/setEnable", a.bulkSetInboundEnable)
 	g.POST("/clientIps/:email", a.getClientIps)
 	g.POST("/clearClientIps/:email", a.clearClientIps)
 	g.POST("/addClient", a.addInboundClient)
@@ -60,6 +63,12 @@ func (a *InboundController) initRouter(g *gin.RouterGroup) {
 	g.POST("/resetAllClientTraffics/:id", a.resetAllClientTraffics)
 	g.POST("/delDepletedClients/:id", a.delDepletedClients)
 	g.POST("/import", a.importInbound)
+	g.GET("/export/:id", a.exportInboundTemplate)
+	g.GET("/:id/singbox/:email", a.getSingboxOutbound)
+	g.POST("/importTemplate", a.importInboundTemplate)
+	g.POST("/clone/:id", a.cloneInbound)
+	g.GET("/reality/generate", a.generateRealityKeys)
+	g.GET("/trafficSeries/:id", a.getInboundTrafficSeries)
 	g.POST("/onlines", a.onlines)
 	g.POST("/lastOnline", a.lastOnline)
 	g.POST("/updateClientTraffic/:email", a.updateClientTraffic)
@@ -74,6 +83,9 @@ func (a *InboundController) getInbounds(c *gin.Context) {
 		jsonMsg(c, I18nWeb(c, "pages.inbounds.toasts.obtain"), err)
 		return
 	}
+	if isReadOnly(c) {
+		inbounds = redactInbounds(inbounds)
+	}
 	jsonObj(c, inbounds, nil)
 }
 
@@ -89,6 +101,9 @@ func (a *InboundController) getInbound(c *gin.Context) {
 		jsonMsg(c, I18nWeb(c, "pages.inbounds.toasts.obtain"), err)
 		return
 	}
+	if isReadOnly(c) {
+		inbound = service.RedactInboundSecrets(inbound)
+	}
 	jsonObj(c, inbound, nil)
 }
 
@@ -297,6 +312,62 @@ func (a *InboundController) delInbound(c *gin.Context) {
 	websocket.BroadcastInbounds(inbounds)
 }
 
+// setInboundEnable enables or disables an inbound without deleting it.
+func (a *InboundController) setInboundEnable(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		jsonMsg(c, "Invalid inbound ID", err)
+		return
+	}
+	var req struct {
+		Enable bool `json:"enable" form:"enable"`
+	}
+	if err := c.ShouldBind(&req); err != nil {
+		jsonMsg(c, "Invalid request data", err)
+		return
+	}
+
+	needRestart, err := a.inboundService.SetInboundEnable(id, req.Enable)
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "somethingWentWrong"), err)
+		return
+	}
+	jsonMsg(c, I18nWeb(c, "pages.inbounds.toasts.inboundUpdateSuccess"), nil)
+	if needRestart {
+		a.xrayService.SetToNeedRestart()
+	}
+	// Broadcast inbounds update via WebSocket
+	user := session.GetLoginUser(c)
+	inbounds, _ := a.inboundService.GetInbounds(user.Id)
+	websocket.BroadcastInbounds(inbounds)
+}
+
+// bulkSetInboundEnable enables or disables selected inbounds with a single restart.
+func (a *InboundController) bulkSetInboundEnable(c *gin.Context) {
+	user := session.GetLoginUser(c)
+	var req struct {
+		InboundIds []int `json:"inboundIds" form:"inboundIds"`
+		Enable     bool  `json:"enable" form:"enable"`
+	}
+	if err := c.ShouldBind(&req); err != nil {
+		jsonMsg(c, "Invalid request data", err)
+		return
+	}
+
+	needRestart, err := a.inboundService.BulkSetEnable(user.Id, req.InboundIds, req.Enable)
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "somethingWentWrong"), err)
+		return
+	}
+	jsonMsg(c, I18nWeb(c, "pages.inbounds.toasts.inboundsUpdateSuccess"), nil)
+	if needRestart {
+		a.xrayService.SetToNeedRestart()
+	}
+	// Broadcast inbounds update via WebSocket
+	inbounds, _ := a.inboundService.GetInbounds(user.Id)
+	websocket.BroadcastInbounds(inbounds)
+}
+
 // updateInbound updates an existing inbound configuration.
 func (a *InboundController) updateInbound(c *gin.Context) {
 	// #region agent log
@@ -711,6 +782,129 @@ func (a *InboundController) importInbound(c *gin.Context) {
 	}
 }
 
+// exportInboundTemplate exports an inbound and its clients as a reusable template.
+func (a *InboundController) exportInboundTemplate(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "get"), err)
+		return
+	}
+	user := session.GetLoginUser(c)
+	inbound, err := a.inboundService.GetInbound(id)
+	if err != nil || inbound.UserId != user.Id {
+		jsonMsg(c, I18nWeb(c, "pages.inbounds.toasts.obtain"), err)
+		return
+	}
+	bundle, err := a.inboundService.ExportInbound(id, c.Query("stripCredentials") == "true", c.Query("includePrivateKey") == "true")
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "pages.inbounds.toasts.obtain"), err)
+		return
+	}
+	jsonObj(c, bundle, nil)
+}
+
+// getSingboxOutbound returns the connection of a client of an inbound as a sing-box outbound object.
+func (a *InboundController) getSingboxOutbound(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "get"), err)
+		return
+	}
+	// The panel address is the server of inbounds listening on all interfaces
+	server := c.Request.Host
+	if host, _, err := net.SplitHostPort(server); err == nil {
+		server = host
+	}
+	user := session.GetLoginUser(c)
+	outbound, err := a.inboundService.GetSingboxOutbound(user.Id, id, c.Param("email"), server)
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "pages.inbounds.toasts.obtain"), err)
+		return
+	}
+	jsonObj(c, outbound, nil)
+}
+
+// importInboundTemplate recreates an inbound from an exported template with a new port and certificate.
+func (a *InboundController) importInboundTemplate(c *gin.Context) {
+	var request struct {
+		Bundle    *service.InboundBundle         `json:"bundle"`
+		Overrides service.InboundImportOverrides `json:"overrides"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		jsonMsg(c, I18nWeb(c, "somethingWentWrong"), err)
+		return
+	}
+	user := session.GetLoginUser(c)
+	inbound, needRestart, err := a.inboundService.ImportInbound(user.Id, request.Bundle, request.Overrides)
+	jsonMsgObj(c, I18nWeb(c, "pages.inbounds.toasts.inboundCreateSuccess"), inbound, err)
+	if err == nil && needRestart {
+		a.xrayService.SetToNeedRestart()
+	}
+}
+
+// cloneInbound creates a copy of an inbound on a new port.
+func (a *InboundController) cloneInbound(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "get"), err)
+		return
+	}
+	var request struct {
+		Port        int    `json:"port" form:"port"`
+		Tag         string `json:"tag" form:"tag"`
+		CopyClients bool   `json:"copyClients" form:"copyClients"`
+	}
+	if err := c.ShouldBind(&request); err != nil {
+		jsonMsg(c, I18nWeb(c, "somethingWentWrong"), err)
+		return
+	}
+	user := session.GetLoginUser(c)
+	source, err := a.inboundService.GetInbound(id)
+	if err != nil || source.UserId != user.Id {
+		jsonMsg(c, I18nWeb(c, "pages.inbounds.toasts.obtain"), err)
+		return
+	}
+	inbound, needRestart, err := a.inboundService.CloneInbound(id, request.Port, request.Tag, request.CopyClients)
+	jsonMsgObj(c, I18nWeb(c, "pages.inbounds.toasts.inboundCreateSuccess"), inbound, err)
+	if err != nil {
+		return
+	}
+	if needRestart {
+		a.xrayService.SetToNeedRestart()
+	}
+	// Broadcast inbounds update via WebSocket
+	inbounds, _ := a.inboundService.GetInbounds(user.Id)
+	websocket.BroadcastInbounds(inbounds)
+}
+
+// generateRealityKeys returns a fresh Reality x25519 key pair and random shortIds.
+func (a *InboundController) generateRealityKeys(c *gin.Context) {
+	count := 8
+	if countStr := c.Query("count"); countStr != "" {
+		n, err := strconv.Atoi(countStr)
+		if err != nil {
+			jsonMsg(c, "Invalid shortId count", err)
+			return
+		}
+		count = n
+	}
+	length := 0
+	if lengthStr := c.Query("length"); lengthStr != "" {
+		n, err := strconv.Atoi(lengthStr)
+		if err != nil {
+			jsonMsg(c, "Invalid shortId length", err)
+			return
+		}
+		length = n
+	}
+	keys, err := service.GenerateRealityKeys(count, length)
+	if err != nil {
+		jsonMsg(c, "Failed to generate Reality keys", err)
+		return
+	}
+	jsonObj(c, keys, nil)
+}
+
 // delDepletedClients deletes clients in an inbound who have exhausted their traffic limits.
 func (a *InboundController) delDepletedClients(c *gin.Context) {
 	id, err := strconv.Atoi(c.Param("id"))
@@ -792,3 +986,29 @@ func (a *InboundController) delInboundClientByEmail(c *gin.Context) {
 	clients, _ := clientService.GetClients(user.Id)
 	websocket.BroadcastClients(clients)
 }
+
+// getInboundTrafficSeries retrieves the traffic history of an inbound bucketed for charts.
+func (a *InboundController) getInboundTrafficSeries(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "get"), err)
+		return
+	}
+	user := session.GetLoginUser(c)
+	inbound, err := a.inboundService.GetInbound(id)
+	if err != nil || inbound.UserId != user.Id {
+		jsonMsg(c, I18nWeb(c, "pages.inbounds.toasts.obtain"), err)
+		return
+	}
+	from, to, bucket, err := parseTrafficSeriesQuery(c)
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "pages.inbounds.toasts.obtain"), err)
+		return
+	}
+	series, err := a.inboundService.GetInboundTrafficSeries(id, from, to, bucket)
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "pages.inbounds.toasts.obtain"), err)
+		return
+	}
+	jsonObj(c, series, nil)
+}
@@ -1,7 +1,9 @@
 package controller
 
 import (
+	"math"
 	"net/http"
+	"strconv"
 	"text/template"
 	"time"
 
@@ -47,7 +49,7 @@ func (a *IndexController) initRouter(g *gin.RouterGroup) {
 
 // index handles the root route, redirecting logged-in users to the panel or showing the login page.
 func (a *IndexController) index(c *gin.Context) {
-	if session.IsLogin(c) {
+	if isLoggedIn(c) {
 		c.Redirect(http.StatusTemporaryRedirect, "panel/")
 		return
 	}
@@ -71,17 +73,29 @@ func (a *IndexController) login(c *gin.Context) {
 		return
 	}
 
+	remoteIp := getRemoteIp(c)
+	if lockedFor := a.userService.LoginLockedFor(remoteIp, form.Username); lockedFor > 0 {
+		minutes := int(math.Ceil(lockedFor.Minutes()))
+		pureJsonMsg(c, http.StatusOK, false, I18nWeb(c, "pages.login.toasts.loginLocked", "Minutes=="+strconv.Itoa(minutes)))
+		return
+	}
+
 	user := a.userService.CheckUser(form.Username, form.Password, form.TwoFactorCode)
 	timeStr := time.Now().Format("2006-01-02 15:04:05")
 	safeUser := template.HTMLEscapeString(form.Username)
 	safePass := template.HTMLEscapeString(form.Password)
 
 	if user == nil {
-		logger.Warningf("wrong username: \"%s\", password: \"%s\", IP: \"%s\"", safeUser, safePass, getRemoteIp(c))
-		a.tgbot.UserLoginNotify(safeUser, safePass, getRemoteIp(c), timeStr, 0)
+		logger.Warningf("wrong username: \"%s\", password: \"%s\", IP: \"%s\"", safeUser, safePass, remoteIp)
+		a.tgbot.UserLoginNotify(safeUser, safePass, remoteIp, timeStr, 0)
+		if locked, attempts, lockout := a.userService.RecordLoginFailure(remoteIp, form.Username); locked {
+			logger.Warningf("login locked for %v after %d failed attempts, username: \"%s\", IP: \"%s\"", lockout, attempts, safeUser, remoteIp)
+			a.tgbot.UserLoginLockoutNotify(safeUser, remoteIp, timeStr, attempts, int(lockout.Minutes()))
+		}
 		pureJsonMsg(c, http.StatusOK, false, I18nWeb(c, "pages.login.toasts.wrongUsernameOrPassword"))
 		return
 	}
+	a.userService.ResetLoginFailures(remoteIp, form.Username)
 
 	logger.Infof("%s logged in successfully, Ip Address: %s\n", safeUser, getRemoteIp(c))
 	a.tgbot.UserLoginNotify(safeUser, ``, getRemoteIp(c), timeStr, 1)
@@ -91,8 +105,14 @@ func (a *IndexController) login(c *gin.Context) {
 		logger.Warning("Unable to get session's max age from DB")
 	}
 
+	sessionEpoch, err := a.settingService.GetSessionEpoch()
+	if err != nil {
+		logger.Warning("Unable to get session epoch from DB")
+	}
+
 	session.SetMaxAge(c, sessionMaxAge*60)
 	session.SetLoginUser(c, user)
+	session.SetSessionEpoch(c, sessionEpoch)
 	if err := sessions.Default(c).Save(); err != nil {
 		logger.Warning("Unable to save session: ", err)
 		return
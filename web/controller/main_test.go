@@ -0,0 +1,24 @@
+package controller
+
+import (
+	"os"
+	"testing"
+
+	"github.com/konstpic/sharx-code/v2/logger"
+
+	"github.com/op/go-logging"
+)
+
+func TestMain(m *testing.M) {
+	// Failed responses are logged through the package logger, which only exists after InitLogger
+	logFolder, err := os.MkdirTemp("", "sharx-controller-test")
+	if err != nil {
+		panic(err)
+	}
+	os.Setenv("XUI_LOG_FOLDER", logFolder)
+	logger.InitLogger(logging.ERROR)
+
+	code := m.Run()
+	os.RemoveAll(logFolder)
+	os.Exit(code)
+}
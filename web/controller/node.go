@@ -74,15 +74,21 @@ func (a *NodeController) initRouter(g *gin.RouterGroup) {
 	g.GET("/get/:id", a.getNode)
 	g.POST("/add", a.addNode)
 	g.POST("/update/:id", a.updateNode)
+	g.POST("/clone/:id", a.cloneNode)
+	g.POST("/rotateApiKey/:id", a.rotateNodeApiKey)
 	g.POST("/del/:id", a.deleteNode)
 	g.POST("/check/:id", a.checkNode)
 	g.POST("/checkAll", a.checkAllNodes)
 	g.POST("/reload/:id", a.reloadNode)
 	g.POST("/reloadAll", a.reloadAllNodes)
+	g.POST("/resync/:id", a.resyncNode)
 	g.GET("/status/:id", a.getNodeStatus)
 	g.POST("/logs/:id", a.getNodeLogs)
 	g.POST("/check-connection", a.checkNodeConnection) // Check node connection without API key
 	g.POST("/resetTraffic/:id", a.resetNodeTraffic)   // Reset node traffic
+	g.GET("/configHistory/:id", a.getNodeConfigHistory) // Config push history
+	g.GET("/pushResults", a.getNodePushResults)         // Outcome of the last config push per node
+	g.GET("/trafficSeries/:id", a.getNodeTrafficSeries)  // Traffic history for charts
 	// push-logs endpoint moved to APIController to bypass session auth
 }
 
@@ -103,10 +109,20 @@ func (a *NodeController) getNodes(c *gin.Context) {
 	}
 	
 	profileService := service.XrayCoreConfigProfileService{}
+	readOnly := isReadOnly(c)
 	result := make([]NodeWithInbounds, 0, len(nodes))
 	for _, node := range nodes {
 		inbounds, _ := a.nodeService.GetInboundsForNode(node.Id)
-		profiles, _ := profileService.GetProfilesForNode(node.Id)
+		var profiles []*model.XrayCoreConfigProfile
+		if readOnly {
+			// Profiles hold outbound credentials, the API key authenticates to the node
+			redacted := *node
+			redacted.ApiKey = ""
+			node = &redacted
+			inbounds = redactInbounds(inbounds)
+		} else {
+			profiles, _ = profileService.GetProfilesForNode(node.Id)
+		}
 		// Get Xray version from node (only if node is online)
 		xrayVersion := ""
 		if node.Status == "online" {
@@ -135,6 +151,11 @@ func (a *NodeController) getNode(c *gin.Context) {
 		jsonMsg(c, "Failed to get node", err)
 		return
 	}
+	if isReadOnly(c) {
+		redacted := *node
+		redacted.ApiKey = ""
+		node = &redacted
+	}
 	jsonObj(c, node, nil)
 }
 
@@ -207,6 +228,62 @@ func (a *NodeController) addNode(c *gin.Context) {
 	jsonMsgObj(c, "Node added and registered successfully", node, nil)
 }
 
+// cloneNode creates a copy of a node at a new address, optionally with its mappings.
+func (a *NodeController) cloneNode(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		jsonMsg(c, "Invalid node ID", err)
+		return
+	}
+	var request struct {
+		Name         string `json:"name" form:"name"`
+		Address      string `json:"address" form:"address"`
+		CopyMappings bool   `json:"copyMappings" form:"copyMappings"`
+	}
+	if err := c.ShouldBind(&request); err != nil {
+		jsonMsg(c, "Invalid node data", err)
+		return
+	}
+
+	node, err := a.nodeService.CloneNode(id, request.Name, request.Address, request.CopyMappings, getRequestPanelURL(c))
+	if err != nil {
+		logger.Errorf("[Node: %s] Clone of node %d failed: %v", request.Name, id, err)
+		jsonMsg(c, "Failed to clone node", err)
+		return
+	}
+
+	go func() {
+		a.nodeService.CheckNodeHealth(node)
+		if request.CopyMappings {
+			xrayService := service.XrayService{}
+			if err := xrayService.ResyncNode(node.Id); err != nil {
+				logger.Warningf("[Node: %s] Failed to push config to cloned node: %v", node.Name, err)
+			}
+		}
+	}()
+	a.broadcastNodesUpdate()
+
+	logger.Infof("[Node: %s] Node cloned from node %d and registered successfully", node.Name, id)
+	jsonMsgObj(c, "Node cloned and registered successfully", node, nil)
+}
+
+// rotateNodeApiKey replaces the API key of a node on the node and in the panel.
+func (a *NodeController) rotateNodeApiKey(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		jsonMsg(c, "Invalid node ID", err)
+		return
+	}
+	if _, err := a.nodeService.RotateApiKey(id); err != nil {
+		logger.Errorf("API key rotation of node %d failed: %v", id, err)
+		jsonMsg(c, "Failed to rotate node API key, the old key is still in use", err)
+		return
+	}
+	node, err := a.nodeService.GetNode(id)
+	jsonMsgObj(c, "Node API key rotated successfully", node, err)
+	a.broadcastNodesUpdate()
+}
+
 // updateNode updates an existing node.
 func (a *NodeController) updateNode(c *gin.Context) {
 	id, err := strconv.Atoi(c.Param("id"))
@@ -250,6 +327,9 @@ func (a *NodeController) updateNode(c *gin.Context) {
 			if keyPathVal, ok := jsonData["keyPath"].(string); ok {
 				node.KeyPath = keyPathVal
 			}
+			if caPathVal, ok := jsonData["caPath"].(string); ok {
+				node.CaPath = caPathVal
+			}
 			if insecureTlsVal, ok := jsonData["insecureTls"].(bool); ok {
 				node.InsecureTLS = insecureTlsVal
 			}
@@ -278,6 +358,9 @@ func (a *NodeController) updateNode(c *gin.Context) {
 		if keyPath := c.PostForm("keyPath"); keyPath != "" {
 			node.KeyPath = keyPath
 		}
+		if caPath := c.PostForm("caPath"); caPath != "" {
+			node.CaPath = caPath
+		}
 		node.InsecureTLS = c.PostForm("insecureTls") == "true" || c.PostForm("insecureTls") == "on"
 		// Traffic limit
 		if trafficLimitGBStr := c.PostForm("trafficLimitGB"); trafficLimitGBStr != "" {
@@ -433,6 +516,23 @@ func (a *NodeController) reloadNode(c *gin.Context) {
 	jsonMsg(c, "Node reloaded successfully", nil)
 }
 
+// resyncNode re-pushes the latest config to a single node.
+func (a *NodeController) resyncNode(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		jsonMsg(c, "Invalid node ID", err)
+		return
+	}
+
+	xrayService := service.XrayService{}
+	if err := xrayService.ResyncNode(id); err != nil {
+		jsonMsg(c, "Failed to resync node", err)
+		return
+	}
+
+	jsonMsg(c, "Node config resynced successfully", nil)
+}
+
 // reloadAllNodes reloads XRAY on all nodes.
 func (a *NodeController) reloadAllNodes(c *gin.Context) {
 	err := a.nodeService.ReloadAllNodes()
@@ -688,3 +788,43 @@ func (a *NodeController) resetNodeTraffic(c *gin.Context) {
 
 	jsonMsg(c, "Node traffic reset successfully", nil)
 }
+
+// getNodeConfigHistory retrieves the config push history for a node.
+func (a *NodeController) getNodeConfigHistory(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		jsonMsg(c, "Invalid node ID", err)
+		return
+	}
+	history, err := a.nodeService.GetConfigHistory(id)
+	if err != nil {
+		jsonMsg(c, "Failed to get node config history", err)
+		return
+	}
+	jsonObj(c, history, nil)
+}
+
+// getNodePushResults retrieves the outcome of the last config push to each node.
+func (a *NodeController) getNodePushResults(c *gin.Context) {
+	jsonObj(c, a.nodeService.GetLastPushResults(), nil)
+}
+
+// getNodeTrafficSeries retrieves the traffic history of a node bucketed for charts.
+func (a *NodeController) getNodeTrafficSeries(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		jsonMsg(c, "Invalid node ID", err)
+		return
+	}
+	from, to, bucket, err := parseTrafficSeriesQuery(c)
+	if err != nil {
+		jsonMsg(c, "Invalid traffic series query", err)
+		return
+	}
+	series, err := a.nodeService.GetTrafficSeries(id, from, to, bucket)
+	if err != nil {
+		jsonMsg(c, "Failed to get node traffic series", err)
+		return
+	}
+	jsonObj(c, series, nil)
+}
@@ -32,6 +32,7 @@ func (a *OutboundController) initRouter(g *gin.RouterGroup) {
 	g.POST("/add", a.addOutbound)
 	g.POST("/del/:id", a.delOutbound)
 	g.POST("/update/:id", a.updateOutbound)
+	g.POST("/setEnable/:id", a.setOutboundEnable)
 }
 
 // getOutbounds retrieves the list of outbounds for the logged-in user.
@@ -311,6 +312,36 @@ func (a *OutboundController) updateOutbound(c *gin.Context) {
 	jsonMsgObj(c, "Outbound updated successfully", outbound, nil)
 }
 
+// setOutboundEnable enables or disables an outbound.
+func (a *OutboundController) setOutboundEnable(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		jsonMsg(c, "Invalid outbound ID", err)
+		return
+	}
+	var req struct {
+		Enable bool `json:"enable" form:"enable"`
+	}
+	if err := c.ShouldBind(&req); err != nil {
+		jsonMsg(c, "Invalid request data", err)
+		return
+	}
+
+	err = a.outboundService.SetEnable(id, req.Enable)
+	if err != nil {
+		jsonMsg(c, "Failed to update outbound: "+err.Error(), err)
+		return
+	}
+
+	// Restart Xray if needed (RestartXray will check internally if restart is needed)
+	err = a.xrayService.RestartXray(false)
+	if err != nil {
+		logger.Warningf("Failed to restart Xray after toggling outbound: %v", err)
+	}
+
+	jsonMsg(c, "Outbound updated successfully", nil)
+}
+
 // delOutbound deletes an outbound configuration by ID.
 func (a *OutboundController) delOutbound(c *gin.Context) {
 	id, err := strconv.Atoi(c.Param("id"))
@@ -0,0 +1,143 @@
+package controller
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/konstpic/sharx-code/v2/database/model"
+	"github.com/konstpic/sharx-code/v2/logger"
+	"github.com/konstpic/sharx-code/v2/web/service"
+	"github.com/konstpic/sharx-code/v2/web/session"
+
+	"github.com/gin-gonic/gin"
+)
+
+// readOnlyKey marks a request of a read-only user or read-scope API token.
+const readOnlyKey = "READ_ONLY"
+
+// readRoutes are the requests that only read, by method and route relative to the base path.
+// Read-only users and read-scope API tokens may make only these. Most reads of the panel are POST requests, so requests
+// are allowed by route rather than by method. Routes returning the database, exports with
+// private keys, outbound and profile credentials or the audit log are left out; for node lists,
+// the setting list and the Xray config, read-only requests get a redacted response.
+var readRoutes = map[string]bool{
+	"GET panel/":                      true,
+	"GET panel/inbounds":              true,
+	"GET panel/clients":               true,
+	"GET panel/groups":                true,
+	"GET panel/hosts":                 true,
+	"GET panel/api-docs":              true,
+	"GET panel/api/api-docs/markdown": true,
+
+	"GET panel/api/inbounds/list":                      true,
+	"GET panel/api/inbounds/get/:id":                   true,
+	"GET panel/api/inbounds/getClientTraffics/:email":  true,
+	"GET panel/api/inbounds/getClientTrafficsById/:id": true,
+	"GET panel/api/inbounds/trafficSeries/:id":         true,
+	"GET panel/api/inbounds/:id/singbox/:email":        true,
+	"POST panel/api/inbounds/onlines":                  true,
+	"POST panel/api/inbounds/lastOnline":               true,
+	"POST panel/api/inbounds/clientIps/:email":         true,
+
+	"GET panel/api/server/status":             true,
+	"GET panel/api/server/cpuHistory/:bucket": true,
+	"GET panel/api/server/getXrayVersion":     true,
+	"GET panel/api/server/getConfigJson":      true,
+	"GET panel/api/server/deferredRestart":    true,
+	"GET panel/api/server/metrics":            true,
+	"POST panel/api/server/logs/:count":       true,
+	"POST panel/api/server/xraylogs/:count":   true,
+	"POST panel/api/server/coreLogs/:count":   true,
+
+	"GET panel/client/list":                true,
+	"GET panel/client/get/:id":             true,
+	"GET panel/client/diagnose/:id":        true,
+	"GET panel/client/expiring":            true,
+	"GET panel/client/export":              true,
+	"GET panel/client/trafficSeries/:id":   true,
+	"GET panel/client/hwid/list/:clientId": true,
+	"POST panel/client/search":             true,
+	"POST panel/client/hwid/search":        true,
+
+	"GET panel/group/list":             true,
+	"GET panel/group/get/:id":          true,
+	"GET panel/group/:id/clients":      true,
+	"GET panel/host/list":              true,
+	"GET panel/host/get/:id":           true,
+	"GET panel/node/list":              true,
+	"GET panel/node/get/:id":           true,
+	"GET panel/node/status/:id":        true,
+	"GET panel/node/pushResults":       true,
+	"GET panel/node/trafficSeries/:id": true,
+	"POST panel/node/logs/:id":         true,
+
+	"POST panel/setting/all":             true,
+	"POST panel/setting/defaultSettings": true,
+	"GET panel/xray/getOutboundsTraffic": true,
+	"GET panel/xray/getXrayResult":       true,
+}
+
+// authorizeUser applies the role of the authenticated user to the request and returns the
+// resulting HTTP status. The role is read from the database, so role changes and deleted users
+// take effect on open sessions and tokens. Users other than the primary admin act on the data of
+// the primary admin, which becomes the request user.
+func authorizeUser(c *gin.Context, user *model.User) int {
+	userService := service.UserService{}
+	stored, primary, err := userService.GetRequestUsers(user.Id)
+	if err != nil {
+		logger.Warningf("User %d rejected, IP: \"%s\": %v", user.Id, getRemoteIp(c), err)
+		return http.StatusUnauthorized
+	}
+	return applyUserRole(c, stored, primary)
+}
+
+// applyUserRole applies the role of stored, the authenticated user as stored, to the request and
+// returns the resulting HTTP status, see authorizeUser.
+func applyUserRole(c *gin.Context, stored *model.User, primary *model.User) int {
+	c.Set(auditUserKey, stored)
+	if stored.Role == model.UserRoleReadOnly {
+		if !isReadRoute(c) {
+			return http.StatusForbidden
+		}
+		c.Set(readOnlyKey, true)
+	}
+	if stored.Id != primary.Id {
+		session.SetRequestUser(c, primary)
+	}
+	return http.StatusOK
+}
+
+// isReadRoute reports whether the current request is one of readRoutes.
+func isReadRoute(c *gin.Context) bool {
+	method := c.Request.Method
+	if method == http.MethodHead {
+		method = http.MethodGet
+	}
+	return readRoutes[method+" "+strings.TrimPrefix(c.FullPath(), c.GetString("base_path"))]
+}
+
+// isReadOnly reports whether the current request is restricted to reading, so responses must
+// leave out credentials.
+func isReadOnly(c *gin.Context) bool {
+	return c.GetBool(readOnlyKey)
+}
+
+// requirePrimaryAdmin rejects requests that are not made by the primary admin in a login session,
+// keeping user management out of reach of other users and of API tokens.
+func requirePrimaryAdmin(c *gin.Context) {
+	if session.IsRequestUser(c) {
+		pureJsonMsg(c, http.StatusForbidden, false, "Only the primary admin can manage users")
+		c.Abort()
+		return
+	}
+	c.Next()
+}
+
+// redactInbounds returns copies of inbounds without their server secrets, for read-only requests.
+func redactInbounds(inbounds []*model.Inbound) []*model.Inbound {
+	redacted := make([]*model.Inbound, len(inbounds))
+	for i, inbound := range inbounds {
+		redacted[i] = service.RedactInboundSecrets(inbound)
+	}
+	return redacted
+}
@@ -0,0 +1,92 @@
+package controller
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/konstpic/sharx-code/v2/database/model"
+	"github.com/konstpic/sharx-code/v2/web/session"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestApplyUserRole(t *testing.T) {
+	primary := &model.User{Id: 1, Username: "admin", Role: model.UserRoleAdmin}
+	support := &model.User{Id: 2, Username: "support", Role: model.UserRoleReadOnly}
+	tests := []struct {
+		name         string
+		user         *model.User
+		method       string
+		route        string
+		path         string
+		wantStatus   int
+		wantReadOnly bool
+	}{
+		{"read-only user lists inbounds", support, http.MethodGet, "panel/api/inbounds/list", "/sharx/panel/api/inbounds/list", http.StatusOK, true},
+		{"read-only user lists clients", support, http.MethodGet, "panel/client/list", "/sharx/panel/client/list", http.StatusOK, true},
+		{"read-only user searches clients", support, http.MethodPost, "panel/client/search", "/sharx/panel/client/search", http.StatusOK, true},
+		{"read-only user deletes an inbound", support, http.MethodPost, "panel/api/inbounds/del/:id", "/sharx/panel/api/inbounds/del/1", http.StatusForbidden, false},
+		{"read-only user deletes a client", support, http.MethodPost, "panel/client/del/:id", "/sharx/panel/client/del/1", http.StatusForbidden, false},
+		{"read-only user changes settings", support, http.MethodPost, "panel/setting/update", "/sharx/panel/setting/update", http.StatusForbidden, false},
+		// Reads that return the database or private keys are left out as well
+		{"read-only user downloads the database", support, http.MethodGet, "panel/api/server/getDb", "/sharx/panel/api/server/getDb", http.StatusForbidden, false},
+		{"admin deletes an inbound", primary, http.MethodPost, "panel/api/inbounds/del/:id", "/sharx/panel/api/inbounds/del/1", http.StatusOK, false},
+	}
+	for _, test := range tests {
+		serveRoute(t, "/sharx/", test.method, test.route, test.path, func(c *gin.Context) {
+			if status := applyUserRole(c, test.user, primary); status != test.wantStatus {
+				t.Errorf("%s: status = %d, want %d", test.name, status, test.wantStatus)
+			}
+			if isReadOnly(c) != test.wantReadOnly {
+				t.Errorf("%s: read-only = %v, want %v", test.name, isReadOnly(c), test.wantReadOnly)
+			}
+		})
+	}
+}
+
+func TestApplyUserRoleActsOnPrimaryAdminData(t *testing.T) {
+	primary := &model.User{Id: 1, Username: "admin", Role: model.UserRoleAdmin}
+	for _, user := range []*model.User{primary, {Id: 2, Username: "support", Role: model.UserRoleReadOnly}} {
+		serveRoute(t, "/sharx/", http.MethodGet, "panel/client/list", "/sharx/panel/client/list", func(c *gin.Context) {
+			// Stands in for the session of the user that logged in
+			session.SetRequestUser(c, user)
+			applyUserRole(c, user, primary)
+			if got := session.GetLoginUser(c); got.Id != primary.Id {
+				t.Errorf("request of user %d acts on user %d, want the primary admin", user.Id, got.Id)
+			}
+			if audited, _ := c.Get(auditUserKey); audited != user {
+				t.Errorf("request of user %d audited as %v", user.Id, audited)
+			}
+		})
+	}
+}
+
+func TestReadRoutesAreReads(t *testing.T) {
+	for route := range readRoutes {
+		method, path, _ := strings.Cut(route, " ")
+		if method != http.MethodGet && method != http.MethodPost {
+			t.Errorf("read route %q has method %s", route, method)
+		}
+		for _, write := range []string{"/del", "/add", "/update", "/reset", "/delete"} {
+			if strings.Contains(path, write) {
+				t.Errorf("read route %q looks like a write", route)
+			}
+		}
+	}
+}
+
+func TestRedactInbounds(t *testing.T) {
+	inbounds := []*model.Inbound{{
+		Id:             1,
+		Settings:       `{"clients":[],"decryption":"none"}`,
+		StreamSettings: `{"security":"reality","realitySettings":{"privateKey":"server-private-key"}}`,
+	}}
+	redacted := redactInbounds(inbounds)
+	if len(redacted) != 1 || redacted[0].Id != 1 || strings.Contains(redacted[0].StreamSettings, "server-private-key") {
+		t.Fatalf("redactInbounds() = %+v, want the inbound without its private key", redacted)
+	}
+	if !strings.Contains(inbounds[0].StreamSettings, "server-private-key") {
+		t.Fatal("redactInbounds() modified the listed inbound")
+	}
+}
@@ -29,6 +29,7 @@ type ServerController struct {
 	serverService  service.ServerService
 	settingService service.SettingService
 	panelService   service.PanelService
+	xrayService    service.XrayService
 
 	lastStatus *service.Status
 
@@ -60,15 +61,22 @@ func (a *ServerController) initRouter(g *gin.RouterGroup) {
 
 	g.POST("/stopXrayService", a.stopXrayService)
 	g.POST("/restartXrayService", a.restartXrayService)
+	g.GET("/deferredRestart", a.getDeferredRestart)
+	g.POST("/deferredRestart/enable", a.enableDeferredRestart)
+	g.POST("/deferredRestart/disable", a.disableDeferredRestart)
+	g.POST("/deferredRestart/apply", a.applyDeferredRestart)
 	g.POST("/installXray/:version", a.installXray)
 	g.POST("/installXrayOnNodes/:version", a.installXrayOnNodes)
 	g.POST("/updateGeofile", a.updateGeofile)
 	g.POST("/updateGeofile/:fileName", a.updateGeofile)
 	g.POST("/logs/:count", a.getLogs)
 	g.POST("/xraylogs/:count", a.getXrayLogs)
+	g.POST("/coreLogs/:count", a.getCoreLogs)
 	g.POST("/importDB", a.importDB)
 	g.POST("/getNewEchCert", a.getNewEchCert)
 	g.GET("/metrics", a.getMetrics)
+	g.GET("/orphanedMappings", a.getOrphanedMappings)
+	g.POST("/pruneOrphanedMappings", a.pruneOrphanedMappings)
 }
 
 // refreshStatus updates the cached server status and collects CPU history.
@@ -362,6 +370,50 @@ func (a *ServerController) restartXrayService(c *gin.Context) {
 	)
 }
 
+// getDeferredRestart returns the state of the deferred restart window.
+func (a *ServerController) getDeferredRestart(c *gin.Context) {
+	jsonObj(c, a.xrayService.GetDeferredRestartStatus(), nil)
+}
+
+// enableDeferredRestart defers non-forced Xray restarts for the given number of minutes.
+func (a *ServerController) enableDeferredRestart(c *gin.Context) {
+	var req struct {
+		Minutes int `json:"minutes" form:"minutes"`
+	}
+	if err := c.ShouldBind(&req); err != nil {
+		jsonMsg(c, "Invalid request data", err)
+		return
+	}
+	err := a.xrayService.DeferRestarts(time.Duration(req.Minutes) * time.Minute)
+	if err != nil {
+		jsonMsg(c, "Failed to defer Xray restarts", err)
+		return
+	}
+	jsonMsgObj(c, fmt.Sprintf("Xray restarts deferred for %d minutes", req.Minutes), a.xrayService.GetDeferredRestartStatus(), nil)
+}
+
+// disableDeferredRestart ends the deferred restart window and applies a pending restart.
+func (a *ServerController) disableDeferredRestart(c *gin.Context) {
+	err := a.xrayService.EndRestartDeferral()
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "pages.xray.restartError"), err)
+		websocket.BroadcastXrayState("error", err.Error())
+		return
+	}
+	jsonMsgObj(c, "Xray restart deferral ended", a.xrayService.GetDeferredRestartStatus(), nil)
+}
+
+// applyDeferredRestart runs a pending restart now while keeping the deferred restart window open.
+func (a *ServerController) applyDeferredRestart(c *gin.Context) {
+	err := a.xrayService.ApplyDeferredRestart()
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "pages.xray.restartError"), err)
+		websocket.BroadcastXrayState("error", err.Error())
+		return
+	}
+	jsonMsgObj(c, "Pending Xray restart applied", a.xrayService.GetDeferredRestartStatus(), nil)
+}
+
 // getLogs retrieves the application logs based on count, level, and syslog filters.
 func (a *ServerController) getLogs(c *gin.Context) {
 	count := c.Param("count")
@@ -371,6 +423,12 @@ func (a *ServerController) getLogs(c *gin.Context) {
 	jsonObj(c, logs, nil)
 }
 
+// getCoreLogs retrieves the most recent lines of Xray output kept by the panel.
+func (a *ServerController) getCoreLogs(c *gin.Context) {
+	logs := a.serverService.GetCoreLogs(c.Param("count"))
+	jsonObj(c, logs, nil)
+}
+
 // getXrayLogs retrieves Xray logs with filtering options for direct, blocked, and proxy traffic.
 func (a *ServerController) getXrayLogs(c *gin.Context) {
 	count := c.Param("count")
@@ -417,9 +475,9 @@ func (a *ServerController) getXrayLogs(c *gin.Context) {
 	jsonObj(c, logs, nil)
 }
 
-// getConfigJson retrieves the Xray configuration as JSON.
+// getConfigJson retrieves the effective Xray configuration as JSON, optionally with secrets redacted.
 func (a *ServerController) getConfigJson(c *gin.Context) {
-	configJson, err := a.serverService.GetConfigJson()
+	configJson, err := a.serverService.GetConfigJson(c.Query("redact") == "true" || isReadOnly(c))
 	if err != nil {
 		jsonMsg(c, I18nWeb(c, "pages.index.getConfigError"), err)
 		return
@@ -549,3 +607,23 @@ func (a *ServerController) getMetrics(c *gin.Context) {
 	c.Header("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
 	c.String(http.StatusOK, metrics)
 }
+
+// getOrphanedMappings lists client/host inbound mappings that point to deleted rows.
+func (a *ServerController) getOrphanedMappings(c *gin.Context) {
+	orphans, err := a.serverService.GetOrphanedMappings()
+	if err != nil {
+		jsonMsg(c, "Failed to get orphaned mappings", err)
+		return
+	}
+	jsonObj(c, orphans, nil)
+}
+
+// pruneOrphanedMappings deletes client/host inbound mappings that point to deleted rows.
+func (a *ServerController) pruneOrphanedMappings(c *gin.Context) {
+	pruned, err := a.serverService.PruneOrphanedMappings()
+	if err != nil {
+		jsonMsg(c, "Failed to prune orphaned mappings", err)
+		return
+	}
+	jsonObj(c, pruned, nil)
+}
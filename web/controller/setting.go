@@ -2,14 +2,20 @@ package controller
 
 import (
 	"errors"
+	"fmt"
 	"net/http"
+	"strconv"
 	"time"
 
+	"github.com/konstpic/sharx-code/v2/database/model"
+	"github.com/konstpic/sharx-code/v2/logger"
 	"github.com/konstpic/sharx-code/v2/util/crypto"
 	"github.com/konstpic/sharx-code/v2/web/entity"
+	"github.com/konstpic/sharx-code/v2/web/job"
 	"github.com/konstpic/sharx-code/v2/web/service"
 	"github.com/konstpic/sharx-code/v2/web/session"
 
+	"github.com/gin-contrib/sessions"
 	"github.com/gin-gonic/gin"
 )
 
@@ -26,6 +32,8 @@ type SettingController struct {
 	settingService  service.SettingService
 	userService     service.UserService
 	panelService    service.PanelService
+	apiTokenService service.ApiTokenService
+	auditLogService service.AuditLogService
 }
 
 // NewSettingController creates a new SettingController and initializes its routes.
@@ -42,10 +50,23 @@ func (a *SettingController) initRouter(g *gin.RouterGroup) {
 	g.POST("/all", a.getAllSetting)
 	g.POST("/defaultSettings", a.getDefaultSettings)
 	g.POST("/update", a.updateSetting)
-	g.POST("/updateUser", a.updateUser)
+	g.POST("/updateUser", requireSession, a.updateUser)
 	g.POST("/restartPanel", a.restartPanel)
+	g.POST("/logoutAll", requireSession, a.logoutAll)
 	g.GET("/getDefaultJsonConfig", a.getDefaultXrayConfig)
 	g.GET("/grafana/dashboard", a.getGrafanaDashboard)
+	g.POST("/ldap/test", a.testLdapConnection)
+	g.POST("/ldap/dryRun", a.ldapSyncDryRun)
+	g.POST("/twoFactor/generate", requireSession, a.generateTwoFactorSecret)
+	g.POST("/twoFactor/enable", requireSession, a.enableTwoFactor)
+	g.POST("/apiTokens", requireSession, a.getApiTokens)
+	g.POST("/apiTokens/create", requireSession, a.createApiToken)
+	g.POST("/apiTokens/revoke/:id", requireSession, a.revokeApiToken)
+	g.POST("/users", requirePrimaryAdmin, a.getUsers)
+	g.POST("/users/add", requirePrimaryAdmin, a.addUser)
+	g.POST("/users/setRole/:id", requirePrimaryAdmin, a.setUserRole)
+	g.POST("/users/del/:id", requirePrimaryAdmin, a.delUser)
+	g.GET("/auditLog", a.getAuditLog)
 
 	// Initialize migration controller
 	NewMigrationController(g)
@@ -58,6 +79,11 @@ func (a *SettingController) getAllSetting(c *gin.Context) {
 		jsonMsg(c, I18nWeb(c, "pages.settings.toasts.getSettings"), err)
 		return
 	}
+	if isReadOnly(c) {
+		redacted := *allSetting
+		redacted.RedactSecrets()
+		allSetting = &redacted
+	}
 	jsonObj(c, allSetting, nil)
 }
 
@@ -79,7 +105,17 @@ func (a *SettingController) updateSetting(c *gin.Context) {
 		jsonMsg(c, I18nWeb(c, "pages.settings.toasts.modifySettings"), err)
 		return
 	}
+	// A setting read that failed would be audited as a change from or to empty settings
+	before, beforeErr := a.settingService.GetAllSetting()
 	err = a.settingService.UpdateAllSetting(allSetting)
+	if err == nil {
+		after, afterErr := a.settingService.GetAllSetting()
+		if beforeErr == nil && afterErr == nil {
+			setAuditChange(c, before, after)
+		} else {
+			logger.Warning("Unable to read settings for the audit log:", errors.Join(beforeErr, afterErr))
+		}
+	}
 	jsonMsg(c, I18nWeb(c, "pages.settings.toasts.modifySettings"), err)
 }
 
@@ -105,10 +141,29 @@ func (a *SettingController) updateUser(c *gin.Context) {
 		user.Username = form.NewUsername
 		user.Password, _ = crypto.HashPasswordAsBcrypt(form.NewPassword)
 		session.SetLoginUser(c, user)
+		// Log out every other session issued with the old credentials
+		if epoch, epochErr := a.settingService.BumpSessionEpoch(); epochErr == nil {
+			session.SetSessionEpoch(c, epoch)
+		}
+		if saveErr := sessions.Default(c).Save(); saveErr != nil {
+			logger.Warning("Unable to save session: ", saveErr)
+		}
 	}
 	jsonMsg(c, I18nWeb(c, "pages.settings.toasts.modifyUser"), err)
 }
 
+// logoutAll invalidates every login session, including the current one, by bumping the session epoch.
+func (a *SettingController) logoutAll(c *gin.Context) {
+	_, err := a.settingService.BumpSessionEpoch()
+	if err == nil {
+		session.ClearSession(c)
+		if saveErr := sessions.Default(c).Save(); saveErr != nil {
+			logger.Warning("Unable to save session after clearing:", saveErr)
+		}
+	}
+	jsonMsg(c, I18nWeb(c, "pages.settings.toasts.logoutAll"), err)
+}
+
 // restartPanel restarts the panel service after a delay.
 func (a *SettingController) restartPanel(c *gin.Context) {
 	err := a.panelService.RestartPanel(time.Second * 3)
@@ -136,3 +191,162 @@ func (a *SettingController) getGrafanaDashboard(c *gin.Context) {
 	c.Header("Content-Disposition", "attachment; filename=sharx-grafana-dashboard.json")
 	c.String(http.StatusOK, dashboardJSON)
 }
+
+// testLdapConnection checks the LDAP connection settings without saving them.
+func (a *SettingController) testLdapConnection(c *gin.Context) {
+	form := &entity.AllSetting{}
+	if err := c.ShouldBind(form); err != nil {
+		jsonMsg(c, "Invalid LDAP settings", err)
+		return
+	}
+	count, err := a.settingService.TestLdapConnection(form)
+	if err != nil {
+		jsonMsg(c, "LDAP connection failed", err)
+		return
+	}
+	jsonMsgObj(c, fmt.Sprintf("LDAP connection successful: %d entries matched", count), count, nil)
+}
+
+// ldapSyncDryRun previews the client changes the LDAP sync would make, using the saved settings.
+func (a *SettingController) ldapSyncDryRun(c *gin.Context) {
+	preview, err := job.NewLdapSyncJob().DryRun()
+	if err != nil {
+		jsonMsg(c, "LDAP sync dry run failed", err)
+		return
+	}
+	jsonObj(c, preview, nil)
+}
+
+// generateTwoFactorSecret creates and stores a new TOTP secret and returns it with its otpauth:// URI.
+func (a *SettingController) generateTwoFactorSecret(c *gin.Context) {
+	secret, uri, err := a.userService.GenerateTwoFactorSecret()
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "pages.settings.toasts.modifySettings"), err)
+		return
+	}
+	jsonObj(c, gin.H{"secret": secret, "uri": uri}, nil)
+}
+
+// enableTwoFactor verifies a TOTP code against the stored secret and enables two-factor authentication.
+func (a *SettingController) enableTwoFactor(c *gin.Context) {
+	err := a.userService.EnableTwoFactor(c.PostForm("code"))
+	jsonMsg(c, I18nWeb(c, "pages.settings.toasts.modifySettings"), err)
+}
+
+// getApiTokens lists the API tokens of the current user. Token values are never returned.
+func (a *SettingController) getApiTokens(c *gin.Context) {
+	user := session.GetLoginUser(c)
+	tokens, err := a.apiTokenService.GetTokens(user.Id)
+	if err != nil {
+		jsonMsg(c, "Failed to get API tokens", err)
+		return
+	}
+	jsonObj(c, tokens, nil)
+}
+
+// createApiToken creates an API token for the current user and returns its value once.
+func (a *SettingController) createApiToken(c *gin.Context) {
+	var req struct {
+		Name  string `json:"name" form:"name"`
+		Scope string `json:"scope" form:"scope"`
+	}
+	if err := c.ShouldBind(&req); err != nil {
+		jsonMsg(c, "Invalid request data", err)
+		return
+	}
+	user := session.GetLoginUser(c)
+	token, apiToken, err := a.apiTokenService.CreateToken(user.Id, req.Name, req.Scope)
+	if err != nil {
+		jsonMsg(c, "Failed to create API token", err)
+		return
+	}
+	jsonMsgObj(c, "API token created, copy it now: it will not be shown again", gin.H{"token": token, "apiToken": apiToken}, nil)
+}
+
+// revokeApiToken revokes an API token of the current user.
+func (a *SettingController) revokeApiToken(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		jsonMsg(c, "Invalid token id", err)
+		return
+	}
+	user := session.GetLoginUser(c)
+	err = a.apiTokenService.RevokeToken(user.Id, id)
+	jsonMsg(c, "API token revoked", err)
+}
+
+// getUsers lists the panel users with their roles.
+func (a *SettingController) getUsers(c *gin.Context) {
+	users, err := a.userService.GetUsers()
+	if err != nil {
+		jsonMsg(c, "Failed to get users", err)
+		return
+	}
+	jsonObj(c, users, nil)
+}
+
+// addUser creates a panel user with a role, e.g. a read-only account for support staff.
+func (a *SettingController) addUser(c *gin.Context) {
+	var req struct {
+		Username string `json:"username" form:"username"`
+		Password string `json:"password" form:"password"`
+		Role     string `json:"role" form:"role"`
+	}
+	if err := c.ShouldBind(&req); err != nil {
+		jsonMsg(c, "Invalid request data", err)
+		return
+	}
+	if req.Role == "" {
+		req.Role = model.UserRoleReadOnly
+	}
+	user, err := a.userService.CreateUser(req.Username, req.Password, req.Role)
+	if err != nil {
+		jsonMsg(c, "Failed to create user", err)
+		return
+	}
+	jsonMsgObj(c, "User created", user, nil)
+}
+
+// setUserRole changes the role of a user other than the primary admin.
+func (a *SettingController) setUserRole(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		jsonMsg(c, "Invalid user id", err)
+		return
+	}
+	var req struct {
+		Role string `json:"role" form:"role"`
+	}
+	if err := c.ShouldBind(&req); err != nil {
+		jsonMsg(c, "Invalid request data", err)
+		return
+	}
+	err = a.userService.UpdateUserRole(id, req.Role)
+	jsonMsg(c, "User role updated", err)
+}
+
+// delUser deletes a user other than the primary admin.
+func (a *SettingController) delUser(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		jsonMsg(c, "Invalid user id", err)
+		return
+	}
+	err = a.userService.DeleteUser(id)
+	jsonMsg(c, "User deleted", err)
+}
+
+// getAuditLog lists audit log entries, newest first, filtered by user, action and time range.
+func (a *SettingController) getAuditLog(c *gin.Context) {
+	var filter service.AuditLogFilter
+	if err := c.ShouldBindQuery(&filter); err != nil {
+		jsonMsg(c, "Invalid request data", err)
+		return
+	}
+	result, err := a.auditLogService.GetAuditLogs(filter)
+	if err != nil {
+		jsonMsg(c, "Failed to get audit log", err)
+		return
+	}
+	jsonObj(c, result, nil)
+}
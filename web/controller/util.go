@@ -1,16 +1,21 @@
 package controller
 
 import (
+	"errors"
 	"net"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/konstpic/sharx-code/v2/config"
 	"github.com/konstpic/sharx-code/v2/logger"
+	"github.com/konstpic/sharx-code/v2/util/common"
 	"github.com/konstpic/sharx-code/v2/web/entity"
 	"github.com/konstpic/sharx-code/v2/web/service"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 // getRemoteIp extracts the real IP address from the request headers or remote address.
@@ -52,12 +57,22 @@ func jsonMsgObj(c *gin.Context, msg string, obj any, err error) {
 	} else {
 		m.Success = false
 		m.Msg = msg + " (" + err.Error() + ")"
+		m.Code = string(errorCode(err))
 		logger.Infof("[DEBUG-AGENT] jsonMsgObj: ERROR response, path=%s, msg=%s, error=%v, errorType=%T", c.Request.URL.Path, msg, err, err)
 		logger.Warning(msg+" "+I18nWeb(c, "fail")+": ", err)
 	}
+	c.Set(auditSuccessKey, m.Success)
 	c.JSON(http.StatusOK, m)
 }
 
+// errorCode returns the API error code of err. Missing records are reported as NOT_FOUND.
+func errorCode(err error) common.ErrorCode {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return common.ErrCodeNotFound
+	}
+	return common.ErrorCodeOf(err)
+}
+
 // pureJsonMsg sends a pure JSON message response with custom status code.
 func pureJsonMsg(c *gin.Context, statusCode int, success bool, msg string) {
 	c.JSON(statusCode, entity.Msg{
@@ -114,3 +129,28 @@ func getContext(h gin.H) gin.H {
 func isAjax(c *gin.Context) bool {
 	return c.GetHeader("X-Requested-With") == "XMLHttpRequest"
 }
+
+// parseTrafficSeriesQuery reads the from and to (unix milliseconds, default the last 24 hours)
+// and bucket (seconds, default 3600) query parameters of a traffic series request.
+func parseTrafficSeriesQuery(c *gin.Context) (int64, int64, time.Duration, error) {
+	var err error
+	to := time.Now().UnixMilli()
+	if value := c.Query("to"); value != "" {
+		if to, err = strconv.ParseInt(value, 10, 64); err != nil {
+			return 0, 0, 0, err
+		}
+	}
+	from := to - (24 * time.Hour).Milliseconds()
+	if value := c.Query("from"); value != "" {
+		if from, err = strconv.ParseInt(value, 10, 64); err != nil {
+			return 0, 0, 0, err
+		}
+	}
+	bucket := 3600
+	if value := c.Query("bucket"); value != "" {
+		if bucket, err = strconv.Atoi(value); err != nil {
+			return 0, 0, 0, err
+		}
+	}
+	return from, to, time.Duration(bucket) * time.Second, nil
+}
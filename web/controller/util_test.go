@@ -0,0 +1,91 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/konstpic/sharx-code/v2/database/model"
+	"github.com/konstpic/sharx-code/v2/util/common"
+	"github.com/konstpic/sharx-code/v2/web/entity"
+	"github.com/konstpic/sharx-code/v2/web/session"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// respond runs jsonMsg with msg and err and decodes the response.
+func respond(t *testing.T, msg string, err error) entity.Msg {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/panel/api/inbounds/add", nil)
+	jsonMsg(c, msg, err)
+
+	var m entity.Msg
+	if err := json.Unmarshal(w.Body.Bytes(), &m); err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestJsonMsgErrorCode(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{"coded", common.NewCodedError(common.ErrCodeInboundTagExists, "tag already exists"), "INBOUND_TAG_EXISTS"},
+		{"wrapped", fmt.Errorf("add inbound: %w", common.NewCodedError(common.ErrCodeInvalidPort, "invalid port")), "INVALID_PORT"},
+		{"missing record", fmt.Errorf("get inbound: %w", gorm.ErrRecordNotFound), "NOT_FOUND"},
+		{"plain", common.NewError("something failed"), "UNKNOWN"},
+	}
+	for _, test := range tests {
+		m := respond(t, "add", test.err)
+		if m.Success || m.Code != test.want {
+			t.Errorf("%s: response = %+v, want a failure with code %s", test.name, m, test.want)
+		}
+	}
+}
+
+func TestJsonMsgSuccessHasNoCode(t *testing.T) {
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/panel/api/inbounds/add", nil)
+	jsonMsg(c, "added", nil)
+
+	var raw map[string]any
+	if err := json.Unmarshal(w.Body.Bytes(), &raw); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := raw["code"]; ok || raw["success"] != true {
+		t.Fatalf("response = %s, want a success without a code", w.Body.String())
+	}
+}
+
+func TestImportInboundTemplateInvalidPortCode(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	group := engine.Group("/panel/api/inbounds", func(c *gin.Context) {
+		session.SetRequestUser(c, &model.User{Id: 1, Username: "admin"})
+	})
+	NewInboundController(group)
+
+	body := `{"bundle":{"version":1,"protocol":"vless","settings":{}},"overrides":{"port":70000}}`
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/panel/api/inbounds/importTemplate", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	engine.ServeHTTP(w, req)
+
+	var m entity.Msg
+	if err := json.Unmarshal(w.Body.Bytes(), &m); err != nil {
+		t.Fatal(err)
+	}
+	if m.Success || m.Code != string(common.ErrCodeInvalidPort) {
+		t.Fatalf("response = %s, want a failure with code %s", w.Body.String(), common.ErrCodeInvalidPort)
+	}
+}
@@ -81,7 +81,8 @@ func NewWebSocketController(hub *websocket.Hub) *WebSocketController {
 // HandleWebSocket handles WebSocket connections
 func (w *WebSocketController) HandleWebSocket(c *gin.Context) {
 	// Check authentication
-	if !session.IsLogin(c) {
+	// Broadcasts carry unredacted inbounds and nodes, so read-only users are not connected
+	if !isLoggedIn(c) || authorizeUser(c, session.GetLoginUser(c)) != http.StatusOK {
 		logger.Warningf("Unauthorized WebSocket connection attempt from %s", getRemoteIp(c))
 		c.AbortWithStatus(http.StatusUnauthorized)
 		return
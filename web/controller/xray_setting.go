@@ -1,6 +1,8 @@
 package controller
 
 import (
+	"strings"
+
 	"github.com/konstpic/sharx-code/v2/web/service"
 
 	"github.com/gin-gonic/gin"
@@ -32,6 +34,8 @@ func (a *XraySettingController) initRouter(g *gin.RouterGroup) {
 
 	g.POST("/", a.getXraySetting)
 	g.POST("/getFullConfig", a.getFullXrayConfig)
+	g.POST("/checkConfig", a.checkXrayConfig)
+	g.POST("/explainRoute", a.explainRoute)
 	g.POST("/warp/:action", a.warp)
 	g.POST("/update", a.updateSetting)
 	g.POST("/resetToDefault", a.resetToDefault)
@@ -93,6 +97,27 @@ func (a *XraySettingController) getFullXrayConfig(c *gin.Context) {
 	jsonObj(c, xrayConfig, nil)
 }
 
+// checkXrayConfig validates the current template and inbounds with the Xray binary
+// without restarting the core and returns the check output.
+func (a *XraySettingController) checkXrayConfig(c *gin.Context) {
+	output, err := a.XrayService.ValidateCurrentConfig()
+	if err != nil {
+		jsonMsgObj(c, I18nWeb(c, "pages.settings.toasts.checkXrayConfigError"), output, err)
+		return
+	}
+	jsonObj(c, output, nil)
+}
+
+// explainRoute reports which routing rule and outbound the template would pick for a domain or IP.
+func (a *XraySettingController) explainRoute(c *gin.Context) {
+	explanation, err := a.XrayService.ExplainRoute(c.PostForm("target"))
+	if err != nil {
+		jsonMsg(c, I18nWeb(c, "pages.settings.toasts.getSettings"), err)
+		return
+	}
+	jsonObj(c, explanation, nil)
+}
+
 // warp handles Warp-related operations based on the action parameter.
 func (a *XraySettingController) warp(c *gin.Context) {
 	action := c.Param("action")
@@ -109,9 +134,27 @@ func (a *XraySettingController) warp(c *gin.Context) {
 		skey := c.PostForm("privateKey")
 		pkey := c.PostForm("publicKey")
 		resp, err = a.WarpService.RegWarp(skey, pkey)
+	case "register":
+		resp, err = a.WarpService.Register(strings.TrimSpace(c.PostForm("license")))
 	case "license":
 		license := c.PostForm("license")
 		resp, err = a.WarpService.SetWarpLicense(license)
+	case "enable":
+		var domains []string
+		for _, d := range strings.Split(c.PostForm("domains"), ",") {
+			if d = strings.TrimSpace(d); d != "" {
+				domains = append(domains, d)
+			}
+		}
+		err = a.WarpService.EnableWarp(domains)
+		if err == nil {
+			a.XrayService.SetToNeedRestart()
+		}
+	case "disable":
+		err = a.WarpService.DisableWarp()
+		if err == nil {
+			a.XrayService.SetToNeedRestart()
+		}
 	}
 
 	jsonObj(c, resp, err)
@@ -23,7 +23,7 @@ func NewXUIController(g *gin.RouterGroup) *XUIController {
 // initRouter sets up the main panel routes and initializes sub-controllers.
 func (a *XUIController) initRouter(g *gin.RouterGroup) {
 	g = g.Group("/panel")
-	g.Use(a.checkLogin)
+	g.Use(a.checkLogin, auditMutations)
 
 	g.GET("/", a.index)
 	g.GET("/inbounds", a.inbounds)
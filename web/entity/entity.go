@@ -5,6 +5,7 @@ import (
 	"crypto/tls"
 	"math"
 	"net"
+	"regexp"
 	"strings"
 	"time"
 
@@ -13,9 +14,10 @@ import (
 
 // Msg represents a standard API response message with success status, message text, and optional data object.
 type Msg struct {
-	Success bool   `json:"success"` // Indicates if the operation was successful
-	Msg     string `json:"msg"`     // Response message text
-	Obj     any    `json:"obj"`     // Optional data object
+	Success bool   `json:"success"`        // Indicates if the operation was successful
+	Msg     string `json:"msg"`            // Response message text
+	Obj     any    `json:"obj"`            // Optional data object
+	Code    string `json:"code,omitempty"` // Machine-readable error code of a failed operation (see common.ErrorCode)
 }
 
 // AllSetting contains all configuration settings for the SharX panel including web server, Telegram bot, and subscription settings.
@@ -37,21 +39,24 @@ type AllSetting struct {
 	Datepicker  string `json:"datepicker" form:"datepicker"`   // Date picker format
 
 	// Telegram bot settings
-	TgBotEnable      bool   `json:"tgBotEnable" form:"tgBotEnable"`           // Enable Telegram bot notifications
-	TgBotToken       string `json:"tgBotToken" form:"tgBotToken"`             // Telegram bot token
-	TgBotProxy       string `json:"tgBotProxy" form:"tgBotProxy"`             // Proxy URL for Telegram bot
-	TgBotAPIServer   string `json:"tgBotAPIServer" form:"tgBotAPIServer"`     // Custom API server for Telegram bot
-	TgBotChatId      string `json:"tgBotChatId" form:"tgBotChatId"`           // Telegram chat ID for notifications
-	TgRunTime        string `json:"tgRunTime" form:"tgRunTime"`               // Cron schedule for Telegram notifications
-	TgBotBackup      bool   `json:"tgBotBackup" form:"tgBotBackup"`           // Enable database backup via Telegram
-	TgBotLoginNotify bool   `json:"tgBotLoginNotify" form:"tgBotLoginNotify"` // Send login notifications
-	TgCpu            int    `json:"tgCpu" form:"tgCpu"`                       // CPU usage threshold for alerts
-	TgLang           string `json:"tgLang" form:"tgLang"`                     // Telegram bot language
+	TgBotEnable          bool   `json:"tgBotEnable" form:"tgBotEnable"`                   // Enable Telegram bot notifications
+	TgBotToken           string `json:"tgBotToken" form:"tgBotToken"`                     // Telegram bot token
+	TgBotProxy           string `json:"tgBotProxy" form:"tgBotProxy"`                     // Proxy URL for Telegram bot
+	TgBotAPIServer       string `json:"tgBotAPIServer" form:"tgBotAPIServer"`             // Custom API server for Telegram bot
+	TgBotChatId          string `json:"tgBotChatId" form:"tgBotChatId"`                   // Telegram chat ID for notifications
+	TgRunTime            string `json:"tgRunTime" form:"tgRunTime"`                       // Cron schedule for Telegram notifications
+	TgBotBackup          bool   `json:"tgBotBackup" form:"tgBotBackup"`                   // Enable database backup via Telegram
+	TgBotLoginNotify     bool   `json:"tgBotLoginNotify" form:"tgBotLoginNotify"`         // Send login notifications
+	TgCpu                int    `json:"tgCpu" form:"tgCpu"`                               // CPU usage threshold for alerts
+	TgLang               string `json:"tgLang" form:"tgLang"`                             // Telegram bot language
+	TgExpiringDigestDays int    `json:"tgExpiringDigestDays" form:"tgExpiringDigestDays"` // Daily digest of clients expiring within N days (0 = disabled)
 
 	// Security settings
-	TimeLocation    string `json:"timeLocation" form:"timeLocation"`       // Time zone location
-	TwoFactorEnable bool   `json:"twoFactorEnable" form:"twoFactorEnable"` // Enable two-factor authentication
-	TwoFactorToken  string `json:"twoFactorToken" form:"twoFactorToken"`   // Two-factor authentication token
+	TimeLocation        string `json:"timeLocation" form:"timeLocation"`               // Time zone location
+	TwoFactorEnable     bool   `json:"twoFactorEnable" form:"twoFactorEnable"`         // Enable two-factor authentication
+	TwoFactorToken      string `json:"twoFactorToken" form:"twoFactorToken"`           // Two-factor authentication token
+	LoginMaxAttempts    int    `json:"loginMaxAttempts" form:"loginMaxAttempts"`       // Failed logins before lockout (0 = disabled)
+	LoginLockoutMinutes int    `json:"loginLockoutMinutes" form:"loginLockoutMinutes"` // Lockout duration after too many failed logins
 
 	// Subscription server settings
 	SubEnable                   bool   `json:"subEnable" form:"subEnable"`                                     // Enable subscription server
@@ -66,6 +71,7 @@ type AllSetting struct {
 	SubUpdates                  int    `json:"subUpdates" form:"subUpdates"`                                   // Subscription update interval in minutes
 	ExternalTrafficInformEnable bool   `json:"externalTrafficInformEnable" form:"externalTrafficInformEnable"` // Enable external traffic reporting
 	ExternalTrafficInformURI    string `json:"externalTrafficInformURI" form:"externalTrafficInformURI"`       // URI for external traffic reporting
+	ExternalTrafficInformSecret string `json:"externalTrafficInformSecret" form:"externalTrafficInformSecret"` // HMAC key for signing external traffic reports
 	SubEncrypt                  bool   `json:"subEncrypt" form:"subEncrypt"`                                   // Encrypt subscription responses
 	SubShowInfo                 bool   `json:"subShowInfo" form:"subShowInfo"`                                 // Show client information in subscriptions
 	SubURI                      string `json:"subURI" form:"subURI"`                                           // Subscription server URI
@@ -112,7 +118,8 @@ type AllSetting struct {
 	LdapDefaultLimitIP    int    `json:"ldapDefaultLimitIP" form:"ldapDefaultLimitIP"`
 	
 	// Multi-node mode setting
-	MultiNodeMode bool `json:"multiNodeMode" form:"multiNodeMode"` // Enable multi-node architecture mode
+	MultiNodeMode       bool `json:"multiNodeMode" form:"multiNodeMode"`             // Enable multi-node architecture mode
+	NodePushConcurrency int  `json:"nodePushConcurrency" form:"nodePushConcurrency"` // Max nodes receiving a config push at the same time (0 = default of 10)
 	
 	// HWID tracking mode
 	// "off" = HWID tracking disabled
@@ -128,15 +135,42 @@ type AllSetting struct {
 	// Panel log level setting (overrides XUI_LOG_LEVEL env var)
 	// Valid values: "debug", "info", "notice", "warning", "error"
 	PanelLogLevel string `json:"panelLogLevel" form:"panelLogLevel"` // Panel log level (default: "info")
+
+	// Default sniffing JSON applied to new inbounds created without sniffing (empty = no default)
+	DefaultSniffing string `json:"defaultSniffing" form:"defaultSniffing"`
+
+	// Explicit Xray binary path (empty = XUI_XRAY_BIN or bin folder discovery)
+	XrayBinaryPath string `json:"xrayBinaryPath" form:"xrayBinaryPath"`
+	// Core log level override for the live config (empty = keep the template's log level)
+	CoreLogLevel string `json:"coreLogLevel" form:"coreLogLevel"`
+	// Port of the local Xray API inbound (0 = keep the template's port)
+	CoreApiPort int `json:"coreApiPort" form:"coreApiPort"`
+	// Days of per-inbound and per-client traffic history kept for charts (0 = disabled)
+	TrafficHistoryDays int `json:"trafficHistoryDays" form:"trafficHistoryDays"`
+	// Seconds without traffic after which a client is shown offline (0 = offline on the first idle check)
+	ClientOfflineTimeout int `json:"clientOfflineTimeout" form:"clientOfflineTimeout"`
 	// JSON subscription routing rules
 }
 
+// RedactSecrets clears the settings that hold credentials: the Telegram bot token and proxy,
+// the two-factor secret, the LDAP password and the traffic report signing key.
+func (s *AllSetting) RedactSecrets() {
+	s.TgBotToken = ""
+	s.TgBotProxy = ""
+	s.TwoFactorToken = ""
+	s.LdapPassword = ""
+	s.ExternalTrafficInformSecret = ""
+}
+
 // CheckValid validates all settings in the AllSetting struct, checking IP addresses, ports, SSL certificates, and other configuration values.
 func (s *AllSetting) CheckValid() error {
 	// WebListen is now env-only setting, only validate if set
 	if s.WebListen != "" {
-		ip := net.ParseIP(s.WebListen)
-		if ip == nil {
+		if path, ok := UnixSocketPath(s.WebListen); ok {
+			if path == "" {
+				return common.NewError("web listen unix socket path is empty:", s.WebListen)
+			}
+		} else if ip := net.ParseIP(s.WebListen); ip == nil {
 			return common.NewError("web listen is not valid ip:", s.WebListen)
 		}
 	}
@@ -187,12 +221,11 @@ func (s *AllSetting) CheckValid() error {
 
 	// WebBasePath is now env-only setting, only validate if set
 	if s.WebBasePath != "" {
-		if !strings.HasPrefix(s.WebBasePath, "/") {
-			s.WebBasePath = "/" + s.WebBasePath
-		}
-		if !strings.HasSuffix(s.WebBasePath, "/") {
-			s.WebBasePath += "/"
+		basePath, err := NormalizeBasePath(s.WebBasePath)
+		if err != nil {
+			return err
 		}
+		s.WebBasePath = basePath
 	}
 	if !strings.HasPrefix(s.SubPath, "/") {
 		s.SubPath = "/" + s.SubPath
@@ -213,6 +246,31 @@ func (s *AllSetting) CheckValid() error {
 		return common.NewError("time location not exist:", s.TimeLocation)
 	}
 
+	if s.LoginMaxAttempts < 0 {
+		return common.NewError("login max attempts can not be negative:", s.LoginMaxAttempts)
+	}
+	if s.LoginMaxAttempts > 0 && s.LoginLockoutMinutes <= 0 {
+		return common.NewError("login lockout minutes must be positive:", s.LoginLockoutMinutes)
+	}
+	if s.CoreApiPort < 0 || s.CoreApiPort > math.MaxUint16 {
+		return common.NewError("core API port is not a valid port:", s.CoreApiPort)
+	}
+	if s.CoreApiPort > 0 && (s.CoreApiPort == s.WebPort || s.CoreApiPort == s.SubPort) {
+		return common.NewError("core API port conflicts with the web or subscription port:", s.CoreApiPort)
+	}
+	if s.TrafficHistoryDays < 0 {
+		return common.NewError("traffic history days can not be negative:", s.TrafficHistoryDays)
+	}
+	if s.ClientOfflineTimeout < 0 {
+		return common.NewError("client offline timeout can not be negative:", s.ClientOfflineTimeout)
+	}
+	if s.NodePushConcurrency < 0 {
+		return common.NewError("node push concurrency can not be negative:", s.NodePushConcurrency)
+	}
+	if s.TgExpiringDigestDays < 0 {
+		return common.NewError("expiring clients digest days can not be negative:", s.TgExpiringDigestDays)
+	}
+
 	// Validate HWID mode
 	validHwidModes := map[string]bool{
 		"off":                true,
@@ -295,3 +353,45 @@ type SubscriptionHeaders struct {
 	// V2RayTun specific headers
 	UpdateAlways string `json:"updateAlways,omitempty"` // Force update on every app open (true)
 }
+
+// unixSocketPrefix marks a web listen address that is a Unix domain socket path, e.g. "unix:/run/sharx.sock".
+const unixSocketPrefix = "unix:"
+
+// UnixSocketPath returns the socket path of a web listen address of the form "unix:<path>",
+// and whether listen has that form.
+func UnixSocketPath(listen string) (string, bool) {
+	if !strings.HasPrefix(listen, unixSocketPrefix) {
+		return "", false
+	}
+	return strings.TrimPrefix(listen, unixSocketPrefix), true
+}
+
+// basePathSegmentRe matches a segment of the web base path: unreserved URL characters only.
+var basePathSegmentRe = regexp.MustCompile(`^[A-Za-z0-9._~-]+$`)
+
+// NormalizeBasePath validates a web base path and returns it with a leading and trailing slash
+// and repeated slashes collapsed. Paths with a scheme, a leading "//" (which browsers treat as
+// another host), "." or ".." segments, or characters other than unreserved URL characters are rejected.
+func NormalizeBasePath(basePath string) (string, error) {
+	basePath = strings.TrimSpace(basePath)
+	if strings.Contains(basePath, "://") || strings.HasPrefix(basePath, "//") || strings.Contains(basePath, "\\") {
+		return "", common.NewErrorf("invalid base path %q: must be a path, not a URL", basePath)
+	}
+	segments := make([]string, 0)
+	for _, segment := range strings.Split(basePath, "/") {
+		if segment == "" {
+			continue
+		}
+		if segment == "." || segment == ".." {
+			return "", common.NewErrorf("invalid base path %q: %q segments are not allowed", basePath, segment)
+		}
+		if !basePathSegmentRe.MatchString(segment) {
+			return "", common.NewErrorf("invalid base path %q: only letters, digits and -._~ are allowed in %q", basePath, segment)
+		}
+		segments = append(segments, segment)
+	}
+	if len(segments) == 0 {
+		return "/", nil
+	}
+	return "/" + strings.Join(segments, "/") + "/", nil
+}
@@ -0,0 +1,23 @@
+package job
+
+import (
+	"github.com/konstpic/sharx-code/v2/logger"
+	"github.com/konstpic/sharx-code/v2/web/service"
+)
+
+// AuditLogPruneJob deletes audit log entries past their retention.
+type AuditLogPruneJob struct {
+	auditLogService service.AuditLogService
+}
+
+// NewAuditLogPruneJob creates a new AuditLogPruneJob instance.
+func NewAuditLogPruneJob() *AuditLogPruneJob {
+	return &AuditLogPruneJob{}
+}
+
+// Run deletes expired audit log entries.
+func (j *AuditLogPruneJob) Run() {
+	if err := j.auditLogService.PruneAuditLogs(); err != nil {
+		logger.Warningf("Failed to prune audit log: %v", err)
+	}
+}
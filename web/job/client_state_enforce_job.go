@@ -0,0 +1,32 @@
+package job
+
+import (
+	"github.com/konstpic/sharx-code/v2/logger"
+	"github.com/konstpic/sharx-code/v2/web/service"
+)
+
+// ClientStateEnforceJob keeps the users of the running Xray in line with client state:
+// expired or disabled clients are removed and renewed clients are re-added over the API,
+// so status changes take effect without restarting the core.
+type ClientStateEnforceJob struct {
+	clientService service.ClientService
+	xrayService   service.XrayService
+}
+
+// NewClientStateEnforceJob creates a new client state enforcement job.
+func NewClientStateEnforceJob() *ClientStateEnforceJob {
+	return new(ClientStateEnforceJob)
+}
+
+// Run applies the differences between the desired and the running users, falling back to
+// a restart only when the API could not apply one of them.
+func (j *ClientStateEnforceJob) Run() {
+	needRestart, err := j.clientService.EnforceClientStates()
+	if err != nil {
+		logger.Debug("Failed to enforce client states:", err)
+		return
+	}
+	if needRestart {
+		j.xrayService.SetToNeedRestart()
+	}
+}
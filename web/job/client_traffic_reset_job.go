@@ -0,0 +1,75 @@
+package job
+
+import (
+	"time"
+
+	"github.com/konstpic/sharx-code/v2/logger"
+	"github.com/konstpic/sharx-code/v2/web/service"
+)
+
+// ClientTrafficResetJob resets client traffic based on the per-client reset period (ClientEntity.Reset, in days).
+// It only works on ClientEntity counters; the inbound-level reset (PeriodicTrafficResetJob) resets
+// inbound and client_traffics counters, so a client is never reset twice for the same period.
+type ClientTrafficResetJob struct {
+	clientService service.ClientService
+	xrayService   service.XrayService
+}
+
+// NewClientTrafficResetJob creates a new per-client traffic reset job.
+func NewClientTrafficResetJob() *ClientTrafficResetJob {
+	return new(ClientTrafficResetJob)
+}
+
+// isClientResetDue reports whether a client with a reset period of resetDays,
+// last reset at lastReset (unix milliseconds), must be reset at now.
+func isClientResetDue(resetDays int, lastReset int64, now time.Time) bool {
+	if resetDays <= 0 {
+		return false
+	}
+	next := time.UnixMilli(lastReset).AddDate(0, 0, resetDays)
+	return !now.Before(next)
+}
+
+// Run resets traffic for all clients whose reset period has elapsed since their last reset.
+func (j *ClientTrafficResetJob) Run() {
+	clients, err := j.clientService.GetClientsWithResetSchedule()
+	if err != nil {
+		logger.Warning("Failed to get clients for traffic reset:", err)
+		return
+	}
+
+	now := time.Now()
+	resetCount := 0
+	needRestart := false
+
+	for _, client := range clients {
+		if client.LastTrafficResetTime == 0 {
+			// Never reset before: start counting the period from now instead of wiping current usage
+			if err := j.clientService.SetClientLastTrafficResetTime(client.Id, now.UnixMilli()); err != nil {
+				logger.Warning("Failed to initialize traffic reset time for client", client.Email, ":", err)
+			}
+			continue
+		}
+		if !isClientResetDue(client.Reset, client.LastTrafficResetTime, now) {
+			continue
+		}
+
+		// Zeroes usage, re-activates clients expired by traffic and updates lastTrafficResetTime
+		clientNeedRestart, err := j.clientService.ResetClientTraffic(client.UserId, client.Id)
+		if err != nil {
+			logger.Warning("Failed to reset traffic for client", client.Email, ":", err)
+			continue
+		}
+		if clientNeedRestart {
+			needRestart = true
+		}
+		resetCount++
+	}
+
+	if needRestart {
+		j.xrayService.SetToNeedRestart()
+	}
+	if resetCount > 0 {
+		logger.Infof("Client traffic reset completed: %d clients reset", resetCount)
+	}
+}
@@ -0,0 +1,38 @@
+package job
+
+import (
+	"testing"
+	"time"
+)
+
+func TestIsClientResetDueAcrossBoundary(t *testing.T) {
+	lastReset := time.Date(2026, time.January, 10, 12, 0, 0, 0, time.Local)
+	boundary := lastReset.AddDate(0, 0, 30)
+
+	tests := []struct {
+		name string
+		now  time.Time
+		want bool
+	}{
+		{"same day", lastReset.Add(time.Hour), false},
+		{"day 29", lastReset.AddDate(0, 0, 29), false},
+		{"just before the boundary", boundary.Add(-time.Second), false},
+		{"at the boundary", boundary, true},
+		{"after the boundary", boundary.Add(time.Hour), true},
+		{"missed period", boundary.AddDate(0, 0, 45), true},
+	}
+	for _, test := range tests {
+		if got := isClientResetDue(30, lastReset.UnixMilli(), test.now); got != test.want {
+			t.Errorf("%s: isClientResetDue(30) at %v = %v, want %v", test.name, test.now, got, test.want)
+		}
+	}
+}
+
+func TestIsClientResetDueWithoutSchedule(t *testing.T) {
+	lastReset := time.Date(2025, time.January, 1, 0, 0, 0, 0, time.Local).UnixMilli()
+	for _, resetDays := range []int{0, -1} {
+		if isClientResetDue(resetDays, lastReset, time.Now()) {
+			t.Errorf("isClientResetDue(%d) = true, want false", resetDays)
+		}
+	}
+}
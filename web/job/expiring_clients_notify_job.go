@@ -0,0 +1,20 @@
+package job
+
+import (
+	"github.com/konstpic/sharx-code/v2/web/service"
+)
+
+// ExpiringClientsNotifyJob sends the daily digest of clients about to expire via Telegram bot.
+type ExpiringClientsNotifyJob struct {
+	tgbotService service.Tgbot
+}
+
+// NewExpiringClientsNotifyJob creates a new expiring clients digest job instance.
+func NewExpiringClientsNotifyJob() *ExpiringClientsNotifyJob {
+	return new(ExpiringClientsNotifyJob)
+}
+
+// Run sends the expiring clients digest to the Telegram bot admins.
+func (j *ExpiringClientsNotifyJob) Run() {
+	j.tgbotService.SendExpiringDigest()
+}
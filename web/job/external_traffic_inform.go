@@ -0,0 +1,230 @@
+package job
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/konstpic/sharx-code/v2/database/model"
+	"github.com/konstpic/sharx-code/v2/logger"
+	"github.com/konstpic/sharx-code/v2/web/service"
+	"github.com/konstpic/sharx-code/v2/xray"
+
+	"github.com/valyala/fasthttp"
+)
+
+const (
+	// trafficInformQueueSize is the number of batches kept while the receiver is slow or down.
+	trafficInformQueueSize = 60
+	// trafficInformMaxAttempts is the number of delivery attempts per batch.
+	trafficInformMaxAttempts = 4
+	// trafficInformTimeout bounds a single delivery attempt.
+	trafficInformTimeout = 10 * time.Second
+	// trafficInformSignatureHeader carries "sha256=<hex HMAC-SHA256 of the body>" keyed with
+	// externalTrafficInformSecret. It is left out when no secret is set.
+	trafficInformSignatureHeader = "X-SharX-Signature"
+	// trafficInformTimestampHeader carries the batch timestamp (unix milliseconds), also part of the body.
+	trafficInformTimestampHeader = "X-SharX-Timestamp"
+)
+
+// trafficInformBackoff is the delay before the first retry; it doubles after each failed attempt.
+var trafficInformBackoff = time.Second
+
+// TrafficEvent is the traffic of one client during one collection cycle.
+type TrafficEvent struct {
+	Email     string `json:"email"`
+	Up        int64  `json:"up"`
+	Down      int64  `json:"down"`
+	Timestamp int64  `json:"timestamp"`
+}
+
+// OutboundTrafficDelta is the traffic of one outbound during one collection cycle,
+// along with its accumulated totals.
+type OutboundTrafficDelta struct {
+	Tag       string `json:"tag"`
+	Up        int64  `json:"up"`
+	Down      int64  `json:"down"`
+	TotalUp   int64  `json:"totalUp"`
+	TotalDown int64  `json:"totalDown"`
+}
+
+// trafficInformBatch is the body posted to externalTrafficInformURI once per collection cycle.
+// clientTraffics and inboundTraffics are kept for receivers written against the previous payload.
+type trafficInformBatch struct {
+	Timestamp        int64                  `json:"timestamp"`
+	Events           []TrafficEvent         `json:"events"`
+	OutboundTraffics []OutboundTrafficDelta `json:"outboundTraffics"`
+	ClientTraffics   []*xray.ClientTraffic  `json:"clientTraffics"`
+	InboundTraffics  []*xray.Traffic        `json:"inboundTraffics"`
+}
+
+// queuedTrafficInform is a marshaled batch waiting for delivery.
+type queuedTrafficInform struct {
+	body      []byte
+	timestamp int64
+}
+
+var (
+	trafficInformQueue     chan queuedTrafficInform
+	trafficInformQueueOnce sync.Once
+)
+
+// signTrafficInform returns the signature header value for body.
+func signTrafficInform(secret []byte, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// buildOutboundTrafficDeltas collects the outbound traffic of one cycle, joined with the
+// accumulated totals from outboundTotals. Outbounds that did not move are left out.
+func buildOutboundTrafficDeltas(traffics []*xray.Traffic, outboundTotals []*model.OutboundTraffics) []OutboundTrafficDelta {
+	totals := make(map[string]*model.OutboundTraffics, len(outboundTotals))
+	for _, total := range outboundTotals {
+		if total != nil {
+			totals[total.Tag] = total
+		}
+	}
+	deltas := make([]OutboundTrafficDelta, 0)
+	for _, traffic := range traffics {
+		if traffic == nil || !traffic.IsOutbound || (traffic.Up == 0 && traffic.Down == 0) {
+			continue
+		}
+		delta := OutboundTrafficDelta{Tag: traffic.Tag, Up: traffic.Up, Down: traffic.Down}
+		if total, ok := totals[traffic.Tag]; ok {
+			delta.TotalUp = total.Up
+			delta.TotalDown = total.Down
+		}
+		deltas = append(deltas, delta)
+	}
+	return deltas
+}
+
+// buildTrafficInformBatch turns the traffic of one cycle into a batch.
+// It returns nil when nothing moved, so idle cycles are not posted.
+func buildTrafficInformBatch(inboundTraffics []*xray.Traffic, clientTraffics []*xray.ClientTraffic, outboundTotals []*model.OutboundTraffics, now time.Time) *trafficInformBatch {
+	ts := now.UnixMilli()
+	events := make([]TrafficEvent, 0, len(clientTraffics))
+	for _, traffic := range clientTraffics {
+		if traffic == nil || (traffic.Up == 0 && traffic.Down == 0) {
+			continue
+		}
+		events = append(events, TrafficEvent{Email: traffic.Email, Up: traffic.Up, Down: traffic.Down, Timestamp: ts})
+	}
+	inboundMoved := false
+	for _, traffic := range inboundTraffics {
+		if traffic != nil && (traffic.Up != 0 || traffic.Down != 0) {
+			inboundMoved = true
+			break
+		}
+	}
+	outboundTraffics := buildOutboundTrafficDeltas(inboundTraffics, outboundTotals)
+	if len(events) == 0 && !inboundMoved && len(outboundTraffics) == 0 {
+		return nil
+	}
+	return &trafficInformBatch{
+		Timestamp:        ts,
+		Events:           events,
+		OutboundTraffics: outboundTraffics,
+		ClientTraffics:   clientTraffics,
+		InboundTraffics:  inboundTraffics,
+	}
+}
+
+// postTrafficInform delivers body once and fails on transport errors and non-2xx responses.
+func postTrafficInform(informURL string, body []byte, signature string, timestamp string) error {
+	request := fasthttp.AcquireRequest()
+	defer fasthttp.ReleaseRequest(request)
+	request.Header.SetMethod("POST")
+	request.Header.SetContentType("application/json; charset=UTF-8")
+	if signature != "" {
+		request.Header.Set(trafficInformSignatureHeader, signature)
+	}
+	request.Header.Set(trafficInformTimestampHeader, timestamp)
+	request.SetBody(body)
+	request.SetRequestURI(informURL)
+	response := fasthttp.AcquireResponse()
+	defer fasthttp.ReleaseResponse(response)
+	if err := fasthttp.DoTimeout(request, response, trafficInformTimeout); err != nil {
+		return err
+	}
+	if code := response.StatusCode(); code < 200 || code >= 300 {
+		return fmt.Errorf("unexpected status code %d", code)
+	}
+	return nil
+}
+
+// deliverTrafficInform posts body with retries and exponential backoff.
+func deliverTrafficInform(informURL string, body []byte, signature string, timestamp string) error {
+	backoff := trafficInformBackoff
+	var err error
+	for attempt := 1; attempt <= trafficInformMaxAttempts; attempt++ {
+		if err = postTrafficInform(informURL, body, signature, timestamp); err == nil {
+			return nil
+		}
+		if attempt < trafficInformMaxAttempts {
+			logger.Debugf("POST ExternalTrafficInformURI attempt %d failed: %v, retrying in %v", attempt, err, backoff)
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+	}
+	return err
+}
+
+// runTrafficInformWorker delivers queued batches one at a time, so a slow receiver never
+// gets concurrent or out-of-order posts.
+func runTrafficInformWorker(settingService service.SettingService) {
+	for item := range trafficInformQueue {
+		informURL, err := settingService.GetExternalTrafficInformURI()
+		if err != nil || informURL == "" {
+			continue
+		}
+		secret, err := settingService.GetExternalTrafficInformSecret()
+		if err != nil {
+			logger.Warning("get secret for ExternalTrafficInformURI failed:", err)
+			continue
+		}
+		signature := ""
+		if secret != "" {
+			signature = signTrafficInform([]byte(secret), item.body)
+		}
+		timestamp := strconv.FormatInt(item.timestamp, 10)
+		if err := deliverTrafficInform(informURL, item.body, signature, timestamp); err != nil {
+			logger.Warning("POST ExternalTrafficInformURI failed:", err)
+		}
+	}
+}
+
+// enqueueTrafficInform queues one cycle of traffic for delivery to externalTrafficInformURI.
+// When the queue is full (the receiver has been failing for a while) the batch is dropped.
+func (j *XrayTrafficJob) enqueueTrafficInform(inboundTraffics []*xray.Traffic, clientTraffics []*xray.ClientTraffic) {
+	// Totals are read after OutboundService.AddTraffic, so they include this cycle
+	outboundTotals, err := j.outboundService.GetOutboundsTraffic()
+	if err != nil {
+		logger.Warning("get outbound traffic for ExternalTrafficInformURI failed:", err)
+	}
+	batch := buildTrafficInformBatch(inboundTraffics, clientTraffics, outboundTotals, time.Now())
+	if batch == nil {
+		return
+	}
+	body, err := json.Marshal(batch)
+	if err != nil {
+		logger.Warning("parse client/inbound traffic failed:", err)
+		return
+	}
+
+	trafficInformQueueOnce.Do(func() {
+		trafficInformQueue = make(chan queuedTrafficInform, trafficInformQueueSize)
+		go runTrafficInformWorker(j.settingService)
+	})
+	select {
+	case trafficInformQueue <- queuedTrafficInform{body: body, timestamp: batch.Timestamp}:
+	default:
+		logger.Warning("ExternalTrafficInformURI queue is full, dropping traffic batch")
+	}
+}
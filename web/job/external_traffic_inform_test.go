@@ -0,0 +1,161 @@
+package job
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/konstpic/sharx-code/v2/database/model"
+	"github.com/konstpic/sharx-code/v2/xray"
+)
+
+// useFastTrafficInformBackoff shortens the retry backoff for the rest of the test.
+func useFastTrafficInformBackoff(t *testing.T) {
+	previous := trafficInformBackoff
+	trafficInformBackoff = time.Millisecond
+	t.Cleanup(func() { trafficInformBackoff = previous })
+}
+
+// verifyTrafficInformSignature checks a signature header the way a receiver would.
+func verifyTrafficInformSignature(secret []byte, body []byte, header string) bool {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return hmac.Equal([]byte(header), []byte("sha256="+hex.EncodeToString(mac.Sum(nil))))
+}
+
+func TestSignTrafficInform(t *testing.T) {
+	secret := []byte("receiver-secret")
+	body := []byte(`{"timestamp":1767225600000,"events":[]}`)
+
+	signature := signTrafficInform(secret, body)
+	if !verifyTrafficInformSignature(secret, body, signature) {
+		t.Fatalf("signature %q does not verify", signature)
+	}
+	if verifyTrafficInformSignature([]byte("other-secret"), body, signature) {
+		t.Fatal("signature verifies with another secret")
+	}
+	if verifyTrafficInformSignature(secret, append(body, ' '), signature) {
+		t.Fatal("signature verifies for a modified body")
+	}
+}
+
+func TestDeliverTrafficInformRetriesFlakyReceiver(t *testing.T) {
+	useFastTrafficInformBackoff(t)
+	secret := []byte("receiver-secret")
+	body := []byte(`{"timestamp":1767225600000,"events":[{"email":"a@example.com","up":1,"down":2}]}`)
+
+	var attempts atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received, _ := io.ReadAll(r.Body)
+		if !verifyTrafficInformSignature(secret, received, r.Header.Get(trafficInformSignatureHeader)) {
+			t.Errorf("attempt %d: signature %q does not verify", attempts.Load()+1, r.Header.Get(trafficInformSignatureHeader))
+		}
+		if r.Header.Get(trafficInformTimestampHeader) != "1767225600000" {
+			t.Errorf("timestamp header = %q", r.Header.Get(trafficInformTimestampHeader))
+		}
+		// Fail the first two deliveries
+		if attempts.Add(1) <= 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	err := deliverTrafficInform(server.URL, body, signTrafficInform(secret, body), "1767225600000")
+	if err != nil {
+		t.Fatalf("deliverTrafficInform() failed: %v", err)
+	}
+	if got := attempts.Load(); got != 3 {
+		t.Fatalf("receiver got %d attempts, want 3", got)
+	}
+}
+
+func TestDeliverTrafficInformGivesUp(t *testing.T) {
+	useFastTrafficInformBackoff(t)
+	var attempts atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts.Add(1)
+		if _, ok := r.Header[trafficInformSignatureHeader]; ok {
+			t.Error("signature header sent without a secret")
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	if err := deliverTrafficInform(server.URL, []byte(`{}`), "", "1"); err == nil {
+		t.Fatal("deliverTrafficInform() succeeded against a failing receiver")
+	}
+	if got := attempts.Load(); got != trafficInformMaxAttempts {
+		t.Fatalf("receiver got %d attempts, want %d", got, trafficInformMaxAttempts)
+	}
+}
+
+func TestBuildTrafficInformBatchOutboundDeltas(t *testing.T) {
+	traffics := []*xray.Traffic{
+		{IsInbound: true, Tag: "inbound-443", Up: 10, Down: 20},
+		{IsOutbound: true, Tag: "direct", Up: 100, Down: 200},
+		{IsOutbound: true, Tag: "warp", Up: 5, Down: 0},
+		{IsOutbound: true, Tag: "blocked"},
+	}
+	totals := []*model.OutboundTraffics{
+		{Tag: "direct", Up: 1100, Down: 2200},
+		{Tag: "blocked", Up: 1, Down: 1},
+	}
+	now := time.UnixMilli(1700000000000)
+
+	batch := buildTrafficInformBatch(traffics, nil, totals, now)
+	if batch == nil {
+		t.Fatal("batch with moving outbounds not built")
+	}
+	want := []OutboundTrafficDelta{
+		{Tag: "direct", Up: 100, Down: 200, TotalUp: 1100, TotalDown: 2200},
+		// No stored totals yet
+		{Tag: "warp", Up: 5},
+	}
+	if !reflect.DeepEqual(batch.OutboundTraffics, want) {
+		t.Fatalf("outboundTraffics = %+v, want %+v", batch.OutboundTraffics, want)
+	}
+
+	body, err := json.Marshal(batch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var payload struct {
+		Timestamp        int64 `json:"timestamp"`
+		OutboundTraffics []map[string]any
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		t.Fatal(err)
+	}
+	if payload.Timestamp != now.UnixMilli() || len(payload.OutboundTraffics) != 2 || payload.OutboundTraffics[0]["totalUp"] != float64(1100) {
+		t.Fatalf("payload = %s, want the outbound deltas with their totals", body)
+	}
+}
+
+func TestBuildTrafficInformBatchOutboundOnly(t *testing.T) {
+	traffics := []*xray.Traffic{{IsOutbound: true, Tag: "direct", Up: 1}}
+	batch := buildTrafficInformBatch(traffics, nil, nil, time.Now())
+	if batch == nil || len(batch.OutboundTraffics) != 1 || len(batch.Events) != 0 {
+		t.Fatalf("batch = %+v, want a batch with only the outbound delta", batch)
+	}
+}
+
+func TestBuildTrafficInformBatchIdle(t *testing.T) {
+	traffics := []*xray.Traffic{
+		{IsInbound: true, Tag: "inbound-443"},
+		{IsOutbound: true, Tag: "direct"},
+	}
+	clients := []*xray.ClientTraffic{{Email: "a@example.com"}}
+	if batch := buildTrafficInformBatch(traffics, clients, nil, time.Now()); batch != nil {
+		t.Fatalf("idle cycle built %+v, want nil", batch)
+	}
+}
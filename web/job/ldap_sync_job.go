@@ -1,6 +1,8 @@
 package job
 
 import (
+	"fmt"
+	"sort"
 	"time"
 
 	"strings"
@@ -20,6 +22,7 @@ var DefaultTruthyValues = []string{"true", "1", "yes", "on"}
 type LdapSyncJob struct {
 	settingService service.SettingService
 	inboundService service.InboundService
+	clientService  service.ClientService
 	xrayService    service.XrayService
 }
 
@@ -60,6 +63,37 @@ func NewLdapSyncJob() *LdapSyncJob {
 	return new(LdapSyncJob)
 }
 
+// LdapSyncAction is a single client change computed by the LDAP sync.
+type LdapSyncAction struct {
+	Email      string `json:"email"`
+	InboundTag string `json:"inboundTag"`
+}
+
+// LdapSyncPreview lists the client changes an LDAP sync run would make.
+// Create and Delete are always computed; AutoCreate and AutoDelete report
+// whether a real run would currently apply them.
+type LdapSyncPreview struct {
+	AutoCreate bool             `json:"autoCreate"`
+	AutoDelete bool             `json:"autoDelete"`
+	Create     []LdapSyncAction `json:"create"`
+	Enable     []LdapSyncAction `json:"enable"`
+	Disable    []LdapSyncAction `json:"disable"`
+	Delete     []LdapSyncAction `json:"delete"`
+}
+
+// ldapSyncPlan holds the changes computed from LDAP flags and current clients.
+type ldapSyncPlan struct {
+	inboundMap       map[string]*model.Inbound // tag -> inbound
+	autoCreate       bool
+	autoDelete       bool
+	defaultTotalGB   int                       // ldapDefaultTotalGB for new clients
+	defaultExpiry    int                       // ldapDefaultExpiryDays for new clients
+	clientsToCreate  map[string][]string       // tag -> []email of new clients
+	clientsToEnable  map[string][]string       // tag -> []email
+	clientsToDisable map[string][]string       // tag -> []email
+	clientsToDelete  map[string][]model.Client // tag -> []clients not in LDAP
+}
+
 func (j *LdapSyncJob) Run() {
 	logger.Info("LDAP sync job started")
 
@@ -69,6 +103,103 @@ func (j *LdapSyncJob) Run() {
 		return
 	}
 
+	plan, err := j.buildPlan()
+	if err != nil {
+		logger.Warning(err)
+		return
+	}
+
+	// --- Execute create ---
+	if plan.autoCreate {
+		j.createClients(plan)
+	}
+
+	// --- Execute enable/disable batch ---
+	for tag, emails := range plan.clientsToEnable {
+		j.batchSetEnable(plan.inboundMap[tag], emails, true)
+	}
+	for tag, emails := range plan.clientsToDisable {
+		j.batchSetEnable(plan.inboundMap[tag], emails, false)
+	}
+
+	// --- Auto delete clients not in LDAP ---
+	if plan.autoDelete {
+		restartNeeded := false
+		for tag, clients := range plan.clientsToDelete {
+			if j.deleteClients(plan.inboundMap[tag], clients) {
+				restartNeeded = true
+			}
+		}
+		// One time after all batches
+		if restartNeeded {
+			j.xrayService.SetToNeedRestart()
+			logger.Info("Xray restart scheduled after batch deletion")
+		}
+	}
+}
+
+// DryRun computes the changes a sync run would make without touching the database.
+// It runs even when LDAP sync is disabled, so settings can be previewed first.
+func (j *LdapSyncJob) DryRun() (preview *LdapSyncPreview, err error) {
+	// mustGet* helpers panic on settings errors
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("failed to read LDAP settings: %v", r)
+		}
+	}()
+
+	plan, err := j.buildPlan()
+	if err != nil {
+		return nil, err
+	}
+
+	return plan.preview(), nil
+}
+
+// preview lists the changes of the plan, sorted by inbound tag and email.
+func (p *ldapSyncPlan) preview() *LdapSyncPreview {
+	preview := &LdapSyncPreview{
+		AutoCreate: p.autoCreate,
+		AutoDelete: p.autoDelete,
+		Create:     []LdapSyncAction{},
+		Enable:     []LdapSyncAction{},
+		Disable:    []LdapSyncAction{},
+		Delete:     []LdapSyncAction{},
+	}
+	for tag, emails := range p.clientsToCreate {
+		for _, email := range emails {
+			preview.Create = append(preview.Create, LdapSyncAction{Email: email, InboundTag: tag})
+		}
+	}
+	for tag, emails := range p.clientsToEnable {
+		for _, email := range emails {
+			preview.Enable = append(preview.Enable, LdapSyncAction{Email: email, InboundTag: tag})
+		}
+	}
+	for tag, emails := range p.clientsToDisable {
+		for _, email := range emails {
+			preview.Disable = append(preview.Disable, LdapSyncAction{Email: email, InboundTag: tag})
+		}
+	}
+	for tag, clients := range p.clientsToDelete {
+		for _, c := range clients {
+			preview.Delete = append(preview.Delete, LdapSyncAction{Email: c.Email, InboundTag: tag})
+		}
+	}
+	for _, actions := range [][]LdapSyncAction{preview.Create, preview.Enable, preview.Disable, preview.Delete} {
+		sort.Slice(actions, func(a, b int) bool {
+			if actions[a].InboundTag != actions[b].InboundTag {
+				return actions[a].InboundTag < actions[b].InboundTag
+			}
+			return actions[a].Email < actions[b].Email
+		})
+	}
+	return preview
+}
+
+// buildPlan fetches LDAP flags and current clients and computes the sync changes.
+// Create and delete candidates are always computed; the caller checks autoCreate/autoDelete.
+func (j *LdapSyncJob) buildPlan() (*ldapSyncPlan, error) {
 	// --- LDAP fetch ---
 	cfg := ldaputil.Config{
 		Host:       mustGetString(j.settingService.GetLdapHost),
@@ -86,8 +217,7 @@ func (j *LdapSyncJob) Run() {
 
 	flags, err := ldaputil.FetchVlessFlags(cfg)
 	if err != nil {
-		logger.Warning("LDAP fetch failed:", err)
-		return
+		return nil, fmt.Errorf("LDAP fetch failed: %w", err)
 	}
 	logger.Infof("Fetched %d LDAP flags", len(flags))
 
@@ -95,78 +225,68 @@ func (j *LdapSyncJob) Run() {
 	inboundTags := splitCsv(mustGetString(j.settingService.GetLdapInboundTags))
 	inbounds, err := j.inboundService.GetAllInbounds()
 	if err != nil {
-		logger.Warning("Failed to get inbounds:", err)
-		return
+		return nil, fmt.Errorf("failed to get inbounds: %w", err)
 	}
 
-	allClients := map[string]*model.Client{}  // email -> client
-	inboundMap := map[string]*model.Inbound{} // tag -> inbound
+	plan := &ldapSyncPlan{
+		inboundMap:       map[string]*model.Inbound{},
+		autoCreate:       mustGetBool(j.settingService.GetLdapAutoCreate),
+		autoDelete:       mustGetBool(j.settingService.GetLdapAutoDelete),
+		clientsToCreate:  map[string][]string{},
+		defaultTotalGB:   mustGetInt(j.settingService.GetLdapDefaultTotalGB),
+		defaultExpiry:    mustGetInt(j.settingService.GetLdapDefaultExpiryDays),
+		clientsToEnable:  map[string][]string{},
+		clientsToDisable: map[string][]string{},
+		clientsToDelete:  map[string][]model.Client{},
+	}
+
+	inboundClients := map[string][]model.Client{} // tag -> clients
 	for _, ib := range inbounds {
-		inboundMap[ib.Tag] = ib
+		plan.inboundMap[ib.Tag] = ib
 		clients, _ := j.inboundService.GetClients(ib)
+		inboundClients[ib.Tag] = clients
+	}
+
+	plan.addChanges(flags, inboundTags, inboundClients)
+	return plan, nil
+}
+
+// addChanges computes the changes that bring the clients of the inbounds in inboundTags in line
+// with the LDAP flags (email -> allowed). inboundClients holds the current clients by inbound tag.
+func (p *ldapSyncPlan) addChanges(flags map[string]bool, inboundTags []string, inboundClients map[string][]model.Client) {
+	allClients := map[string]*model.Client{} // email -> client
+	for _, clients := range inboundClients {
 		for i := range clients {
 			allClients[clients[i].Email] = &clients[i]
 		}
 	}
 
 	// --- Prepare batch operations ---
-	autoCreate := mustGetBool(j.settingService.GetLdapAutoCreate)
-	defGB := mustGetInt(j.settingService.GetLdapDefaultTotalGB)
-	defExpiryDays := mustGetInt(j.settingService.GetLdapDefaultExpiryDays)
-	// defLimitIP removed - using HWID only
-
-	clientsToCreate := map[string][]model.Client{} // tag -> []new clients
-	clientsToEnable := map[string][]string{}       // tag -> []email
-	clientsToDisable := map[string][]string{}      // tag -> []email
-
+	// ldapDefaultLimitIP is not applied - IP limits were removed, using HWID only
 	for email, allowed := range flags {
 		exists := allClients[email] != nil
 		for _, tag := range inboundTags {
-			if !exists && allowed && autoCreate {
-				newClient := j.buildClient(inboundMap[tag], email, defGB, defExpiryDays)
-				clientsToCreate[tag] = append(clientsToCreate[tag], newClient)
+			if p.inboundMap[tag] == nil {
+				continue
+			}
+			if !exists && allowed {
+				p.clientsToCreate[tag] = append(p.clientsToCreate[tag], email)
 			} else if exists {
 				if allowed && !allClients[email].Enable {
-					clientsToEnable[tag] = append(clientsToEnable[tag], email)
+					p.clientsToEnable[tag] = append(p.clientsToEnable[tag], email)
 				} else if !allowed && allClients[email].Enable {
-					clientsToDisable[tag] = append(clientsToDisable[tag], email)
+					p.clientsToDisable[tag] = append(p.clientsToDisable[tag], email)
 				}
 			}
 		}
 	}
 
-	// --- Execute batch create ---
-	for tag, newClients := range clientsToCreate {
-		if len(newClients) == 0 {
-			continue
-		}
-		payload := &model.Inbound{Id: inboundMap[tag].Id}
-		payload.Settings = j.clientsToJSON(newClients)
-		if _, err := j.inboundService.AddInboundClient(payload); err != nil {
-			logger.Warningf("Failed to add clients for tag %s: %v", tag, err)
-		} else {
-			logger.Infof("LDAP auto-create: %d clients for %s", len(newClients), tag)
-			j.xrayService.SetToNeedRestart()
-		}
-	}
-
-	// --- Execute enable/disable batch ---
-	for tag, emails := range clientsToEnable {
-		j.batchSetEnable(inboundMap[tag], emails, true)
-	}
-	for tag, emails := range clientsToDisable {
-		j.batchSetEnable(inboundMap[tag], emails, false)
-	}
-
-	// --- Auto delete clients not in LDAP ---
-	autoDelete := mustGetBool(j.settingService.GetLdapAutoDelete)
-	if autoDelete {
-		ldapEmailSet := map[string]struct{}{}
-		for e := range flags {
-			ldapEmailSet[e] = struct{}{}
-		}
-		for _, tag := range inboundTags {
-			j.deleteClientsNotInLDAP(tag, ldapEmailSet)
+	// --- Clients not in LDAP (auto delete candidates) ---
+	for _, tag := range inboundTags {
+		for _, c := range inboundClients[tag] {
+			if _, ok := flags[c.Email]; !ok {
+				p.clientsToDelete[tag] = append(p.clientsToDelete[tag], c)
+			}
 		}
 	}
 }
@@ -186,23 +306,73 @@ func splitCsv(s string) []string {
 	return out
 }
 
-// buildClient creates a new client for auto-create
-func (j *LdapSyncJob) buildClient(ib *model.Inbound, email string, defGB, defExpiryDays int) model.Client {
-	c := model.Client{
+// createClients creates each new LDAP user once as a ClientEntity assigned to
+// every inbound from ldapInboundTags it was planned for, seeded with the
+// ldapDefaultTotalGB/ldapDefaultExpiryDays defaults.
+func (j *LdapSyncJob) createClients(plan *ldapSyncPlan) {
+	emails, emailInbounds := plan.newClients()
+
+	created := 0
+	restartNeeded := false
+	for _, email := range emails {
+		inbounds := emailInbounds[email]
+		client := j.buildClient(email, inbounds, plan.defaultTotalGB, plan.defaultExpiry)
+		needRestart, err := j.clientService.AddClient(inbounds[0].UserId, client)
+		if err != nil {
+			logger.Warningf("LDAP auto-create failed for %s: %v", email, err)
+			continue
+		}
+		created++
+		if needRestart {
+			restartNeeded = true
+		}
+	}
+
+	if created > 0 {
+		logger.Infof("LDAP auto-create: %d clients", created)
+	}
+	if restartNeeded {
+		j.xrayService.SetToNeedRestart()
+	}
+}
+
+// newClients groups the planned creations by client: it returns the sorted emails of the new
+// clients and the inbounds each of them is created on.
+func (p *ldapSyncPlan) newClients() ([]string, map[string][]*model.Inbound) {
+	emailInbounds := map[string][]*model.Inbound{} // email -> target inbounds
+	emails := []string{}
+	for tag, tagEmails := range p.clientsToCreate {
+		for _, email := range tagEmails {
+			if _, ok := emailInbounds[email]; !ok {
+				emails = append(emails, email)
+			}
+			emailInbounds[email] = append(emailInbounds[email], p.inboundMap[tag])
+		}
+	}
+	sort.Strings(emails)
+	return emails, emailInbounds
+}
+
+// buildClient creates a new client entity for auto-create
+func (j *LdapSyncJob) buildClient(email string, inbounds []*model.Inbound, defGB, defExpiryDays int) *model.ClientEntity {
+	c := &model.ClientEntity{
 		Email:   email,
 		Enable:  true,
-		// LimitIP removed - using HWID only
-		TotalGB: int64(defGB),
+		TotalGB: float64(defGB),
 	}
 	if defExpiryDays > 0 {
 		c.ExpiryTime = time.Now().Add(time.Duration(defExpiryDays) * 24 * time.Hour).UnixMilli()
 	}
-	switch ib.Protocol {
-	case model.Trojan, model.Shadowsocks:
-		c.Password = uuid.NewString()
-	default:
-		c.ID = uuid.NewString()
+	for _, ib := range inbounds {
+		c.InboundIds = append(c.InboundIds, ib.Id)
+		switch ib.Protocol {
+		case model.Trojan, model.Shadowsocks:
+			if c.Password == "" {
+				c.Password = uuid.NewString()
+			}
+		}
 	}
+	// UUID for vless/vmess is generated by ClientService.AddClient
 	return c
 }
 
@@ -236,76 +406,43 @@ func (j *LdapSyncJob) batchSetEnable(ib *model.Inbound, emails []string, enable
 	j.xrayService.SetToNeedRestart()
 }
 
-// deleteClientsNotInLDAP deletes clients not in LDAP using batches and a single restart
-func (j *LdapSyncJob) deleteClientsNotInLDAP(inboundTag string, ldapEmails map[string]struct{}) {
-	inbounds, err := j.inboundService.GetAllInbounds()
-	if err != nil {
-		logger.Warning("Failed to get inbounds for deletion:", err)
-		return
-	}
-
+// deleteClients deletes the given clients from an inbound in batches.
+// It returns true if at least one client was deleted and Xray needs a restart.
+func (j *LdapSyncJob) deleteClients(ib *model.Inbound, toDelete []model.Client) bool {
 	batchSize := 50 //  clients in 1 batch
 	restartNeeded := false
 
-	for _, ib := range inbounds {
-		if ib.Tag != inboundTag {
-			continue
-		}
-		clients, err := j.inboundService.GetClients(ib)
-		if err != nil {
-			logger.Warningf("Failed to get clients for inbound %s: %v", ib.Tag, err)
-			continue
+	// Delete in batches
+	for i := 0; i < len(toDelete); i += batchSize {
+		end := i + batchSize
+		if end > len(toDelete) {
+			end = len(toDelete)
 		}
-
-		// Collect clients for deletion
-		toDelete := []model.Client{}
-		for _, c := range clients {
-			if _, ok := ldapEmails[c.Email]; !ok {
-				toDelete = append(toDelete, c)
-			}
-		}
-
-		if len(toDelete) == 0 {
-			continue
-		}
-
-		// Delete in batches
-		for i := 0; i < len(toDelete); i += batchSize {
-			end := i + batchSize
-			if end > len(toDelete) {
-				end = len(toDelete)
+		batch := toDelete[i:end]
+
+		for _, c := range batch {
+			var clientKey string
+			switch ib.Protocol {
+			case model.Trojan:
+				clientKey = c.Password
+			case model.Shadowsocks:
+				clientKey = c.Email
+			default: // vless/vmess
+				clientKey = c.ID
 			}
-			batch := toDelete[i:end]
-
-			for _, c := range batch {
-				var clientKey string
-				switch ib.Protocol {
-				case model.Trojan:
-					clientKey = c.Password
-				case model.Shadowsocks:
-					clientKey = c.Email
-				default: // vless/vmess
-					clientKey = c.ID
-				}
 
-				if _, err := j.inboundService.DelInboundClient(ib.Id, clientKey); err != nil {
-					logger.Warningf("Failed to delete client %s from inbound id=%d(tag=%s): %v",
-						c.Email, ib.Id, ib.Tag, err)
-				} else {
-					logger.Infof("Deleted client %s from inbound id=%d(tag=%s)",
-						c.Email, ib.Id, ib.Tag)
-					// do not restart here
-					restartNeeded = true
-				}
+			if _, err := j.inboundService.DelInboundClient(ib.Id, clientKey); err != nil {
+				logger.Warningf("Failed to delete client %s from inbound id=%d(tag=%s): %v",
+					c.Email, ib.Id, ib.Tag, err)
+			} else {
+				logger.Infof("Deleted client %s from inbound id=%d(tag=%s)",
+					c.Email, ib.Id, ib.Tag)
+				// do not restart here
+				restartNeeded = true
 			}
 		}
 	}
-
-	// One time after all batches
-	if restartNeeded {
-		j.xrayService.SetToNeedRestart()
-		logger.Info("Xray restart scheduled after batch deletion")
-	}
+	return restartNeeded
 }
 
 // clientsToJSON serializes an array of clients to JSON
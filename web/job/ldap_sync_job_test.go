@@ -0,0 +1,121 @@
+package job
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/konstpic/sharx-code/v2/database/model"
+)
+
+// testLdapSyncPlan returns an empty plan over inbounds with the given tags.
+func testLdapSyncPlan(tags ...string) *ldapSyncPlan {
+	plan := &ldapSyncPlan{
+		inboundMap:       map[string]*model.Inbound{},
+		autoCreate:       true,
+		clientsToCreate:  map[string][]string{},
+		clientsToEnable:  map[string][]string{},
+		clientsToDisable: map[string][]string{},
+		clientsToDelete:  map[string][]model.Client{},
+	}
+	for i, tag := range tags {
+		plan.inboundMap[tag] = &model.Inbound{Id: i + 1, Tag: tag, Protocol: model.VLESS}
+	}
+	return plan
+}
+
+func TestLdapSyncPlanPreview(t *testing.T) {
+	plan := testLdapSyncPlan("vless-a", "vless-b", "other")
+	// The directory as returned by FetchVlessFlags: email -> allowed
+	flags := map[string]bool{
+		"new@example.com":       true,
+		"denied@example.com":    false,
+		"enable@example.com":    true,
+		"disable@example.com":   false,
+		"unchanged@example.com": true,
+	}
+	inboundClients := map[string][]model.Client{
+		"vless-a": {
+			{Email: "enable@example.com", Enable: false},
+			{Email: "disable@example.com", Enable: true},
+			{Email: "unchanged@example.com", Enable: true},
+			{Email: "gone@example.com", Enable: true},
+		},
+		"other": {
+			{Email: "outside@example.com", Enable: true},
+		},
+	}
+
+	plan.addChanges(flags, []string{"vless-a", "vless-b", "missing"}, inboundClients)
+	preview := plan.preview()
+
+	want := &LdapSyncPreview{
+		AutoCreate: true,
+		Create: []LdapSyncAction{
+			{Email: "new@example.com", InboundTag: "vless-a"},
+			{Email: "new@example.com", InboundTag: "vless-b"},
+		},
+		Enable: []LdapSyncAction{
+			{Email: "enable@example.com", InboundTag: "vless-a"},
+			{Email: "enable@example.com", InboundTag: "vless-b"},
+		},
+		Disable: []LdapSyncAction{
+			{Email: "disable@example.com", InboundTag: "vless-a"},
+			{Email: "disable@example.com", InboundTag: "vless-b"},
+		},
+		Delete: []LdapSyncAction{
+			{Email: "gone@example.com", InboundTag: "vless-a"},
+		},
+	}
+	if !reflect.DeepEqual(preview, want) {
+		t.Fatalf("preview = %+v, want %+v", preview, want)
+	}
+}
+
+func TestLdapSyncPlanPreviewEmpty(t *testing.T) {
+	plan := testLdapSyncPlan("vless-a")
+	plan.addChanges(map[string]bool{}, []string{"vless-a"}, map[string][]model.Client{})
+	preview := plan.preview()
+	// Empty lists rather than null keep the response shape stable
+	for _, actions := range [][]LdapSyncAction{preview.Create, preview.Enable, preview.Disable, preview.Delete} {
+		if actions == nil || len(actions) != 0 {
+			t.Fatalf("preview = %+v, want empty action lists", preview)
+		}
+	}
+}
+
+func TestLdapSyncPlanNewClients(t *testing.T) {
+	plan := testLdapSyncPlan("vless-a", "trojan-b", "other")
+	plan.inboundMap["trojan-b"].Protocol = model.Trojan
+	plan.addChanges(map[string]bool{"b@example.com": true, "a@example.com": true}, []string{"vless-a", "trojan-b"}, map[string][]model.Client{})
+
+	emails, emailInbounds := plan.newClients()
+	if !reflect.DeepEqual(emails, []string{"a@example.com", "b@example.com"}) {
+		t.Fatalf("new clients = %v, want each LDAP user once", emails)
+	}
+
+	before := time.Now().Truncate(time.Millisecond)
+	client := (&LdapSyncJob{}).buildClient("a@example.com", emailInbounds["a@example.com"], 50, 30)
+	ids := append([]int(nil), client.InboundIds...)
+	sort.Ints(ids)
+	if !reflect.DeepEqual(ids, []int{1, 2}) {
+		t.Fatalf("inbound ids = %v, want the ldapInboundTags inbounds [1 2]", client.InboundIds)
+	}
+	if client.Email != "a@example.com" || !client.Enable || client.TotalGB != 50 {
+		t.Fatalf("client = %+v, want an enabled client with the default 50 GB", client)
+	}
+	if expiry := time.UnixMilli(client.ExpiryTime); expiry.Before(before.AddDate(0, 0, 30)) || expiry.After(time.Now().AddDate(0, 0, 30)) {
+		t.Fatalf("expiry = %v, want 30 days from now", expiry)
+	}
+	if client.Password == "" {
+		t.Fatal("client on a trojan inbound created without a password")
+	}
+}
+
+func TestLdapSyncBuildClientWithoutDefaults(t *testing.T) {
+	client := (&LdapSyncJob{}).buildClient("a@example.com", []*model.Inbound{{Id: 1, Protocol: model.VLESS}}, 0, 0)
+	if client.TotalGB != 0 || client.ExpiryTime != 0 || client.Password != "" {
+		t.Fatalf("client = %+v, want no limits and no password", client)
+	}
+}
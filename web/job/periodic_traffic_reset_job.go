@@ -1,6 +1,8 @@
 package job
 
 import (
+	"time"
+
 	"github.com/konstpic/sharx-code/v2/logger"
 	"github.com/konstpic/sharx-code/v2/web/service"
 )
@@ -8,47 +10,86 @@ import (
 // Period represents the time period for traffic resets.
 type Period string
 
+// trafficResetPeriods lists the inbound trafficReset values that are processed ("never" is skipped).
+var trafficResetPeriods = []Period{"daily", "weekly", "monthly"}
+
 // PeriodicTrafficResetJob resets traffic statistics for inbounds based on their configured reset period.
+// It runs frequently and resets every inbound whose last reset is older than the start of
+// its current period, so a reset missed while the panel was down is caught up on the next run.
 type PeriodicTrafficResetJob struct {
 	inboundService service.InboundService
-	period         Period
 }
 
-// NewPeriodicTrafficResetJob creates a new periodic traffic reset job for the specified period.
-func NewPeriodicTrafficResetJob(period Period) *PeriodicTrafficResetJob {
-	return &PeriodicTrafficResetJob{
-		period: period,
-	}
+// NewPeriodicTrafficResetJob creates a new periodic traffic reset job.
+func NewPeriodicTrafficResetJob() *PeriodicTrafficResetJob {
+	return new(PeriodicTrafficResetJob)
 }
 
-// Run resets traffic statistics for all inbounds that match the configured reset period.
-func (j *PeriodicTrafficResetJob) Run() {
-	inbounds, err := j.inboundService.GetInboundsByTrafficReset(string(j.period))
-	if err != nil {
-		logger.Warning("Failed to get inbounds for traffic reset:", err)
-		return
+// periodStart returns the local start of the reset period that contains now:
+// midnight for daily, Sunday midnight for weekly and the first of the month for monthly.
+func periodStart(period Period, now time.Time) (time.Time, bool) {
+	year, month, day := now.Date()
+	today := time.Date(year, month, day, 0, 0, 0, 0, now.Location())
+	switch period {
+	case "daily":
+		return today, true
+	case "weekly":
+		return today.AddDate(0, 0, -int(today.Weekday())), true
+	case "monthly":
+		return time.Date(year, month, 1, 0, 0, 0, 0, now.Location()), true
+	default:
+		return time.Time{}, false
 	}
+}
 
-	if len(inbounds) == 0 {
-		return
+// isTrafficResetDue reports whether an inbound last reset at lastReset (unix milliseconds)
+// must be reset at now for the given period.
+func isTrafficResetDue(period Period, lastReset int64, now time.Time) bool {
+	start, ok := periodStart(period, now)
+	if !ok {
+		return false
 	}
-	logger.Infof("Running periodic traffic reset job for period: %s (%d matching inbounds)", j.period, len(inbounds))
+	return lastReset < start.UnixMilli()
+}
 
+// Run resets traffic statistics for all inbounds whose reset period has elapsed.
+func (j *PeriodicTrafficResetJob) Run() {
+	now := time.Now()
 	resetCount := 0
 
-	for _, inbound := range inbounds {
-		resetInboundErr := j.inboundService.ResetAllTraffics()
-		if resetInboundErr != nil {
-			logger.Warning("Failed to reset traffic for inbound", inbound.Id, ":", resetInboundErr)
+	for _, period := range trafficResetPeriods {
+		inbounds, err := j.inboundService.GetInboundsByTrafficReset(string(period))
+		if err != nil {
+			logger.Warning("Failed to get inbounds for traffic reset:", err)
+			continue
 		}
 
-		resetClientErr := j.inboundService.ResetAllClientTraffics(inbound.Id)
-		if resetClientErr != nil {
-			logger.Warning("Failed to reset traffic for all users of inbound", inbound.Id, ":", resetClientErr)
-		}
+		for _, inbound := range inbounds {
+			if inbound.LastTrafficResetTime == 0 {
+				// Never reset before: start counting from now instead of wiping current usage
+				if err := j.inboundService.SetLastTrafficResetTime(inbound.Id, now.UnixMilli()); err != nil {
+					logger.Warning("Failed to initialize traffic reset time for inbound", inbound.Id, ":", err)
+				}
+				continue
+			}
+			if !isTrafficResetDue(period, inbound.LastTrafficResetTime, now) {
+				continue
+			}
+
+			resetInboundErr := j.inboundService.ResetInboundTraffic(inbound.Id)
+			if resetInboundErr != nil {
+				logger.Warning("Failed to reset traffic for inbound", inbound.Id, ":", resetInboundErr)
+			}
+
+			// Also updates the inbound's lastTrafficResetTime
+			resetClientErr := j.inboundService.ResetAllClientTraffics(inbound.Id)
+			if resetClientErr != nil {
+				logger.Warning("Failed to reset traffic for all users of inbound", inbound.Id, ":", resetClientErr)
+			}
 
-		if resetInboundErr == nil && resetClientErr == nil {
-			resetCount++
+			if resetInboundErr == nil && resetClientErr == nil {
+				resetCount++
+			}
 		}
 	}
 
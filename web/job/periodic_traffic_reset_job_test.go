@@ -0,0 +1,75 @@
+package job
+
+import (
+	"testing"
+	"time"
+)
+
+func TestIsTrafficResetDueAcrossMonthlyBoundary(t *testing.T) {
+	lastReset := time.Date(2026, time.January, 1, 0, 5, 0, 0, time.Local).UnixMilli()
+
+	// Advance the clock through January and across into February
+	for _, now := range []time.Time{
+		time.Date(2026, time.January, 1, 12, 0, 0, 0, time.Local),
+		time.Date(2026, time.January, 15, 0, 0, 0, 0, time.Local),
+		time.Date(2026, time.January, 31, 23, 59, 59, 0, time.Local),
+	} {
+		if isTrafficResetDue("monthly", lastReset, now) {
+			t.Errorf("monthly reset due at %v after a reset on January 1", now)
+		}
+	}
+	for _, now := range []time.Time{
+		time.Date(2026, time.February, 1, 0, 0, 0, 0, time.Local),
+		// A run missed while the panel was down is caught up later
+		time.Date(2026, time.March, 10, 8, 0, 0, 0, time.Local),
+	} {
+		if !isTrafficResetDue("monthly", lastReset, now) {
+			t.Errorf("monthly reset not due at %v after a reset on January 1", now)
+		}
+	}
+
+	// Once reset in February, the next reset is due in March
+	lastReset = time.Date(2026, time.February, 1, 0, 1, 0, 0, time.Local).UnixMilli()
+	if isTrafficResetDue("monthly", lastReset, time.Date(2026, time.February, 28, 23, 0, 0, 0, time.Local)) {
+		t.Error("monthly reset due twice in February")
+	}
+	if !isTrafficResetDue("monthly", lastReset, time.Date(2026, time.March, 1, 0, 0, 1, 0, time.Local)) {
+		t.Error("monthly reset not due on March 1")
+	}
+}
+
+func TestIsTrafficResetDueDailyAndWeekly(t *testing.T) {
+	// Wednesday, January 14 2026
+	lastReset := time.Date(2026, time.January, 14, 0, 0, 1, 0, time.Local).UnixMilli()
+	tests := []struct {
+		period Period
+		now    time.Time
+		want   bool
+	}{
+		{"daily", time.Date(2026, time.January, 14, 23, 59, 0, 0, time.Local), false},
+		{"daily", time.Date(2026, time.January, 15, 0, 0, 0, 0, time.Local), true},
+		{"weekly", time.Date(2026, time.January, 17, 23, 59, 0, 0, time.Local), false},
+		{"weekly", time.Date(2026, time.January, 18, 0, 0, 0, 0, time.Local), true},
+		{"never", time.Date(2027, time.January, 1, 0, 0, 0, 0, time.Local), false},
+		{"", time.Date(2027, time.January, 1, 0, 0, 0, 0, time.Local), false},
+	}
+	for _, test := range tests {
+		if got := isTrafficResetDue(test.period, lastReset, test.now); got != test.want {
+			t.Errorf("isTrafficResetDue(%q, %v) = %v, want %v", test.period, test.now, got, test.want)
+		}
+	}
+}
+
+func TestPeriodStart(t *testing.T) {
+	now := time.Date(2026, time.January, 14, 15, 30, 0, 0, time.Local)
+	want := map[Period]time.Time{
+		"daily":   time.Date(2026, time.January, 14, 0, 0, 0, 0, time.Local),
+		"weekly":  time.Date(2026, time.January, 11, 0, 0, 0, 0, time.Local),
+		"monthly": time.Date(2026, time.January, 1, 0, 0, 0, 0, time.Local),
+	}
+	for period, start := range want {
+		if got, ok := periodStart(period, now); !ok || !got.Equal(start) {
+			t.Errorf("periodStart(%q) = %v, %v, want %v", period, got, ok, start)
+		}
+	}
+}
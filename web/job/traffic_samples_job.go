@@ -0,0 +1,30 @@
+package job
+
+import (
+	"github.com/konstpic/sharx-code/v2/logger"
+	"github.com/konstpic/sharx-code/v2/web/service"
+)
+
+// TrafficSamplesJob compacts and prunes the recorded node, inbound and client traffic history.
+type TrafficSamplesJob struct {
+	nodeService    service.NodeService
+	inboundService service.InboundService
+}
+
+// NewTrafficSamplesJob creates a new TrafficSamplesJob instance.
+func NewTrafficSamplesJob() *TrafficSamplesJob {
+	return &TrafficSamplesJob{
+		nodeService:    service.NodeService{},
+		inboundService: service.InboundService{},
+	}
+}
+
+// Run merges old traffic samples into hourly ones and deletes expired samples.
+func (j *TrafficSamplesJob) Run() {
+	if err := j.nodeService.CompactNodeTrafficSamples(); err != nil {
+		logger.Warningf("Failed to compact node traffic samples: %v", err)
+	}
+	if err := j.inboundService.CompactTrafficSamples(); err != nil {
+		logger.Warningf("Failed to compact traffic samples: %v", err)
+	}
+}
@@ -0,0 +1,39 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/konstpic/sharx-code/v2/database/model"
+)
+
+func TestApiTokenAuthenticateRejectsForeignTokens(t *testing.T) {
+	// Tokens without the panel prefix are rejected before any lookup
+	for _, token := range []string{"", "0123456789abcdef", "Bearer sx_0123"} {
+		if _, _, err := (&ApiTokenService{}).Authenticate(token); err == nil {
+			t.Errorf("Authenticate(%q) accepted a token without the %s prefix", token, apiTokenPrefix)
+		}
+	}
+}
+
+func TestCheckApiTokenUsable(t *testing.T) {
+	if err := checkApiTokenUsable(&model.ApiToken{Scope: ApiTokenScopeFull}); err != nil {
+		t.Errorf("valid token rejected: %v", err)
+	}
+	if err := checkApiTokenUsable(&model.ApiToken{Scope: ApiTokenScopeFull, Revoked: true}); err == nil {
+		t.Error("revoked token accepted")
+	}
+}
+
+func TestHashApiToken(t *testing.T) {
+	token := apiTokenPrefix + "0123456789abcdef"
+	hash := hashApiToken(token)
+	if hash == token || len(hash) != 64 {
+		t.Fatalf("hashApiToken() = %q, want a SHA-256 hex digest", hash)
+	}
+	if hashApiToken(token) != hash {
+		t.Fatal("hashApiToken() is not deterministic")
+	}
+	if hashApiToken(token+"0") == hash {
+		t.Fatal("different tokens have the same hash")
+	}
+}
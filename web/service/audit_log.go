@@ -0,0 +1,189 @@
+package service
+
+import (
+	"encoding/json"
+	"net/url"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/konstpic/sharx-code/v2/database"
+	"github.com/konstpic/sharx-code/v2/database/model"
+	"github.com/konstpic/sharx-code/v2/logger"
+	"github.com/konstpic/sharx-code/v2/util/common"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// auditLogRetention is how long audit log entries are kept.
+	auditLogRetention = 90 * 24 * time.Hour
+	// defaultAuditLogLimit is the page size used when AuditLogFilter.Limit is not set.
+	defaultAuditLogLimit = 50
+	// maxAuditLogLimit bounds the page size of an audit log query.
+	maxAuditLogLimit = 500
+	// auditRedacted replaces sensitive values in audit summaries.
+	auditRedacted = "[redacted]"
+)
+
+// auditSensitiveKeys are the substrings of field names whose values are redacted in audit
+// summaries, compared case-insensitively: passwords, tokens, secrets, keys, client UUIDs and
+// subscription IDs, which give access to the subscription of a client, and proxies, which may
+// carry credentials in any form. Credentials in the URLs of other fields are redacted as well.
+var auditSensitiveKeys = []string{"password", "token", "secret", "key", "uuid", "subid", "proxy"}
+
+// AuditLogService records mutating requests to the panel and queries them.
+type AuditLogService struct{}
+
+// AuditLogFilter selects audit log entries. Zero values do not filter.
+type AuditLogFilter struct {
+	UserId int    `json:"userId" form:"userId"`
+	Action string `json:"action" form:"action"` // substring of the route, e.g. "client/del"
+	From   int64  `json:"from" form:"from"`     // entries at or after this time (unix milliseconds)
+	To     int64  `json:"to" form:"to"`         // entries before this time (unix milliseconds)
+	Offset int    `json:"offset" form:"offset"`
+	Limit  int    `json:"limit" form:"limit"`
+}
+
+// AuditLogResult is one page of audit log entries along with the total number of matches.
+type AuditLogResult struct {
+	Entries []model.AuditLog `json:"entries"`
+	Total   int64            `json:"total"`
+}
+
+// Record stores an audit log entry.
+// Failures are logged, not returned, so auditing never fails the request.
+func (s *AuditLogService) Record(entry *model.AuditLog) {
+	if entry.CreatedAt == 0 {
+		entry.CreatedAt = time.Now().UnixMilli()
+	}
+	if err := database.GetDB().Create(entry).Error; err != nil {
+		logger.Warningf("Failed to record audit log entry for %s: %v", entry.Action, err)
+	}
+}
+
+// PruneAuditLogs deletes the audit log entries older than auditLogRetention.
+func (s *AuditLogService) PruneAuditLogs() error {
+	cutoff := time.Now().Add(-auditLogRetention).UnixMilli()
+	return database.GetDB().Where("created_at < ?", cutoff).Delete(&model.AuditLog{}).Error
+}
+
+// GetAuditLogs returns the audit log entries matching filter, newest first.
+func (s *AuditLogService) GetAuditLogs(filter AuditLogFilter) (*AuditLogResult, error) {
+	if filter.Offset < 0 || filter.Limit < 0 {
+		return nil, common.NewErrorf("invalid page: offset %d, limit %d", filter.Offset, filter.Limit)
+	}
+	if filter.Limit == 0 {
+		filter.Limit = defaultAuditLogLimit
+	}
+	if filter.Limit > maxAuditLogLimit {
+		filter.Limit = maxAuditLogLimit
+	}
+
+	query := auditLogQuery(database.GetDB(), filter)
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, err
+	}
+	entries := make([]model.AuditLog, 0)
+	err := query.Order("created_at DESC, id DESC").Offset(filter.Offset).Limit(filter.Limit).Find(&entries).Error
+	if err != nil {
+		return nil, err
+	}
+	return &AuditLogResult{Entries: entries, Total: total}, nil
+}
+
+// auditLogQuery returns the query on db for the audit log entries matching filter, without paging.
+func auditLogQuery(db *gorm.DB, filter AuditLogFilter) *gorm.DB {
+	query := db.Model(&model.AuditLog{})
+	if filter.UserId > 0 {
+		query = query.Where("user_id = ?", filter.UserId)
+	}
+	if action := strings.TrimSpace(filter.Action); action != "" {
+		query = query.Where("action LIKE ?", "%"+escapeLike(action)+"%")
+	}
+	if filter.From > 0 {
+		query = query.Where("created_at >= ?", filter.From)
+	}
+	if filter.To > 0 {
+		query = query.Where("created_at < ?", filter.To)
+	}
+	return query
+}
+
+// AuditSummary returns the JSON of the top-level fields of before and after that differ, with
+// sensitive values redacted. A nil before or after (creation, deletion) yields an empty string on
+// that side and all fields of the other one.
+func AuditSummary(before any, after any) (string, string) {
+	beforeFields := auditFields(before)
+	afterFields := auditFields(after)
+	if beforeFields != nil && afterFields != nil {
+		for name, value := range beforeFields {
+			if other, ok := afterFields[name]; ok && reflect.DeepEqual(value, other) {
+				delete(beforeFields, name)
+				delete(afterFields, name)
+			}
+		}
+	}
+	return auditJSON(beforeFields), auditJSON(afterFields)
+}
+
+// auditFields converts v to a map of its JSON fields, nil when v is nil or not a JSON object.
+func auditFields(v any) map[string]any {
+	if v == nil || (reflect.ValueOf(v).Kind() == reflect.Pointer && reflect.ValueOf(v).IsNil()) {
+		return nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+	var fields map[string]any
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil
+	}
+	return fields
+}
+
+// auditJSON marshals fields with sensitive values redacted, an empty string for nil.
+func auditJSON(fields map[string]any) string {
+	if fields == nil {
+		return ""
+	}
+	for name, value := range fields {
+		if isAuditSensitive(name) && value != nil && value != "" {
+			fields[name] = auditRedacted
+		} else if str, ok := value.(string); ok {
+			fields[name] = redactURLUserinfo(str)
+		}
+	}
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+// isAuditSensitive reports whether the value of a field may hold a credential.
+func isAuditSensitive(name string) bool {
+	name = strings.ToLower(name)
+	for _, key := range auditSensitiveKeys {
+		if strings.Contains(name, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// redactURLUserinfo redacts the user name and password of value if it is a URL that carries them,
+// e.g. a monitoring endpoint with basic authentication. Other values are returned unchanged.
+func redactURLUserinfo(value string) string {
+	if !strings.Contains(value, "@") {
+		return value
+	}
+	u, err := url.Parse(value)
+	if err != nil || u.User == nil || u.Scheme == "" || u.Host == "" {
+		return value
+	}
+	u.User = nil
+	return strings.Replace(u.String(), "://", "://"+auditRedacted+"@", 1)
+}
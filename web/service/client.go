@@ -40,6 +40,12 @@ func (s *ClientService) GetClients(userId int) ([]*model.ClientEntity, error) {
 			client.InboundIds = inboundIds
 		}
 
+		// Load node restrictions
+		nodeIds, err := s.GetNodeIdsForClient(client.Id)
+		if err == nil {
+			client.NodeIds = nodeIds
+		}
+
 		// Traffic statistics are now stored directly in ClientEntity table
 		// No need to load from client_traffics - fields are already loaded from DB
 		
@@ -94,25 +100,13 @@ func (s *ClientService) GetClients(userId int) ([]*model.ClientEntity, error) {
 									}
 								}
 							} else {
-								// Single mode: instantly update config.json and restart
+								// Single mode: remove from the running Xray via API, restarting only if that fails
 								if p != nil && p.IsRunning() {
-									processConfig := p.GetConfig()
-									if processConfig != nil {
-										// Instantly remove client from config.json
-										if err := xray.UpdateConfigFileAfterUserRemoval(processConfig, inbound.Tag, client.Email); err != nil {
-											logger.Warningf("GetClients: failed to instantly remove expired client %s from config.json: %v", client.Email, err)
-										} else {
-											logger.Infof("GetClients: instantly removed expired client %s from config.json (inbound: %s)", client.Email, inbound.Tag)
-											// Schedule async restart to apply changes
-											xrayService := XrayService{}
-											go func() {
-												if err := xrayService.RestartXray(false); err != nil {
-													logger.Warningf("GetClients: failed to restart Xray after removing expired client: %v", err)
-												} else {
-													logger.Debugf("GetClients: Xray restarted successfully after removing expired client (config synced)")
-												}
-											}()
-										}
+									if s.removeClientFromLocalXray(inbound.Tag, client.Email) {
+										logger.Infof("GetClients: removed expired client %s from Xray via API (inbound: %s)", client.Email, inbound.Tag)
+									} else {
+										xrayService := XrayService{}
+										xrayService.SetToNeedRestart()
 									}
 								}
 							}
@@ -122,6 +116,8 @@ func (s *ClientService) GetClients(userId int) ([]*model.ClientEntity, error) {
 			}
 		}
 
+		client.ComputeRemaining(now)
+
 		// Load HWIDs for this client
 		hwidService := ClientHWIDService{}
 		hwids, err := hwidService.GetHWIDsForClient(client.Id)
@@ -151,8 +147,15 @@ func (s *ClientService) GetClient(id int) (*model.ClientEntity, error) {
 		client.InboundIds = inboundIds
 	}
 
+	// Load node restrictions
+	nodeIds, err := s.GetNodeIdsForClient(client.Id)
+	if err == nil {
+		client.NodeIds = nodeIds
+	}
+
 	// Traffic statistics (Up, Down, AllTime, LastOnline) are already loaded from ClientEntity table
 	// No need to load from client_traffics
+	client.ComputeRemaining(time.Now().UnixMilli())
 
 	// Load HWIDs for this client
 	hwidService := ClientHWIDService{}
@@ -202,17 +205,72 @@ func (s *ClientService) GetInboundIdsForClient(clientId int) ([]int, error) {
 // AddClient creates a new client.
 // Returns whether Xray needs restart and any error.
 func (s *ClientService) AddClient(userId int, client *model.ClientEntity) (bool, error) {
+	if err := s.insertClient(userId, client); err != nil {
+		return false, err
+	}
+
+	// Now update Settings for all assigned inbounds
+	// This is done AFTER committing the client transaction to avoid nested transactions and database locks
+	needRestart := false
+	if len(client.InboundIds) > 0 {
+		inboundService := InboundService{}
+		for _, inboundId := range client.InboundIds {
+			inbound, err := inboundService.GetInbound(inboundId)
+			if err != nil {
+				logger.Warningf("Failed to get inbound %d for settings update: %v", inboundId, err)
+				continue
+			}
+			
+			// Get all clients for this inbound (from ClientEntity)
+			clientEntities, err := s.GetClientsForInbound(inboundId)
+			if err != nil {
+				logger.Warningf("Failed to get clients for inbound %d: %v", inboundId, err)
+				continue
+			}
+			
+			// Rebuild Settings from ClientEntity
+			newSettings, err := inboundService.BuildSettingsFromClientEntities(inbound, clientEntities)
+			if err != nil {
+				logger.Warningf("Failed to build settings for inbound %d: %v", inboundId, err)
+				continue
+			}
+			
+			// Update inbound Settings (this will open its own transaction)
+			// Use retry logic to handle database lock errors
+			inbound.Settings = newSettings
+			_, inboundNeedRestart, err := inboundService.updateInboundWithRetry(inbound)
+			if err != nil {
+				logger.Warningf("Failed to update inbound %d settings: %v", inboundId, err)
+				// Continue with other inbounds
+			} else if inboundNeedRestart {
+				needRestart = true
+			}
+		}
+	}
+
+	// Send notification about client creation
+	tgbotService := Tgbot{}
+	if tgbotService.IsRunning() {
+		tgbotService.NotifyClientCreated(client)
+	}
+
+	return needRestart, nil
+}
+
+// insertClient validates a new client and stores it with its inbound and node assignments,
+// without rebuilding the settings of the assigned inbounds.
+func (s *ClientService) insertClient(userId int, client *model.ClientEntity) (err error) {
 	// Validate email uniqueness for this user
 	existing, err := s.GetClientByEmail(userId, client.Email)
 	if err == nil && existing != nil {
-		return false, common.NewError("Client with email already exists: ", client.Email)
+		return common.NewCodedError(common.ErrCodeClientEmailExists, "Client with email already exists: ", client.Email)
 	}
 
 	// Generate UUID if not provided and needed
 	if client.UUID == "" {
 		newUUID, err := uuid.NewRandom()
 		if err != nil {
-			return false, common.NewError("Failed to generate UUID: ", err.Error())
+			return common.NewError("Failed to generate UUID: ", err.Error())
 		}
 		client.UUID = newUUID.String()
 	}
@@ -224,7 +282,10 @@ func (s *ClientService) AddClient(userId int, client *model.ClientEntity) (bool,
 
 	// Validate comment length (spaces count as characters)
 	if len(client.Comment) > 100 {
-		return false, common.NewError("Client comment exceeds maximum length of 100 characters (spaces count as characters)")
+		return common.NewError("Client comment exceeds maximum length of 100 characters (spaces count as characters)")
+	}
+	if client.SubUpdates < 0 {
+		return common.NewError("Subscription update interval must not be negative")
 	}
 	
 	// Trim whitespace from comment
@@ -234,6 +295,11 @@ func (s *ClientService) AddClient(userId int, client *model.ClientEntity) (bool,
 	client.Email = strings.ToLower(client.Email)
 	client.UserId = userId
 
+	// Reject flows the assigned inbounds' transport cannot carry
+	if err := s.validateClientFlowForInbounds(client.Email, client.Flow, client.InboundIds); err != nil {
+		return err
+	}
+
 	// Set timestamps
 	now := time.Now().Unix()
 	if client.CreatedAt == 0 {
@@ -275,6 +341,7 @@ func (s *ClientService) AddClient(userId int, client *model.ClientEntity) (bool,
 		"limit_ip", "total_gb", "expiry_time", "enable", "status",
 		"tg_id", "sub_id", "comment", "reset", "created_at", "updated_at",
 		"up", "down", "all_time", "last_online", "hwid_enabled", "max_hwid",
+		"sub_updates",
 	}
 	// Add group_id only if it's not nil
 	if client.GroupId != nil {
@@ -283,7 +350,7 @@ func (s *ClientService) AddClient(userId int, client *model.ClientEntity) (bool,
 	
 	err = tx.Select(fieldsToInsert).Create(client).Error
 	if err != nil {
-		return false, err
+		return err
 	}
 
 	// Traffic statistics are now stored directly in ClientEntity table
@@ -293,65 +360,27 @@ func (s *ClientService) AddClient(userId int, client *model.ClientEntity) (bool,
 	if len(client.InboundIds) > 0 {
 		err = s.AssignClientToInbounds(tx, client.Id, client.InboundIds)
 		if err != nil {
-			return false, err
+			return err
+		}
+	}
+
+	// Restrict to nodes if provided
+	if len(client.NodeIds) > 0 {
+		err = s.AssignClientToNodes(tx, client.Id, client.NodeIds)
+		if err != nil {
+			return err
 		}
 	}
 	
 	// Commit client transaction first to avoid nested transactions
 	err = tx.Commit().Error
 	if err != nil {
-		return false, err
+		return err
 	}
 	
 	// Invalidate cache for this user's clients
 	cache.InvalidateClients(userId)
-	
-	// Now update Settings for all assigned inbounds
-	// This is done AFTER committing the client transaction to avoid nested transactions and database locks
-	needRestart := false
-	if len(client.InboundIds) > 0 {
-		inboundService := InboundService{}
-		for _, inboundId := range client.InboundIds {
-			inbound, err := inboundService.GetInbound(inboundId)
-			if err != nil {
-				logger.Warningf("Failed to get inbound %d for settings update: %v", inboundId, err)
-				continue
-			}
-			
-			// Get all clients for this inbound (from ClientEntity)
-			clientEntities, err := s.GetClientsForInbound(inboundId)
-			if err != nil {
-				logger.Warningf("Failed to get clients for inbound %d: %v", inboundId, err)
-				continue
-			}
-			
-			// Rebuild Settings from ClientEntity
-			newSettings, err := inboundService.BuildSettingsFromClientEntities(inbound, clientEntities)
-			if err != nil {
-				logger.Warningf("Failed to build settings for inbound %d: %v", inboundId, err)
-				continue
-			}
-			
-			// Update inbound Settings (this will open its own transaction)
-			// Use retry logic to handle database lock errors
-			inbound.Settings = newSettings
-			_, inboundNeedRestart, err := inboundService.updateInboundWithRetry(inbound)
-			if err != nil {
-				logger.Warningf("Failed to update inbound %d settings: %v", inboundId, err)
-				// Continue with other inbounds
-			} else if inboundNeedRestart {
-				needRestart = true
-			}
-		}
-	}
-
-	// Send notification about client creation
-	tgbotService := Tgbot{}
-	if tgbotService.IsRunning() {
-		tgbotService.NotifyClientCreated(client)
-	}
-
-	return needRestart, nil
+	return nil
 }
 
 // UpdateClient updates an existing client.
@@ -363,14 +392,14 @@ func (s *ClientService) UpdateClient(userId int, client *model.ClientEntity) (bo
 		return false, err
 	}
 	if existing.UserId != userId {
-		return false, common.NewError("Client not found or access denied")
+		return false, common.NewCodedError(common.ErrCodeNotFound, "Client not found or access denied")
 	}
 
 	// Check email uniqueness if email changed
 	if client.Email != "" && strings.ToLower(client.Email) != strings.ToLower(existing.Email) {
 		existingByEmail, err := s.GetClientByEmail(userId, client.Email)
 		if err == nil && existingByEmail != nil && existingByEmail.Id != client.Id {
-			return false, common.NewError("Client with email already exists: ", client.Email)
+			return false, common.NewCodedError(common.ErrCodeClientEmailExists, "Client with email already exists: ", client.Email)
 		}
 	}
 
@@ -378,6 +407,9 @@ func (s *ClientService) UpdateClient(userId int, client *model.ClientEntity) (bo
 	if client.Comment != "" && len(client.Comment) > 100 {
 		return false, common.NewError("Client comment exceeds maximum length of 100 characters (spaces count as characters)")
 	}
+	if client.SubUpdates < 0 {
+		return false, common.NewError("Subscription update interval must not be negative")
+	}
 	
 	// Trim whitespace from comment if provided
 	if client.Comment != "" {
@@ -389,6 +421,15 @@ func (s *ClientService) UpdateClient(userId int, client *model.ClientEntity) (bo
 		client.Email = strings.ToLower(client.Email)
 	}
 
+	// Reject flows the assigned inbounds' transport cannot carry
+	flowInboundIds := existing.InboundIds
+	if client.InboundIds != nil {
+		flowInboundIds = client.InboundIds
+	}
+	if err := s.validateClientFlowForInbounds(existing.Email, client.Flow, flowInboundIds); err != nil {
+		return false, err
+	}
+
 	// Update timestamp
 	client.UpdatedAt = time.Now().Unix()
 
@@ -439,6 +480,7 @@ func (s *ClientService) UpdateClient(userId int, client *model.ClientEntity) (bo
 	updates["comment"] = client.Comment
 	updates["flow"] = client.Flow
 	updates["reset"] = client.Reset
+	updates["sub_updates"] = client.SubUpdates
 	// Update group_id - can be nil (no group)
 	// Only update if it's different from existing value
 	if existing.GroupId == nil && client.GroupId == nil {
@@ -520,6 +562,23 @@ func (s *ClientService) UpdateClient(userId int, client *model.ClientEntity) (bo
 	} else {
 		logger.Debugf("UpdateClient: inboundIds is nil for client %d, keeping existing assignments", client.Id)
 	}
+
+	// Update node restrictions if provided (empty array means all nodes)
+	nodesChanged := false
+	if client.NodeIds != nil {
+		err = tx.Where("client_id = ?", client.Id).Delete(&model.ClientNodeMapping{}).Error
+		if err != nil {
+			logger.Errorf("UpdateClient: failed to delete existing node mappings for client %d: %v", client.Id, err)
+			return false, err
+		}
+		if len(client.NodeIds) > 0 {
+			err = s.AssignClientToNodes(tx, client.Id, client.NodeIds)
+			if err != nil {
+				return false, err
+			}
+		}
+		nodesChanged = !sameIntSet(existing.NodeIds, client.NodeIds)
+	}
 	
 	// Traffic statistics are now stored directly in ClientEntity table
 	// No need to sync with client_traffics - all fields (TotalGB, ExpiryTime, Enable, Email) are in ClientEntity
@@ -721,6 +780,11 @@ func (s *ClientService) UpdateClient(userId int, client *model.ClientEntity) (bo
 		if !multiMode {
 			needRestart = true
 		}
+
+		// Node restrictions only take effect when the node configs are pushed again
+		if multiMode && nodesChanged {
+			needRestart = true
+		}
 		
 		// Restart Xray asynchronously in background to apply changes
 		// This ensures config is fully synchronized without blocking the response
@@ -769,7 +833,7 @@ func (s *ClientService) DeleteClient(userId int, id int) (bool, error) {
 		return false, err
 	}
 	if existing.UserId != userId {
-		return false, common.NewError("Client not found or access denied")
+		return false, common.NewCodedError(common.ErrCodeNotFound, "Client not found or access denied")
 	}
 	
 	// Get inbound assignments before deleting
@@ -803,6 +867,12 @@ func (s *ClientService) DeleteClient(userId int, id int) (bool, error) {
 		return false, err
 	}
 
+	// Delete node mappings
+	err = tx.Where("client_id = ?", id).Delete(&model.ClientNodeMapping{}).Error
+	if err != nil {
+		return false, err
+	}
+
 	// Delete client
 	err = tx.Where("id = ? AND user_id = ?", id, userId).Delete(&model.ClientEntity{}).Error
 	if err != nil {
@@ -903,13 +973,7 @@ func (s *ClientService) DeleteClient(userId int, id int) (bool, error) {
 	// Fastest approach: instant config update + async restart (user gets instant response, restart happens in background)
 	if needRestart {
 		logger.Debugf("DeleteClient: scheduling async restart to apply changes")
-		go func() {
-			if err := xrayService.RestartXray(false); err != nil {
-				logger.Warningf("DeleteClient: failed to restart Xray: %v", err)
-			} else {
-				logger.Debugf("DeleteClient: Xray restarted successfully (config synced)")
-			}
-		}()
+		xrayService.RestartXrayAsync(false)
 		
 		// Send notification about client deletion
 		tgbotService := Tgbot{}
@@ -1092,20 +1156,15 @@ func (s *ClientService) DisableClientsByEmail(clientsToDisable map[string]string
 			}
 		}
 	} else {
-		// Single mode: instantly update config.json and restart
+		// Single mode: remove from the running Xray via API and keep config.json in sync;
+		// a restart is only needed when the API cannot apply the removal
 		xrayService := XrayService{}
 		if xrayService.IsXrayRunning() {
-			processConfig := xrayService.GetConfig()
-			if processConfig != nil {
-				for email, inboundInfo := range emailToInbound {
-					// Instantly remove client from config.json
-					if err := xray.UpdateConfigFileAfterUserRemoval(processConfig, inboundInfo.tag, email); err != nil {
-						logger.Warningf("DisableClientsByEmail: failed to instantly remove client %s from config.json: %v", email, err)
-						needRestart = true
-					} else {
-						logger.Infof("DisableClientsByEmail: instantly removed client %s from config.json (inbound: %s)", email, inboundInfo.tag)
-						needRestart = true
-					}
+			for email, inboundInfo := range emailToInbound {
+				if s.removeClientFromLocalXray(inboundInfo.tag, email) {
+					logger.Infof("DisableClientsByEmail: removed client %s from Xray via API (inbound: %s)", email, inboundInfo.tag)
+				} else {
+					needRestart = true
 				}
 			}
 		}
@@ -1187,6 +1246,28 @@ func (s *ClientService) DisableClientsByEmail(clientsToDisable map[string]string
 	return needRestart, nil
 }
 
+// removeClientFromLocalXray removes a client from an inbound of the running local Xray via API
+// and drops it from config.json, so a later restart does not bring it back.
+// It returns false when the API removal failed and a restart is needed to apply it.
+func (s *ClientService) removeClientFromLocalXray(tag string, email string) bool {
+	inboundService := InboundService{}
+	api, err := inboundService.getXrayAPI(p.GetAPIPort())
+	if err != nil {
+		logger.Debugf("removeClientFromLocalXray: failed to get XrayAPI connection: %v", err)
+		return false
+	}
+	if err := api.RemoveUser(tag, email); err != nil && !strings.Contains(err.Error(), "not found") {
+		logger.Warningf("removeClientFromLocalXray: failed to remove client %s from inbound %s via API: %v", email, tag, err)
+		return false
+	}
+	if processConfig := p.GetConfig(); processConfig != nil {
+		if err := xray.UpdateConfigFileAfterUserRemoval(processConfig, tag, email); err != nil {
+			logger.Debugf("removeClientFromLocalXray: failed to remove client %s from config.json: %v", email, err)
+		}
+	}
+	return true
+}
+
 // ResetAllClientTraffics resets traffic counters for all clients of a specific user.
 // Returns whether Xray needs restart and any error.
 func (s *ClientService) ResetAllClientTraffics(userId int) (bool, error) {
@@ -1203,9 +1284,10 @@ func (s *ClientService) ResetAllClientTraffics(userId int) (bool, error) {
 	result := db.Model(&model.ClientEntity{}).
 		Where("user_id = ?", userId).
 		Updates(map[string]interface{}{
-			"up":       0,
-			"down":     0,
-			"all_time": 0,
+			"up":                      0,
+			"down":                    0,
+			"all_time":                0,
+			"last_traffic_reset_time": time.Now().UnixMilli(),
 		})
 	
 	if result.Error != nil {
@@ -1335,7 +1417,7 @@ func (s *ClientService) ResetClientTraffic(userId int, clientId int) (bool, erro
 		return false, err
 	}
 	if client.UserId != userId {
-		return false, common.NewError("Client not found or access denied")
+		return false, common.NewCodedError(common.ErrCodeNotFound, "Client not found or access denied")
 	}
 	
 	// Check if client was expired due to traffic
@@ -1345,9 +1427,10 @@ func (s *ClientService) ResetClientTraffic(userId int, clientId int) (bool, erro
 	result := db.Model(&model.ClientEntity{}).
 		Where("id = ? AND user_id = ?", clientId, userId).
 		Updates(map[string]interface{}{
-			"up":       0,
-			"down":     0,
-			"all_time": 0,
+			"up":                      0,
+			"down":                    0,
+			"all_time":                0,
+			"last_traffic_reset_time": time.Now().UnixMilli(),
 		})
 	
 	if result.Error != nil {
@@ -1415,6 +1498,9 @@ func (s *ClientService) ResetClientTraffic(userId int, clientId int) (bool, erro
 						nodes, err := nodeService.GetNodesForInbound(inboundId)
 						if err == nil && len(nodes) > 0 {
 							for _, node := range nodes {
+								if !s.IsClientOnNode(client.Id, node.Id) {
+									continue
+								}
 								go func(n *model.Node) {
 									if err := nodeService.AddUserToNode(n, string(inbound.Protocol), inbound.Tag, clientData); err != nil {
 										logger.Warningf("ResetClientTraffic: failed to re-add client %s to node %s via API: %v", client.Email, n.Name, err)
@@ -1484,6 +1570,28 @@ func (s *ClientService) ResetClientTraffic(userId int, clientId int) (bool, erro
 	return needRestart, nil
 }
 
+// GetClientsWithResetSchedule returns all clients that have a traffic reset period (Reset > 0) configured.
+// Clients expired by time are skipped: resetting their traffic would not make them usable again.
+func (s *ClientService) GetClientsWithResetSchedule() ([]*model.ClientEntity, error) {
+	db := database.GetDB()
+	var clients []*model.ClientEntity
+	err := db.Where("reset > ? AND status <> ?", 0, "expired_time").
+		Order("id ASC").
+		Find(&clients).Error
+	if err != nil {
+		return nil, err
+	}
+	return clients, nil
+}
+
+// SetClientLastTrafficResetTime records when the traffic of a client was last reset (unix milliseconds).
+func (s *ClientService) SetClientLastTrafficResetTime(clientId int, resetTime int64) error {
+	db := database.GetDB()
+	return db.Model(&model.ClientEntity{}).
+		Where("id = ?", clientId).
+		Update("last_traffic_reset_time", resetTime).Error
+}
+
 // DelDepletedClients deletes clients that have exhausted their traffic limits or expired.
 // Returns the number of deleted clients, whether Xray needs restart, and any error.
 func (s *ClientService) DelDepletedClients(userId int) (int, bool, error) {
@@ -1553,6 +1661,12 @@ func (s *ClientService) DelDepletedClients(userId int) (int, bool, error) {
 	if err != nil {
 		return 0, false, err
 	}
+
+	// Delete client-node mappings
+	err = tx.Where("client_id IN (?)", clientIdsToDelete).Delete(&model.ClientNodeMapping{}).Error
+	if err != nil {
+		return 0, false, err
+	}
 	
 	// Delete client traffic records
 	err = tx.Where("email IN (?)", depletedEmails).Delete(&xray.ClientTraffic{}).Error
@@ -1652,45 +1766,46 @@ func (s *ClientService) DelDepletedClients(userId int) (int, bool, error) {
 }
 
 // BulkResetTraffic resets traffic counters for multiple clients.
-// Returns whether Xray needs restart and any error.
-func (s *ClientService) BulkResetTraffic(userId int, clientIds []int) (bool, error) {
+// Returns the per-client result, whether Xray needs restart and any error.
+func (s *ClientService) BulkResetTraffic(userId int, clientIds []int) (*BulkResult, bool, error) {
+	result := newBulkResult()
 	if len(clientIds) == 0 {
-		return false, nil
+		return result, false, nil
 	}
 
 	db := database.GetDB()
 
-	// Verify all clients belong to user
-	var count int64
-	err := db.Model(&model.ClientEntity{}).
-		Where("id IN ? AND user_id = ?", clientIds, userId).
-		Count(&count).Error
+	// Skip clients that do not belong to user
+	clients, err := s.getBulkClients(userId, clientIds, result)
 	if err != nil {
-		return false, err
+		return nil, false, err
 	}
-	if int(count) != len(clientIds) {
-		return false, common.NewError("Some clients not found or access denied")
+	if len(clients) == 0 {
+		return result, false, nil
 	}
+	clientIds = bulkClientIds(clients)
 
 	// Get clients that were expired due to traffic before reset
 	var expiredClients []model.ClientEntity
 	err = db.Where("id IN ? AND user_id = ? AND status = ?", clientIds, userId, "expired_traffic").Find(&expiredClients).Error
 	if err != nil {
-		return false, err
+		return nil, false, err
 	}
 
 	// Reset traffic for selected clients
-	result := db.Model(&model.ClientEntity{}).
+	resetResult := db.Model(&model.ClientEntity{}).
 		Where("id IN ? AND user_id = ?", clientIds, userId).
 		Updates(map[string]interface{}{
-			"up":       0,
-			"down":     0,
-			"all_time": 0,
+			"up":                      0,
+			"down":                    0,
+			"all_time":                0,
+			"last_traffic_reset_time": time.Now().UnixMilli(),
 		})
 
-	if result.Error != nil {
-		return false, result.Error
+	if resetResult.Error != nil {
+		return nil, false, resetResult.Error
 	}
+	result.succeed(clients)
 
 	// Invalidate cache for this user's clients
 	cache.InvalidateClients(userId)
@@ -1766,6 +1881,9 @@ func (s *ClientService) BulkResetTraffic(userId int, clientIds []int) (bool, err
 						nodes, err := nodeService.GetNodesForInbound(inboundId)
 						if err == nil && len(nodes) > 0 {
 							for _, node := range nodes {
+								if !s.IsClientOnNode(client.Id, node.Id) {
+									continue
+								}
 								go func(n *model.Node) {
 									if err := nodeService.AddUserToNode(n, string(inbound.Protocol), inbound.Tag, clientData); err != nil {
 										logger.Warningf("BulkResetTraffic: failed to re-add client %s to node %s via API: %v", client.Email, n.Name, err)
@@ -1818,68 +1936,100 @@ func (s *ClientService) BulkResetTraffic(userId int, clientIds []int) (bool, err
 		}
 	}
 
-	return needRestart, nil
+	return result, needRestart, nil
 }
 
-// BulkClearHWIDs clears HWIDs for multiple clients.
-func (s *ClientService) BulkClearHWIDs(userId int, clientIds []int) error {
-	if len(clientIds) == 0 {
-		return nil
+// ClearClientHWIDs removes all HWIDs of a client, including blocked ones, so its devices are
+// registered from scratch on their next subscription request.
+// Returns the number of HWIDs removed.
+func (s *ClientService) ClearClientHWIDs(userId int, clientId int) (int64, error) {
+	client, err := s.GetClient(clientId)
+	if err != nil || client.UserId != userId {
+		return 0, common.NewCodedError(common.ErrCodeNotFound, "Client not found or access denied")
 	}
 
-	// Verify all clients belong to user
-	db := database.GetDB()
 	var count int64
-	err := db.Model(&model.ClientEntity{}).
-		Where("id IN ? AND user_id = ?", clientIds, userId).
-		Count(&count).Error
+	db := database.GetDB()
+	err = db.Transaction(func(tx *gorm.DB) error {
+		result := deleteClientHWIDs(tx, clientId)
+		if result.Error != nil {
+			return result.Error
+		}
+		count = result.RowsAffected
+		return nil
+	})
 	if err != nil {
-		return err
+		return 0, err
 	}
-	if int(count) != len(clientIds) {
-		return common.NewError("Some clients not found or access denied")
+	logger.Infof("Cleared %d HWIDs for client %d", count, clientId)
+
+	// Invalidate cache for this user's clients
+	cache.InvalidateClients(userId)
+
+	return count, nil
+}
+
+// deleteClientHWIDs deletes every HWID row of a client on tx, active, inactive and blocked alike.
+func deleteClientHWIDs(tx *gorm.DB, clientId int) *gorm.DB {
+	return tx.Where("client_id = ?", clientId).Delete(&model.ClientHWID{})
+}
+
+// BulkClearHWIDs clears HWIDs for multiple clients.
+// Returns the per-client result and any error.
+func (s *ClientService) BulkClearHWIDs(userId int, clientIds []int) (*BulkResult, error) {
+	result := newBulkResult()
+	if len(clientIds) == 0 {
+		return result, nil
+	}
+
+	// Skip clients that do not belong to user
+	clients, err := s.getBulkClients(userId, clientIds, result)
+	if err != nil {
+		return nil, err
 	}
 
 	// Clear HWIDs for selected clients
 	hwidService := ClientHWIDService{}
-	for _, clientId := range clientIds {
-		err = hwidService.ClearHWIDsForClient(clientId)
+	for _, client := range clients {
+		err = hwidService.ClearHWIDsForClient(client.Id)
 		if err != nil {
-			logger.Warningf("Failed to clear HWIDs for client %d: %v", clientId, err)
+			logger.Warningf("Failed to clear HWIDs for client %d: %v", client.Id, err)
+			result.fail(client.Id, client.Email, err.Error())
+			continue
 		}
+		result.Succeeded = append(result.Succeeded, client.Id)
 	}
 
 	// Invalidate cache for this user's clients
 	cache.InvalidateClients(userId)
 
-	return nil
+	return result, nil
 }
 
 // BulkDelete deletes multiple clients.
-// Returns whether Xray needs restart and any error.
-func (s *ClientService) BulkDelete(userId int, clientIds []int) (bool, error) {
+// Returns the per-client result, whether Xray needs restart and any error.
+func (s *ClientService) BulkDelete(userId int, clientIds []int) (*BulkResult, bool, error) {
+	result := newBulkResult()
 	if len(clientIds) == 0 {
-		return false, nil
+		return result, false, nil
 	}
 
-	// Verify all clients belong to user
+	// Skip clients that do not belong to user
 	db := database.GetDB()
-	var count int64
-	err := db.Model(&model.ClientEntity{}).
-		Where("id IN ? AND user_id = ?", clientIds, userId).
-		Count(&count).Error
+	clients, err := s.getBulkClients(userId, clientIds, result)
 	if err != nil {
-		return false, err
+		return nil, false, err
 	}
-	if int(count) != len(clientIds) {
-		return false, common.NewError("Some clients not found or access denied")
+	if len(clients) == 0 {
+		return result, false, nil
 	}
+	clientIds = bulkClientIds(clients)
 
 	// Get inbound assignments before deleting
 	var mappings []model.ClientInboundMapping
 	err = db.Where("client_id IN ?", clientIds).Find(&mappings).Error
 	if err != nil {
-		return false, err
+		return nil, false, err
 	}
 
 	affectedInboundIds := make(map[int]bool)
@@ -1901,14 +2051,21 @@ func (s *ClientService) BulkDelete(userId int, clientIds []int) (bool, error) {
 	// Delete inbound mappings
 	err = tx.Where("client_id IN ?", clientIds).Delete(&model.ClientInboundMapping{}).Error
 	if err != nil {
-		return false, err
+		return nil, false, err
+	}
+
+	// Delete node mappings
+	err = tx.Where("client_id IN ?", clientIds).Delete(&model.ClientNodeMapping{}).Error
+	if err != nil {
+		return nil, false, err
 	}
 
 	// Delete clients
 	err = tx.Where("id IN ? AND user_id = ?", clientIds, userId).Delete(&model.ClientEntity{}).Error
 	if err != nil {
-		return false, err
+		return nil, false, err
 	}
+	result.succeed(clients)
 
 	// Invalidate cache for this user's clients
 	cache.InvalidateClients(userId)
@@ -1940,34 +2097,33 @@ func (s *ClientService) BulkDelete(userId int, clientIds []int) (bool, error) {
 		}
 	}
 
-	return needRestart, nil
+	return result, needRestart, nil
 }
 
 // BulkEnable enables or disables multiple clients.
-// Returns whether Xray needs restart and any error.
-func (s *ClientService) BulkEnable(userId int, clientIds []int, enable bool) (bool, error) {
+// Returns the per-client result, whether Xray needs restart and any error.
+func (s *ClientService) BulkEnable(userId int, clientIds []int, enable bool) (*BulkResult, bool, error) {
+	result := newBulkResult()
 	if len(clientIds) == 0 {
-		return false, nil
+		return result, false, nil
 	}
 
-	// Verify all clients belong to user
+	// Skip clients that do not belong to user
 	db := database.GetDB()
-	var count int64
-	err := db.Model(&model.ClientEntity{}).
-		Where("id IN ? AND user_id = ?", clientIds, userId).
-		Count(&count).Error
+	clients, err := s.getBulkClients(userId, clientIds, result)
 	if err != nil {
-		return false, err
+		return nil, false, err
 	}
-	if int(count) != len(clientIds) {
-		return false, common.NewError("Some clients not found or access denied")
+	if len(clients) == 0 {
+		return result, false, nil
 	}
+	clientIds = bulkClientIds(clients)
 
 	// Get inbound assignments
 	var mappings []model.ClientInboundMapping
 	err = db.Where("client_id IN ?", clientIds).Find(&mappings).Error
 	if err != nil {
-		return false, err
+		return nil, false, err
 	}
 
 	affectedInboundIds := make(map[int]bool)
@@ -1980,8 +2136,9 @@ func (s *ClientService) BulkEnable(userId int, clientIds []int, enable bool) (bo
 		Where("id IN ? AND user_id = ?", clientIds, userId).
 		Update("enable", enable).Error
 	if err != nil {
-		return false, err
+		return nil, false, err
 	}
+	result.succeed(clients)
 
 	// Invalidate cache for this user's clients
 	cache.InvalidateClients(userId)
@@ -2100,44 +2257,38 @@ func (s *ClientService) BulkEnable(userId int, clientIds []int, enable bool) (bo
 	if !multiMode && needRestart {
 		logger.Debugf("BulkEnable: scheduling async restart to apply changes")
 		xrayService := XrayService{}
-		go func() {
-			if err := xrayService.RestartXray(false); err != nil {
-				logger.Warningf("BulkEnable: failed to restart Xray: %v", err)
-			} else {
-				logger.Debugf("BulkEnable: Xray restarted successfully (config synced)")
-			}
-		}()
+		xrayService.RestartXrayAsync(false)
 		
 		// Note: Notifications are now handled by the caller (e.g., bulkEnable controller)
 		// to allow sending group-level notifications instead of per-client notifications
 		
-		return false, nil // No need for synchronous restart
+		return result, false, nil // No need for synchronous restart
 	}
 
 	// Note: Notifications are now handled by the caller (e.g., bulkEnable controller)
 	// to allow sending group-level notifications instead of per-client notifications
 
-	return needRestart, nil
+	return result, needRestart, nil
 }
 
 // BulkSetHWIDLimit sets HWID limit for multiple clients.
-func (s *ClientService) BulkSetHWIDLimit(userId int, clientIds []int, maxHwid int, enabled bool) error {
+// Returns the per-client result and any error.
+func (s *ClientService) BulkSetHWIDLimit(userId int, clientIds []int, maxHwid int, enabled bool) (*BulkResult, error) {
+	result := newBulkResult()
 	if len(clientIds) == 0 {
-		return nil
+		return result, nil
 	}
 
-	// Verify all clients belong to user
+	// Skip clients that do not belong to user
 	db := database.GetDB()
-	var count int64
-	err := db.Model(&model.ClientEntity{}).
-		Where("id IN ? AND user_id = ?", clientIds, userId).
-		Count(&count).Error
+	clients, err := s.getBulkClients(userId, clientIds, result)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	if int(count) != len(clientIds) {
-		return common.NewError("Some clients not found or access denied")
+	if len(clients) == 0 {
+		return result, nil
 	}
+	clientIds = bulkClientIds(clients)
 
 	// Update HWID settings
 	err = db.Model(&model.ClientEntity{}).
@@ -2148,33 +2299,116 @@ func (s *ClientService) BulkSetHWIDLimit(userId int, clientIds []int, maxHwid in
 		}).Error
 
 	if err != nil {
-		return err
+		return nil, err
 	}
+	result.succeed(clients)
 
 	// Invalidate cache for this user's clients
 	cache.InvalidateClients(userId)
 
-	return nil
+	return result, nil
 }
 
-// BulkAssignInbounds assigns multiple inbounds to multiple clients.
-// Returns whether Xray needs restart and any error.
-func (s *ClientService) BulkAssignInbounds(userId int, clientIds []int, inboundIds []int) (bool, error) {
-	if len(clientIds) == 0 || len(inboundIds) == 0 {
-		return false, nil
+// BulkSetExpiryRelative extends the expiry time of multiple clients by addDays, counted from the
+// current expiry or from now if the client has already expired. Clients with a delayed start
+// (negative expiry time) get addDays more duration; clients without an expiry time are skipped.
+// Clients expired only by time, or by traffic still within their limit, are set back to active
+// (as UpdateClient does). All clients are updated in one statement and each affected inbound is
+// rebuilt once.
+// Returns the per-client result, whether Xray needs restart and any error.
+func (s *ClientService) BulkSetExpiryRelative(userId int, clientIds []int, addDays int) (*BulkResult, bool, error) {
+	result := newBulkResult()
+	if addDays <= 0 {
+		return nil, false, common.NewError("days to add must be positive:", addDays)
+	}
+	if len(clientIds) == 0 {
+		return result, false, nil
 	}
 
-	// Verify all clients belong to user
-	db := database.GetDB()
-	var clientCount int64
-	err := db.Model(&model.ClientEntity{}).
-		Where("id IN ? AND user_id = ?", clientIds, userId).
-		Count(&clientCount).Error
+	clients, err := s.getBulkClients(userId, clientIds, result)
 	if err != nil {
-		return false, err
+		return nil, false, err
+	}
+
+	now := time.Now().UnixMilli()
+	var expiryCase, statusCase strings.Builder
+	expiryArgs := make([]any, 0)
+	statusArgs := make([]any, 0)
+	extended := make([]model.ClientEntity, 0, len(clients))
+	for _, client := range clients {
+		expiryTime, ok := relativeExpiryTime(&client, now, addDays)
+		if !ok {
+			result.fail(client.Id, client.Email, "client has no expiry time")
+			continue
+		}
+		expiryCase.WriteString(" WHEN ? THEN ?")
+		expiryArgs = append(expiryArgs, client.Id, expiryTime)
+
+		if reactivatedByExtension(&client) {
+			statusCase.WriteString(" WHEN ? THEN 'active'")
+			statusArgs = append(statusArgs, client.Id)
+		}
+		extended = append(extended, client)
+	}
+	if len(extended) == 0 {
+		return result, false, nil
+	}
+
+	updates := map[string]any{
+		"expiry_time": gorm.Expr("CASE id"+expiryCase.String()+" ELSE expiry_time END", expiryArgs...),
+	}
+	if len(statusArgs) > 0 {
+		updates["status"] = gorm.Expr("CASE id"+statusCase.String()+" ELSE status END", statusArgs...)
+	}
+	extendedIds := bulkClientIds(extended)
+	err = database.GetDB().Model(&model.ClientEntity{}).
+		Where("id IN ? AND user_id = ?", extendedIds, userId).
+		Updates(updates).Error
+	if err != nil {
+		return nil, false, err
+	}
+	result.succeed(extended)
+
+	// Invalidate cache for this user's clients
+	cache.InvalidateClients(userId)
+
+	needRestart, err := s.rebuildClientInbounds(extendedIds)
+	if err != nil {
+		logger.Warningf("BulkSetExpiryRelative: failed to rebuild inbounds: %v", err)
 	}
-	if int(clientCount) != len(clientIds) {
-		return false, common.NewError("Some clients not found or access denied")
+	return result, needRestart, nil
+}
+
+// relativeExpiryTime returns the expiry time of client extended by addDays from max(now, current expiry).
+// For a delayed start (negative expiry time) the duration grows by addDays instead.
+// Returns false if the client has no expiry time.
+func relativeExpiryTime(client *model.ClientEntity, now int64, addDays int) (int64, bool) {
+	extension := int64(addDays) * 24 * 60 * 60 * 1000
+	switch {
+	case client.ExpiryTime == 0:
+		return 0, false
+	case client.ExpiryTime < 0:
+		// Delayed start: the duration is stored as a negative value
+		return client.ExpiryTime - extension, true
+	default:
+		return max(now, client.ExpiryTime) + extension, true
+	}
+}
+
+// reactivatedByExtension reports whether an enabled expired client becomes active again once its
+// expiry time is extended, which is the case unless its traffic limit is exhausted.
+func reactivatedByExtension(client *model.ClientEntity) bool {
+	wasExpired := client.Status == "expired_traffic" || client.Status == "expired_time"
+	trafficExceeded := client.TotalGB > 0 && client.Up+client.Down >= int64(client.TotalGB*1024*1024*1024)
+	return wasExpired && !trafficExceeded && client.Enable
+}
+
+// BulkAssignInbounds assigns multiple inbounds to multiple clients.
+// Returns the per-client result, whether Xray needs restart and any error.
+func (s *ClientService) BulkAssignInbounds(userId int, clientIds []int, inboundIds []int) (*BulkResult, bool, error) {
+	result := newBulkResult()
+	if len(clientIds) == 0 || len(inboundIds) == 0 {
+		return result, false, nil
 	}
 
 	// Verify all inbounds belong to user
@@ -2182,20 +2416,19 @@ func (s *ClientService) BulkAssignInbounds(userId int, clientIds []int, inboundI
 	for _, inboundId := range inboundIds {
 		inbound, err := inboundService.GetInbound(inboundId)
 		if err != nil {
-			return false, common.NewError("Inbound not found: %d", inboundId)
+			return nil, false, common.NewCodedErrorf(common.ErrCodeNotFound, "Inbound not found: %d", inboundId)
 		}
 		if inbound.UserId != userId {
-			return false, common.NewError("Inbound access denied: %d", inboundId)
+			return nil, false, common.NewCodedErrorf(common.ErrCodeNotFound, "Inbound access denied: %d", inboundId)
 		}
 	}
 
 	needRestart := false
 
-	// Get clients to update
-	var clients []model.ClientEntity
-	err = db.Where("id IN ? AND user_id = ?", clientIds, userId).Find(&clients).Error
+	// Get clients to update, skipping clients that do not belong to user
+	clients, err := s.getBulkClients(userId, clientIds, result)
 	if err != nil {
-		return false, err
+		return nil, false, err
 	}
 
 	// For each client, add the new inbounds (keeping existing ones)
@@ -2203,6 +2436,7 @@ func (s *ClientService) BulkAssignInbounds(userId int, clientIds []int, inboundI
 		// Get current inbound assignments
 		currentInboundIds, err := s.GetInboundIdsForClient(client.Id)
 		if err != nil {
+			result.fail(client.Id, client.Email, err.Error())
 			continue
 		}
 
@@ -2226,8 +2460,10 @@ func (s *ClientService) BulkAssignInbounds(userId int, clientIds []int, inboundI
 		clientNeedRestart, err := s.UpdateClient(userId, &client)
 		if err != nil {
 			logger.Warningf("Failed to update client %d inbounds: %v", client.Id, err)
+			result.fail(client.Id, client.Email, err.Error())
 			continue
 		}
+		result.Succeeded = append(result.Succeeded, client.Id)
 		if clientNeedRestart {
 			needRestart = true
 		}
@@ -2236,5 +2472,5 @@ func (s *ClientService) BulkAssignInbounds(userId int, clientIds []int, inboundI
 	// Invalidate cache for this user's clients
 	cache.InvalidateClients(userId)
 
-	return needRestart, nil
+	return result, needRestart, nil
 }
\ No newline at end of file
@@ -0,0 +1,118 @@
+package service
+
+import (
+	"github.com/konstpic/sharx-code/v2/database"
+	"github.com/konstpic/sharx-code/v2/database/model"
+	"github.com/konstpic/sharx-code/v2/logger"
+)
+
+// BulkFailure is a client a bulk operation was not applied to, with the reason.
+type BulkFailure struct {
+	ClientId int    `json:"clientId"`
+	Email    string `json:"email,omitempty"`
+	Reason   string `json:"reason"`
+}
+
+// BulkResult reports which clients a bulk operation was applied to and which failed.
+type BulkResult struct {
+	Succeeded []int         `json:"succeeded"`
+	Failed    []BulkFailure `json:"failed"`
+}
+
+// newBulkResult creates an empty result, so both lists are serialized as arrays.
+func newBulkResult() *BulkResult {
+	return &BulkResult{
+		Succeeded: make([]int, 0),
+		Failed:    make([]BulkFailure, 0),
+	}
+}
+
+// fail records that the operation could not be applied to a client.
+func (r *BulkResult) fail(clientId int, email string, reason string) {
+	r.Failed = append(r.Failed, BulkFailure{ClientId: clientId, Email: email, Reason: reason})
+}
+
+// succeed records that the operation was applied to the clients.
+func (r *BulkResult) succeed(clients []model.ClientEntity) {
+	for _, client := range clients {
+		r.Succeeded = append(r.Succeeded, client.Id)
+	}
+}
+
+// getBulkClients loads the clients of clientIds that belong to userId.
+// Clients that do not exist or belong to another user are recorded as failed in result.
+func (s *ClientService) getBulkClients(userId int, clientIds []int, result *BulkResult) ([]model.ClientEntity, error) {
+	db := database.GetDB()
+	var clients []model.ClientEntity
+	err := db.Where("id IN ? AND user_id = ?", clientIds, userId).Find(&clients).Error
+	if err != nil {
+		return nil, err
+	}
+
+	recordMissingBulkClients(clientIds, clients, result)
+	return clients, nil
+}
+
+// recordMissingBulkClients records the IDs of clientIds that are not among the loaded clients as failed.
+func recordMissingBulkClients(clientIds []int, clients []model.ClientEntity, result *BulkResult) {
+	found := make(map[int]bool, len(clients))
+	for _, client := range clients {
+		found[client.Id] = true
+	}
+	for _, clientId := range clientIds {
+		if !found[clientId] {
+			result.fail(clientId, "", "client not found or access denied")
+			// Report each missing ID once
+			found[clientId] = true
+		}
+	}
+}
+
+// bulkClientIds returns the IDs of clients.
+func bulkClientIds(clients []model.ClientEntity) []int {
+	ids := make([]int, len(clients))
+	for i, client := range clients {
+		ids[i] = client.Id
+	}
+	return ids
+}
+
+// rebuildClientInbounds rebuilds the settings of every inbound assigned to one of clientIds once,
+// so a change to many clients costs one inbound update each instead of one per client.
+// Returns whether Xray needs restart.
+func (s *ClientService) rebuildClientInbounds(clientIds []int) (bool, error) {
+	var mappings []model.ClientInboundMapping
+	err := database.GetDB().Where("client_id IN ?", clientIds).Find(&mappings).Error
+	if err != nil {
+		return false, err
+	}
+	affectedInboundIds := make(map[int]bool)
+	for _, mapping := range mappings {
+		affectedInboundIds[mapping.InboundId] = true
+	}
+
+	needRestart := false
+	inboundService := InboundService{}
+	for inboundId := range affectedInboundIds {
+		inbound, err := inboundService.GetInbound(inboundId)
+		if err != nil {
+			continue
+		}
+		clientEntities, err := s.GetClientsForInbound(inboundId)
+		if err != nil {
+			continue
+		}
+		newSettings, err := inboundService.BuildSettingsFromClientEntities(inbound, clientEntities)
+		if err != nil {
+			continue
+		}
+		inbound.Settings = newSettings
+		_, inboundNeedRestart, err := inboundService.updateInboundWithRetry(inbound)
+		if err != nil {
+			logger.Warningf("Failed to update inbound %d settings: %v", inboundId, err)
+		} else if inboundNeedRestart {
+			needRestart = true
+		}
+	}
+	return needRestart, nil
+}
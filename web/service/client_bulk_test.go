@@ -0,0 +1,101 @@
+package service
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/konstpic/sharx-code/v2/database/model"
+)
+
+func TestBulkResultReportsPerClientFailures(t *testing.T) {
+	result := newBulkResult()
+	clients := []model.ClientEntity{{Id: 1, Email: "a@example.com"}, {Id: 2, Email: "b@example.com"}, {Id: 3, Email: "c@example.com"}}
+	// Client 4 does not exist or belongs to another user, client 3 fails when applied
+	recordMissingBulkClients([]int{1, 2, 3, 4, 4}, clients, result)
+	result.fail(3, "c@example.com", "hwid store unavailable")
+	result.succeed(clients[:2])
+
+	if !reflect.DeepEqual(result.Succeeded, []int{1, 2}) {
+		t.Fatalf("succeeded = %v, want [1 2]", result.Succeeded)
+	}
+	wantFailed := []BulkFailure{
+		{ClientId: 4, Reason: "client not found or access denied"},
+		{ClientId: 3, Email: "c@example.com", Reason: "hwid store unavailable"},
+	}
+	if !reflect.DeepEqual(result.Failed, wantFailed) {
+		t.Fatalf("failed = %+v, want %+v", result.Failed, wantFailed)
+	}
+
+	encoded, err := json.Marshal(result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"succeeded":[1,2],"failed":[{"clientId":4,"reason":"client not found or access denied"},{"clientId":3,"email":"c@example.com","reason":"hwid store unavailable"}]}`
+	if string(encoded) != want {
+		t.Fatalf("JSON = %s, want %s", encoded, want)
+	}
+}
+
+func TestBulkResultAllSucceeded(t *testing.T) {
+	result := newBulkResult()
+	clients := []model.ClientEntity{{Id: 1}, {Id: 2}}
+	recordMissingBulkClients([]int{1, 2}, clients, result)
+	result.succeed(clients)
+
+	if !reflect.DeepEqual(result.Succeeded, []int{1, 2}) || len(result.Failed) != 0 {
+		t.Fatalf("result = %+v, want clients 1 and 2 succeeded", result)
+	}
+	// Empty lists rather than null keep the response shape stable
+	encoded, _ := json.Marshal(newBulkResult())
+	if string(encoded) != `{"succeeded":[],"failed":[]}` {
+		t.Fatalf("empty result JSON = %s", encoded)
+	}
+}
+
+func TestRelativeExpiryTime(t *testing.T) {
+	now := time.Date(2026, time.January, 14, 12, 0, 0, 0, time.UTC).UnixMilli()
+	day := 24 * time.Hour.Milliseconds()
+	tests := []struct {
+		name   string
+		expiry int64
+		want   int64
+		ok     bool
+	}{
+		// Extends from the current expiry
+		{"active", now + 5*day, now + 35*day, true},
+		// Extends from now, not from the past expiry
+		{"expired", now - 10*day, now + 30*day, true},
+		// Delayed start: 7 days not yet started become 37
+		{"delayed start", -7 * day, -37 * day, true},
+		{"no expiry", 0, 0, false},
+	}
+	for _, test := range tests {
+		client := &model.ClientEntity{ExpiryTime: test.expiry}
+		got, ok := relativeExpiryTime(client, now, 30)
+		if got != test.want || ok != test.ok {
+			t.Errorf("%s: relativeExpiryTime() = %d, %v, want %d, %v", test.name, got, ok, test.want, test.ok)
+		}
+	}
+}
+
+func TestReactivatedByExtension(t *testing.T) {
+	const gb = 1024 * 1024 * 1024
+	tests := []struct {
+		name   string
+		client model.ClientEntity
+		want   bool
+	}{
+		{"active", model.ClientEntity{Enable: true, Status: "active"}, false},
+		{"expired by time", model.ClientEntity{Enable: true, Status: "expired_time"}, true},
+		{"expired by traffic within the limit", model.ClientEntity{Enable: true, Status: "expired_traffic", TotalGB: 10, Up: gb}, true},
+		{"traffic limit exhausted", model.ClientEntity{Enable: true, Status: "expired_traffic", TotalGB: 10, Up: 6 * gb, Down: 4 * gb}, false},
+		{"disabled", model.ClientEntity{Enable: false, Status: "expired_time"}, false},
+	}
+	for _, test := range tests {
+		if got := reactivatedByExtension(&test.client); got != test.want {
+			t.Errorf("%s: reactivatedByExtension() = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,329 @@
+package service
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/konstpic/sharx-code/v2/database"
+	"github.com/konstpic/sharx-code/v2/database/model"
+	"github.com/konstpic/sharx-code/v2/logger"
+	"github.com/konstpic/sharx-code/v2/util/common"
+	"github.com/konstpic/sharx-code/v2/util/random"
+)
+
+// clientImportColumns are the columns ImportClientsCSV understands, by lowercase header name.
+// Only email is required.
+var clientImportColumns = map[string]bool{
+	"email":      true,
+	"totalgb":    true,
+	"expirydays": true,
+	"limitip":    true,
+	"comment":    true,
+	"uuid":       true,
+	"password":   true,
+}
+
+// ClientImportRow is the outcome of one data row of a client import.
+// Row is the line number in the CSV, the header being line 1.
+type ClientImportRow struct {
+	Row      int    `json:"row"`
+	Email    string `json:"email,omitempty"`
+	ClientId int    `json:"clientId,omitempty"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+// ClientImportResult reports which rows of a client import were created and which failed.
+type ClientImportResult struct {
+	Created []ClientImportRow `json:"created"`
+	Failed  []ClientImportRow `json:"failed"`
+}
+
+// Summary describes the result for a response message, e.g. "Imported 48 of 50 clients".
+func (r *ClientImportResult) Summary() string {
+	total := len(r.Created) + len(r.Failed)
+	if len(r.Failed) == 0 {
+		return fmt.Sprintf("Imported %d clients", total)
+	}
+	return fmt.Sprintf("Imported %d of %d clients, %d failed", len(r.Created), total, len(r.Failed))
+}
+
+// ImportClientsCSV creates a client for each data row of a CSV file and assigns it to inboundIds.
+// The first row is the header; columns are matched by name, case-insensitively:
+// email, totalGB, expiryDays, limitIp, comment, uuid and password. A positive expiryDays expires
+// the client that many days from now, a negative one starts the countdown on first use, and
+// 0 or empty never expires. UUID and password are generated when empty. ClientEntity has no IP
+// limit, so limitIp is validated but not stored.
+// A row that fails (e.g. a duplicate email) is reported and does not stop the import.
+// All rows are stored first, then each inbound is rebuilt once and one summary is sent to the
+// Telegram admins instead of a notification per client.
+// Returns the per-row result, whether Xray needs restart and any error.
+func (s *ClientService) ImportClientsCSV(userId int, data []byte, inboundIds []int) (*ClientImportResult, bool, error) {
+	// Verify all inbounds belong to user
+	inboundService := InboundService{}
+	for _, inboundId := range inboundIds {
+		inbound, err := inboundService.GetInbound(inboundId)
+		if err != nil {
+			return nil, false, common.NewCodedErrorf(common.ErrCodeNotFound, "Inbound not found: %d", inboundId)
+		}
+		if inbound.UserId != userId {
+			return nil, false, common.NewCodedErrorf(common.ErrCodeNotFound, "Inbound access denied: %d", inboundId)
+		}
+	}
+
+	result, err := importClientRows(data, func(client *model.ClientEntity) error {
+		client.InboundIds = inboundIds
+		return s.insertClient(userId, client)
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	createdIds := make([]int, len(result.Created))
+	for i, row := range result.Created {
+		createdIds[i] = row.ClientId
+	}
+	if len(createdIds) == 0 {
+		return result, false, nil
+	}
+
+	needRestart, err := s.rebuildClientInbounds(createdIds)
+	if err != nil {
+		logger.Warningf("ImportClientsCSV: failed to rebuild inbounds: %v", err)
+	}
+	tgbotService := Tgbot{}
+	if tgbotService.IsRunning() {
+		tgbotService.NotifyClientsImported(len(result.Created), len(result.Failed))
+	}
+	return result, needRestart, nil
+}
+
+// importClientRows parses a client import CSV and calls insert with the client of each data row.
+// Rows that are invalid or that insert rejects are reported as failed; the others as created.
+func importClientRows(data []byte, insert func(client *model.ClientEntity) error) (*ClientImportResult, error) {
+	// Spreadsheet exports often start with a UTF-8 byte order mark
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.TrimLeadingSpace = true
+	// Trailing empty cells are often dropped, missing fields are treated as empty
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, common.NewError("CSV file is empty")
+	}
+	if err != nil {
+		return nil, common.NewErrorf("invalid CSV header: %v", err)
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if !clientImportColumns[name] {
+			return nil, common.NewErrorf("unknown CSV column %q", header[i])
+		}
+		if _, ok := columns[name]; ok {
+			return nil, common.NewErrorf("duplicate CSV column %q", header[i])
+		}
+		columns[name] = i
+	}
+	if _, ok := columns["email"]; !ok {
+		return nil, common.NewError("CSV header has no email column")
+	}
+
+	result := &ClientImportResult{
+		Created: make([]ClientImportRow, 0),
+		Failed:  make([]ClientImportRow, 0),
+	}
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, common.NewErrorf("invalid CSV: %v", err)
+		}
+		line, _ := reader.FieldPos(0)
+		field := func(name string) string {
+			if i, ok := columns[name]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+
+		row := ClientImportRow{Row: line, Email: strings.ToLower(field("email"))}
+		client, err := clientFromImportRow(field)
+		if err != nil {
+			row.Reason = err.Error()
+			result.Failed = append(result.Failed, row)
+			continue
+		}
+		if err := insert(client); err != nil {
+			row.Reason = err.Error()
+			result.Failed = append(result.Failed, row)
+			continue
+		}
+		row.ClientId = client.Id
+		result.Created = append(result.Created, row)
+	}
+	return result, nil
+}
+
+// clientFromImportRow builds a new client from the fields of an import row.
+func clientFromImportRow(field func(name string) string) (*model.ClientEntity, error) {
+	client := &model.ClientEntity{
+		Email:    strings.ToLower(field("email")),
+		UUID:     field("uuid"),
+		Password: field("password"),
+		Comment:  field("comment"),
+		Enable:   true,
+	}
+	if client.Email == "" {
+		return nil, common.NewError("email is required")
+	}
+	if client.Password == "" {
+		client.Password = random.Seq(10)
+	}
+	if value := field("totalgb"); value != "" {
+		totalGB, err := strconv.ParseFloat(value, 64)
+		if err != nil || totalGB < 0 {
+			return nil, common.NewErrorf("invalid totalGB %q", value)
+		}
+		client.TotalGB = totalGB
+	}
+	if value := field("expirydays"); value != "" {
+		days, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, common.NewErrorf("invalid expiryDays %q", value)
+		}
+		duration := int64(days) * 24 * time.Hour.Milliseconds()
+		if days > 0 {
+			client.ExpiryTime = time.Now().UnixMilli() + duration
+		} else {
+			// Negative expiry time: the countdown starts on first use
+			client.ExpiryTime = duration
+		}
+	}
+	if value := field("limitip"); value != "" {
+		if limitIp, err := strconv.Atoi(value); err != nil || limitIp < 0 {
+			return nil, common.NewErrorf("invalid limitIp %q", value)
+		}
+	}
+	return client, nil
+}
+
+// clientExportBatchSize is the number of clients read per query of a client export.
+const clientExportBatchSize = 500
+
+// clientExportHeader is the header row of ExportClientsCSV.
+var clientExportHeader = []string{
+	"email", "enable", "status", "totalGB", "up", "down", "allTime",
+	"expiryTime", "expiryDate", "maxHwid", "group", "inbounds", "comment",
+}
+
+// ExportClientsCSV writes the clients of a user matching the filters of filter to w as CSV,
+// ordered by ID. Offset and Limit of filter are ignored, all matches are exported. Clients are
+// read and written in batches, so large exports are streamed. Traffic is in bytes, expiryTime
+// is the raw value (negative = countdown starts on first use) and expiryDate the expiry in UTC.
+// The inbounds column lists the inbound tags separated by semicolons.
+func (s *ClientService) ExportClientsCSV(userId int, filter ClientSearchFilter, w io.Writer) error {
+	db := database.GetDB()
+	var groups []model.ClientGroup
+	if err := db.Where("user_id = ?", userId).Find(&groups).Error; err != nil {
+		return err
+	}
+	groupNames := make(map[int]string, len(groups))
+	for _, group := range groups {
+		groupNames[group.Id] = group.Name
+	}
+
+	writer := csv.NewWriter(w)
+	if err := writer.Write(clientExportHeader); err != nil {
+		return err
+	}
+	lastId := 0
+	for {
+		var clients []model.ClientEntity
+		err := clientSearchQuery(userId, filter).
+			Where("client_entities.id > ?", lastId).
+			Order("client_entities.id").
+			Limit(clientExportBatchSize).
+			Find(&clients).Error
+		if err != nil {
+			return err
+		}
+		if len(clients) == 0 {
+			break
+		}
+		lastId = clients[len(clients)-1].Id
+
+		inboundTags, err := clientInboundTags(bulkClientIds(clients))
+		if err != nil {
+			return err
+		}
+		for _, client := range clients {
+			if err := writer.Write(clientExportRecord(&client, groupNames, inboundTags[client.Id])); err != nil {
+				return err
+			}
+		}
+		writer.Flush()
+		if err := writer.Error(); err != nil {
+			return err
+		}
+		if len(clients) < clientExportBatchSize {
+			break
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// clientExportRecord returns the CSV row of a client, in the order of clientExportHeader.
+func clientExportRecord(client *model.ClientEntity, groupNames map[int]string, inboundTags []string) []string {
+	expiryDate := ""
+	if client.ExpiryTime > 0 {
+		expiryDate = time.UnixMilli(client.ExpiryTime).UTC().Format(time.RFC3339)
+	}
+	group := ""
+	if client.GroupId != nil {
+		group = groupNames[*client.GroupId]
+	}
+	return []string{
+		client.Email,
+		strconv.FormatBool(client.Enable),
+		client.Status,
+		strconv.FormatFloat(client.TotalGB, 'f', -1, 64),
+		strconv.FormatInt(client.Up, 10),
+		strconv.FormatInt(client.Down, 10),
+		strconv.FormatInt(client.AllTime, 10),
+		strconv.FormatInt(client.ExpiryTime, 10),
+		expiryDate,
+		strconv.Itoa(client.MaxHWID),
+		group,
+		strings.Join(inboundTags, ";"),
+		client.Comment,
+	}
+}
+
+// clientInboundTags returns the tags of the inbounds assigned to each of clientIds, by client ID.
+func clientInboundTags(clientIds []int) (map[int][]string, error) {
+	var rows []struct {
+		ClientId int
+		Tag      string
+	}
+	err := database.GetDB().Table("client_inbound_mappings").
+		Select("client_inbound_mappings.client_id, inbounds.tag").
+		Joins("JOIN inbounds ON inbounds.id = client_inbound_mappings.inbound_id").
+		Where("client_inbound_mappings.client_id IN ?", clientIds).
+		Order("inbounds.id").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	tags := make(map[int][]string, len(clientIds))
+	for _, row := range rows {
+		tags[row.ClientId] = append(tags[row.ClientId], row.Tag)
+	}
+	return tags, nil
+}
@@ -0,0 +1,140 @@
+package service
+
+import (
+	"encoding/csv"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/konstpic/sharx-code/v2/database/model"
+	"github.com/konstpic/sharx-code/v2/util/common"
+)
+
+// testImportStore stands in for insertClient: it assigns IDs and rejects emails already in use.
+type testImportStore struct {
+	clients []*model.ClientEntity
+}
+
+func (s *testImportStore) insert(client *model.ClientEntity) error {
+	for _, existing := range s.clients {
+		if existing.Email == client.Email {
+			return common.NewCodedError(common.ErrCodeClientEmailExists, "Client with email already exists: ", client.Email)
+		}
+	}
+	client.Id = len(s.clients) + 1
+	s.clients = append(s.clients, client)
+	return nil
+}
+
+func TestImportClientRowsDuplicateEmail(t *testing.T) {
+	data := "\xef\xbb\xbfEmail,totalGB,expiryDays,limitIp,comment,uuid,password\n" +
+		"a@example.com,10,30,2,first,b831381d-6324-4d53-ad4f-8cda48b30811,secret\n" +
+		"B@Example.com,0.5,-7,,second\n" +
+		"a@example.com,5,,,duplicate\n" +
+		"c@example.com\n"
+	store := &testImportStore{}
+	before := time.Now()
+	result, err := importClientRows([]byte(data), store.insert)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantCreated := []ClientImportRow{
+		{Row: 2, Email: "a@example.com", ClientId: 1},
+		{Row: 3, Email: "b@example.com", ClientId: 2},
+		{Row: 5, Email: "c@example.com", ClientId: 3},
+	}
+	if !reflect.DeepEqual(result.Created, wantCreated) {
+		t.Fatalf("created = %+v, want %+v", result.Created, wantCreated)
+	}
+	if len(result.Failed) != 1 || result.Failed[0].Row != 4 || result.Failed[0].Email != "a@example.com" ||
+		!strings.Contains(result.Failed[0].Reason, "already exists") {
+		t.Fatalf("failed = %+v, want the duplicate a@example.com on row 4", result.Failed)
+	}
+	if got, want := result.Summary(), "Imported 3 of 4 clients, 1 failed"; got != want {
+		t.Fatalf("Summary() = %q, want %q", got, want)
+	}
+
+	first, second, third := store.clients[0], store.clients[1], store.clients[2]
+	if first.TotalGB != 10 || first.Comment != "first" || first.UUID != "b831381d-6324-4d53-ad4f-8cda48b30811" || first.Password != "secret" || !first.Enable {
+		t.Errorf("first client = %+v, want the values of its row", first)
+	}
+	if expiry := time.UnixMilli(first.ExpiryTime); expiry.Before(before.AddDate(0, 0, 30).Truncate(time.Millisecond)) || expiry.After(time.Now().AddDate(0, 0, 30)) {
+		t.Errorf("first client expiry = %v, want 30 days from now", expiry)
+	}
+	if second.TotalGB != 0.5 || second.ExpiryTime != -7*24*time.Hour.Milliseconds() {
+		t.Errorf("second client = %+v, want 0.5 GB and a 7 day countdown on first use", second)
+	}
+	// Credentials are generated when omitted; the UUID is left to insertClient
+	if second.Password == "" || third.Password == "" || second.Password == third.Password {
+		t.Errorf("passwords %q and %q, want distinct generated passwords", second.Password, third.Password)
+	}
+	if third.ExpiryTime != 0 || third.TotalGB != 0 {
+		t.Errorf("third client = %+v, want no limits", third)
+	}
+}
+
+func TestImportClientRowsInvalidRows(t *testing.T) {
+	data := "email,totalGB,expiryDays,limitIp\n" +
+		",1,,\n" +
+		"a@example.com,-1,,\n" +
+		"b@example.com,,soon,\n" +
+		"c@example.com,,,-2\n"
+	store := &testImportStore{}
+	result, err := importClientRows([]byte(data), store.insert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Created) != 0 || len(result.Failed) != 4 || len(store.clients) != 0 {
+		t.Fatalf("result = %+v, want every row failed and nothing inserted", result)
+	}
+	for i, want := range []string{"email is required", "invalid totalGB", "invalid expiryDays", "invalid limitIp"} {
+		if !strings.Contains(result.Failed[i].Reason, want) {
+			t.Errorf("row %d reason = %q, want %q", result.Failed[i].Row, result.Failed[i].Reason, want)
+		}
+	}
+}
+
+func TestImportClientRowsInvalidHeader(t *testing.T) {
+	for _, data := range []string{
+		"",
+		"totalGB,comment\n1,x\n",
+		"email,quota\na@example.com,1\n",
+		"email,Email\na@example.com,a@example.com\n",
+	} {
+		if _, err := importClientRows([]byte(data), (&testImportStore{}).insert); err == nil {
+			t.Errorf("importClientRows(%q) accepted an invalid header", data)
+		}
+	}
+}
+
+func TestClientExportRecords(t *testing.T) {
+	groupId := 4
+	groupNames := map[int]string{groupId: "Premium"}
+	clients := []model.ClientEntity{
+		{
+			Id: 1, Email: "a@example.com", Enable: true, Status: "active", TotalGB: 50, Up: 1024, Down: 2048, AllTime: 4096,
+			ExpiryTime: time.Date(2026, time.February, 1, 12, 0, 0, 0, time.UTC).UnixMilli(), MaxHWID: 3, GroupId: &groupId,
+			Comment: "pays, monthly",
+		},
+		// A countdown starting on first use has no expiry date yet
+		{Id: 2, Email: "b@example.com", Status: "expired_traffic", TotalGB: 0.5, ExpiryTime: -7 * 24 * time.Hour.Milliseconds()},
+	}
+	inboundTags := map[int][]string{1: {"inbound-443", "inbound-8443"}}
+
+	var out strings.Builder
+	writer := csv.NewWriter(&out)
+	writer.Write(clientExportHeader)
+	for _, client := range clients {
+		writer.Write(clientExportRecord(&client, groupNames, inboundTags[client.Id]))
+	}
+	writer.Flush()
+
+	want := "email,enable,status,totalGB,up,down,allTime,expiryTime,expiryDate,maxHwid,group,inbounds,comment\n" +
+		"a@example.com,true,active,50,1024,2048,4096,1769947200000,2026-02-01T12:00:00Z,3,Premium,inbound-443;inbound-8443,\"pays, monthly\"\n" +
+		"b@example.com,false,expired_traffic,0.5,0,0,0,-604800000,,0,,,\n"
+	if out.String() != want {
+		t.Fatalf("export =\n%s\nwant\n%s", out.String(), want)
+	}
+}
@@ -0,0 +1,198 @@
+package service
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/konstpic/sharx-code/v2/database/model"
+	"github.com/konstpic/sharx-code/v2/xray"
+)
+
+// Sources of the core presence check in ClientInboundDiagnosis.CoreCheck.
+const (
+	coreCheckAPI         = "api"         // asked the running Xray over its API
+	coreCheckConfig      = "config"      // looked up in the config the Xray process was started with
+	coreCheckUnavailable = "unavailable" // Xray is not running locally (or multi-node mode), presence is unknown
+)
+
+// ClientInboundDiagnosis describes whether a client is usable on one of its inbounds.
+type ClientInboundDiagnosis struct {
+	InboundId        int      `json:"inboundId"`
+	Remark           string   `json:"remark"`
+	Tag              string   `json:"tag"`
+	Protocol         string   `json:"protocol"`
+	InboundEnabled   bool     `json:"inboundEnabled"`
+	InCore           *bool    `json:"inCore"`           // nil when the core could not be checked
+	CoreCheck        string   `json:"coreCheck"`        // api, config or unavailable
+	RemainingTraffic int64    `json:"remainingTraffic"` // bytes, -1 = unlimited
+	ExpiresIn        int64    `json:"expiresIn"`        // milliseconds, -1 = never, 0 = expired
+	Usable           bool     `json:"usable"`
+	Problems         []string `json:"problems"`
+}
+
+// ClientDiagnosis is the result of ClientService.DiagnoseClient.
+type ClientDiagnosis struct {
+	ClientId int                      `json:"clientId"`
+	Email    string                   `json:"email"`
+	Enable   bool                     `json:"enable"`
+	Status   string                   `json:"status"`
+	Usable   bool                     `json:"usable"` // usable on at least one inbound
+	Problems []string                 `json:"problems"`
+	Inbounds []ClientInboundDiagnosis `json:"inbounds"`
+}
+
+// DiagnoseClient checks a client across all its inbounds: whether each inbound is enabled,
+// whether the running core actually has the client, the remaining traffic and the time to expiry.
+func (s *ClientService) DiagnoseClient(clientId int) (*ClientDiagnosis, error) {
+	client, err := s.GetClient(clientId)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UnixMilli()
+	client.ComputeRemaining(now)
+	remaining := client.RemainingBytes
+	expiresIn := clientExpiresIn(client, now)
+
+	diagnosis := &ClientDiagnosis{
+		ClientId: client.Id,
+		Email:    client.Email,
+		Enable:   client.Enable,
+		Status:   client.Status,
+		Problems: make([]string, 0),
+		Inbounds: make([]ClientInboundDiagnosis, 0, len(client.InboundIds)),
+	}
+	if !client.Enable {
+		diagnosis.Problems = append(diagnosis.Problems, "client is disabled")
+	}
+	if remaining == 0 {
+		diagnosis.Problems = append(diagnosis.Problems, "traffic limit reached")
+	}
+	if expiresIn == 0 {
+		diagnosis.Problems = append(diagnosis.Problems, "client has expired")
+	}
+	if len(client.InboundIds) == 0 {
+		diagnosis.Problems = append(diagnosis.Problems, "client is not assigned to any inbound")
+	}
+
+	checker := newCoreClientChecker()
+	inboundService := InboundService{}
+	for _, inboundId := range client.InboundIds {
+		inbound, err := inboundService.GetInbound(inboundId)
+		if err != nil {
+			return nil, err
+		}
+		item := diagnoseClientInbound(client, inbound, now, checker)
+		if item.Usable {
+			diagnosis.Usable = true
+		}
+		diagnosis.Inbounds = append(diagnosis.Inbounds, item)
+	}
+	return diagnosis, nil
+}
+
+// diagnoseClientInbound checks whether client is usable on one of its inbounds.
+// The client's remaining traffic must already be computed for now (see ComputeRemaining).
+func diagnoseClientInbound(client *model.ClientEntity, inbound *model.Inbound, now int64, checker *coreClientChecker) ClientInboundDiagnosis {
+	remaining := client.RemainingBytes
+	expiresIn := clientExpiresIn(client, now)
+	item := ClientInboundDiagnosis{
+		InboundId:        inbound.Id,
+		Remark:           inbound.Remark,
+		Tag:              inbound.Tag,
+		Protocol:         string(inbound.Protocol),
+		InboundEnabled:   inbound.Enable,
+		RemainingTraffic: remaining,
+		ExpiresIn:        expiresIn,
+		Problems:         make([]string, 0),
+	}
+	item.InCore, item.CoreCheck = checker.has(inbound.Tag, client.Email)
+
+	if !inbound.Enable {
+		item.Problems = append(item.Problems, "inbound is disabled")
+	}
+	if item.InCore != nil && !*item.InCore {
+		item.Problems = append(item.Problems, "client is missing from the running core")
+	}
+	item.Usable = client.Enable && remaining != 0 && expiresIn != 0 && inbound.Enable &&
+		(item.InCore == nil || *item.InCore)
+	return item
+}
+
+// clientExpiresIn returns the milliseconds until the client expires, -1 when it never expires
+// and 0 when it has expired. A negative ExpiryTime is a duration that starts on first use.
+func clientExpiresIn(client *model.ClientEntity, now int64) int64 {
+	switch {
+	case client.ExpiryTime == 0:
+		return -1
+	case client.ExpiryTime < 0:
+		return -client.ExpiryTime
+	case client.ExpiryTime <= now:
+		return 0
+	default:
+		return client.ExpiryTime - now
+	}
+}
+
+// coreClientChecker answers whether the local Xray has a client on an inbound, preferring
+// the live API and falling back to the config the process was started with.
+type coreClientChecker struct {
+	api    *xray.XrayAPI
+	config *xray.Config
+}
+
+func newCoreClientChecker() *coreClientChecker {
+	checker := &coreClientChecker{}
+	settingService := SettingService{}
+	if multiMode, _ := settingService.GetMultiNodeMode(); multiMode {
+		// Node cores are not reachable from here
+		return checker
+	}
+	if p == nil || !p.IsRunning() {
+		return checker
+	}
+	checker.config = p.GetConfig()
+	inboundService := InboundService{}
+	if api, err := inboundService.getXrayAPI(p.GetAPIPort()); err == nil {
+		checker.api = api
+	}
+	return checker
+}
+
+func (c *coreClientChecker) has(tag string, email string) (*bool, string) {
+	if c.api != nil {
+		if found, err := c.api.HasInboundUser(tag, email); err == nil {
+			return &found, coreCheckAPI
+		}
+	}
+	if c.config != nil {
+		found := configHasClient(c.config, tag, email)
+		return &found, coreCheckConfig
+	}
+	return nil, coreCheckUnavailable
+}
+
+// configHasClient reports whether the inbound with the given tag in config lists a client with email.
+func configHasClient(config *xray.Config, tag string, email string) bool {
+	for _, inbound := range config.InboundConfigs {
+		if inbound.Tag != tag {
+			continue
+		}
+		var settings struct {
+			Clients []struct {
+				Email string `json:"email"`
+			} `json:"clients"`
+		}
+		if err := json.Unmarshal(inbound.Settings, &settings); err != nil {
+			return false
+		}
+		for _, client := range settings.Clients {
+			if strings.EqualFold(client.Email, email) {
+				return true
+			}
+		}
+		return false
+	}
+	return false
+}
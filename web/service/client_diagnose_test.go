@@ -0,0 +1,75 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/konstpic/sharx-code/v2/database/model"
+	"github.com/konstpic/sharx-code/v2/xray"
+)
+
+// testCoreConfig is a process config with the client on inbound-443 only.
+func testCoreConfig() *xray.Config {
+	return &xray.Config{InboundConfigs: []xray.InboundConfig{
+		{Tag: "inbound-443", Settings: []byte(`{"clients":[{"email":"User@example.com"},{"email":"other@example.com"}]}`)},
+		{Tag: "inbound-8443", Settings: []byte(`{"clients":[{"email":"other@example.com"}]}`)},
+	}}
+}
+
+func TestDiagnoseClientInboundMissingFromCore(t *testing.T) {
+	const now = int64(1700000000000)
+	client := &model.ClientEntity{Email: "user@example.com", Enable: true, TotalGB: 1, Up: 1024, ExpiryTime: now + 60000}
+	client.ComputeRemaining(now)
+	checker := &coreClientChecker{config: testCoreConfig()}
+
+	present := diagnoseClientInbound(client, &model.Inbound{Id: 1, Tag: "inbound-443", Enable: true}, now, checker)
+	if present.InCore == nil || !*present.InCore || present.CoreCheck != coreCheckConfig {
+		t.Fatalf("inbound-443: inCore = %v via %q, want true via config", present.InCore, present.CoreCheck)
+	}
+	if !present.Usable || len(present.Problems) != 0 {
+		t.Fatalf("inbound-443 = %+v, want usable", present)
+	}
+	if present.RemainingTraffic != 1024*1024*1024-1024 || present.ExpiresIn != 60000 {
+		t.Fatalf("inbound-443: remaining %d, expires in %d", present.RemainingTraffic, present.ExpiresIn)
+	}
+
+	missing := diagnoseClientInbound(client, &model.Inbound{Id: 2, Tag: "inbound-8443", Enable: true}, now, checker)
+	if missing.InCore == nil || *missing.InCore || missing.Usable {
+		t.Fatalf("inbound-8443 = %+v, want a client missing from the core", missing)
+	}
+	if len(missing.Problems) != 1 || missing.Problems[0] != "client is missing from the running core" {
+		t.Fatalf("inbound-8443 problems = %q", missing.Problems)
+	}
+}
+
+func TestDiagnoseClientInboundWithoutCore(t *testing.T) {
+	client := &model.ClientEntity{Email: "user@example.com", Enable: true}
+	client.ComputeRemaining(0)
+	item := diagnoseClientInbound(client, &model.Inbound{Tag: "inbound-443", Enable: false}, 0, &coreClientChecker{})
+	if item.InCore != nil || item.CoreCheck != coreCheckUnavailable {
+		t.Fatalf("inCore = %v via %q, want unknown", item.InCore, item.CoreCheck)
+	}
+	if item.Usable || len(item.Problems) != 1 || item.Problems[0] != "inbound is disabled" {
+		t.Fatalf("item = %+v, want unusable on a disabled inbound", item)
+	}
+	if item.RemainingTraffic != -1 || item.ExpiresIn != -1 {
+		t.Fatalf("remaining %d, expires in %d, want -1 for no limits", item.RemainingTraffic, item.ExpiresIn)
+	}
+}
+
+func TestClientExpiresIn(t *testing.T) {
+	const now = int64(1700000000000)
+	tests := []struct {
+		expiryTime int64
+		want       int64
+	}{
+		{0, -1},
+		{-86400000, 86400000}, // starts on first use
+		{now - 1, 0},
+		{now + 5000, 5000},
+	}
+	for _, test := range tests {
+		if got := clientExpiresIn(&model.ClientEntity{ExpiryTime: test.expiryTime}, now); got != test.want {
+			t.Errorf("clientExpiresIn(%d) = %d, want %d", test.expiryTime, got, test.want)
+		}
+	}
+}
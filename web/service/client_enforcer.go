@@ -0,0 +1,144 @@
+package service
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/konstpic/sharx-code/v2/database"
+	"github.com/konstpic/sharx-code/v2/database/model"
+	"github.com/konstpic/sharx-code/v2/logger"
+	"github.com/konstpic/sharx-code/v2/xray"
+)
+
+// userManagedProtocols are the inbound protocols whose users can be changed over the Xray API.
+var userManagedProtocols = map[model.Protocol]bool{
+	model.VMESS:       true,
+	model.VLESS:       true,
+	model.Trojan:      true,
+	model.Shadowsocks: true,
+}
+
+// isClientActive reports whether a client should be present in the running core.
+func isClientActive(client *model.ClientEntity) bool {
+	return client.Enable && client.Status != "expired_traffic" && client.Status != "expired_time"
+}
+
+// clientAPIUser builds the user passed to XrayAPI.AddUser for a client of inbound.
+func clientAPIUser(inbound *model.Inbound, client *model.ClientEntity) map[string]any {
+	user := map[string]any{"email": client.Email}
+	switch inbound.Protocol {
+	case model.Trojan:
+		user["password"] = client.Password
+	case model.Shadowsocks:
+		var settings struct {
+			Method string `json:"method"`
+		}
+		json.Unmarshal([]byte(inbound.Settings), &settings)
+		user["cipher"] = settings.Method
+		user["password"] = client.Password
+	case model.VMESS:
+		user["id"] = client.UUID
+	case model.VLESS:
+		user["id"] = client.UUID
+		user["flow"] = client.Flow
+	}
+	return user
+}
+
+// EnforceClientStates brings the users of the running local Xray in line with the database:
+// clients that are disabled or expired are removed and active clients that are missing are
+// (re-)added, one API call per difference, so the core is never restarted for it.
+// It returns true when a change could not be applied over the API and a restart is needed instead.
+// Multi-node mode is left alone: node cores get the same changes pushed per client.
+func (s *ClientService) EnforceClientStates() (bool, error) {
+	settingService := SettingService{}
+	if multiMode, _ := settingService.GetMultiNodeMode(); multiMode {
+		return false, nil
+	}
+	if p == nil || !p.IsRunning() {
+		return false, nil
+	}
+	inboundService := InboundService{}
+	api, err := inboundService.getXrayAPI(p.GetAPIPort())
+	if err != nil {
+		return false, err
+	}
+
+	db := database.GetDB()
+	var inbounds []*model.Inbound
+	if err := db.Model(model.Inbound{}).Where("enable = ?", true).Order("id").Find(&inbounds).Error; err != nil {
+		return false, err
+	}
+
+	needRestart := false
+	for _, inbound := range inbounds {
+		if !userManagedProtocols[inbound.Protocol] {
+			continue
+		}
+		if s.enforceInboundClients(api, inbound) {
+			needRestart = true
+		}
+	}
+	return needRestart, nil
+}
+
+// enforceInboundClients applies the user differences of one inbound and reports whether a restart is needed.
+func (s *ClientService) enforceInboundClients(api *xray.XrayAPI, inbound *model.Inbound) bool {
+	coreEmails, err := api.GetInboundUserEmails(inbound.Tag)
+	if err != nil {
+		// The inbound itself is missing from the core; re-adding inbounds is not this loop's job
+		logger.Debugf("EnforceClientStates: skipping inbound %s: %v", inbound.Tag, err)
+		return false
+	}
+	inCore := make(map[string]bool, len(coreEmails))
+	for _, email := range coreEmails {
+		inCore[strings.ToLower(email)] = true
+	}
+
+	clients, err := s.GetClientsForInbound(inbound.Id)
+	if err != nil {
+		logger.Warningf("EnforceClientStates: failed to get clients for inbound %d: %v", inbound.Id, err)
+		return false
+	}
+
+	return applyClientStates(api, inbound, clients, inCore)
+}
+
+// coreUserEditor adds and removes users of a running core; implemented by xray.XrayAPI.
+type coreUserEditor interface {
+	AddUser(protocol string, inboundTag string, user map[string]any) error
+	RemoveUser(inboundTag, email string) error
+}
+
+// applyClientStates adds the active clients of inbound missing from the core and removes the
+// inactive ones still in it. inCore holds the lowercased emails of the core's users.
+// It reports whether a change failed and a restart is needed to apply it.
+func applyClientStates(api coreUserEditor, inbound *model.Inbound, clients []*model.ClientEntity, inCore map[string]bool) bool {
+	// Only clients known to the inbound are touched; users that exist in the core but not in
+	// client_entities (e.g. legacy settings) are left to the next config rebuild
+	needRestart := false
+	for _, client := range clients {
+		email := strings.ToLower(client.Email)
+		active := isClientActive(client)
+		switch {
+		case active && !inCore[email]:
+			if err := api.AddUser(string(inbound.Protocol), inbound.Tag, clientAPIUser(inbound, client)); err != nil {
+				if !strings.Contains(err.Error(), "already exists") {
+					logger.Warningf("EnforceClientStates: failed to add client %s to inbound %s: %v", client.Email, inbound.Tag, err)
+					needRestart = true
+				}
+				continue
+			}
+			logger.Infof("EnforceClientStates: added client %s to inbound %s", client.Email, inbound.Tag)
+		case !active && inCore[email]:
+			if err := api.RemoveUser(inbound.Tag, client.Email); err != nil {
+				logger.Warningf("EnforceClientStates: failed to remove client %s from inbound %s: %v", client.Email, inbound.Tag, err)
+				needRestart = true
+				continue
+			}
+			logger.Infof("EnforceClientStates: removed %s client %s from inbound %s", client.Status, client.Email, inbound.Tag)
+		}
+	}
+
+	return needRestart
+}
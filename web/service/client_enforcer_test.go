@@ -0,0 +1,95 @@
+package service
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/konstpic/sharx-code/v2/database/model"
+)
+
+// recordingCoreAPI records the user changes applied to a core and fails those listed in failures.
+type recordingCoreAPI struct {
+	added    []string
+	removed  []string
+	failures map[string]error // email -> error
+}
+
+func (a *recordingCoreAPI) AddUser(protocol string, inboundTag string, user map[string]any) error {
+	email := user["email"].(string)
+	if err := a.failures[email]; err != nil {
+		return err
+	}
+	a.added = append(a.added, protocol+" "+inboundTag+" "+email)
+	return nil
+}
+
+func (a *recordingCoreAPI) RemoveUser(inboundTag, email string) error {
+	if err := a.failures[email]; err != nil {
+		return err
+	}
+	a.removed = append(a.removed, inboundTag+" "+email)
+	return nil
+}
+
+func TestApplyClientStatesRemovesExpiredClient(t *testing.T) {
+	inbound := &model.Inbound{Tag: "inbound-443", Protocol: model.VLESS}
+	clients := []*model.ClientEntity{
+		{Email: "Expired@example.com", Enable: true, Status: "expired_time"},
+		{Email: "active@example.com", Enable: true, Status: "active"},
+		{Email: "renewed@example.com", Enable: true, Status: "active", UUID: "b831381d-6324-4d53-ad4f-8cda48b30811"},
+		{Email: "disabled@example.com", Enable: false},
+		{Email: "gone@example.com", Enable: true, Status: "expired_traffic"},
+	}
+	inCore := map[string]bool{"expired@example.com": true, "active@example.com": true, "disabled@example.com": true}
+	api := &recordingCoreAPI{}
+
+	if applyClientStates(api, inbound, clients, inCore) {
+		t.Fatal("restart requested although every change was applied over the API")
+	}
+	if want := []string{"inbound-443 Expired@example.com", "inbound-443 disabled@example.com"}; !reflect.DeepEqual(api.removed, want) {
+		t.Fatalf("removed = %q, want %q", api.removed, want)
+	}
+	if want := []string{"vless inbound-443 renewed@example.com"}; !reflect.DeepEqual(api.added, want) {
+		t.Fatalf("added = %q, want %q", api.added, want)
+	}
+}
+
+func TestApplyClientStatesFailureNeedsRestart(t *testing.T) {
+	inbound := &model.Inbound{Tag: "inbound-443", Protocol: model.Trojan}
+	clients := []*model.ClientEntity{{Email: "expired@example.com", Enable: true, Status: "expired_time"}}
+	api := &recordingCoreAPI{failures: map[string]error{"expired@example.com": errors.New("rpc error")}}
+
+	if !applyClientStates(api, inbound, clients, map[string]bool{"expired@example.com": true}) {
+		t.Fatal("failed removal did not request a restart")
+	}
+}
+
+func TestApplyClientStatesIgnoresExistingUser(t *testing.T) {
+	inbound := &model.Inbound{Tag: "inbound-443", Protocol: model.Trojan}
+	clients := []*model.ClientEntity{{Email: "active@example.com", Enable: true, Password: "secret"}}
+	api := &recordingCoreAPI{failures: map[string]error{"active@example.com": errors.New("User active@example.com already exists.")}}
+
+	if applyClientStates(api, inbound, clients, map[string]bool{}) {
+		t.Fatal("a user the core already has requested a restart")
+	}
+}
+
+func TestClientAPIUser(t *testing.T) {
+	client := &model.ClientEntity{Email: "user@example.com", UUID: "uuid", Password: "secret", Flow: "xtls-rprx-vision"}
+	tests := []struct {
+		inbound *model.Inbound
+		want    map[string]any
+	}{
+		{&model.Inbound{Protocol: model.VLESS}, map[string]any{"email": "user@example.com", "id": "uuid", "flow": "xtls-rprx-vision"}},
+		{&model.Inbound{Protocol: model.VMESS}, map[string]any{"email": "user@example.com", "id": "uuid"}},
+		{&model.Inbound{Protocol: model.Trojan}, map[string]any{"email": "user@example.com", "password": "secret"}},
+		{&model.Inbound{Protocol: model.Shadowsocks, Settings: `{"method":"2022-blake3-aes-128-gcm"}`},
+			map[string]any{"email": "user@example.com", "password": "secret", "cipher": "2022-blake3-aes-128-gcm"}},
+	}
+	for _, test := range tests {
+		if user := clientAPIUser(test.inbound, client); !reflect.DeepEqual(user, test.want) {
+			t.Errorf("%s user = %v, want %v", test.inbound.Protocol, user, test.want)
+		}
+	}
+}
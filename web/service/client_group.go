@@ -61,6 +61,9 @@ func (s *ClientGroupService) AddGroup(userId int, group *model.ClientGroup) erro
 	if len(group.Description) > 100 {
 		return common.NewError("Group description exceeds maximum length of 100 characters (spaces count as characters)")
 	}
+	if group.SubUpdates < 0 {
+		return common.NewError("Subscription update interval must not be negative")
+	}
 	
 	// Trim whitespace from name and description
 	group.Name = strings.TrimSpace(group.Name)
@@ -104,6 +107,9 @@ func (s *ClientGroupService) UpdateGroup(userId int, id int, group *model.Client
 	if len(group.Description) > 100 {
 		return common.NewError("Group description exceeds maximum length of 100 characters (spaces count as characters)")
 	}
+	if group.SubUpdates < 0 {
+		return common.NewError("Subscription update interval must not be negative")
+	}
 	
 	// Trim whitespace from name and description
 	group.Name = strings.TrimSpace(group.Name)
@@ -120,6 +126,7 @@ func (s *ClientGroupService) UpdateGroup(userId int, id int, group *model.Client
 		Updates(map[string]interface{}{
 			"name":        group.Name,
 			"description": group.Description,
+			"sub_updates": group.SubUpdates,
 			"updated_at":  group.UpdatedAt,
 		}).Error
 
@@ -218,7 +225,7 @@ func (s *ClientGroupService) AssignClientsToGroup(groupId int, clientIds []int,
 		return err
 	}
 	if int(count) != len(clientIds) {
-		return common.NewError("Some clients not found or access denied")
+		return common.NewCodedError(common.ErrCodeNotFound, "Some clients not found or access denied")
 	}
 
 	// Assign clients to group
@@ -247,7 +254,7 @@ func (s *ClientGroupService) RemoveClientsFromGroup(clientIds []int, userId int)
 		return err
 	}
 	if int(count) != len(clientIds) {
-		return common.NewError("Some clients not found or access denied")
+		return common.NewCodedError(common.ErrCodeNotFound, "Some clients not found or access denied")
 	}
 
 	// Remove clients from group
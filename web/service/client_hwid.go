@@ -48,6 +48,10 @@ func (s *ClientHWIDService) AddHWIDForClient(clientId int, hwid string, deviceOS
 	if hwid == "" {
 		return nil, fmt.Errorf("HWID cannot be empty")
 	}
+	deviceOS = strings.TrimSpace(deviceOS)
+	deviceModel = strings.TrimSpace(deviceModel)
+	osVersion = strings.TrimSpace(osVersion)
+	userAgent = strings.TrimSpace(userAgent)
 
 	// Get client to check restrictions
 	clientService := ClientService{}
@@ -74,35 +78,7 @@ func (s *ClientHWIDService) AddHWIDForClient(clientId int, hwid string, deviceOS
 	err = tx.Where("client_id = ? AND hwid = ?", clientId, hwid).First(&existingHWID).Error
 	if err == nil {
 		// HWID exists - update last seen and IP with Moscow time
-		now := s.getMoscowTime().Unix()
-		// Fix timestamps if they're incorrect (less than year 2000, which is 946684800)
-		// This handles cases where old records have wrong timestamps
-		year2000Timestamp := int64(946684800) // January 1, 2000 00:00:00 UTC
-		updates := map[string]interface{}{
-			"last_seen_at": now,
-			"ip_address":   ipAddress,
-		}
-		// Fix first_seen_at if it's incorrect (only fix, don't update if it's correct)
-		if existingHWID.FirstSeenAt < year2000Timestamp {
-			updates["first_seen_at"] = now
-		}
-		// Fix last_seen_at if it's incorrect (shouldn't happen, but just in case)
-		if existingHWID.LastSeenAt < year2000Timestamp {
-			updates["last_seen_at"] = now
-		}
-		if userAgent != "" {
-			updates["user_agent"] = userAgent
-		}
-		// Update device metadata if provided
-		if deviceOS != "" {
-			updates["device_os"] = deviceOS
-		}
-		if deviceModel != "" {
-			updates["device_model"] = deviceModel
-		}
-		if osVersion != "" {
-			updates["os_version"] = osVersion
-		}
+		updates := hwidRefreshUpdates(&existingHWID, deviceOS, deviceModel, osVersion, ipAddress, userAgent, s.getMoscowTime().Unix())
 		existingHWID.IsActive = true
 		err = tx.Model(&existingHWID).Updates(updates).Error
 		if err != nil {
@@ -137,21 +113,8 @@ func (s *ClientHWIDService) AddHWIDForClient(clientId int, hwid string, deviceOS
 	}
 
 	// Create new HWID record with Moscow time
-	now := s.getMoscowTime().Unix()
-	newHWID := &model.ClientHWID{
-		ClientId:    clientId,
-		HWID:        hwid,
-		DeviceOS:    deviceOS,
-		DeviceModel: deviceModel,
-		OSVersion:   osVersion,
-		IPAddress:   ipAddress,
-		FirstSeenIP: ipAddress,
-		UserAgent:   userAgent,
-		IsActive:    true,
-		FirstSeenAt: now,
-		LastSeenAt:  now,
-		DeviceName:  fmt.Sprintf("Device %d", activeHWIDCount+1), // Legacy field, deprecated
-	}
+	newHWID := newClientHWID(clientId, hwid, deviceOS, deviceModel, osVersion, ipAddress, userAgent, s.getMoscowTime().Unix())
+	newHWID.DeviceName = fmt.Sprintf("Device %d", activeHWIDCount+1) // Legacy field, deprecated
 
 	err = tx.Create(newHWID).Error
 	if err != nil {
@@ -168,6 +131,57 @@ func (s *ClientHWIDService) AddHWIDForClient(clientId int, hwid string, deviceOS
 	return newHWID, nil
 }
 
+// newClientHWID returns the record of a HWID registered for the first time at now (unix seconds).
+func newClientHWID(clientId int, hwid string, deviceOS string, deviceModel string, osVersion string, ipAddress string, userAgent string, now int64) *model.ClientHWID {
+	return &model.ClientHWID{
+		ClientId:    clientId,
+		HWID:        hwid,
+		DeviceOS:    deviceOS,
+		DeviceModel: deviceModel,
+		OSVersion:   osVersion,
+		IPAddress:   ipAddress,
+		FirstSeenIP: ipAddress,
+		UserAgent:   userAgent,
+		IsActive:    true,
+		FirstSeenAt: now,
+		LastSeenAt:  now,
+	}
+}
+
+// hwidRefreshUpdates returns the columns to update when a known HWID is seen again at now (unix seconds).
+// Device metadata is only written when provided and changed; FirstSeenIP is kept from the first registration.
+func hwidRefreshUpdates(existingHWID *model.ClientHWID, deviceOS string, deviceModel string, osVersion string, ipAddress string, userAgent string, now int64) map[string]interface{} {
+	// Fix timestamps if they're incorrect (less than year 2000, which is 946684800)
+	// This handles cases where old records have wrong timestamps
+	year2000Timestamp := int64(946684800) // January 1, 2000 00:00:00 UTC
+	updates := map[string]interface{}{
+		"last_seen_at": now,
+		"ip_address":   ipAddress,
+	}
+	// Fix first_seen_at if it's incorrect (only fix, don't update if it's correct)
+	if existingHWID.FirstSeenAt < year2000Timestamp {
+		updates["first_seen_at"] = now
+	}
+	// FirstSeenIP is kept from the first registration; only records created without one get it set
+	if existingHWID.FirstSeenIP == "" && ipAddress != "" {
+		updates["first_seen_ip"] = ipAddress
+	}
+	// Update device metadata if provided and changed (e.g. after an app or OS update)
+	if userAgent != "" && userAgent != existingHWID.UserAgent {
+		updates["user_agent"] = userAgent
+	}
+	if deviceOS != "" && deviceOS != existingHWID.DeviceOS {
+		updates["device_os"] = deviceOS
+	}
+	if deviceModel != "" && deviceModel != existingHWID.DeviceModel {
+		updates["device_model"] = deviceModel
+	}
+	if osVersion != "" && osVersion != existingHWID.OSVersion {
+		updates["os_version"] = osVersion
+	}
+	return updates
+}
+
 // RemoveHWID removes a HWID from a client.
 func (s *ClientHWIDService) RemoveHWID(hwidId int) error {
 	db := database.GetDB()
@@ -0,0 +1,99 @@
+package service
+
+import (
+	"strings"
+
+	"github.com/konstpic/sharx-code/v2/database"
+	"github.com/konstpic/sharx-code/v2/database/model"
+	"github.com/konstpic/sharx-code/v2/util/common"
+
+	"gorm.io/gorm"
+)
+
+// HWID states of HWIDListFilter.State.
+const (
+	HWIDStateActive  = "active"  // active and not blocked
+	HWIDStateBlocked = "blocked" // blocked, e.g. because the HWID limit was exceeded
+)
+
+// HWIDListFilter narrows ClientService.ListHWIDs. Zero values disable a filter.
+type HWIDListFilter struct {
+	State      string `json:"state" form:"state"`           // active or blocked
+	DeviceOS   string `json:"deviceOs" form:"deviceOs"`     // device OS (case-insensitive exact match)
+	SeenAfter  int64  `json:"seenAfter" form:"seenAfter"`   // last seen at or after this unix timestamp (seconds)
+	SeenBefore int64  `json:"seenBefore" form:"seenBefore"` // last seen before this unix timestamp (seconds)
+	Offset     int    `json:"offset" form:"offset"`
+	Limit      int    `json:"limit" form:"limit"`
+}
+
+// HWIDListEntry is a HWID with the email of the client it belongs to.
+type HWIDListEntry struct {
+	model.ClientHWID
+	ClientEmail string `json:"clientEmail"`
+}
+
+// HWIDListResult is one page of a HWID list along with the total number of matches.
+type HWIDListResult struct {
+	HWIDs []*HWIDListEntry `json:"hwids"`
+	Total int64            `json:"total"`
+}
+
+// ListHWIDs lists the HWIDs of all clients of a user matching filter, most recently seen first.
+// Paging uses the same defaults and bounds as SearchClients.
+func (s *ClientService) ListHWIDs(userId int, filter HWIDListFilter) (*HWIDListResult, error) {
+	if filter.Offset < 0 || filter.Limit < 0 {
+		return nil, common.NewErrorf("invalid page: offset %d, limit %d", filter.Offset, filter.Limit)
+	}
+	if filter.Limit == 0 {
+		filter.Limit = defaultClientSearchLimit
+	}
+	if filter.Limit > maxClientSearchLimit {
+		filter.Limit = maxClientSearchLimit
+	}
+
+	query, err := hwidListQuery(database.GetDB(), userId, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, err
+	}
+
+	hwids := make([]*HWIDListEntry, 0)
+	err = query.Select("client_hw_ids.*, client_entities.email AS client_email").
+		Order("client_hw_ids.last_seen_at DESC, client_hw_ids.id").
+		Offset(filter.Offset).Limit(filter.Limit).
+		Scan(&hwids).Error
+	if err != nil {
+		return nil, err
+	}
+	return &HWIDListResult{HWIDs: hwids, Total: total}, nil
+}
+
+// hwidListQuery returns the query on db for the HWIDs of the clients of userId matching filter, without paging.
+func hwidListQuery(db *gorm.DB, userId int, filter HWIDListFilter) (*gorm.DB, error) {
+	query := db.Model(&model.ClientHWID{}).
+		Joins("JOIN client_entities ON client_entities.id = client_hw_ids.client_id").
+		Where("client_entities.user_id = ?", userId)
+	switch filter.State {
+	case "":
+	case HWIDStateActive:
+		query = query.Where("client_hw_ids.is_active = ? AND client_hw_ids.blocked_at IS NULL", true)
+	case HWIDStateBlocked:
+		query = query.Where("client_hw_ids.blocked_at IS NOT NULL")
+	default:
+		return nil, common.NewErrorf("invalid HWID state %q: expected %q or %q", filter.State, HWIDStateActive, HWIDStateBlocked)
+	}
+	if deviceOS := strings.TrimSpace(filter.DeviceOS); deviceOS != "" {
+		query = query.Where("LOWER(client_hw_ids.device_os) = ?", strings.ToLower(deviceOS))
+	}
+	if filter.SeenAfter > 0 {
+		query = query.Where("client_hw_ids.last_seen_at >= ?", filter.SeenAfter)
+	}
+	if filter.SeenBefore > 0 {
+		query = query.Where("client_hw_ids.last_seen_at < ?", filter.SeenBefore)
+	}
+	return query, nil
+}
@@ -0,0 +1,89 @@
+package service
+
+import (
+	"strings"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+// hwidListSQL returns the FROM and WHERE clauses of the statement hwidListQuery builds for filter.
+func hwidListSQL(t *testing.T, filter HWIDListFilter) string {
+	t.Helper()
+	db := dryRunDB(t)
+	sql := db.ToSQL(func(tx *gorm.DB) *gorm.DB {
+		query, err := hwidListQuery(tx, 7, filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var entries []*HWIDListEntry
+		return query.Find(&entries)
+	})
+	_, conditions, ok := strings.Cut(sql, " FROM ")
+	if !ok {
+		t.Fatalf("SQL %q has no FROM clause", sql)
+	}
+	return conditions
+}
+
+func TestHWIDListQueryFilters(t *testing.T) {
+	tests := []struct {
+		name    string
+		filter  HWIDListFilter
+		want    []string
+		notWant []string
+	}{
+		{
+			"active only",
+			HWIDListFilter{State: HWIDStateActive},
+			[]string{"client_hw_ids.is_active = true AND client_hw_ids.blocked_at IS NULL"},
+			[]string{"blocked_at IS NOT NULL"},
+		},
+		{
+			"blocked only",
+			HWIDListFilter{State: HWIDStateBlocked},
+			[]string{"client_hw_ids.blocked_at IS NOT NULL"},
+			[]string{"is_active", "blocked_at IS NULL"},
+		},
+		{
+			"device OS",
+			HWIDListFilter{DeviceOS: " iOS "},
+			[]string{"LOWER(client_hw_ids.device_os) = 'ios'"},
+			[]string{"blocked_at"},
+		},
+		{
+			"last seen window",
+			HWIDListFilter{SeenAfter: 1768392000, SeenBefore: 1768478400},
+			[]string{"client_hw_ids.last_seen_at >= 1768392000", "client_hw_ids.last_seen_at < 1768478400"},
+			nil,
+		},
+	}
+	for _, test := range tests {
+		sql := hwidListSQL(t, test.filter)
+		// Every query is limited to the HWIDs of the user's clients
+		for _, want := range append(test.want, "JOIN client_entities ON client_entities.id = client_hw_ids.client_id", "client_entities.user_id = 7") {
+			if !strings.Contains(sql, want) {
+				t.Errorf("%s: SQL %q does not contain %q", test.name, sql, want)
+			}
+		}
+		for _, notWant := range test.notWant {
+			if strings.Contains(sql, notWant) {
+				t.Errorf("%s: SQL %q contains %q", test.name, sql, notWant)
+			}
+		}
+	}
+}
+
+func TestHWIDListQueryRejectsUnknownState(t *testing.T) {
+	if _, err := hwidListQuery(dryRunDB(t), 7, HWIDListFilter{State: "deleted"}); err == nil {
+		t.Fatal("hwidListQuery() accepted an unknown state")
+	}
+}
+
+func TestListHWIDsRejectsNegativePage(t *testing.T) {
+	for _, filter := range []HWIDListFilter{{Offset: -1}, {Limit: -1}} {
+		if _, err := (&ClientService{}).ListHWIDs(7, filter); err == nil {
+			t.Errorf("ListHWIDs(%+v) accepted a negative page", filter)
+		}
+	}
+}
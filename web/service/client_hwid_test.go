@@ -0,0 +1,67 @@
+package service
+
+import (
+	"reflect"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+func TestHWIDMetadataOnRegistrationAndRefresh(t *testing.T) {
+	const registered, refreshed = int64(1768392000), int64(1768395600)
+
+	// First registration stores the device metadata of the request
+	hwid := newClientHWID(3, "a1b2c3", "iOS", "iPhone15,2", "17.4", "203.0.113.5", "Happ/3.1", registered)
+	if hwid.ClientId != 3 || hwid.HWID != "a1b2c3" || hwid.DeviceOS != "iOS" || hwid.DeviceModel != "iPhone15,2" ||
+		hwid.OSVersion != "17.4" || hwid.UserAgent != "Happ/3.1" || !hwid.IsActive {
+		t.Fatalf("registered HWID = %+v, want the request's device metadata", hwid)
+	}
+	if hwid.IPAddress != "203.0.113.5" || hwid.FirstSeenIP != "203.0.113.5" || hwid.FirstSeenAt != registered || hwid.LastSeenAt != registered {
+		t.Fatalf("registered HWID = %+v, want first and last seen from this request", hwid)
+	}
+
+	// A refresh after an OS and app update writes only what changed
+	updates := hwidRefreshUpdates(hwid, "iOS", "iPhone15,2", "17.5", "198.51.100.7", "Happ/3.2", refreshed)
+	want := map[string]interface{}{
+		"last_seen_at": refreshed,
+		"ip_address":   "198.51.100.7",
+		"os_version":   "17.5",
+		"user_agent":   "Happ/3.2",
+	}
+	if !reflect.DeepEqual(updates, want) {
+		t.Fatalf("refresh updates = %v, want %v", updates, want)
+	}
+
+	// Missing headers do not clear stored metadata
+	updates = hwidRefreshUpdates(hwid, "", "", "", "203.0.113.5", "", refreshed)
+	want = map[string]interface{}{"last_seen_at": refreshed, "ip_address": "203.0.113.5"}
+	if !reflect.DeepEqual(updates, want) {
+		t.Fatalf("refresh updates = %v, want only last seen and IP", updates)
+	}
+}
+
+func TestHWIDRefreshFillsMissingFirstSeen(t *testing.T) {
+	const now = int64(1768392000)
+	// A record from an older version, without FirstSeenIP and with a broken first seen time
+	hwid := newClientHWID(3, "a1b2c3", "Android", "Pixel 8", "14", "", "", 0)
+	updates := hwidRefreshUpdates(hwid, "Android", "Pixel 8", "14", "203.0.113.5", "", now)
+	if updates["first_seen_ip"] != "203.0.113.5" || updates["first_seen_at"] != now {
+		t.Fatalf("refresh updates = %v, want first seen IP and time filled once", updates)
+	}
+
+	hwid.FirstSeenIP = "203.0.113.5"
+	hwid.FirstSeenAt = now
+	if updates := hwidRefreshUpdates(hwid, "", "", "", "198.51.100.7", "", now+60); updates["first_seen_ip"] != nil || updates["first_seen_at"] != nil {
+		t.Fatalf("refresh updates = %v, want first seen IP and time kept", updates)
+	}
+}
+
+func TestDeleteClientHWIDsIncludesBlocked(t *testing.T) {
+	sql := dryRunDB(t).ToSQL(func(tx *gorm.DB) *gorm.DB {
+		return deleteClientHWIDs(tx, 3)
+	})
+	// No condition on is_active or blocked_at, so blocked devices are removed too
+	if want := `DELETE FROM "client_hw_ids" WHERE client_id = 3`; sql != want {
+		t.Fatalf("SQL = %q, want %q", sql, want)
+	}
+}
@@ -0,0 +1,82 @@
+package service
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/konstpic/sharx-code/v2/database/model"
+	"github.com/konstpic/sharx-code/v2/logger"
+	"github.com/konstpic/sharx-code/v2/util/common"
+	"github.com/konstpic/sharx-code/v2/web/cache"
+)
+
+const (
+	// clientIdempotencyTTL is how long a client creation can be replayed with its idempotency key.
+	clientIdempotencyTTL = 24 * time.Hour
+	// clientIdempotencyPrefix is the cache key prefix of client idempotency keys, followed by
+	// the user ID and the key.
+	clientIdempotencyPrefix = "idempotency:client:user:"
+	// clientIdempotencyPending marks a key whose client is still being created.
+	clientIdempotencyPending = "pending"
+	// maxIdempotencyKeyLength bounds the length of an idempotency key.
+	maxIdempotencyKeyLength = 255
+)
+
+// AddClientIdempotent creates a client like AddClient, remembering the result under idempotencyKey
+// for clientIdempotencyTTL. A request replaying a key of the same user returns the client as the
+// first request returned it, instead of creating another one or failing on the duplicate email;
+// the payload of the replay is not compared. A failed creation releases the key, so the request
+// can be retried. Returns the client, whether it was created by an earlier request, whether Xray
+// needs restart and any error.
+func (s *ClientService) AddClientIdempotent(userId int, client *model.ClientEntity, idempotencyKey string) (*model.ClientEntity, bool, bool, error) {
+	return s.addClientIdempotent(userId, client, idempotencyKey, s.AddClient)
+}
+
+// addClientIdempotent is AddClientIdempotent with add creating the client.
+func (s *ClientService) addClientIdempotent(userId int, client *model.ClientEntity, idempotencyKey string, add func(userId int, client *model.ClientEntity) (bool, error)) (*model.ClientEntity, bool, bool, error) {
+	idempotencyKey = strings.TrimSpace(idempotencyKey)
+	if idempotencyKey == "" || len(idempotencyKey) > maxIdempotencyKeyLength {
+		return nil, false, false, common.NewErrorf("invalid idempotency key: must be 1 to %d characters", maxIdempotencyKeyLength)
+	}
+	cacheKey := clientIdempotencyPrefix + strconv.Itoa(userId) + ":" + idempotencyKey
+
+	reserved, err := cache.SetNX(cacheKey, clientIdempotencyPending, clientIdempotencyTTL)
+	if err != nil {
+		return nil, false, false, common.NewErrorf("idempotency keys are unavailable: %v", err)
+	}
+	if !reserved {
+		existing, err := s.getIdempotentClient(cacheKey)
+		return existing, true, false, err
+	}
+
+	needRestart, err := add(userId, client)
+	if err != nil {
+		if delErr := cache.Delete(cacheKey); delErr != nil {
+			logger.Warningf("Failed to release idempotency key of failed client creation: %v", delErr)
+		}
+		return nil, false, false, err
+	}
+	if err := cache.SetJSON(cacheKey, client, clientIdempotencyTTL); err != nil {
+		logger.Warningf("Failed to store idempotency key of client %s: %v", client.Email, err)
+	}
+	return client, false, needRestart, nil
+}
+
+// getIdempotentClient returns the client stored for an idempotency key, as it was returned
+// by the request that created it.
+func (s *ClientService) getIdempotentClient(cacheKey string) (*model.ClientEntity, error) {
+	value, err := cache.Get(cacheKey)
+	if err != nil {
+		return nil, common.NewErrorf("idempotency keys are unavailable: %v", err)
+	}
+	if value == clientIdempotencyPending {
+		return nil, common.NewError("A request with this idempotency key is still in progress")
+	}
+	client := &model.ClientEntity{}
+	if err := json.Unmarshal([]byte(value), client); err != nil {
+		return nil, common.NewErrorf("invalid idempotency key record: %v", err)
+	}
+	return client, nil
+}
@@ -0,0 +1,129 @@
+package service
+
+import (
+	"errors"
+	"reflect"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/konstpic/sharx-code/v2/database/model"
+	"github.com/konstpic/sharx-code/v2/web/cache"
+)
+
+// useIdempotencyKey returns an idempotency key of the test, released from the cache when it ends.
+func useIdempotencyKey(t *testing.T, userId int) string {
+	t.Helper()
+	useTestCache()
+	key := t.Name()
+	t.Cleanup(func() { cache.Delete(clientIdempotencyPrefix + strconv.Itoa(userId) + ":" + key) })
+	return key
+}
+
+// addToStore creates clients in store like AddClient, which needs a restart for each.
+func addToStore(store *testImportStore) func(int, *model.ClientEntity) (bool, error) {
+	return func(userId int, client *model.ClientEntity) (bool, error) {
+		client.UserId = userId
+		client.CreatedAt = time.Now().UnixMilli()
+		return true, store.insert(client)
+	}
+}
+
+func TestAddClientIdempotentReplay(t *testing.T) {
+	key := useIdempotencyKey(t, 1)
+	store := &testImportStore{}
+	s := &ClientService{}
+
+	first, replayed, needRestart, err := s.addClientIdempotent(1, &model.ClientEntity{Email: "a@example.com", TotalGB: 10}, key, addToStore(store))
+	if err != nil || replayed || !needRestart {
+		t.Fatalf("first request = %v, replayed %v, restart %v, want a new client needing a restart", err, replayed, needRestart)
+	}
+	// The retry of a timed-out request carries the same key and payload
+	second, replayed, needRestart, err := s.addClientIdempotent(1, &model.ClientEntity{Email: "a@example.com", TotalGB: 10}, key, addToStore(store))
+	if err != nil || !replayed || needRestart {
+		t.Fatalf("replay = %v, replayed %v, restart %v, want the earlier client without a restart", err, replayed, needRestart)
+	}
+
+	if len(store.clients) != 1 {
+		t.Fatalf("%d clients created, want 1", len(store.clients))
+	}
+	if !reflect.DeepEqual(second, first) {
+		t.Fatalf("replay returned %+v, want %+v", second, first)
+	}
+}
+
+func TestAddClientIdempotentScopedToUser(t *testing.T) {
+	key := useIdempotencyKey(t, 1)
+	useIdempotencyKey(t, 2)
+	store := &testImportStore{}
+	s := &ClientService{}
+
+	if _, _, _, err := s.addClientIdempotent(1, &model.ClientEntity{Email: "a@example.com"}, key, addToStore(store)); err != nil {
+		t.Fatal(err)
+	}
+	client, replayed, _, err := s.addClientIdempotent(2, &model.ClientEntity{Email: "b@example.com"}, key, addToStore(store))
+	if err != nil || replayed || client.Email != "b@example.com" {
+		t.Fatalf("other user's request = %+v, replayed %v, %v, want a new client", client, replayed, err)
+	}
+}
+
+func TestAddClientIdempotentFailureReleasesKey(t *testing.T) {
+	key := useIdempotencyKey(t, 1)
+	s := &ClientService{}
+
+	failure := errors.New("Client with email already exists: a@example.com")
+	_, _, _, err := s.addClientIdempotent(1, &model.ClientEntity{Email: "a@example.com"}, key, func(int, *model.ClientEntity) (bool, error) {
+		return false, failure
+	})
+	if !errors.Is(err, failure) {
+		t.Fatalf("failed creation = %v, want its error", err)
+	}
+	// A corrected retry with the same key goes through
+	store := &testImportStore{}
+	client, replayed, _, err := s.addClientIdempotent(1, &model.ClientEntity{Email: "b@example.com"}, key, addToStore(store))
+	if err != nil || replayed || client.Email != "b@example.com" || len(store.clients) != 1 {
+		t.Fatalf("retry = %+v, replayed %v, %v, want the corrected client created", client, replayed, err)
+	}
+}
+
+func TestAddClientIdempotentInProgress(t *testing.T) {
+	key := useIdempotencyKey(t, 1)
+	s := &ClientService{}
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		s.addClientIdempotent(1, &model.ClientEntity{Email: "a@example.com"}, key, func(int, *model.ClientEntity) (bool, error) {
+			close(started)
+			<-release
+			return false, nil
+		})
+	}()
+	<-started
+	_, _, _, err := s.addClientIdempotent(1, &model.ClientEntity{Email: "a@example.com"}, key, func(int, *model.ClientEntity) (bool, error) {
+		t.Error("client created while the first request was running")
+		return false, nil
+	})
+	close(release)
+	wg.Wait()
+	if err == nil {
+		t.Fatal("replay during the first request succeeded")
+	}
+}
+
+func TestAddClientIdempotentRejectsKey(t *testing.T) {
+	s := &ClientService{}
+	for _, key := range []string{" ", string(make([]byte, maxIdempotencyKeyLength+1))} {
+		_, _, _, err := s.addClientIdempotent(1, &model.ClientEntity{Email: "a@example.com"}, key, func(int, *model.ClientEntity) (bool, error) {
+			t.Error("client created with an invalid key")
+			return false, nil
+		})
+		if err == nil {
+			t.Errorf("key of %d characters accepted", len(key))
+		}
+	}
+}
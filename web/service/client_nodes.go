@@ -0,0 +1,96 @@
+package service
+
+import (
+	"strings"
+
+	"github.com/konstpic/sharx-code/v2/database"
+	"github.com/konstpic/sharx-code/v2/database/model"
+	"github.com/konstpic/sharx-code/v2/logger"
+
+	"gorm.io/gorm"
+)
+
+// GetNodeIdsForClient retrieves the node IDs a client is restricted to.
+// An empty result means the client is served by all nodes of its inbounds.
+func (s *ClientService) GetNodeIdsForClient(clientId int) ([]int, error) {
+	db := database.GetDB()
+	var mappings []model.ClientNodeMapping
+	err := db.Where("client_id = ?", clientId).Find(&mappings).Error
+	if err != nil {
+		return nil, err
+	}
+
+	nodeIds := make([]int, len(mappings))
+	for i, mapping := range mappings {
+		nodeIds[i] = mapping.NodeId
+	}
+
+	return nodeIds, nil
+}
+
+// AssignClientToNodes restricts a client to the given nodes.
+func (s *ClientService) AssignClientToNodes(tx *gorm.DB, clientId int, nodeIds []int) error {
+	for _, nodeId := range nodeIds {
+		mapping := &model.ClientNodeMapping{
+			ClientId: clientId,
+			NodeId:   nodeId,
+		}
+		err := tx.Create(mapping).Error
+		if err != nil {
+			logger.Warningf("Failed to assign client %d to node %d: %v", clientId, nodeId, err)
+			// Continue with other assignments
+		}
+	}
+	return nil
+}
+
+// IsClientOnNode reports whether a client is served by a node: either it has no node
+// restrictions or the node is one of the nodes it is restricted to.
+func (s *ClientService) IsClientOnNode(clientId int, nodeId int) bool {
+	nodeIds, err := s.GetNodeIdsForClient(clientId)
+	if err != nil || len(nodeIds) == 0 {
+		return true
+	}
+	for _, id := range nodeIds {
+		if id == nodeId {
+			return true
+		}
+	}
+	return false
+}
+
+// getClientEmailsExcludedFromNode returns the lowercased emails of the clients that are
+// restricted to other nodes and so must not be included in the config of nodeId.
+func (s *ClientService) getClientEmailsExcludedFromNode(nodeId int) (map[string]bool, error) {
+	db := database.GetDB()
+	var emails []string
+	err := db.Model(&model.ClientEntity{}).
+		Where("EXISTS (SELECT 1 FROM client_node_mappings m WHERE m.client_id = client_entities.id)").
+		Where("NOT EXISTS (SELECT 1 FROM client_node_mappings m WHERE m.client_id = client_entities.id AND m.node_id = ?)", nodeId).
+		Pluck("email", &emails).Error
+	if err != nil {
+		return nil, err
+	}
+
+	excluded := make(map[string]bool, len(emails))
+	for _, email := range emails {
+		excluded[strings.ToLower(email)] = true
+	}
+	return excluded, nil
+}
+
+// sameIntSet reports whether a and b contain the same IDs, ignoring order and duplicates.
+func sameIntSet(a []int, b []int) bool {
+	set := make(map[int]bool, len(a))
+	for _, id := range a {
+		set[id] = true
+	}
+	other := make(map[int]bool, len(b))
+	for _, id := range b {
+		if !set[id] {
+			return false
+		}
+		other[id] = true
+	}
+	return len(set) == len(other)
+}
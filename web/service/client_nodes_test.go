@@ -0,0 +1,95 @@
+package service
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/konstpic/sharx-code/v2/database/model"
+)
+
+// nodeInboundEmails returns the client emails of the node copy of inbound.
+func nodeInboundEmails(t *testing.T, inbound *model.Inbound) []string {
+	t.Helper()
+	var settings struct {
+		Clients []struct {
+			Email string `json:"email"`
+		} `json:"clients"`
+	}
+	if err := json.Unmarshal([]byte(inbound.Settings), &settings); err != nil {
+		t.Fatal(err)
+	}
+	emails := make([]string, 0, len(settings.Clients))
+	for _, client := range settings.Clients {
+		emails = append(emails, client.Email)
+	}
+	return emails
+}
+
+func TestNodeInboundClientRestrictedToOneNode(t *testing.T) {
+	settings := `{"clients":[{"email":"everywhere@example.com","id":"a"},{"email":"Node2@example.com","id":"b"}]}`
+	inbound := &model.Inbound{Id: 1, Protocol: model.VLESS, Tag: "inbound-443", Settings: settings}
+	// The client is restricted to node 2, so it is excluded from node 1 only
+	excluded := map[int]map[string]bool{
+		1: {"node2@example.com": true},
+		2: {},
+	}
+
+	node1 := nodeInbound(inbound, excluded[1])
+	node2 := nodeInbound(inbound, excluded[2])
+
+	if emails := nodeInboundEmails(t, node1); !reflect.DeepEqual(emails, []string{"everywhere@example.com"}) {
+		t.Errorf("node 1 clients = %q, want only the unrestricted client", emails)
+	}
+	if emails := nodeInboundEmails(t, node2); !reflect.DeepEqual(emails, []string{"everywhere@example.com", "Node2@example.com"}) {
+		t.Errorf("node 2 clients = %q, want both clients", emails)
+	}
+	if inbound.Settings != settings {
+		t.Errorf("shared inbound modified: %s", inbound.Settings)
+	}
+}
+
+func TestNodeInboundStripsPanelFields(t *testing.T) {
+	inbound := &model.Inbound{
+		Settings:       `{"clients":[{"email":"a@example.com","id":"a","flow":"xtls-rprx-vision-udp443","limitIp":2,"tgId":"1"},{"email":"off@example.com","enable":false}]}`,
+		StreamSettings: `{"security":"reality","realitySettings":{"privateKey":"k","settings":{"publicKey":"p"}},"externalProxy":[{"dest":"example.com"}]}`,
+	}
+	stripped := nodeInbound(inbound, nil)
+
+	var settings struct {
+		Clients []map[string]any `json:"clients"`
+	}
+	if err := json.Unmarshal([]byte(stripped.Settings), &settings); err != nil {
+		t.Fatal(err)
+	}
+	want := []map[string]any{{"email": "a@example.com", "id": "a", "flow": "xtls-rprx-vision"}}
+	if !reflect.DeepEqual(settings.Clients, want) {
+		t.Errorf("clients = %v, want %v", settings.Clients, want)
+	}
+	var stream map[string]any
+	if err := json.Unmarshal([]byte(stripped.StreamSettings), &stream); err != nil {
+		t.Fatal(err)
+	}
+	reality := stream["realitySettings"].(map[string]any)
+	if _, ok := stream["externalProxy"]; ok || reality["settings"] != nil || reality["privateKey"] != "k" {
+		t.Errorf("stream settings = %s, want the panel-only fields removed", stripped.StreamSettings)
+	}
+}
+
+func TestSameIntSet(t *testing.T) {
+	tests := []struct {
+		a, b []int
+		want bool
+	}{
+		{nil, []int{}, true},
+		{[]int{1, 2}, []int{2, 1}, true},
+		{[]int{1, 1, 2}, []int{2, 1}, true},
+		{[]int{1, 2}, []int{1}, false},
+		{[]int{1}, []int{1, 3}, false},
+	}
+	for _, test := range tests {
+		if got := sameIntSet(test.a, test.b); got != test.want {
+			t.Errorf("sameIntSet(%v, %v) = %v, want %v", test.a, test.b, got, test.want)
+		}
+	}
+}
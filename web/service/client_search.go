@@ -0,0 +1,127 @@
+package service
+
+import (
+	"strings"
+	"time"
+
+	"github.com/konstpic/sharx-code/v2/database"
+	"github.com/konstpic/sharx-code/v2/database/model"
+	"github.com/konstpic/sharx-code/v2/util/common"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// defaultClientSearchLimit is the page size used when ClientSearchFilter.Limit is not set.
+	defaultClientSearchLimit = 50
+	// maxClientSearchLimit bounds the page size of a client search.
+	maxClientSearchLimit = 500
+)
+
+// ClientSearchFilter narrows ClientService.SearchClients. Zero values disable a filter.
+type ClientSearchFilter struct {
+	Query        string `json:"query" form:"query"`               // substring of email or comment (case-insensitive)
+	Status       string `json:"status" form:"status"`             // active, expired_traffic or expired_time
+	GroupId      *int   `json:"groupId" form:"groupId"`           // 0 = clients without a group
+	InboundId    int    `json:"inboundId" form:"inboundId"`       // clients assigned to this inbound
+	ExpiringDays int    `json:"expiringDays" form:"expiringDays"` // clients expiring within this many days (not yet expired)
+	Offset       int    `json:"offset" form:"offset"`
+	Limit        int    `json:"limit" form:"limit"`
+}
+
+// ClientSearchResult is one page of a client search along with the total number of matches.
+type ClientSearchResult struct {
+	Clients []*model.ClientEntity `json:"clients"`
+	Total   int64                 `json:"total"`
+}
+
+// SearchClients finds the clients of a user matching filter, ordered by ID.
+// Filtering and paging run in SQL, so it stays cheap on large client tables.
+func (s *ClientService) SearchClients(userId int, filter ClientSearchFilter) (*ClientSearchResult, error) {
+	if filter.Offset < 0 || filter.Limit < 0 {
+		return nil, common.NewErrorf("invalid page: offset %d, limit %d", filter.Offset, filter.Limit)
+	}
+	if filter.Limit == 0 {
+		filter.Limit = defaultClientSearchLimit
+	}
+	if filter.Limit > maxClientSearchLimit {
+		filter.Limit = maxClientSearchLimit
+	}
+
+	query := clientSearchQuery(userId, filter)
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, err
+	}
+
+	clients := make([]*model.ClientEntity, 0)
+	err := query.Order("client_entities.id").Offset(filter.Offset).Limit(filter.Limit).Find(&clients).Error
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UnixMilli()
+	for _, client := range clients {
+		if inboundIds, err := s.GetInboundIdsForClient(client.Id); err == nil {
+			client.InboundIds = inboundIds
+		}
+		client.ComputeRemaining(now)
+	}
+	return &ClientSearchResult{Clients: clients, Total: total}, nil
+}
+
+// clientSearchQuery returns a query for the clients of a user matching the filters of filter.
+// Offset and Limit are not applied.
+func clientSearchQuery(userId int, filter ClientSearchFilter) *gorm.DB {
+	db := database.GetDB()
+	query := db.Model(&model.ClientEntity{}).Where("client_entities.user_id = ?", userId)
+	if q := strings.TrimSpace(filter.Query); q != "" {
+		pattern := "%" + escapeLike(strings.ToLower(q)) + "%"
+		query = query.Where("(LOWER(client_entities.email) LIKE ? OR LOWER(client_entities.comment) LIKE ?)", pattern, pattern)
+	}
+	if filter.Status != "" {
+		query = query.Where("client_entities.status = ?", filter.Status)
+	}
+	if filter.GroupId != nil {
+		if *filter.GroupId > 0 {
+			query = query.Where("client_entities.group_id = ?", *filter.GroupId)
+		} else {
+			query = query.Where("client_entities.group_id IS NULL")
+		}
+	}
+	if filter.InboundId > 0 {
+		query = query.Where("EXISTS (SELECT 1 FROM client_inbound_mappings m WHERE m.client_id = client_entities.id AND m.inbound_id = ?)", filter.InboundId)
+	}
+	if filter.ExpiringDays > 0 {
+		now := time.Now()
+		query = query.Where("client_entities.expiry_time > ? AND client_entities.expiry_time <= ?",
+			now.UnixMilli(), now.AddDate(0, 0, filter.ExpiringDays).UnixMilli())
+	}
+	return query
+}
+
+// escapeLike escapes the LIKE wildcards in s so it matches literally.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// GetExpiringClients returns the clients of a user that expire within the next withinDays days,
+// soonest first. Clients that never expire (ExpiryTime 0), have not started their
+// expiry countdown (negative ExpiryTime) or have already expired are excluded.
+// A userId of 0 returns the expiring clients of all users.
+func (s *ClientService) GetExpiringClients(userId int, withinDays int) ([]*model.ClientEntity, error) {
+	if withinDays <= 0 {
+		return nil, common.NewErrorf("invalid number of days: %d", withinDays)
+	}
+	now := time.Now()
+	db := database.GetDB()
+	query := db.Model(&model.ClientEntity{}).Where("expiry_time > ? AND expiry_time <= ?",
+		now.UnixMilli(), now.AddDate(0, 0, withinDays).UnixMilli())
+	if userId > 0 {
+		query = query.Where("user_id = ?", userId)
+	}
+	clients := make([]*model.ClientEntity, 0)
+	if err := query.Order("expiry_time, id").Find(&clients).Error; err != nil {
+		return nil, err
+	}
+	return clients, nil
+}
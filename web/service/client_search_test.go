@@ -0,0 +1,27 @@
+package service
+
+import "testing"
+
+func TestEscapeLike(t *testing.T) {
+	tests := map[string]string{
+		"user@example.com": "user@example.com",
+		"50%":              `50\%`,
+		"user_1":           `user\_1`,
+		`a\b`:              `a\\b`,
+		`%_\`:              `\%\_\\`,
+	}
+	for input, want := range tests {
+		if got := escapeLike(input); got != want {
+			t.Errorf("escapeLike(%q) = %q, want %q", input, got, want)
+		}
+	}
+}
+
+func TestSearchClientsRejectsNegativePage(t *testing.T) {
+	s := &ClientService{}
+	for _, filter := range []ClientSearchFilter{{Offset: -1}, {Limit: -5}} {
+		if _, err := s.SearchClients(1, filter); err == nil {
+			t.Errorf("SearchClients(%+v) accepted a negative page", filter)
+		}
+	}
+}
@@ -15,10 +15,13 @@ import (
 
 // clientTrafficState stores previous traffic values for speed calculation
 type clientTrafficState struct {
-	prevUp      int64
-	prevDown    int64
-	prevTime    int64
-	mu          sync.RWMutex
+	prevUp     int64
+	prevDown   int64
+	prevTime   int64
+	lastActive int64  // unix seconds of the last cycle the client's counters changed
+	email      string // for the online list of clients that are not in the current cycle
+	enabled    bool
+	mu         sync.RWMutex
 }
 
 var (
@@ -35,10 +38,16 @@ func (s *ClientService) AddClientTraffic(tx *gorm.DB, traffics []*xray.ClientTra
 	clientsToDisable := make(map[string]string) // map[email]tag
 	affectedInboundIds := make(map[int]bool)    // Track affected inbounds for traffic sync
 
+	settingService := SettingService{}
+	offlineAfter, err := settingService.GetClientOfflineTimeout()
+	if err != nil {
+		offlineAfter = 0
+	}
+
 	if len(traffics) == 0 {
-		// Empty onlineUsers
+		// Only clients still within the offline timeout stay online
 		if p != nil {
-			p.SetOnlineClients(make([]string, 0))
+			p.SetOnlineClients(recentlyActiveClients(time.Now().Unix(), int64(offlineAfter), make([]string, 0)))
 		}
 		return clientsToDisable, affectedInboundIds, nil
 	}
@@ -86,7 +95,7 @@ func (s *ClientService) AddClientTraffic(tx *gorm.DB, traffics []*xray.ClientTra
 
 	// Load ClientEntity records for these emails
 	var clientEntities []*model.ClientEntity
-	err := tx.Model(&model.ClientEntity{}).Where("LOWER(email) IN (?)", emails).Find(&clientEntities).Error
+	err = tx.Model(&model.ClientEntity{}).Where("LOWER(email) IN (?)", emails).Find(&clientEntities).Error
 	if err != nil {
 		return nil, nil, err
 	}
@@ -258,6 +267,8 @@ func (s *ClientService) AddClientTraffic(tx *gorm.DB, traffics []*xray.ClientTra
 		client.Down += newUp   // Download (server→client) goes to Down
 		client.AllTime += newTotal
 		
+		state.recordActivity(client, newTotal, currentTime, int64(offlineAfter))
+
 		// Update state for next calculation (use updated values)
 		state.prevUp = client.Up
 		state.prevDown = client.Down
@@ -328,39 +339,16 @@ func (s *ClientService) AddClientTraffic(tx *gorm.DB, traffics []*xray.ClientTra
 		}
 	}
 
-	// Set onlineUsers
+	// Set onlineUsers: with an offline timeout, clients stay online until their counters
+	// have not changed for that long, instead of dropping out on the first idle cycle
 	if p != nil {
-		p.SetOnlineClients(onlineClients)
+		p.SetOnlineClients(recentlyActiveClients(time.Now().Unix(), int64(offlineAfter), onlineClients))
 	}
 
-	// Save client entities with retry logic for database lock errors
-	maxRetries := 3
-	baseDelay := 10 * time.Millisecond
-	for attempt := 0; attempt < maxRetries; attempt++ {
-		if attempt > 0 {
-			delay := baseDelay * time.Duration(1<<uint(attempt-1))
-			logger.Debugf("Retrying Save client entities (attempt %d/%d) after %v", attempt+1, maxRetries, delay)
-			time.Sleep(delay)
-		}
-		
-		err = tx.Save(clientEntities).Error
-		if err == nil {
-			break
-		}
-		
-		// Check if error is "database is locked"
-		errStr := err.Error()
-		if strings.Contains(errStr, "database is locked") || strings.Contains(errStr, "locked") {
-			if attempt < maxRetries-1 {
-				logger.Debugf("Database locked when saving client entities, will retry: %v", err)
-				continue
-			}
-			// Last attempt failed
-			logger.Warningf("Failed to save client entities after %d retries: %v", maxRetries, err)
-			return nil, nil, err
-		}
-		
-		// For other errors, don't retry
+	// Save client entities. A failed statement aborts the transaction, so transient errors
+	// (locks, deadlocks) are retried by the callers for the whole transaction.
+	err = tx.Save(clientEntities).Error
+	if err != nil {
 		logger.Warning("AddClientTraffic update data ", err)
 		return nil, nil, err
 	}
@@ -450,3 +438,37 @@ func (s *ClientService) syncInboundTrafficFromClients(tx *gorm.DB, inboundIds ma
 
 	return nil
 }
+
+// recordActivity notes whether the client's counters changed in this cycle (newTotal bytes) and
+// zeroes its speeds once they have not changed for offlineAfter seconds. The caller holds state.mu.
+func (state *clientTrafficState) recordActivity(client *model.ClientEntity, newTotal int64, now int64, offlineAfter int64) {
+	if newTotal > 0 {
+		state.lastActive = now
+	}
+	if offlineAfter > 0 && now-state.lastActive >= offlineAfter {
+		client.UpSpeed = 0
+		client.DownSpeed = 0
+	}
+	state.email = client.Email
+	state.enabled = client.Enable
+}
+
+// recentlyActiveClients returns the enabled clients whose traffic counters changed less than
+// offlineAfter seconds before now. With offlineAfter 0 the clients with traffic in this cycle
+// (current) are returned as they are.
+func recentlyActiveClients(now int64, offlineAfter int64, current []string) []string {
+	if offlineAfter <= 0 {
+		return current
+	}
+	trafficStateMu.RLock()
+	defer trafficStateMu.RUnlock()
+	online := make([]string, 0, len(current))
+	for _, state := range trafficStateMap {
+		state.mu.RLock()
+		if state.enabled && state.lastActive > 0 && now-state.lastActive < offlineAfter {
+			online = append(online, state.email)
+		}
+		state.mu.RUnlock()
+	}
+	return online
+}
@@ -0,0 +1,83 @@
+package service
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/konstpic/sharx-code/v2/database/model"
+)
+
+// useTrafficStates replaces the speed calculation states for the duration of the test.
+func useTrafficStates(t *testing.T, states map[int]*clientTrafficState) {
+	t.Helper()
+	trafficStateMu.Lock()
+	saved := trafficStateMap
+	trafficStateMap = states
+	trafficStateMu.Unlock()
+	t.Cleanup(func() {
+		trafficStateMu.Lock()
+		trafficStateMap = saved
+		trafficStateMu.Unlock()
+	})
+}
+
+func TestClientOfflineAfterIdenticalSnapshots(t *testing.T) {
+	state := &clientTrafficState{}
+	useTrafficStates(t, map[int]*clientTrafficState{1: state})
+	client := &model.ClientEntity{Email: "a@example.com", Enable: true}
+	const offlineAfter = 60
+
+	// First snapshot: the counters moved
+	client.UpSpeed, client.DownSpeed = 8000, 16000
+	state.recordActivity(client, 3000, 1000, offlineAfter)
+	if client.UpSpeed != 8000 || client.DownSpeed != 16000 {
+		t.Fatalf("speeds = %d/%d, want them kept for an active client", client.UpSpeed, client.DownSpeed)
+	}
+	if online := recentlyActiveClients(1000, offlineAfter, nil); !reflect.DeepEqual(online, []string{"a@example.com"}) {
+		t.Fatalf("online = %v, want the active client", online)
+	}
+
+	// An identical snapshot within the window keeps the client online
+	state.recordActivity(client, 0, 1030, offlineAfter)
+	if online := recentlyActiveClients(1030, offlineAfter, nil); !reflect.DeepEqual(online, []string{"a@example.com"}) {
+		t.Fatalf("online = %v, want the client online within the offline timeout", online)
+	}
+
+	// An identical snapshot after the window reports it offline
+	client.UpSpeed, client.DownSpeed = 8000, 16000
+	state.recordActivity(client, 0, 1060, offlineAfter)
+	if client.UpSpeed != 0 || client.DownSpeed != 0 {
+		t.Fatalf("speeds = %d/%d, want 0 for an idle client", client.UpSpeed, client.DownSpeed)
+	}
+	if online := recentlyActiveClients(1060, offlineAfter, nil); len(online) != 0 {
+		t.Fatalf("online = %v, want the idle client offline", online)
+	}
+}
+
+func TestRecentlyActiveClientsSkipsDisabledClients(t *testing.T) {
+	useTrafficStates(t, map[int]*clientTrafficState{
+		1: {email: "enabled@example.com", enabled: true, lastActive: 1000},
+		2: {email: "disabled@example.com", enabled: false, lastActive: 1000},
+		3: {email: "never@example.com", enabled: true},
+	})
+	if online := recentlyActiveClients(1010, 60, nil); !reflect.DeepEqual(online, []string{"enabled@example.com"}) {
+		t.Fatalf("online = %v, want only the enabled active client", online)
+	}
+}
+
+func TestRecentlyActiveClientsWithoutTimeout(t *testing.T) {
+	useTrafficStates(t, map[int]*clientTrafficState{
+		1: {email: "earlier@example.com", enabled: true, lastActive: 1000},
+	})
+	current := []string{"now@example.com"}
+	if online := recentlyActiveClients(1001, 0, current); !reflect.DeepEqual(online, current) {
+		t.Fatalf("online = %v, want only the clients of this cycle %v", online, current)
+	}
+
+	// Speeds are left to the speed calculation
+	client := &model.ClientEntity{UpSpeed: 100, DownSpeed: 200}
+	(&clientTrafficState{lastActive: 1}).recordActivity(client, 0, 1000, 0)
+	if client.UpSpeed != 100 || client.DownSpeed != 200 {
+		t.Fatalf("speeds = %d/%d, want them unchanged with the timeout disabled", client.UpSpeed, client.DownSpeed)
+	}
+}
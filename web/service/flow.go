@@ -0,0 +1,109 @@
+package service
+
+import (
+	"encoding/json"
+
+	"github.com/konstpic/sharx-code/v2/database/model"
+	"github.com/konstpic/sharx-code/v2/util/common"
+)
+
+// validFlows lists the XTLS flows a client may use.
+var validFlows = map[string]bool{
+	"xtls-rprx-vision":        true,
+	"xtls-rprx-vision-udp443": true,
+}
+
+// inboundFlowTransport returns the network and security of an inbound's stream settings.
+func inboundFlowTransport(inbound *model.Inbound) (network string, security string) {
+	network, security = "tcp", "none"
+	if inbound.StreamSettings == "" {
+		return network, security
+	}
+	var stream struct {
+		Network  string `json:"network"`
+		Security string `json:"security"`
+	}
+	if err := json.Unmarshal([]byte(inbound.StreamSettings), &stream); err != nil {
+		return network, security
+	}
+	if stream.Network != "" {
+		network = stream.Network
+	}
+	if stream.Security != "" {
+		security = stream.Security
+	}
+	return network, security
+}
+
+// validateClientFlow checks that flow can be used by a client of inbound.
+// Flow is only written for VLESS inbounds, where it requires TCP (raw) with TLS or Reality.
+func validateClientFlow(inbound *model.Inbound, email string, flow string) error {
+	if flow == "" || inbound.Protocol != model.VLESS {
+		return nil
+	}
+	if !validFlows[flow] {
+		return common.NewErrorf("Invalid flow %q for client %s", flow, email)
+	}
+	network, security := inboundFlowTransport(inbound)
+	if network != "tcp" && network != "raw" {
+		return common.NewErrorf("Flow %s of client %s requires TCP transport, but inbound %q uses %s", flow, email, inbound.Remark, network)
+	}
+	if security != "tls" && security != "reality" {
+		return common.NewErrorf("Flow %s of client %s requires TLS or Reality, but inbound %q uses %s", flow, email, inbound.Remark, security)
+	}
+	return nil
+}
+
+// validateInboundFlows checks the flows of the clients in inbound settings and of
+// the clients already assigned to the inbound against its transport.
+func (s *InboundService) validateInboundFlows(inbound *model.Inbound) error {
+	if inbound.Protocol != model.VLESS {
+		return nil
+	}
+	var settings struct {
+		Clients []struct {
+			Email string `json:"email"`
+			Flow  string `json:"flow"`
+		} `json:"clients"`
+	}
+	if inbound.Settings != "" {
+		if err := json.Unmarshal([]byte(inbound.Settings), &settings); err == nil {
+			for _, client := range settings.Clients {
+				if err := validateClientFlow(inbound, client.Email, client.Flow); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	if inbound.Id == 0 {
+		return nil
+	}
+	clients, err := s.GetClients(inbound)
+	if err != nil {
+		return err
+	}
+	for _, client := range clients {
+		if err := validateClientFlow(inbound, client.Email, client.Flow); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateClientFlowForInbounds checks the flow of a client against every inbound it is assigned to.
+func (s *ClientService) validateClientFlowForInbounds(email string, flow string, inboundIds []int) error {
+	if flow == "" {
+		return nil
+	}
+	inboundService := InboundService{}
+	for _, inboundId := range inboundIds {
+		inbound, err := inboundService.GetInbound(inboundId)
+		if err != nil {
+			return err
+		}
+		if err := validateClientFlow(inbound, email, flow); err != nil {
+			return err
+		}
+	}
+	return nil
+}
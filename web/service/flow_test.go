@@ -0,0 +1,51 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/konstpic/sharx-code/v2/database/model"
+)
+
+func TestValidateClientFlow(t *testing.T) {
+	tests := []struct {
+		name     string
+		protocol model.Protocol
+		stream   string
+		flow     string
+		ok       bool
+	}{
+		{"vless reality tcp vision", model.VLESS, `{"network":"tcp","security":"reality"}`, "xtls-rprx-vision", true},
+		{"vless tls raw vision", model.VLESS, `{"network":"raw","security":"tls"}`, "xtls-rprx-vision-udp443", true},
+		{"vless ws without flow", model.VLESS, `{"network":"ws","security":"tls"}`, "", true},
+		{"vless ws with flow", model.VLESS, `{"network":"ws","security":"tls"}`, "xtls-rprx-vision", false},
+		{"vless tcp without security", model.VLESS, `{"network":"tcp","security":"none"}`, "xtls-rprx-vision", false},
+		{"vless without stream settings", model.VLESS, "", "xtls-rprx-vision", false},
+		{"vless unknown flow", model.VLESS, `{"network":"tcp","security":"reality"}`, "xtls-rprx-direct", false},
+		// Flow is not written for other protocols
+		{"trojan ws with flow", model.Trojan, `{"network":"ws","security":"tls"}`, "xtls-rprx-vision", true},
+	}
+	for _, test := range tests {
+		inbound := &model.Inbound{Protocol: test.protocol, StreamSettings: test.stream, Remark: "test"}
+		err := validateClientFlow(inbound, "user@example.com", test.flow)
+		if (err == nil) != test.ok {
+			t.Errorf("%s: validateClientFlow() error = %v, want ok = %v", test.name, err, test.ok)
+		}
+	}
+}
+
+func TestValidateInboundFlowsOfNewInbound(t *testing.T) {
+	inbound := &model.Inbound{
+		Protocol:       model.VLESS,
+		StreamSettings: `{"network":"ws","security":"tls"}`,
+		Settings:       `{"clients":[{"email":"a@example.com","flow":""},{"email":"b@example.com","flow":"xtls-rprx-vision"}]}`,
+	}
+	s := &InboundService{}
+	if err := s.validateInboundFlows(inbound); err == nil {
+		t.Fatal("ws inbound with a vision client accepted")
+	}
+
+	inbound.StreamSettings = `{"network":"tcp","security":"reality"}`
+	if err := s.validateInboundFlows(inbound); err != nil {
+		t.Fatalf("reality inbound with a vision client rejected: %v", err)
+	}
+}
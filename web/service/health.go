@@ -0,0 +1,73 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/konstpic/sharx-code/v2/config"
+	"github.com/konstpic/sharx-code/v2/database"
+)
+
+// healthDBTimeout bounds the database ping done by the health check.
+const healthDBTimeout = 2 * time.Second
+
+// HealthStatus is the unauthenticated health/readiness report of the panel.
+// It intentionally carries no configuration details or secrets.
+type HealthStatus struct {
+	Healthy     bool   `json:"healthy"`     // Whether the panel is ready to serve (database reachable and core healthy)
+	Version     string `json:"version"`     // Panel version
+	Database    bool   `json:"database"`    // Whether the database is reachable
+	Core        string `json:"core"`        // Selected proxy core ("xray")
+	CoreRunning bool   `json:"coreRunning"` // Whether the local core process is running
+	CoreVersion string `json:"coreVersion"` // Version of the running core, "Unknown" if it is not running
+	MultiNode   bool   `json:"multiNode"`   // In multi-node mode the core runs on nodes, not locally
+}
+
+// GetHealth checks the database connection and the local core and reports overall health.
+// In multi-node mode the local core is not required to run.
+func GetHealth() *HealthStatus {
+	xrayService := XrayService{}
+	database := pingDatabase()
+	multiNode := false
+	if database {
+		settingService := SettingService{}
+		multiNode, _ = settingService.GetMultiNodeMode()
+	}
+	return newHealthStatus(database, xrayService.IsXrayRunning(), xrayService.GetXrayVersion(), multiNode)
+}
+
+// newHealthStatus builds the health report from the checked components.
+func newHealthStatus(database bool, coreRunning bool, coreVersion string, multiNode bool) *HealthStatus {
+	return &HealthStatus{
+		Healthy:     database && (coreRunning || multiNode),
+		Version:     config.GetVersion(),
+		Database:    database,
+		Core:        "xray",
+		CoreRunning: coreRunning,
+		CoreVersion: coreVersion,
+		MultiNode:   multiNode,
+	}
+}
+
+// StatusCode returns the HTTP status of the health endpoint: 200 when healthy, 503 otherwise.
+func (h *HealthStatus) StatusCode() int {
+	if !h.Healthy {
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusOK
+}
+
+func pingDatabase() bool {
+	db := database.GetDB()
+	if db == nil {
+		return false
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		return false
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), healthDBTimeout)
+	defer cancel()
+	return sqlDB.PingContext(ctx) == nil
+}
@@ -0,0 +1,38 @@
+package service
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestHealthStatusCode(t *testing.T) {
+	tests := []struct {
+		name        string
+		database    bool
+		coreRunning bool
+		multiNode   bool
+		want        int
+	}{
+		{"core running", true, true, false, http.StatusOK},
+		{"core not running", true, false, false, http.StatusServiceUnavailable},
+		{"core not running in multi-node mode", true, false, true, http.StatusOK},
+		{"database unreachable", false, true, false, http.StatusServiceUnavailable},
+	}
+	for _, test := range tests {
+		status := newHealthStatus(test.database, test.coreRunning, "25.12.8", test.multiNode)
+		if got := status.StatusCode(); got != test.want {
+			t.Errorf("%s: status code = %d, want %d (%+v)", test.name, got, test.want, status)
+		}
+	}
+}
+
+func TestGetHealthWithoutCore(t *testing.T) {
+	// No database and no Xray process in tests: the endpoint must report 503
+	status := GetHealth()
+	if status.CoreRunning || status.CoreVersion != "Unknown" {
+		t.Fatalf("health = %+v, want a stopped core", status)
+	}
+	if status.Healthy || status.StatusCode() != http.StatusServiceUnavailable {
+		t.Fatalf("health = %+v with status %d, want 503", status, status.StatusCode())
+	}
+}
@@ -140,7 +140,7 @@ func (s *HostService) UpdateHost(userId int, host *model.Host) error {
 		return err
 	}
 	if existing.UserId != userId {
-		return common.NewError("Host not found or access denied")
+		return common.NewCodedError(common.ErrCodeNotFound, "Host not found or access denied")
 	}
 
 	// Update timestamp
@@ -209,7 +209,7 @@ func (s *HostService) DeleteHost(userId int, id int) error {
 		return err
 	}
 	if existing.UserId != userId {
-		return common.NewError("Host not found or access denied")
+		return common.NewCodedError(common.ErrCodeNotFound, "Host not found or access denied")
 	}
 
 	db := database.GetDB()
@@ -158,10 +158,70 @@ func (s *InboundService) GetInbounds(userId int) ([]*model.Inbound, error) {
 			}
 		}
 	}
+
+	if err := s.fillClientAggregates(result); err != nil {
+		return nil, err
+	}
 	
 	return result, nil
 }
 
+// clientAggregateRow is the aggregate over the clients of one inbound.
+type clientAggregateRow struct {
+	InboundId         int
+	ActiveClientCount int
+	TotalUp           int64
+	TotalDown         int64
+}
+
+// fillClientAggregates sets the active client count and the summed client traffic of the inbounds
+// from client_entities, in a single grouped query.
+func (s *InboundService) fillClientAggregates(inbounds []*model.Inbound) error {
+	if len(inbounds) == 0 {
+		return nil
+	}
+	ids := make([]int, len(inbounds))
+	for i, inbound := range inbounds {
+		ids[i] = inbound.Id
+	}
+
+	var rows []clientAggregateRow
+	if err := clientAggregatesQuery(database.GetDB(), ids).Scan(&rows).Error; err != nil {
+		return err
+	}
+	applyClientAggregates(inbounds, rows)
+	return nil
+}
+
+// clientAggregatesQuery returns the grouped query on db for the client aggregates of inboundIds.
+// Active clients are those enabled and with active status, so expired and disabled clients
+// count towards the traffic only.
+func clientAggregatesQuery(db *gorm.DB, inboundIds []int) *gorm.DB {
+	return db.Table("client_inbound_mappings").
+		Select("client_inbound_mappings.inbound_id, "+
+			"COUNT(*) FILTER (WHERE client_entities.enable AND client_entities.status = ?) AS active_client_count, "+
+			"COALESCE(SUM(client_entities.up), 0) AS total_up, "+
+			"COALESCE(SUM(client_entities.down), 0) AS total_down", "active").
+		Joins("JOIN client_entities ON client_entities.id = client_inbound_mappings.client_id").
+		Where("client_inbound_mappings.inbound_id IN ?", inboundIds).
+		Group("client_inbound_mappings.inbound_id")
+}
+
+// applyClientAggregates sets the aggregates of rows on the inbounds; inbounds without clients keep zeros.
+func applyClientAggregates(inbounds []*model.Inbound, rows []clientAggregateRow) {
+	byInbound := make(map[int]int, len(rows))
+	for i, row := range rows {
+		byInbound[row.InboundId] = i
+	}
+	for _, inbound := range inbounds {
+		if i, ok := byInbound[inbound.Id]; ok {
+			inbound.ActiveClientCount = rows[i].ActiveClientCount
+			inbound.TotalUp = rows[i].TotalUp
+			inbound.TotalDown = rows[i].TotalDown
+		}
+	}
+}
+
 // GetAllInbounds retrieves all inbounds from the database.
 // Returns a slice of all inbound models with their associated client statistics.
 func (s *InboundService) GetAllInbounds() ([]*model.Inbound, error) {
@@ -171,8 +231,50 @@ func (s *InboundService) GetAllInbounds() ([]*model.Inbound, error) {
 	if err != nil && err != gorm.ErrRecordNotFound {
 		return nil, err
 	}
-	
-	// Enrich with node assignments
+	s.enrichInbounds(inbounds)
+	return inbounds, nil
+}
+
+// GetEnabledInbounds retrieves only enabled inbounds from the database.
+// The enable filter is applied in SQL, so disabled inbounds are never loaded.
+func (s *InboundService) GetEnabledInbounds() ([]*model.Inbound, error) {
+	var inbounds []*model.Inbound
+	err := enabledInboundsQuery(database.GetDB()).Find(&inbounds).Error
+	if err != nil && err != gorm.ErrRecordNotFound {
+		return nil, err
+	}
+	s.enrichInbounds(inbounds)
+	return inbounds, nil
+}
+
+// enabledInboundsQuery returns the query on db for the enabled inbounds with their client stats, ordered by ID.
+func enabledInboundsQuery(db *gorm.DB) *gorm.DB {
+	return db.Model(model.Inbound{}).Preload("ClientStats").Where("enable = ?", true).Order("id")
+}
+
+// GetInboundsPaged retrieves a page of inbounds ordered by ID.
+// Use it instead of GetAllInbounds when walking large tables in batches;
+// an empty result means there are no more inbounds.
+func (s *InboundService) GetInboundsPaged(offset, limit int) ([]*model.Inbound, error) {
+	if offset < 0 || limit <= 0 {
+		return nil, common.NewErrorf("invalid page: offset %d, limit %d", offset, limit)
+	}
+	var inbounds []*model.Inbound
+	err := inboundsPageQuery(database.GetDB(), offset, limit).Find(&inbounds).Error
+	if err != nil && err != gorm.ErrRecordNotFound {
+		return nil, err
+	}
+	s.enrichInbounds(inbounds)
+	return inbounds, nil
+}
+
+// inboundsPageQuery returns the query on db for one page of inbounds with their client stats, ordered by ID.
+func inboundsPageQuery(db *gorm.DB, offset, limit int) *gorm.DB {
+	return db.Model(model.Inbound{}).Preload("ClientStats").Order("id").Offset(offset).Limit(limit)
+}
+
+// enrichInbounds fills node assignments and client stats UUID/SubId for the given inbounds.
+func (s *InboundService) enrichInbounds(inbounds []*model.Inbound) {
 	nodeService := NodeService{}
 	for _, inbound := range inbounds {
 		// Load all nodes for this inbound
@@ -207,7 +309,6 @@ func (s *InboundService) GetAllInbounds() ([]*model.Inbound, error) {
 			}
 		}
 	}
-	return inbounds, nil
 }
 
 func (s *InboundService) GetInboundsByTrafficReset(period string) ([]*model.Inbound, error) {
@@ -243,34 +344,88 @@ func (s *InboundService) generateInboundTag(inbound *model.Inbound, multiMode bo
 	return fmt.Sprintf("inbound-%v:%v", inbound.Listen, inbound.Port)
 }
 
-func (s *InboundService) checkPortExist(listen string, port int, ignoreId int) (bool, error) {
-	db := database.GetDB()
-	if listen == "" || listen == "0.0.0.0" || listen == "::" || listen == "::0" {
-		db = db.Model(model.Inbound{}).Where("port = ?", port)
-	} else {
-		db = db.Model(model.Inbound{}).
-			Where("port = ?", port).
-			Where(
-				db.Model(model.Inbound{}).Where(
-					"listen = ?", listen,
-				).Or(
-					"listen = \"\"",
-				).Or(
-					"listen = \"0.0.0.0\"",
-				).Or(
-					"listen = \"::\"",
-				).Or(
-					"listen = \"::0\""))
+// isAnyListen reports whether listen binds all interfaces.
+func isAnyListen(listen string) bool {
+	return listen == "" || listen == "0.0.0.0" || listen == "::" || listen == "::0"
+}
+
+// listenAddresses returns the listen addresses of inbound, with an empty listen
+// standing for the wildcard address.
+func listenAddresses(inbound *model.Inbound) []string {
+	addresses := inbound.ListenAddresses()
+	if len(addresses) == 0 {
+		return []string{""}
+	}
+	return addresses
+}
+
+// listenOverlaps reports whether two listen addresses on the same port collide. A wildcard
+// collides with every address, IPv4 and IPv6 alike, since "::" is dual-stack on Linux.
+func listenOverlaps(a, b string) bool {
+	return isAnyListen(a) || isAnyListen(b) || a == b
+}
+
+// checkListenAddresses rejects listen addresses of one inbound that collide with each other,
+// such as a repeated address or a wildcard next to another address.
+func checkListenAddresses(inbound *model.Inbound) error {
+	addresses := listenAddresses(inbound)
+	for i := range addresses {
+		for j := i + 1; j < len(addresses); j++ {
+			if listenOverlaps(addresses[i], addresses[j]) {
+				return common.NewErrorf("listen addresses %s and %s overlap on port %d", addresses[i], addresses[j], inbound.Port)
+			}
+		}
 	}
+	return nil
+}
+
+// checkPortExist returns the first listen address of inbound that collides with another inbound
+// on the same port, or "" if there is none. Every address of inbound is checked against every
+// address of the stored inbounds.
+func (s *InboundService) checkPortExist(inbound *model.Inbound, ignoreId int) (string, error) {
+	db := database.GetDB()
+	query := db.Model(model.Inbound{}).Select("id", "listen").Where("port = ?", inbound.Port)
 	if ignoreId > 0 {
-		db = db.Where("id != ?", ignoreId)
+		query = query.Where("id != ?", ignoreId)
+	}
+	var existing []*model.Inbound
+	if err := query.Find(&existing).Error; err != nil {
+		return "", err
 	}
-	var count int64
-	err := db.Count(&count).Error
+	for _, address := range listenAddresses(inbound) {
+		for _, other := range existing {
+			for _, otherAddress := range listenAddresses(other) {
+				if listenOverlaps(address, otherAddress) {
+					if isAnyListen(address) {
+						address = "0.0.0.0"
+					}
+					return address, nil
+				}
+			}
+		}
+	}
+	return "", nil
+}
+
+// checkPortConflict validates that the listen addresses of inbound do not collide with each
+// other or with an existing inbound on the same port. Other inbounds are only checked in
+// single-node mode: in multi-node mode the same port may be reused on different nodes
+// (distinguished by SNI).
+func (s *InboundService) checkPortConflict(inbound *model.Inbound, ignoreId int, multiMode bool) error {
+	if err := checkListenAddresses(inbound); err != nil {
+		return err
+	}
+	if multiMode {
+		return nil
+	}
+	listen, err := s.checkPortExist(inbound, ignoreId)
 	if err != nil {
-		return false, err
+		return err
+	}
+	if listen != "" {
+		return common.NewCodedErrorf(common.ErrCodeInboundPortConflict, "Port already exists: %s:%d is already used by another inbound", listen, inbound.Port)
 	}
-	return count > 0, nil
+	return nil
 }
 
 // GetClients retrieves clients for an inbound.
@@ -415,6 +570,13 @@ func (s *InboundService) checkEmailExistForInbound(inbound *model.Inbound) (stri
 	return "", nil
 }
 
+// applyDefaultSniffing sets the sniffing of an inbound created without sniffing to defaultSniffing.
+func applyDefaultSniffing(inbound *model.Inbound, defaultSniffing string) {
+	if strings.TrimSpace(inbound.Sniffing) == "" && defaultSniffing != "" {
+		inbound.Sniffing = defaultSniffing
+	}
+}
+
 // AddInbound creates a new inbound configuration.
 // It validates port uniqueness, client email uniqueness, and required fields,
 // then saves the inbound to the database and optionally adds it to the running Xray instance.
@@ -424,14 +586,22 @@ func (s *InboundService) AddInbound(inbound *model.Inbound) (*model.Inbound, boo
 	// In multi-node mode, same port is allowed (with different SNI), but one node cannot have two inbounds with same port
 	settingService := SettingService{}
 	multiMode, _ := settingService.GetMultiNodeMode()
-	if !multiMode {
-		exist, err := s.checkPortExist(inbound.Listen, inbound.Port, 0)
-		if err != nil {
-			return inbound, false, err
-		}
-		if exist {
-			return inbound, false, common.NewError("Port already exists:", inbound.Port)
-		}
+	if err := s.checkPortConflict(inbound, 0, multiMode); err != nil {
+		return inbound, false, err
+	}
+	if err := s.validateInboundFlows(inbound); err != nil {
+		return inbound, false, err
+	}
+	if err := validateRealityKeys(inbound); err != nil {
+		return inbound, false, err
+	}
+	if err := validateSourceCountries(inbound); err != nil {
+		return inbound, false, err
+	}
+
+	// Apply the panel-wide default sniffing when none was specified
+	if defaultSniffing, err := settingService.GetDefaultSniffing(); err == nil {
+		applyDefaultSniffing(inbound, defaultSniffing)
 	}
 
 	existEmail, err := s.checkEmailExistForInbound(inbound)
@@ -439,7 +609,7 @@ func (s *InboundService) AddInbound(inbound *model.Inbound) (*model.Inbound, boo
 		return inbound, false, err
 	}
 	if existEmail != "" {
-		return inbound, false, common.NewError("Duplicate email:", existEmail)
+		return inbound, false, common.NewCodedError(common.ErrCodeClientEmailExists, "Duplicate email:", existEmail)
 	}
 
 	clients, err := s.GetClients(inbound)
@@ -524,7 +694,11 @@ func (s *InboundService) AddInbound(inbound *model.Inbound) (*model.Inbound, boo
 	// Traffic is stored directly in ClientEntity table
 
 	needRestart := false
-	if inbound.Enable {
+	if inbound.Enable && (inbound.HasMultipleListen() || inbound.RestrictsSourceCountries()) {
+		// The alias inbounds of additional listen addresses and the source country rules
+		// are only built on a full config reload
+		needRestart = true
+	} else if inbound.Enable {
 		if p != nil {
 			apiPort := p.GetAPIPort()
 			api, err := s.getXrayAPI(apiPort)
@@ -800,20 +974,17 @@ func (s *InboundService) UpdateInbound(inbound *model.Inbound) (*model.Inbound,
 	// In multi-node mode, same port is allowed (with different SNI), but one node cannot have two inbounds with same port
 	settingService := SettingService{}
 	multiMode, _ := settingService.GetMultiNodeMode()
-	if !multiMode {
-		exist, err := s.checkPortExist(inbound.Listen, inbound.Port, inbound.Id)
-		if err != nil {
-			// #region agent log
-			logger.Debugf("[DEBUG-AGENT] UpdateInbound service: checkPortExist error, inboundId=%d, error=%v", inbound.Id, err)
-			// #endregion
-			return inbound, false, err
-		}
-		if exist {
-			// #region agent log
-			logger.Debugf("[DEBUG-AGENT] UpdateInbound service: port already exists, inboundId=%d, port=%d", inbound.Id, inbound.Port)
-			// #endregion
-			return inbound, false, common.NewError("Port already exists:", inbound.Port)
-		}
+	if err := s.checkPortConflict(inbound, inbound.Id, multiMode); err != nil {
+		return inbound, false, err
+	}
+	if err := s.validateInboundFlows(inbound); err != nil {
+		return inbound, false, err
+	}
+	if err := validateRealityKeys(inbound); err != nil {
+		return inbound, false, err
+	}
+	if err := validateSourceCountries(inbound); err != nil {
+		return inbound, false, err
 	}
 
 	oldInbound, err := s.GetInbound(inbound.Id)
@@ -893,6 +1064,10 @@ func (s *InboundService) UpdateInbound(inbound *model.Inbound) (*model.Inbound,
 		}
 	}
 
+	// Inbounds with several listen addresses are expanded into several Xray inbounds,
+	// which are only (re)built on a full config reload
+	multiListen := oldInbound.HasMultipleListen() || inbound.HasMultipleListen()
+
 	oldInbound.Up = inbound.Up
 	oldInbound.Down = inbound.Down
 	oldInbound.Total = inbound.Total
@@ -906,6 +1081,8 @@ func (s *InboundService) UpdateInbound(inbound *model.Inbound) (*model.Inbound,
 	oldInbound.Settings = inbound.Settings
 	oldInbound.StreamSettings = inbound.StreamSettings
 	oldInbound.Sniffing = inbound.Sniffing
+	oldInbound.SourceCountryMode = inbound.SourceCountryMode
+	oldInbound.SourceCountries = inbound.SourceCountries
 	// Generate tag based on mode (multi-node uses ID for uniqueness)
 	oldInbound.Tag = s.generateInboundTag(inbound, multiMode)
 
@@ -927,7 +1104,12 @@ func (s *InboundService) UpdateInbound(inbound *model.Inbound) (*model.Inbound,
 	// Use fast API update if:
 	// 1. Only Settings changed (clients list), OR
 	// 2. In single mode and Xray is running locally
-	useFastAPI := onlySettingsChanged || (p != nil && !multiMode)
+	// 3. The inbound is bound to a single listen address
+	// 4. The source country rules of the inbound stay the same (rules are part of the routing config)
+	sourceCountriesChanged := originalOldInbound.SourceCountryMode != oldInbound.SourceCountryMode ||
+		originalOldInbound.SourceCountries != oldInbound.SourceCountries ||
+		(oldInbound.RestrictsSourceCountries() && (oldInbound.Tag != tag || originalOldInbound.Enable != oldInbound.Enable))
+	useFastAPI := (onlySettingsChanged || (p != nil && !multiMode)) && !multiListen && !sourceCountriesChanged
 
 	if useFastAPI {
 		// Fast path: Use API to update inbound (instant, no restart)
@@ -1046,6 +1228,8 @@ func (s *InboundService) UpdateInbound(inbound *model.Inbound) (*model.Inbound,
 			originalOldInbound.Listen != inbound.Listen ||
 			originalOldInbound.StreamSettings != inbound.StreamSettings ||
 			originalOldInbound.Sniffing != inbound.Sniffing ||
+			originalOldInbound.SourceCountryMode != inbound.SourceCountryMode ||
+			originalOldInbound.SourceCountries != inbound.SourceCountries ||
 			originalOldInbound.ExpiryTime != inbound.ExpiryTime ||
 			originalOldInbound.TrafficReset != inbound.TrafficReset
 		
@@ -1061,6 +1245,152 @@ func (s *InboundService) UpdateInbound(inbound *model.Inbound) (*model.Inbound,
 	return inbound, needRestart, err
 }
 
+// SetInboundEnable enables or disables an inbound without touching its clients or traffic.
+// Disabled inbounds are left out of generated Xray configs.
+// Returns whether Xray needs restart and any error.
+func (s *InboundService) SetInboundEnable(id int, enable bool) (bool, error) {
+	inbound, err := s.GetInbound(id)
+	if err != nil {
+		return false, err
+	}
+	if inbound.Enable == enable {
+		return false, nil
+	}
+
+	if err := updateInboundEnable(database.GetDB(), []int{id}, enable); err != nil {
+		return false, err
+	}
+	inbound.Enable = enable
+	if inbound.UserId > 0 {
+		cache.InvalidateInbounds(inbound.UserId)
+	}
+
+	settingService := SettingService{}
+	multiMode, _ := settingService.GetMultiNodeMode()
+	return s.applyInboundEnable(inbound, multiMode), nil
+}
+
+// BulkSetEnable enables or disables several inbounds of a user in one transaction.
+// Returns whether Xray needs a single restart afterwards and any error.
+func (s *InboundService) BulkSetEnable(userId int, inboundIds []int, enable bool) (bool, error) {
+	changed, err := setUserInboundsEnable(database.GetDB(), userId, inboundIds, enable)
+	if err != nil || len(changed) == 0 {
+		return false, err
+	}
+	cache.InvalidateInbounds(userId)
+
+	settingService := SettingService{}
+	multiMode, _ := settingService.GetMultiNodeMode()
+	return s.applyInboundsEnable(changed, multiMode), nil
+}
+
+// setUserInboundsEnable sets the enable flag of the inbounds inboundIds of userId in db with a
+// single update. Returns the inbounds whose flag changed; fails without changes if any of the
+// inbounds does not belong to the user.
+func setUserInboundsEnable(db *gorm.DB, userId int, inboundIds []int, enable bool) ([]*model.Inbound, error) {
+	if len(inboundIds) == 0 {
+		return nil, nil
+	}
+
+	// Verify all inbounds belong to user
+	var inbounds []*model.Inbound
+	err := db.Model(&model.Inbound{}).
+		Where("id IN ? AND user_id = ?", inboundIds, userId).
+		Find(&inbounds).Error
+	if err != nil {
+		return nil, err
+	}
+	if len(inbounds) != len(inboundIds) {
+		return nil, common.NewCodedError(common.ErrCodeNotFound, "Some inbounds not found or access denied")
+	}
+
+	changed := make([]*model.Inbound, 0, len(inbounds))
+	changedIds := make([]int, 0, len(inbounds))
+	for _, inbound := range inbounds {
+		if inbound.Enable != enable {
+			inbound.Enable = enable
+			changed = append(changed, inbound)
+			changedIds = append(changedIds, inbound.Id)
+		}
+	}
+	if len(changed) == 0 {
+		return nil, nil
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		return updateInboundEnable(tx, changedIds, enable)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return changed, nil
+}
+
+// applyInboundsEnable applies the changed enable flags of inbounds to the running local Xray.
+// Returns true if one restart is needed for the whole batch instead.
+func (s *InboundService) applyInboundsEnable(inbounds []*model.Inbound, multiMode bool) bool {
+	if multiMode {
+		// Node configs are rebuilt from enabled inbounds on restart
+		return true
+	}
+
+	needRestart := false
+	for _, inbound := range inbounds {
+		full, err := s.GetInbound(inbound.Id)
+		if err != nil {
+			needRestart = true
+			continue
+		}
+		if s.applyInboundEnable(full, false) {
+			needRestart = true
+		}
+	}
+	return needRestart
+}
+
+// updateInboundEnable sets the enable flag of the inbounds ids in db. Only that column is
+// written, so clients, client mappings and traffic of the inbounds are kept.
+func updateInboundEnable(db *gorm.DB, ids []int, enable bool) error {
+	return db.Model(&model.Inbound{}).Where("id IN ?", ids).Update("enable", enable).Error
+}
+
+// applyInboundEnable adds or removes an inbound on the running local Xray via API
+// after its enable flag changed. Returns true if a restart is needed instead.
+func (s *InboundService) applyInboundEnable(inbound *model.Inbound, multiMode bool) bool {
+	if multiMode || p == nil || inbound.HasMultipleListen() || inbound.RestrictsSourceCountries() {
+		// Node configs (or a stopped local Xray) are rebuilt from enabled inbounds on restart,
+		// as are the alias inbounds of additional listen addresses and source country rules
+		return true
+	}
+
+	api, err := s.getXrayAPI(p.GetAPIPort())
+	if err != nil {
+		logger.Debug("Failed to get XrayAPI connection:", err)
+		return true
+	}
+
+	if !inbound.Enable {
+		if err := api.DelInbound(inbound.Tag); err != nil {
+			logger.Debug("Unable to delete disabled inbound by api:", err)
+			return true
+		}
+		logger.Debug("Disabled inbound deleted by api:", inbound.Tag)
+		return false
+	}
+
+	inboundJson, err := json.MarshalIndent(inbound.GenXrayInboundConfig(), "", "  ")
+	if err != nil {
+		logger.Debug("Unable to marshal enabled inbound config:", err)
+		return true
+	}
+	if err := api.AddInbound(inboundJson); err != nil {
+		logger.Debug("Unable to add enabled inbound by api:", err)
+		return true
+	}
+	logger.Debug("Enabled inbound added by api:", inbound.Tag)
+	return false
+}
+
 // updateClientTraffics is removed - clients are now managed through ClientEntity
 // Traffic is stored directly in ClientEntity table, no need to sync with client_traffics
 
@@ -1269,7 +1599,7 @@ func (s *InboundService) UpdateInboundClient(data *model.Inbound, clientId strin
 			return false, err
 		}
 		if existEmail != "" {
-			return false, common.NewError("Duplicate email:", existEmail)
+			return false, common.NewCodedError(common.ErrCodeClientEmailExists, "Duplicate email:", existEmail)
 		}
 	}
 
@@ -1298,34 +1628,39 @@ func (s *InboundService) UpdateInboundClient(data *model.Inbound, clientId strin
 }
 
 func (s *InboundService) AddTraffic(inboundTraffics []*xray.Traffic, clientTraffics []*xray.ClientTraffic) (error, bool) {
-	var err error
-	db := database.GetDB()
-	tx := db.Begin()
+	recordTrafficSamples(inboundTraffics, clientTraffics)
+
+	// The whole transaction is retried on transient database errors (locks, deadlocks)
+	var clientsToDisable map[string]string
+	needRestart0 := false
+	err := database.RetryWrite(func() error {
+		return database.GetDB().Transaction(func(tx *gorm.DB) error {
+			var err error
+			// Client traffic is now handled by ClientService
+			// Inbound traffic will be synchronized as sum of all its clients' traffic
+			clientService := ClientService{}
+			clientsToDisable, _, err = clientService.AddClientTraffic(tx, clientTraffics, s)
+			if err != nil {
+				return err
+			}
 
-	defer func() {
-		if err != nil {
-			tx.Rollback()
-		} else {
-			tx.Commit()
-		}
-	}()
-	// Client traffic is now handled by ClientService
-	// Inbound traffic will be synchronized as sum of all its clients' traffic
-	clientService := ClientService{}
-	clientsToDisable, _, err := clientService.AddClientTraffic(tx, clientTraffics, s)
-	if err != nil {
-		return err, false
-	}
-	
-	// Note: We no longer update inbound traffic directly from Xray API
-	// Instead, inbound traffic is synchronized as sum of all its clients' traffic in AddClientTraffic
-	// This ensures consistency between inbound and client traffic
+			// Note: We no longer update inbound traffic directly from Xray API
+			// Instead, inbound traffic is synchronized as sum of all its clients' traffic in AddClientTraffic
+			// This ensures consistency between inbound and client traffic
 
-	needRestart0, count, err := s.autoRenewClients(tx)
+			var count int64
+			needRestart0, count, err = s.autoRenewClients(tx)
+			if err != nil {
+				logger.Warning("Error in renew clients:", err)
+				return err
+			} else if count > 0 {
+				logger.Debugf("%v clients renewed", count)
+			}
+			return nil
+		})
+	})
 	if err != nil {
-		logger.Warning("Error in renew clients:", err)
-	} else if count > 0 {
-		logger.Debugf("%v clients renewed", count)
+		return err, false
 	}
 
 	// NOTE: disableInvalidClients is no longer needed - client disabling is handled by ClientService.AddClientTraffic
@@ -1343,8 +1678,7 @@ func (s *InboundService) AddTraffic(inboundTraffics []*xray.Traffic, clientTraff
 	// This is done outside the transaction to avoid nested transactions
 	// The client_traffics.enable has already been updated in addClientTraffic
 	// Now we need to sync ClientEntity.Enable and remove from Xray API
-	// IMPORTANT: Only process if we have clients to disable AND transaction was successful
-	if len(clientsToDisable) > 0 && err == nil {
+	if len(clientsToDisable) > 0 {
 		logger.Debugf("AddTraffic: %d clients need to be disabled: %v", len(clientsToDisable), clientsToDisable)
 		// Run in goroutine to avoid blocking traffic updates
 		go func() {
@@ -1366,8 +1700,6 @@ func (s *InboundService) AddTraffic(inboundTraffics []*xray.Traffic, clientTraff
 				}
 			}
 		}()
-	} else if len(clientsToDisable) > 0 {
-		logger.Debugf("AddTraffic: %d clients to disable but transaction failed, skipping", len(clientsToDisable))
 	}
 	
 	return nil, (needRestart0 || needRestart1 || needRestart2)
@@ -1382,7 +1714,8 @@ func (s *InboundService) addInboundTraffic(tx *gorm.DB, traffics []*xray.Traffic
 
 	for _, traffic := range traffics {
 		if traffic.IsInbound {
-			err = tx.Model(&model.Inbound{}).Where("tag = ?", traffic.Tag).
+			// Traffic of additional listen addresses is accounted to the inbound itself
+			err = tx.Model(&model.Inbound{}).Where("tag = ?", xray.BaseInboundTag(traffic.Tag)).
 				Updates(map[string]any{
 					"up":       gorm.Expr("up + ?", traffic.Up),
 					"down":     gorm.Expr("down + ?", traffic.Down),
@@ -2140,6 +2473,22 @@ func (s *InboundService) ResetAllClientTraffics(id int) error {
 	})
 }
 
+// ResetInboundTraffic resets the up/down counters of a single inbound.
+func (s *InboundService) ResetInboundTraffic(id int) error {
+	db := database.GetDB()
+	return db.Model(model.Inbound{}).
+		Where("id = ?", id).
+		Updates(map[string]any{"up": 0, "down": 0}).Error
+}
+
+// SetLastTrafficResetTime records when the traffic of an inbound was last reset (unix milliseconds).
+func (s *InboundService) SetLastTrafficResetTime(id int, resetTime int64) error {
+	db := database.GetDB()
+	return db.Model(model.Inbound{}).
+		Where("id = ?", id).
+		Update("last_traffic_reset_time", resetTime).Error
+}
+
 func (s *InboundService) ResetAllTraffics() error {
 	db := database.GetDB()
 
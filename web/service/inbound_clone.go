@@ -0,0 +1,150 @@
+package service
+
+import (
+	"encoding/json"
+
+	"github.com/konstpic/sharx-code/v2/database"
+	"github.com/konstpic/sharx-code/v2/database/model"
+	"github.com/konstpic/sharx-code/v2/util/common"
+	"github.com/konstpic/sharx-code/v2/web/cache"
+)
+
+// CloneInbound creates a copy of an inbound with its settings, stream settings and sniffing on
+// newPort. The copy starts with zero traffic and, in multi-node mode, is assigned to the same nodes.
+// An empty newTag generates the tag as for a new inbound; in multi-node mode tags are always derived
+// from the inbound ID, so newTag is ignored there. With copyClients the clients of the inbound are
+// assigned to the copy as well.
+// Returns the new inbound and whether Xray needs restart.
+func (s *InboundService) CloneInbound(id int, newPort int, newTag string, copyClients bool) (*model.Inbound, bool, error) {
+	if newPort <= 0 || newPort > 65535 {
+		return nil, false, common.NewCodedErrorf(common.ErrCodeInvalidPort, "invalid port: %d", newPort)
+	}
+	source, err := s.GetInbound(id)
+	if err != nil {
+		return nil, false, err
+	}
+
+	inbound, err := newClonedInbound(source, newPort)
+	if err != nil {
+		return nil, false, err
+	}
+
+	settingService := SettingService{}
+	multiMode, _ := settingService.GetMultiNodeMode()
+	if newTag == "" || multiMode {
+		newTag = s.generateInboundTag(inbound, multiMode)
+	} else {
+		var count int64
+		if err := database.GetDB().Model(model.Inbound{}).Where("tag = ?", newTag).Count(&count).Error; err != nil {
+			return nil, false, err
+		}
+		if count > 0 {
+			return nil, false, common.NewCodedErrorf(common.ErrCodeInboundTagExists, "Tag already exists: %s is already used by another inbound", newTag)
+		}
+	}
+	inbound.Tag = newTag
+
+	inbound, needRestart, err := s.AddInbound(inbound)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if multiMode {
+		nodeService := NodeService{}
+		nodes, err := nodeService.GetNodesForInbound(id)
+		if err != nil {
+			return inbound, needRestart, err
+		}
+		if len(nodes) > 0 {
+			nodeIds := make([]int, len(nodes))
+			for i, node := range nodes {
+				nodeIds[i] = node.Id
+			}
+			if err := nodeService.AssignInboundToNodes(inbound.Id, nodeIds); err != nil {
+				return inbound, needRestart, err
+			}
+			inbound.NodeIds = nodeIds
+		}
+	}
+
+	if !copyClients {
+		return inbound, needRestart, nil
+	}
+	clientService := ClientService{}
+	clients, err := clientService.GetClientsForInbound(id)
+	if err != nil {
+		return inbound, needRestart, err
+	}
+	if len(clients) == 0 {
+		return inbound, needRestart, nil
+	}
+	db := database.GetDB()
+	tx := db.Begin()
+	for _, client := range clients {
+		if err := clientService.AssignClientToInbounds(tx, client.Id, []int{inbound.Id}); err != nil {
+			tx.Rollback()
+			return inbound, needRestart, err
+		}
+	}
+	if err := tx.Commit().Error; err != nil {
+		return inbound, needRestart, err
+	}
+	cache.InvalidateClients(inbound.UserId)
+
+	// Rebuild the settings' client list from the assigned clients
+	newSettings, err := s.BuildSettingsFromClientEntities(inbound, clients)
+	if err != nil {
+		return inbound, needRestart, err
+	}
+	inbound.Settings = newSettings
+	updated, inboundNeedRestart, err := s.updateInboundWithRetry(inbound)
+	if err != nil {
+		return inbound, needRestart, err
+	}
+	return updated, needRestart || inboundNeedRestart, nil
+}
+
+// newClonedInbound returns a copy of source on newPort, without ID, tag, traffic or clients.
+func newClonedInbound(source *model.Inbound, newPort int) (*model.Inbound, error) {
+	// The client list of the settings is rebuilt from the assigned clients after creation
+	settings, err := cloneSettingsWithoutClients(source.Settings)
+	if err != nil {
+		return nil, common.NewErrorf("invalid settings of inbound %d: %v", source.Id, err)
+	}
+	return &model.Inbound{
+		UserId:         source.UserId,
+		Remark:         source.Remark,
+		Enable:         source.Enable,
+		Total:          source.Total,
+		ExpiryTime:     source.ExpiryTime,
+		TrafficReset:   source.TrafficReset,
+		Listen:         source.Listen,
+		Port:           newPort,
+		Protocol:       source.Protocol,
+		Settings:       settings,
+		StreamSettings: source.StreamSettings,
+		Sniffing:       source.Sniffing,
+
+		SourceCountryMode: source.SourceCountryMode,
+		SourceCountries:   source.SourceCountries,
+	}, nil
+}
+
+// cloneSettingsWithoutClients returns inbound settings with an empty client list.
+func cloneSettingsWithoutClients(settings string) (string, error) {
+	if settings == "" {
+		return "{}", nil
+	}
+	parsed := map[string]any{}
+	if err := json.Unmarshal([]byte(settings), &parsed); err != nil {
+		return "", err
+	}
+	if _, ok := parsed["clients"]; ok {
+		parsed["clients"] = []any{}
+	}
+	out, err := json.MarshalIndent(parsed, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
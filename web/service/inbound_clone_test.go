@@ -0,0 +1,90 @@
+package service
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/konstpic/sharx-code/v2/database/model"
+	"github.com/konstpic/sharx-code/v2/xray"
+)
+
+func testCloneSource() *model.Inbound {
+	return &model.Inbound{
+		Id:             7,
+		UserId:         1,
+		Remark:         "vless",
+		Enable:         true,
+		Up:             1000,
+		Down:           2000,
+		AllTime:        3000,
+		Port:           443,
+		Protocol:       model.VLESS,
+		Tag:            "inbound-443",
+		Settings:       `{"clients":[{"id":"b831381d-6324-4d53-ad4f-8cda48b30811","email":"a@example.com"}],"decryption":"none"}`,
+		StreamSettings: `{"network":"tcp","security":"reality"}`,
+		Sniffing:       `{"enabled":true,"destOverride":["http","tls"]}`,
+		ClientStats:    []xray.ClientTraffic{{Email: "a@example.com", Up: 10}},
+		NodeIds:        []int{2},
+
+		SourceCountryMode: model.SourceCountryDeny,
+		SourceCountries:   "cn,ir",
+	}
+}
+
+func TestNewClonedInbound(t *testing.T) {
+	source := testCloneSource()
+	clone, err := newClonedInbound(source, 8443)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if clone.Id != 0 || clone.Tag != "" || clone.Port != 8443 {
+		t.Fatalf("clone id %d, tag %q, port %d, want a new inbound on 8443 without id and tag", clone.Id, clone.Tag, clone.Port)
+	}
+	if clone.Up != 0 || clone.Down != 0 || clone.AllTime != 0 || clone.ClientStats != nil || clone.NodeIds != nil {
+		t.Fatalf("clone = %+v, want no traffic, client stats or nodes", clone)
+	}
+	if clone.Protocol != source.Protocol || clone.StreamSettings != source.StreamSettings || clone.Sniffing != source.Sniffing ||
+		clone.Remark != source.Remark || clone.SourceCountryMode != source.SourceCountryMode || clone.SourceCountries != source.SourceCountries {
+		t.Fatalf("clone = %+v, want the settings of the source", clone)
+	}
+
+	var settings map[string]any
+	if err := json.Unmarshal([]byte(clone.Settings), &settings); err != nil {
+		t.Fatal(err)
+	}
+	if clients, ok := settings["clients"].([]any); !ok || len(clients) != 0 || settings["decryption"] != "none" {
+		t.Fatalf("clone settings = %s, want the source settings with an empty client list", clone.Settings)
+	}
+
+	// Changing the clone leaves the source as it was
+	clone.Remark = "copy"
+	clone.Enable = false
+	if source.Remark != "vless" || !source.Enable || source.Port != 443 || source.Tag != "inbound-443" {
+		t.Fatalf("source changed with the clone: %+v", source)
+	}
+}
+
+func TestNewClonedInboundTag(t *testing.T) {
+	clone, err := newClonedInbound(testCloneSource(), 8443)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tag := (&InboundService{}).generateInboundTag(clone, false); tag != "inbound-8443" {
+		t.Fatalf("generated tag = %q, want one distinct from the source's inbound-443", tag)
+	}
+}
+
+func TestNewClonedInboundInvalidSettings(t *testing.T) {
+	source := testCloneSource()
+	source.Settings = `{"clients":`
+	if _, err := newClonedInbound(source, 8443); err == nil {
+		t.Fatal("cloned an inbound with invalid settings")
+	}
+
+	source.Settings = ""
+	clone, err := newClonedInbound(source, 8443)
+	if err != nil || clone.Settings != "{}" {
+		t.Fatalf("clone settings = %q, %v, want {} for an inbound without settings", clone.Settings, err)
+	}
+}
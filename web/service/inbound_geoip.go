@@ -0,0 +1,144 @@
+package service
+
+import (
+	"encoding/json"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/konstpic/sharx-code/v2/database/model"
+	"github.com/konstpic/sharx-code/v2/util/common"
+	"github.com/konstpic/sharx-code/v2/util/json_util"
+	"github.com/konstpic/sharx-code/v2/xray"
+)
+
+// sourceCountryBlockedTag is the tag of the blackhole outbound added for source country rules
+// when the config has none.
+const sourceCountryBlockedTag = "blocked"
+
+// countryCodeRe matches a two-letter geoip country code.
+var countryCodeRe = regexp.MustCompile(`^[a-z]{2}$`)
+
+// validateSourceCountries checks the source country restriction of an inbound and normalizes
+// the country codes to a sorted, lowercase list without duplicates.
+func validateSourceCountries(inbound *model.Inbound) error {
+	inbound.SourceCountryMode = strings.ToLower(strings.TrimSpace(inbound.SourceCountryMode))
+	countries := make([]string, 0)
+	for _, country := range inbound.SourceCountryList() {
+		country = strings.ToLower(country)
+		if !countryCodeRe.MatchString(country) {
+			return common.NewErrorf("Invalid country code %q: expected a two-letter ISO 3166-1 code", country)
+		}
+		if !slices.Contains(countries, country) {
+			countries = append(countries, country)
+		}
+	}
+	slices.Sort(countries)
+	inbound.SourceCountries = strings.Join(countries, ",")
+
+	switch inbound.SourceCountryMode {
+	case "":
+		return nil
+	case model.SourceCountryAllow, model.SourceCountryDeny:
+		if len(countries) == 0 {
+			return common.NewErrorf("Source country mode %q needs at least one country", inbound.SourceCountryMode)
+		}
+		return nil
+	default:
+		return common.NewErrorf("Invalid source country mode %q: expected %q or %q", inbound.SourceCountryMode, model.SourceCountryAllow, model.SourceCountryDeny)
+	}
+}
+
+// applySourceCountryRules adds a routing rule for every inbound with a source country restriction
+// that sends connections from disallowed countries to a blackhole outbound. In allow mode the rule
+// matches sources outside all listed countries (negated geoip entries are merged by Xray), in deny
+// mode sources in any of them. The rules go first, so they apply before any other routing rule.
+func applySourceCountryRules(config *xray.Config, inbounds []*model.Inbound) error {
+	var rules []any
+	for _, inbound := range inbounds {
+		if !inbound.RestrictsSourceCountries() {
+			continue
+		}
+		tags := make([]string, 0, 1)
+		for _, inboundConfig := range inbound.GenXrayInboundConfigs() {
+			tags = append(tags, inboundConfig.Tag)
+		}
+		prefix := "geoip:"
+		if inbound.SourceCountryMode == model.SourceCountryAllow {
+			prefix = "geoip:!"
+		}
+		sources := make([]string, 0)
+		for _, country := range inbound.SourceCountryList() {
+			sources = append(sources, prefix+country)
+		}
+		rules = append(rules, map[string]any{
+			"type":       "field",
+			"inboundTag": tags,
+			"source":     sources,
+		})
+	}
+	if len(rules) == 0 {
+		return nil
+	}
+
+	blockedTag, err := ensureBlackholeOutbound(config)
+	if err != nil {
+		return err
+	}
+	for _, rule := range rules {
+		rule.(map[string]any)["outboundTag"] = blockedTag
+	}
+
+	routing := map[string]any{}
+	if len(config.RouterConfig) > 0 && string(config.RouterConfig) != "null" {
+		if err := json.Unmarshal(config.RouterConfig, &routing); err != nil {
+			return common.NewErrorf("invalid routing config: %v", err)
+		}
+	}
+	existing, _ := routing["rules"].([]any)
+	routing["rules"] = append(rules, existing...)
+	raw, err := json.MarshalIndent(routing, "", "  ")
+	if err != nil {
+		return err
+	}
+	config.RouterConfig = json_util.RawMessage(raw)
+	return nil
+}
+
+// ensureBlackholeOutbound returns the tag of the first blackhole outbound of config,
+// adding one if there is none.
+func ensureBlackholeOutbound(config *xray.Config) (string, error) {
+	var outbounds []map[string]any
+	if len(config.OutboundConfigs) > 0 && string(config.OutboundConfigs) != "null" {
+		if err := json.Unmarshal(config.OutboundConfigs, &outbounds); err != nil {
+			return "", common.NewErrorf("invalid outbounds config: %v", err)
+		}
+	}
+	for _, outbound := range outbounds {
+		if protocol, _ := outbound["protocol"].(string); protocol == "blackhole" {
+			if tag, _ := outbound["tag"].(string); tag != "" {
+				return tag, nil
+			}
+		}
+	}
+
+	tag := sourceCountryBlockedTag
+	for _, outbound := range outbounds {
+		if existing, _ := outbound["tag"].(string); existing == tag {
+			// The tag is taken by an outbound of another protocol
+			tag = "source-country-" + sourceCountryBlockedTag
+			break
+		}
+	}
+	outbounds = append(outbounds, map[string]any{
+		"protocol": "blackhole",
+		"tag":      tag,
+		"settings": map[string]any{},
+	})
+	raw, err := json.MarshalIndent(outbounds, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	config.OutboundConfigs = json_util.RawMessage(raw)
+	return tag, nil
+}
@@ -0,0 +1,118 @@
+package service
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/konstpic/sharx-code/v2/database/model"
+	"github.com/konstpic/sharx-code/v2/xray"
+)
+
+func TestValidateSourceCountries(t *testing.T) {
+	inbound := &model.Inbound{SourceCountryMode: " Allow ", SourceCountries: "US, de,us,,FR"}
+	if err := validateSourceCountries(inbound); err != nil {
+		t.Fatal(err)
+	}
+	if inbound.SourceCountryMode != model.SourceCountryAllow || inbound.SourceCountries != "de,fr,us" {
+		t.Fatalf("normalized to %q %q, want allow de,fr,us", inbound.SourceCountryMode, inbound.SourceCountries)
+	}
+
+	for _, invalid := range []model.Inbound{
+		{SourceCountryMode: "deny", SourceCountries: "usa"},
+		{SourceCountryMode: "deny", SourceCountries: "u1"},
+		{SourceCountryMode: "deny", SourceCountries: "private"},
+		{SourceCountryMode: "deny"},
+		{SourceCountryMode: "block", SourceCountries: "ru"},
+	} {
+		if err := validateSourceCountries(&invalid); err == nil {
+			t.Errorf("validateSourceCountries(%q, %q) accepted an invalid restriction", invalid.SourceCountryMode, invalid.SourceCountries)
+		}
+	}
+
+	// Countries without a mode are kept but do not restrict anything
+	inbound = &model.Inbound{SourceCountries: "ru"}
+	if err := validateSourceCountries(inbound); err != nil || inbound.RestrictsSourceCountries() {
+		t.Fatalf("validateSourceCountries() = %v, restricts %v, want no restriction without a mode", err, inbound.RestrictsSourceCountries())
+	}
+}
+
+// sourceCountryTestConfig decodes the routing rules and outbounds of config.
+func sourceCountryTestConfig(t *testing.T, config *xray.Config) ([]map[string]any, []map[string]any) {
+	t.Helper()
+	var routing struct {
+		Rules []map[string]any `json:"rules"`
+	}
+	if err := json.Unmarshal(config.RouterConfig, &routing); err != nil {
+		t.Fatal(err)
+	}
+	var outbounds []map[string]any
+	if err := json.Unmarshal(config.OutboundConfigs, &outbounds); err != nil {
+		t.Fatal(err)
+	}
+	return routing.Rules, outbounds
+}
+
+func TestApplySourceCountryRules(t *testing.T) {
+	config := &xray.Config{
+		RouterConfig:    []byte(`{"domainStrategy":"AsIs","rules":[{"type":"field","outboundTag":"blocked","ip":["geoip:private"]}]}`),
+		OutboundConfigs: []byte(`[{"protocol":"freedom","tag":"direct"},{"protocol":"blackhole","tag":"blocked"}]`),
+	}
+	inbounds := []*model.Inbound{
+		{Tag: "inbound-443", Port: 443, Protocol: model.VLESS, SourceCountryMode: model.SourceCountryAllow, SourceCountries: "de,fr"},
+		{Tag: "inbound-8443", Port: 8443, Listen: "192.0.2.10,192.0.2.11", Protocol: model.VLESS, SourceCountryMode: model.SourceCountryDeny, SourceCountries: "cn"},
+		{Tag: "inbound-9443", Port: 9443, Protocol: model.VLESS},
+	}
+	if err := applySourceCountryRules(config, inbounds); err != nil {
+		t.Fatal(err)
+	}
+
+	rules, outbounds := sourceCountryTestConfig(t, config)
+	if len(rules) != 3 {
+		t.Fatalf("rules = %v, want two source country rules ahead of the template's rule", rules)
+	}
+	allow := rules[0]
+	if !reflect.DeepEqual(allow["inboundTag"], []any{"inbound-443"}) || !reflect.DeepEqual(allow["source"], []any{"geoip:!de", "geoip:!fr"}) || allow["outboundTag"] != "blocked" {
+		t.Errorf("allow rule = %v, want sources outside de and fr of inbound-443 blocked", allow)
+	}
+	deny := rules[1]
+	// The rule covers the listen alias as well
+	if !reflect.DeepEqual(deny["inboundTag"], []any{"inbound-8443", "inbound-8443-listen2"}) || !reflect.DeepEqual(deny["source"], []any{"geoip:cn"}) || deny["outboundTag"] != "blocked" {
+		t.Errorf("deny rule = %v, want sources in cn of inbound-8443 and its alias blocked", deny)
+	}
+	if !reflect.DeepEqual(rules[2]["ip"], []any{"geoip:private"}) {
+		t.Errorf("last rule = %v, want the template's rule", rules[2])
+	}
+	if len(outbounds) != 2 {
+		t.Errorf("outbounds = %v, want the existing blackhole reused", outbounds)
+	}
+}
+
+func TestApplySourceCountryRulesAddsBlackhole(t *testing.T) {
+	config := &xray.Config{
+		// "blocked" is taken by an outbound that is not a blackhole
+		OutboundConfigs: []byte(`[{"protocol":"freedom","tag":"direct"},{"protocol":"socks","tag":"blocked"}]`),
+	}
+	inbounds := []*model.Inbound{{Tag: "inbound-443", Port: 443, Protocol: model.VLESS, SourceCountryMode: model.SourceCountryDeny, SourceCountries: "ir"}}
+	if err := applySourceCountryRules(config, inbounds); err != nil {
+		t.Fatal(err)
+	}
+
+	rules, outbounds := sourceCountryTestConfig(t, config)
+	if len(rules) != 1 || rules[0]["outboundTag"] != "source-country-blocked" {
+		t.Fatalf("rules = %v, want one rule to the added blackhole", rules)
+	}
+	if len(outbounds) != 3 || outbounds[2]["protocol"] != "blackhole" || outbounds[2]["tag"] != "source-country-blocked" {
+		t.Fatalf("outbounds = %v, want a blackhole added under a free tag", outbounds)
+	}
+}
+
+func TestApplySourceCountryRulesWithoutRestrictions(t *testing.T) {
+	config := &xray.Config{RouterConfig: []byte(`{"rules":[]}`)}
+	if err := applySourceCountryRules(config, []*model.Inbound{{Tag: "inbound-443", SourceCountries: "de"}}); err != nil {
+		t.Fatal(err)
+	}
+	if string(config.RouterConfig) != `{"rules":[]}` || config.OutboundConfigs != nil {
+		t.Fatalf("config changed without restricted inbounds: routing %s, outbounds %s", config.RouterConfig, config.OutboundConfigs)
+	}
+}
@@ -0,0 +1,309 @@
+package service
+
+import (
+	"encoding/json"
+	"net"
+	"strings"
+
+	"github.com/konstpic/sharx-code/v2/database/model"
+	"github.com/konstpic/sharx-code/v2/util/common"
+)
+
+// defaultSingboxFingerprint is the uTLS fingerprint of Reality outbounds whose inbound sets none;
+// sing-box requires uTLS for Reality.
+const defaultSingboxFingerprint = "chrome"
+
+// GetSingboxOutbound returns the connection of the client with the given email to an inbound as
+// a sing-box outbound object (type, server, credentials, tls/reality and transport), tagged with
+// the client email. The server address is taken as for subscription links: the first external
+// proxy, the enabled host of the inbound, the first node in multi-node mode, a specific listen
+// address, and defaultServer last. Reality uses the first server name and a shortId chosen by
+// client ID, so the object of a client stays the same between calls.
+func (s *InboundService) GetSingboxOutbound(userId int, inboundId int, email string, defaultServer string) (map[string]any, error) {
+	inbound, err := s.GetInbound(inboundId)
+	if err != nil {
+		return nil, err
+	}
+	if inbound.UserId != userId {
+		return nil, common.NewCodedErrorf(common.ErrCodeNotFound, "Inbound not found: %d", inboundId)
+	}
+	clientService := ClientService{}
+	clients, err := clientService.GetClientsForInbound(inboundId)
+	if err != nil {
+		return nil, err
+	}
+	var client *model.ClientEntity
+	for _, c := range clients {
+		if strings.EqualFold(c.Email, email) {
+			client = c
+			break
+		}
+	}
+	if client == nil {
+		return nil, common.NewCodedErrorf(common.ErrCodeNotFound, "Client %s not found in inbound %d", email, inboundId)
+	}
+
+	stream := map[string]any{}
+	if inbound.StreamSettings != "" {
+		if err := json.Unmarshal([]byte(inbound.StreamSettings), &stream); err != nil {
+			return nil, common.NewErrorf("invalid stream settings of inbound %d: %v", inboundId, err)
+		}
+	}
+
+	server, port, security := s.singboxServer(inbound, stream, defaultServer)
+	if server == "" {
+		return nil, common.NewErrorf("no server address for inbound %d", inboundId)
+	}
+	return singboxOutbound(inbound, client, stream, server, port, security)
+}
+
+// singboxOutbound builds the sing-box outbound of client on inbound, whose clients connect to
+// server and port with the given security, see GetSingboxOutbound.
+func singboxOutbound(inbound *model.Inbound, client *model.ClientEntity, stream map[string]any, server string, port int, security string) (map[string]any, error) {
+	var settings map[string]any
+	if err := json.Unmarshal([]byte(inbound.Settings), &settings); err != nil {
+		return nil, common.NewErrorf("invalid settings of inbound %d: %v", inbound.Id, err)
+	}
+	outbound := map[string]any{
+		"type":        string(inbound.Protocol),
+		"tag":         client.Email,
+		"server":      server,
+		"server_port": port,
+	}
+	network, _ := stream["network"].(string)
+	switch inbound.Protocol {
+	case model.VLESS:
+		outbound["uuid"] = client.UUID
+		if client.Flow != "" && (network == "" || network == "tcp" || network == "raw") && (security == "tls" || security == "reality") {
+			outbound["flow"] = client.Flow
+		}
+		outbound["packet_encoding"] = "xudp"
+	case model.VMESS:
+		outbound["uuid"] = client.UUID
+		outbound["alter_id"] = 0
+		outbound["security"] = "auto"
+		if client.Security != "" {
+			outbound["security"] = client.Security
+		}
+	case model.Trojan:
+		outbound["password"] = client.Password
+	case model.Shadowsocks:
+		method, _ := settings["method"].(string)
+		password := client.Password
+		// Shadowsocks 2022 multi-user inbounds expect the server key followed by the user key
+		if inboundPassword, _ := settings["password"].(string); strings.HasPrefix(method, "2022-") && inboundPassword != "" {
+			password = inboundPassword + ":" + password
+		}
+		outbound["method"] = method
+		outbound["password"] = password
+	default:
+		return nil, common.NewErrorf("protocol %s has no sing-box outbound", inbound.Protocol)
+	}
+
+	switch security {
+	case "tls":
+		outbound["tls"] = singboxTLS(stream)
+	case "reality":
+		tls, err := singboxReality(stream, client)
+		if err != nil {
+			return nil, err
+		}
+		outbound["tls"] = tls
+	}
+	transport, err := singboxTransport(stream)
+	if err != nil {
+		return nil, err
+	}
+	if transport != nil {
+		outbound["transport"] = transport
+	}
+	return outbound, nil
+}
+
+// singboxServer returns the address, port and security a client connects with, following the
+// address priority of subscription links. An external proxy may force or disable TLS.
+func (s *InboundService) singboxServer(inbound *model.Inbound, stream map[string]any, defaultServer string) (string, int, string) {
+	security, _ := stream["security"].(string)
+	if externalProxies, _ := stream["externalProxy"].([]any); len(externalProxies) > 0 {
+		proxy, _ := externalProxies[0].(map[string]any)
+		dest, _ := proxy["dest"].(string)
+		port := inbound.Port
+		if p, ok := proxy["port"].(float64); ok && p > 0 {
+			port = int(p)
+		}
+		if forceTls, _ := proxy["forceTls"].(string); forceTls != "" && forceTls != "same" {
+			security = forceTls
+		}
+		return dest, port, security
+	}
+
+	hostService := HostService{}
+	if host, err := hostService.GetHostForInbound(inbound.Id); err == nil && host != nil && host.Enable {
+		port := inbound.Port
+		if host.Port > 0 {
+			port = host.Port
+		}
+		return host.Address, port, security
+	}
+
+	settingService := SettingService{}
+	if multiMode, _ := settingService.GetMultiNodeMode(); multiMode {
+		nodeService := NodeService{}
+		if nodes, err := nodeService.GetNodesForInbound(inbound.Id); err == nil {
+			for _, node := range nodes {
+				address := strings.TrimPrefix(strings.TrimPrefix(node.Address, "http://"), "https://")
+				if host, _, err := net.SplitHostPort(address); err == nil {
+					address = host
+				}
+				if address != "" {
+					return address, inbound.Port, security
+				}
+			}
+		}
+	}
+
+	switch inbound.Listen {
+	case "", "0.0.0.0", "::", "::0":
+		return defaultServer, inbound.Port, security
+	}
+	return inbound.Listen, inbound.Port, security
+}
+
+// singboxTLS converts the tlsSettings of an inbound to the tls object of a sing-box outbound.
+func singboxTLS(stream map[string]any) map[string]any {
+	tlsSettings, _ := stream["tlsSettings"].(map[string]any)
+	clientSettings, _ := tlsSettings["settings"].(map[string]any)
+	tls := map[string]any{"enabled": true}
+	if serverName, _ := tlsSettings["serverName"].(string); serverName != "" {
+		tls["server_name"] = serverName
+	}
+	if alpn, _ := tlsSettings["alpn"].([]any); len(alpn) > 0 {
+		tls["alpn"] = alpn
+	}
+	if insecure, _ := clientSettings["allowInsecure"].(bool); insecure {
+		tls["insecure"] = true
+	}
+	if fingerprint, _ := clientSettings["fingerprint"].(string); fingerprint != "" {
+		tls["utls"] = map[string]any{"enabled": true, "fingerprint": fingerprint}
+	}
+	return tls
+}
+
+// singboxReality converts the realitySettings of an inbound to the tls object of a sing-box outbound.
+// The public key is derived from the private key when the inbound does not store it.
+func singboxReality(stream map[string]any, client *model.ClientEntity) (map[string]any, error) {
+	realitySettings, _ := stream["realitySettings"].(map[string]any)
+	clientSettings, _ := realitySettings["settings"].(map[string]any)
+
+	publicKey, _ := clientSettings["publicKey"].(string)
+	if publicKey == "" {
+		privateKey, _ := realitySettings["privateKey"].(string)
+		if privateKey == "" {
+			return nil, common.NewError("Reality inbound has no private key")
+		}
+		derived, err := DeriveRealityPublicKey(privateKey)
+		if err != nil {
+			return nil, common.NewErrorf("invalid Reality private key: %v", err)
+		}
+		publicKey = derived
+	}
+	shortId := ""
+	if shortIds, _ := realitySettings["shortIds"].([]any); len(shortIds) > 0 {
+		shortId, _ = shortIds[client.Id%len(shortIds)].(string)
+	}
+	serverName := ""
+	if serverNames, _ := realitySettings["serverNames"].([]any); len(serverNames) > 0 {
+		serverName, _ = serverNames[0].(string)
+	}
+	fingerprint, _ := clientSettings["fingerprint"].(string)
+	if fingerprint == "" {
+		fingerprint = defaultSingboxFingerprint
+	}
+
+	return map[string]any{
+		"enabled":     true,
+		"server_name": serverName,
+		"utls":        map[string]any{"enabled": true, "fingerprint": fingerprint},
+		"reality": map[string]any{
+			"enabled":    true,
+			"public_key": publicKey,
+			"short_id":   shortId,
+		},
+	}, nil
+}
+
+// singboxTransport converts the transport of an inbound to the transport object of a sing-box
+// outbound. Plain TCP (or "raw", as newer Xray calls it) needs none and returns nil; transports sing-box lacks (kcp, xhttp) fail.
+func singboxTransport(stream map[string]any) (map[string]any, error) {
+	network, _ := stream["network"].(string)
+	switch network {
+	case "", "tcp", "raw":
+		tcpSettings, _ := stream["tcpSettings"].(map[string]any)
+		if rawSettings, ok := stream["rawSettings"].(map[string]any); ok {
+			// Xray's newer name for TCP
+			tcpSettings = rawSettings
+		}
+		header, _ := tcpSettings["header"].(map[string]any)
+		if headerType, _ := header["type"].(string); headerType != "http" {
+			return nil, nil
+		}
+		request, _ := header["request"].(map[string]any)
+		transport := map[string]any{"type": "http"}
+		if paths, _ := request["path"].([]any); len(paths) > 0 {
+			transport["path"] = paths[0]
+		}
+		headers, _ := request["headers"].(map[string]any)
+		if host := singboxHostHeader(headers); host != "" {
+			transport["host"] = strings.Split(host, ",")
+		}
+		return transport, nil
+	case "ws", "httpupgrade":
+		netSettings, _ := stream[network+"Settings"].(map[string]any)
+		transport := map[string]any{"type": network}
+		if path, _ := netSettings["path"].(string); path != "" {
+			transport["path"] = path
+		}
+		host, _ := netSettings["host"].(string)
+		if host == "" {
+			headers, _ := netSettings["headers"].(map[string]any)
+			host = singboxHostHeader(headers)
+		}
+		if host != "" {
+			if network == "ws" {
+				transport["headers"] = map[string]any{"Host": host}
+			} else {
+				transport["host"] = host
+			}
+		}
+		return transport, nil
+	case "grpc":
+		grpcSettings, _ := stream["grpcSettings"].(map[string]any)
+		serviceName, _ := grpcSettings["serviceName"].(string)
+		return map[string]any{"type": "grpc", "service_name": serviceName}, nil
+	default:
+		return nil, common.NewErrorf("transport %s is not supported by sing-box", network)
+	}
+}
+
+// singboxHostHeader returns the Host header of a header map of the stream settings, whose values
+// are a string or a list of strings.
+func singboxHostHeader(headers map[string]any) string {
+	for name, value := range headers {
+		if !strings.EqualFold(name, "host") {
+			continue
+		}
+		switch v := value.(type) {
+		case string:
+			return v
+		case []any:
+			hosts := make([]string, 0, len(v))
+			for _, host := range v {
+				if h, ok := host.(string); ok {
+					hosts = append(hosts, h)
+				}
+			}
+			return strings.Join(hosts, ",")
+		}
+	}
+	return ""
+}
@@ -0,0 +1,161 @@
+package service
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/konstpic/sharx-code/v2/database/model"
+)
+
+// assertJSON fails the test unless v marshals to the same JSON value as want.
+func assertJSON(t *testing.T, v any, want string) {
+	t.Helper()
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got, wantValue any
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal([]byte(want), &wantValue); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, wantValue) {
+		t.Fatalf("got %s, want %s", data, want)
+	}
+}
+
+// parseStream decodes the stream settings of a test inbound.
+func parseStream(t *testing.T, streamSettings string) map[string]any {
+	t.Helper()
+	stream := map[string]any{}
+	if err := json.Unmarshal([]byte(streamSettings), &stream); err != nil {
+		t.Fatal(err)
+	}
+	return stream
+}
+
+func TestSingboxOutboundVlessReality(t *testing.T) {
+	inbound := &model.Inbound{
+		Id:       1,
+		Protocol: model.VLESS,
+		Port:     443,
+		Settings: `{"clients":[],"decryption":"none"}`,
+	}
+	// Only the private key is stored, the public key is derived from it
+	stream := parseStream(t, `{
+		"network": "raw",
+		"security": "reality",
+		"realitySettings": {
+			"privateKey": "`+testRealityPrivateKey+`",
+			"serverNames": ["www.example.com", "example.com"],
+			"shortIds": ["a1", "b2", "c3"],
+			"settings": {"fingerprint": "firefox"}
+		}
+	}`)
+	client := &model.ClientEntity{Id: 4, Email: "alice", UUID: "b831381d-6324-4d53-ad4f-8cda48b30811", Flow: "xtls-rprx-vision"}
+
+	outbound, err := singboxOutbound(inbound, client, stream, "vpn.example.com", 443, "reality")
+	if err != nil {
+		t.Fatalf("singboxOutbound() failed: %v", err)
+	}
+	// The shortId is picked by client ID: 4 % 3 = 1
+	assertJSON(t, outbound, `{
+		"type": "vless",
+		"tag": "alice",
+		"server": "vpn.example.com",
+		"server_port": 443,
+		"uuid": "b831381d-6324-4d53-ad4f-8cda48b30811",
+		"flow": "xtls-rprx-vision",
+		"packet_encoding": "xudp",
+		"tls": {
+			"enabled": true,
+			"server_name": "www.example.com",
+			"utls": {"enabled": true, "fingerprint": "firefox"},
+			"reality": {"enabled": true, "public_key": "`+testRealityPublicKey+`", "short_id": "b2"}
+		}
+	}`)
+
+	again, err := singboxOutbound(inbound, client, stream, "vpn.example.com", 443, "reality")
+	if err != nil || !reflect.DeepEqual(again, outbound) {
+		t.Fatalf("second call = %v, %v, want the same outbound", again, err)
+	}
+}
+
+func TestSingboxOutboundRealityDefaults(t *testing.T) {
+	inbound := &model.Inbound{Id: 1, Protocol: model.VLESS, Port: 443, Settings: `{"clients":[]}`}
+	stream := parseStream(t, `{"network":"tcp","security":"reality","realitySettings":{"serverNames":["example.com"],"settings":{"publicKey":"`+testRealityPublicKey+`"}}}`)
+	outbound, err := singboxOutbound(inbound, &model.ClientEntity{Email: "bob", UUID: "id"}, stream, "vpn.example.com", 443, "reality")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tls := outbound["tls"].(map[string]any)
+	reality := tls["reality"].(map[string]any)
+	if reality["public_key"] != testRealityPublicKey || reality["short_id"] != "" {
+		t.Fatalf("reality = %v, want the stored public key and an empty shortId", reality)
+	}
+	if utls := tls["utls"].(map[string]any); utls["fingerprint"] != defaultSingboxFingerprint {
+		t.Fatalf("utls = %v, want the default fingerprint", utls)
+	}
+	if _, ok := outbound["flow"]; ok {
+		t.Fatal("flow set for a client without one")
+	}
+
+	stream = parseStream(t, `{"network":"tcp","security":"reality","realitySettings":{}}`)
+	if _, err := singboxOutbound(inbound, &model.ClientEntity{Email: "bob"}, stream, "vpn.example.com", 443, "reality"); err == nil {
+		t.Fatal("singboxOutbound() accepted a Reality inbound without keys")
+	}
+}
+
+func TestSingboxOutboundTrojanWebsocket(t *testing.T) {
+	inbound := &model.Inbound{Id: 2, Protocol: model.Trojan, Port: 8443, Settings: `{"clients":[]}`}
+	stream := parseStream(t, `{
+		"network": "ws",
+		"security": "tls",
+		"tlsSettings": {"serverName": "cdn.example.com", "alpn": ["h2", "http/1.1"], "settings": {"fingerprint": "chrome"}},
+		"wsSettings": {"path": "/ws", "headers": {"Host": "cdn.example.com"}}
+	}`)
+	client := &model.ClientEntity{Email: "carol", Password: "secret", Flow: "xtls-rprx-vision"}
+
+	outbound, err := singboxOutbound(inbound, client, stream, "cdn.example.com", 8443, "tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertJSON(t, outbound, `{
+		"type": "trojan",
+		"tag": "carol",
+		"server": "cdn.example.com",
+		"server_port": 8443,
+		"password": "secret",
+		"tls": {
+			"enabled": true,
+			"server_name": "cdn.example.com",
+			"alpn": ["h2", "http/1.1"],
+			"utls": {"enabled": true, "fingerprint": "chrome"}
+		},
+		"transport": {"type": "ws", "path": "/ws", "headers": {"Host": "cdn.example.com"}}
+	}`)
+}
+
+func TestSingboxOutboundRejectsUnsupported(t *testing.T) {
+	client := &model.ClientEntity{Email: "dave", UUID: "id"}
+	kcp := &model.Inbound{Id: 3, Protocol: model.VLESS, Settings: `{}`}
+	if _, err := singboxOutbound(kcp, client, parseStream(t, `{"network":"kcp"}`), "vpn.example.com", 443, ""); err == nil {
+		t.Error("singboxOutbound() accepted a kcp inbound")
+	}
+	mixed := &model.Inbound{Id: 4, Protocol: model.Mixed, Settings: `{}`}
+	if _, err := singboxOutbound(mixed, client, map[string]any{}, "vpn.example.com", 1080, ""); err == nil {
+		t.Error("singboxOutbound() accepted a mixed inbound")
+	}
+}
+
+func TestSingboxServerExternalProxy(t *testing.T) {
+	inbound := &model.Inbound{Id: 5, Port: 443}
+	stream := parseStream(t, `{"security":"none","externalProxy":[{"dest":"edge.example.com","port":8443,"forceTls":"tls"},{"dest":"other.example.com"}]}`)
+	server, port, security := (&InboundService{}).singboxServer(inbound, stream, "panel.example.com")
+	if server != "edge.example.com" || port != 8443 || security != "tls" {
+		t.Fatalf("singboxServer() = %s, %d, %s, want the first external proxy with forced TLS", server, port, security)
+	}
+}
@@ -0,0 +1,419 @@
+package service
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+
+	"github.com/konstpic/sharx-code/v2/database"
+	"github.com/konstpic/sharx-code/v2/database/model"
+	"github.com/konstpic/sharx-code/v2/logger"
+	"github.com/konstpic/sharx-code/v2/util/common"
+	"github.com/konstpic/sharx-code/v2/util/random"
+	"github.com/konstpic/sharx-code/v2/web/cache"
+
+	"github.com/google/uuid"
+)
+
+// inboundBundleVersion is the format version written by ExportInbound.
+const inboundBundleVersion = 1
+
+// InboundBundle is an inbound exported as a reusable template: its protocol, settings,
+// stream settings and clients, without the fields bound to the server it came from
+// (ID, port, listen address, tag, traffic counters and TLS certificates).
+type InboundBundle struct {
+	Version        int                   `json:"version"`
+	Remark         string                `json:"remark"`
+	Protocol       model.Protocol        `json:"protocol"`
+	Settings       json.RawMessage       `json:"settings"` // without clients, see Clients
+	StreamSettings json.RawMessage       `json:"streamSettings,omitempty"`
+	Sniffing       json.RawMessage       `json:"sniffing,omitempty"`
+	Total          int64                 `json:"total"`
+	TrafficReset   string                `json:"trafficReset"`
+	Clients        []InboundBundleClient `json:"clients"`
+}
+
+// InboundBundleClient is a client of an exported inbound.
+// UUID, Password and SubID are empty when the bundle was exported without credentials.
+type InboundBundleClient struct {
+	Email       string  `json:"email"`
+	UUID        string  `json:"uuid,omitempty"`
+	Password    string  `json:"password,omitempty"`
+	SubID       string  `json:"subId,omitempty"`
+	Security    string  `json:"security,omitempty"`
+	Flow        string  `json:"flow,omitempty"`
+	TotalGB     float64 `json:"totalGB"`
+	ExpiryTime  int64   `json:"expiryTime"`
+	Enable      bool    `json:"enable"`
+	TgID        int64   `json:"tgId,omitempty"`
+	Comment     string  `json:"comment,omitempty"`
+	Reset       int     `json:"reset,omitempty"`
+	HWIDEnabled bool    `json:"hwidEnabled,omitempty"`
+	MaxHWID     int     `json:"maxHwid,omitempty"`
+}
+
+// InboundImportOverrides are the server-specific values applied when importing an InboundBundle.
+type InboundImportOverrides struct {
+	Port     int    `json:"port"`               // required
+	Listen   string `json:"listen,omitempty"`   // empty = all interfaces
+	Remark   string `json:"remark,omitempty"`   // empty = remark from the bundle
+	CertFile string `json:"certFile,omitempty"` // TLS certificate path, used with KeyFile for TLS inbounds
+	KeyFile  string `json:"keyFile,omitempty"`  // TLS key path
+}
+
+// ExportInbound exports an inbound and its clients as a bundle that ImportInbound can recreate
+// on another server. With stripCredentials, client UUIDs, passwords and subscription IDs are left
+// out and regenerated on import. The Reality key pair is only exported with includePrivateKey;
+// otherwise a new one is generated on import.
+func (s *InboundService) ExportInbound(id int, stripCredentials bool, includePrivateKey bool) (*InboundBundle, error) {
+	inbound, err := s.GetInbound(id)
+	if err != nil {
+		return nil, err
+	}
+	bundle, err := newInboundBundle(inbound, includePrivateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	clientService := ClientService{}
+	clients, err := clientService.GetClientsForInbound(id)
+	if err != nil {
+		return nil, err
+	}
+	for _, client := range clients {
+		bundle.Clients = append(bundle.Clients, newInboundBundleClient(client, stripCredentials))
+	}
+	return bundle, nil
+}
+
+// newInboundBundle exports inbound without its clients, see ExportInbound.
+func newInboundBundle(inbound *model.Inbound, includePrivateKey bool) (*InboundBundle, error) {
+	settings := map[string]any{}
+	if inbound.Settings != "" {
+		if err := json.Unmarshal([]byte(inbound.Settings), &settings); err != nil {
+			return nil, common.NewErrorf("invalid settings of inbound %d: %v", inbound.Id, err)
+		}
+	}
+	// Clients are exported from client_entities, which is the source of the settings' client list
+	delete(settings, "clients")
+	settingsJSON, err := json.Marshal(settings)
+	if err != nil {
+		return nil, err
+	}
+
+	bundle := &InboundBundle{
+		Version:      inboundBundleVersion,
+		Remark:       inbound.Remark,
+		Protocol:     inbound.Protocol,
+		Settings:     settingsJSON,
+		Total:        inbound.Total,
+		TrafficReset: inbound.TrafficReset,
+		Clients:      make([]InboundBundleClient, 0),
+	}
+	if inbound.StreamSettings != "" {
+		stream, err := stripServerStreamSettings(inbound.StreamSettings, includePrivateKey)
+		if err != nil {
+			return nil, common.NewErrorf("invalid stream settings of inbound %d: %v", inbound.Id, err)
+		}
+		bundle.StreamSettings = stream
+	}
+	if inbound.Sniffing != "" && json.Valid([]byte(inbound.Sniffing)) {
+		bundle.Sniffing = json.RawMessage(inbound.Sniffing)
+	}
+	return bundle, nil
+}
+
+// newInboundBundleClient exports a client, without its credentials when stripCredentials is set.
+func newInboundBundleClient(client *model.ClientEntity, stripCredentials bool) InboundBundleClient {
+	item := InboundBundleClient{
+		Email:       client.Email,
+		Security:    client.Security,
+		Flow:        client.Flow,
+		TotalGB:     client.TotalGB,
+		ExpiryTime:  client.ExpiryTime,
+		Enable:      client.Enable,
+		TgID:        client.TgID,
+		Comment:     client.Comment,
+		Reset:       client.Reset,
+		HWIDEnabled: client.HWIDEnabled,
+		MaxHWID:     client.MaxHWID,
+	}
+	if !stripCredentials {
+		item.UUID = client.UUID
+		item.Password = client.Password
+		item.SubID = client.SubID
+	}
+	return item
+}
+
+// stripServerStreamSettings removes the TLS certificates, which point to files or hold keys
+// of the exporting server, and the external proxies from stream settings. Without
+// includePrivateKey the Reality key pair is removed as well.
+func stripServerStreamSettings(streamSettings string, includePrivateKey bool) (json.RawMessage, error) {
+	var stream map[string]any
+	if err := json.Unmarshal([]byte(streamSettings), &stream); err != nil {
+		return nil, err
+	}
+	if tlsSettings, ok := stream["tlsSettings"].(map[string]any); ok {
+		tlsSettings["certificates"] = []any{}
+	}
+	if realitySettings, ok := stream["realitySettings"].(map[string]any); ok && !includePrivateKey {
+		delete(realitySettings, "privateKey")
+		// The public key belongs to the removed private key
+		if settings, ok := realitySettings["settings"].(map[string]any); ok {
+			delete(settings, "publicKey")
+		}
+	}
+	delete(stream, "externalProxy")
+	return json.Marshal(stream)
+}
+
+// ImportInbound recreates an exported inbound for a user with the port, listen address and
+// certificate from overrides. Bundle clients whose email already exists for the user are
+// assigned to the new inbound as they are; the others are created, with fresh credentials
+// when the bundle has none. A Reality inbound exported without its key pair gets a new one.
+// If the clients cannot be imported, the new inbound and the clients created for it are
+// deleted again.
+// Returns the new inbound and whether Xray needs restart.
+func (s *InboundService) ImportInbound(userId int, bundle *InboundBundle, overrides InboundImportOverrides) (*model.Inbound, bool, error) {
+	inbound, err := newImportedInbound(userId, bundle, overrides)
+	if err != nil {
+		return nil, false, err
+	}
+
+	settingService := SettingService{}
+	multiMode, _ := settingService.GetMultiNodeMode()
+	inbound.Tag = s.generateInboundTag(inbound, multiMode)
+
+	inbound, needRestart, err := s.AddInbound(inbound)
+	if err != nil {
+		return nil, false, err
+	}
+	if len(bundle.Clients) == 0 {
+		return inbound, needRestart, nil
+	}
+
+	createdIds, err := s.importBundleClients(userId, inbound, bundle.Clients)
+	if err != nil {
+		return nil, s.discardImportedInbound(userId, inbound.Id, nil) || needRestart, err
+	}
+
+	// Rebuild the settings' client list from the imported clients
+	clientService := ClientService{}
+	clientEntities, err := clientService.GetClientsForInbound(inbound.Id)
+	if err != nil {
+		return nil, s.discardImportedInbound(userId, inbound.Id, createdIds) || needRestart, err
+	}
+	newSettings, err := s.BuildSettingsFromClientEntities(inbound, clientEntities)
+	if err != nil {
+		return nil, s.discardImportedInbound(userId, inbound.Id, createdIds) || needRestart, err
+	}
+	inbound.Settings = newSettings
+	updated, inboundNeedRestart, err := s.updateInboundWithRetry(inbound)
+	if err != nil {
+		return nil, s.discardImportedInbound(userId, inbound.Id, createdIds) || needRestart, err
+	}
+	return updated, needRestart || inboundNeedRestart, nil
+}
+
+// discardImportedInbound deletes an inbound whose import failed, together with the clients
+// created for it, and returns whether Xray needs restart.
+func (s *InboundService) discardImportedInbound(userId int, inboundId int, clientIds []int) bool {
+	needRestart, err := s.DelInbound(inboundId)
+	if err != nil {
+		logger.Warningf("ImportInbound: failed to delete inbound %d after a failed import: %v", inboundId, err)
+	}
+	clientService := ClientService{}
+	for _, clientId := range clientIds {
+		clientNeedRestart, err := clientService.DeleteClient(userId, clientId)
+		if err != nil {
+			logger.Warningf("ImportInbound: failed to delete client %d after a failed import: %v", clientId, err)
+		}
+		needRestart = needRestart || clientNeedRestart
+	}
+	return needRestart
+}
+
+// newImportedInbound builds the inbound recreated from bundle with overrides applied and checks
+// the bundle clients against its transport, see ImportInbound.
+func newImportedInbound(userId int, bundle *InboundBundle, overrides InboundImportOverrides) (*model.Inbound, error) {
+	if bundle == nil || bundle.Protocol == "" {
+		return nil, common.NewError("invalid inbound bundle: protocol is missing")
+	}
+	if bundle.Version > inboundBundleVersion {
+		return nil, common.NewErrorf("unsupported inbound bundle version %d", bundle.Version)
+	}
+	if overrides.Port <= 0 || overrides.Port > 65535 {
+		return nil, common.NewCodedErrorf(common.ErrCodeInvalidPort, "invalid port: %d", overrides.Port)
+	}
+
+	inbound := &model.Inbound{
+		UserId:       userId,
+		Remark:       bundle.Remark,
+		Enable:       true,
+		Total:        bundle.Total,
+		TrafficReset: bundle.TrafficReset,
+		Listen:       overrides.Listen,
+		Port:         overrides.Port,
+		Protocol:     bundle.Protocol,
+		Settings:     string(bundle.Settings),
+		Sniffing:     string(bundle.Sniffing),
+	}
+	if overrides.Remark != "" {
+		inbound.Remark = overrides.Remark
+	}
+	if inbound.TrafficReset == "" {
+		inbound.TrafficReset = "never"
+	}
+	if inbound.Settings == "" {
+		inbound.Settings = "{}"
+	}
+	if len(bundle.StreamSettings) > 0 {
+		stream, err := applyImportStreamSettings(bundle.StreamSettings, overrides)
+		if err != nil {
+			return nil, common.NewErrorf("invalid stream settings in bundle: %v", err)
+		}
+		inbound.StreamSettings = stream
+	}
+
+	// Check the clients against the imported transport before creating anything
+	for _, client := range bundle.Clients {
+		if strings.TrimSpace(client.Email) == "" {
+			return nil, common.NewError("invalid inbound bundle: client without email")
+		}
+		if err := validateClientFlow(inbound, client.Email, client.Flow); err != nil {
+			return nil, err
+		}
+	}
+	return inbound, nil
+}
+
+// applyImportStreamSettings sets the certificate from overrides on TLS stream settings and
+// generates a Reality key pair when the bundle has none.
+func applyImportStreamSettings(streamSettings json.RawMessage, overrides InboundImportOverrides) (string, error) {
+	var stream map[string]any
+	if err := json.Unmarshal(streamSettings, &stream); err != nil {
+		return "", err
+	}
+	if security, _ := stream["security"].(string); security == "tls" && overrides.CertFile != "" && overrides.KeyFile != "" {
+		tlsSettings, ok := stream["tlsSettings"].(map[string]any)
+		if !ok {
+			tlsSettings = map[string]any{}
+			stream["tlsSettings"] = tlsSettings
+		}
+		tlsSettings["certificates"] = []any{
+			map[string]any{
+				"certificateFile": overrides.CertFile,
+				"keyFile":         overrides.KeyFile,
+			},
+		}
+	}
+	if realitySettings, ok := stream["realitySettings"].(map[string]any); ok {
+		if privateKey, _ := realitySettings["privateKey"].(string); privateKey == "" {
+			privateKey, publicKey, err := GenerateRealityKeypair()
+			if err != nil {
+				return "", err
+			}
+			realitySettings["privateKey"] = privateKey
+			settings, ok := realitySettings["settings"].(map[string]any)
+			if !ok {
+				settings = map[string]any{}
+				realitySettings["settings"] = settings
+			}
+			settings["publicKey"] = publicKey
+		}
+	}
+	out, err := json.MarshalIndent(stream, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
+
+// importBundleClients creates the bundle clients missing for the user and assigns all of them to inbound.
+// Returns the IDs of the created clients.
+func (s *InboundService) importBundleClients(userId int, inbound *model.Inbound, clients []InboundBundleClient) ([]int, error) {
+	clientService := ClientService{}
+	db := database.GetDB()
+	createdIds := make([]int, 0)
+	tx := db.Begin()
+	for _, item := range clients {
+		existing, err := clientService.GetClientByEmail(userId, item.Email)
+		if err == nil && existing != nil {
+			if err := clientService.AssignClientToInbounds(tx, existing.Id, []int{inbound.Id}); err != nil {
+				tx.Rollback()
+				return nil, err
+			}
+			continue
+		}
+
+		client := &model.ClientEntity{
+			UserId:      userId,
+			Email:       strings.ToLower(strings.TrimSpace(item.Email)),
+			UUID:        item.UUID,
+			Password:    item.Password,
+			SubID:       item.SubID,
+			Security:    item.Security,
+			Flow:        item.Flow,
+			TotalGB:     item.TotalGB,
+			ExpiryTime:  item.ExpiryTime,
+			Enable:      item.Enable,
+			Status:      "active",
+			TgID:        item.TgID,
+			Comment:     item.Comment,
+			Reset:       item.Reset,
+			HWIDEnabled: item.HWIDEnabled,
+			MaxHWID:     item.MaxHWID,
+		}
+		if client.UUID == "" {
+			newUUID, err := uuid.NewRandom()
+			if err != nil {
+				tx.Rollback()
+				return nil, common.NewError("Failed to generate UUID: ", err.Error())
+			}
+			client.UUID = newUUID.String()
+		}
+		if client.Password == "" {
+			client.Password = importClientPassword(inbound)
+		}
+		if client.SubID == "" {
+			client.SubID = random.Seq(16)
+		}
+		if err := tx.Create(client).Error; err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+		if err := clientService.AssignClientToInbounds(tx, client.Id, []int{inbound.Id}); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+		createdIds = append(createdIds, client.Id)
+	}
+	if err := tx.Commit().Error; err != nil {
+		return nil, err
+	}
+	cache.InvalidateClients(userId)
+	return createdIds, nil
+}
+
+// importClientPassword generates a client password suitable for the inbound's protocol.
+// Shadowsocks 2022 ciphers need a base64 key of the cipher's key size.
+func importClientPassword(inbound *model.Inbound) string {
+	if inbound.Protocol == model.Shadowsocks {
+		var settings struct {
+			Method string `json:"method"`
+		}
+		json.Unmarshal([]byte(inbound.Settings), &settings)
+		if strings.HasPrefix(settings.Method, "2022-") {
+			size := 32
+			if strings.Contains(settings.Method, "aes-128") {
+				size = 16
+			}
+			key := make([]byte, size)
+			rand.Read(key)
+			return base64.StdEncoding.EncodeToString(key)
+		}
+	}
+	return random.Seq(16)
+}
@@ -0,0 +1,162 @@
+package service
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/konstpic/sharx-code/v2/database/model"
+)
+
+// roundTripInbound exports inbound, passes the bundle through JSON and imports it with overrides.
+func roundTripInbound(t *testing.T, inbound *model.Inbound, includePrivateKey bool, overrides InboundImportOverrides) (*InboundBundle, *model.Inbound) {
+	t.Helper()
+	bundle, err := newInboundBundle(inbound, includePrivateKey)
+	if err != nil {
+		t.Fatalf("newInboundBundle() failed: %v", err)
+	}
+	data, err := json.Marshal(bundle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded InboundBundle
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	imported, err := newImportedInbound(2, &decoded, overrides)
+	if err != nil {
+		t.Fatalf("newImportedInbound() failed: %v", err)
+	}
+	return &decoded, imported
+}
+
+func decodeJSONObject(t *testing.T, data string) map[string]any {
+	t.Helper()
+	var object map[string]any
+	if err := json.Unmarshal([]byte(data), &object); err != nil {
+		t.Fatalf("invalid JSON %s: %v", data, err)
+	}
+	return object
+}
+
+func TestInboundTemplateRoundTripTLS(t *testing.T) {
+	inbound := &model.Inbound{
+		Id:       5,
+		Remark:   "edge",
+		Port:     443,
+		Listen:   "192.0.2.10",
+		Protocol: model.Trojan,
+		Settings: `{"clients":[{"email":"a@example.com","password":"x"}],"fallbacks":[{"dest":80}]}`,
+		StreamSettings: `{"network":"ws","security":"tls","wsSettings":{"path":"/edge"},` +
+			`"tlsSettings":{"serverName":"old.example.com","certificates":[{"certificateFile":"/etc/old.crt","keyFile":"/etc/old.key"}]},` +
+			`"externalProxy":[{"dest":"cdn.example.com"}]}`,
+		Sniffing:     `{"enabled":true}`,
+		TrafficReset: "monthly",
+	}
+	overrides := InboundImportOverrides{Port: 8443, CertFile: "/etc/new.crt", KeyFile: "/etc/new.key"}
+
+	bundle, imported := roundTripInbound(t, inbound, false, overrides)
+
+	if bundle.Version != inboundBundleVersion || bundle.Protocol != model.Trojan {
+		t.Fatalf("bundle = %+v", bundle)
+	}
+	if imported.Protocol != model.Trojan || imported.Port != 8443 || imported.Listen != "" || imported.UserId != 2 {
+		t.Fatalf("imported inbound = %+v, want trojan on the override port", imported)
+	}
+	if imported.Remark != "edge" || imported.TrafficReset != "monthly" || imported.Sniffing != `{"enabled":true}` || !imported.Enable {
+		t.Fatalf("imported inbound = %+v, want the exported remark, reset and sniffing", imported)
+	}
+	settings := decodeJSONObject(t, imported.Settings)
+	if _, ok := settings["clients"]; ok || settings["fallbacks"] == nil {
+		t.Fatalf("imported settings = %s, want the settings without the exported clients", imported.Settings)
+	}
+
+	stream := decodeJSONObject(t, imported.StreamSettings)
+	if stream["network"] != "ws" || stream["security"] != "tls" || stream["wsSettings"].(map[string]any)["path"] != "/edge" {
+		t.Fatalf("imported stream = %s, want the transport of the export", imported.StreamSettings)
+	}
+	if _, ok := stream["externalProxy"]; ok {
+		t.Fatal("external proxies of the exporting server were imported")
+	}
+	tlsSettings := stream["tlsSettings"].(map[string]any)
+	want := []any{map[string]any{"certificateFile": "/etc/new.crt", "keyFile": "/etc/new.key"}}
+	if tlsSettings["serverName"] != "old.example.com" || !reflect.DeepEqual(tlsSettings["certificates"], want) {
+		t.Fatalf("imported TLS settings = %v, want the override certificate", tlsSettings)
+	}
+}
+
+func TestInboundTemplateRoundTripReality(t *testing.T) {
+	privateKey, publicKey, err := GenerateRealityKeypair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	inbound := &model.Inbound{
+		Port:     443,
+		Protocol: model.VLESS,
+		Settings: `{"clients":[],"decryption":"none"}`,
+		StreamSettings: `{"network":"tcp","security":"reality","realitySettings":{"dest":"example.com:443",` +
+			`"serverNames":["example.com"],"shortIds":["6ba85179e30d4fc2"],"privateKey":"` + privateKey + `","settings":{"publicKey":"` + publicKey + `"}}}`,
+	}
+
+	// Without the private key, the import gets a new matching pair
+	bundle, imported := roundTripInbound(t, inbound, false, InboundImportOverrides{Port: 8443})
+	reality := decodeJSONObject(t, string(bundle.StreamSettings))["realitySettings"].(map[string]any)
+	if _, ok := reality["privateKey"]; ok {
+		t.Fatal("Reality private key exported without includePrivateKey")
+	}
+	reality = decodeJSONObject(t, imported.StreamSettings)["realitySettings"].(map[string]any)
+	newPrivate := reality["privateKey"].(string)
+	newPublic := reality["settings"].(map[string]any)["publicKey"].(string)
+	if newPrivate == "" || newPrivate == privateKey {
+		t.Fatalf("imported private key = %q, want a new key", newPrivate)
+	}
+	if derived, err := DeriveRealityPublicKey(newPrivate); err != nil || derived != newPublic {
+		t.Fatalf("imported public key %q does not match the private key (derived %q, %v)", newPublic, derived, err)
+	}
+	if !reflect.DeepEqual(reality["serverNames"], []any{"example.com"}) || reality["dest"] != "example.com:443" {
+		t.Fatalf("imported Reality settings = %v, want the exported server names and dest", reality)
+	}
+
+	// With it, the key pair moves along
+	_, imported = roundTripInbound(t, inbound, true, InboundImportOverrides{Port: 8443})
+	reality = decodeJSONObject(t, imported.StreamSettings)["realitySettings"].(map[string]any)
+	if reality["privateKey"] != privateKey || reality["settings"].(map[string]any)["publicKey"] != publicKey {
+		t.Fatalf("imported Reality settings = %v, want the exported key pair", reality)
+	}
+}
+
+func TestNewImportedInboundRejectsInvalidBundles(t *testing.T) {
+	ws := json.RawMessage(`{"network":"ws","security":"tls"}`)
+	tests := []struct {
+		name      string
+		bundle    *InboundBundle
+		overrides InboundImportOverrides
+	}{
+		{"no bundle", nil, InboundImportOverrides{Port: 443}},
+		{"no protocol", &InboundBundle{Version: 1}, InboundImportOverrides{Port: 443}},
+		{"newer version", &InboundBundle{Version: inboundBundleVersion + 1, Protocol: model.VLESS}, InboundImportOverrides{Port: 443}},
+		{"no port", &InboundBundle{Version: 1, Protocol: model.VLESS}, InboundImportOverrides{}},
+		{"port out of range", &InboundBundle{Version: 1, Protocol: model.VLESS}, InboundImportOverrides{Port: 70000}},
+		{"client without email", &InboundBundle{Version: 1, Protocol: model.VLESS, Clients: []InboundBundleClient{{Email: " "}}}, InboundImportOverrides{Port: 443}},
+		{"flow over ws", &InboundBundle{Version: 1, Protocol: model.VLESS, StreamSettings: ws,
+			Clients: []InboundBundleClient{{Email: "a@example.com", Flow: "xtls-rprx-vision"}}}, InboundImportOverrides{Port: 443}},
+	}
+	for _, test := range tests {
+		if _, err := newImportedInbound(1, test.bundle, test.overrides); err == nil {
+			t.Errorf("%s: bundle accepted", test.name)
+		}
+	}
+}
+
+func TestNewInboundBundleClient(t *testing.T) {
+	client := &model.ClientEntity{Email: "a@example.com", UUID: "uuid", Password: "secret", SubID: "sub", Flow: "xtls-rprx-vision", TotalGB: 10, Enable: true}
+
+	full := newInboundBundleClient(client, false)
+	if full.UUID != "uuid" || full.Password != "secret" || full.SubID != "sub" || full.Flow != "xtls-rprx-vision" || full.TotalGB != 10 {
+		t.Fatalf("exported client = %+v", full)
+	}
+	stripped := newInboundBundleClient(client, true)
+	if stripped.UUID != "" || stripped.Password != "" || stripped.SubID != "" || stripped.Email != "a@example.com" || !stripped.Enable {
+		t.Fatalf("client exported without credentials = %+v", stripped)
+	}
+}
@@ -0,0 +1,432 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/konstpic/sharx-code/v2/database/model"
+	"github.com/konstpic/sharx-code/v2/xray"
+
+	"gorm.io/gorm"
+)
+
+func TestListenOverlaps(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		// Colliding: a wildcard takes the port on every address
+		{"", "", true},
+		{"", "192.0.2.10", true},
+		{"0.0.0.0", "192.0.2.10", true},
+		{"::", "192.0.2.10", true},
+		{"::0", "2001:db8::10", true},
+		{"192.0.2.10", "0.0.0.0", true},
+		{"0.0.0.0", "::", true},
+		{"192.0.2.10", "192.0.2.10", true},
+		// Not colliding: different specific addresses
+		{"192.0.2.10", "192.0.2.11", false},
+		{"192.0.2.10", "2001:db8::10", false},
+		{"127.0.0.1", "192.0.2.10", false},
+	}
+	for _, test := range tests {
+		if got := listenOverlaps(test.a, test.b); got != test.want {
+			t.Errorf("listenOverlaps(%q, %q) = %v, want %v", test.a, test.b, got, test.want)
+		}
+	}
+}
+
+func TestIsAnyListen(t *testing.T) {
+	for _, listen := range []string{"", "0.0.0.0", "::", "::0"} {
+		if !isAnyListen(listen) {
+			t.Errorf("isAnyListen(%q) = false, want true", listen)
+		}
+	}
+	for _, listen := range []string{"127.0.0.1", "192.0.2.10", "::1", "2001:db8::10"} {
+		if isAnyListen(listen) {
+			t.Errorf("isAnyListen(%q) = true, want false", listen)
+		}
+	}
+}
+
+func TestCheckListenAddresses(t *testing.T) {
+	tests := []struct {
+		listen string
+		ok     bool
+	}{
+		{"", true},
+		{"192.0.2.10", true},
+		{"192.0.2.10,192.0.2.11,2001:db8::10", true},
+		{"192.0.2.10, 192.0.2.10", false},
+		{"0.0.0.0,192.0.2.10", false},
+		{"192.0.2.10,::", false},
+	}
+	for _, test := range tests {
+		err := checkListenAddresses(&model.Inbound{Listen: test.listen, Port: 443})
+		if (err == nil) != test.ok {
+			t.Errorf("checkListenAddresses(%q) error = %v, want ok = %v", test.listen, err, test.ok)
+		}
+	}
+}
+
+func TestApplyDefaultSniffing(t *testing.T) {
+	const defaultSniffing = `{"enabled":true,"destOverride":["http","tls"]}`
+
+	inbound := &model.Inbound{Tag: "inbound-443", Port: 443, Protocol: model.VLESS}
+	applyDefaultSniffing(inbound, defaultSniffing)
+	if inbound.Sniffing != defaultSniffing {
+		t.Fatalf("sniffing = %q, want the default %q", inbound.Sniffing, defaultSniffing)
+	}
+	if got := string(inbound.GenXrayInboundConfig().Sniffing); got != defaultSniffing {
+		t.Fatalf("generated sniffing = %q, want %q", got, defaultSniffing)
+	}
+
+	own := &model.Inbound{Sniffing: `{"enabled":false}`}
+	applyDefaultSniffing(own, defaultSniffing)
+	if own.Sniffing != `{"enabled":false}` {
+		t.Fatalf("sniffing of the inbound replaced by the default: %q", own.Sniffing)
+	}
+
+	none := &model.Inbound{}
+	applyDefaultSniffing(none, "")
+	if none.Sniffing != "" {
+		t.Fatalf("sniffing = %q without a default", none.Sniffing)
+	}
+}
+
+func TestClientAggregatesQuery(t *testing.T) {
+	sql := dryRunDB(t).ToSQL(func(tx *gorm.DB) *gorm.DB {
+		var rows []clientAggregateRow
+		return clientAggregatesQuery(tx, []int{1, 2}).Find(&rows)
+	})
+	for _, want := range []string{
+		// Expired and disabled clients are not counted as active, but their traffic is summed
+		"COUNT(*) FILTER (WHERE client_entities.enable AND client_entities.status = 'active') AS active_client_count",
+		"COALESCE(SUM(client_entities.up), 0) AS total_up",
+		"COALESCE(SUM(client_entities.down), 0) AS total_down",
+		"JOIN client_entities ON client_entities.id = client_inbound_mappings.client_id",
+		"WHERE client_inbound_mappings.inbound_id IN (1,2)",
+		`GROUP BY "client_inbound_mappings"."inbound_id"`,
+	} {
+		if !strings.Contains(sql, want) {
+			t.Errorf("SQL %q does not contain %q", sql, want)
+		}
+	}
+}
+
+func TestApplyClientAggregates(t *testing.T) {
+	inbounds := []*model.Inbound{{Id: 1}, {Id: 2}, {Id: 3}}
+	// Inbound 1 has two active and one expired client, inbound 3 has no clients
+	rows := []clientAggregateRow{
+		{InboundId: 2, ActiveClientCount: 0, TotalUp: 50, TotalDown: 60},
+		{InboundId: 1, ActiveClientCount: 2, TotalUp: 300, TotalDown: 3000},
+	}
+	applyClientAggregates(inbounds, rows)
+
+	want := []model.Inbound{
+		{Id: 1, ActiveClientCount: 2, TotalUp: 300, TotalDown: 3000},
+		{Id: 2, ActiveClientCount: 0, TotalUp: 50, TotalDown: 60},
+		{Id: 3},
+	}
+	for i, inbound := range inbounds {
+		if inbound.ActiveClientCount != want[i].ActiveClientCount || inbound.TotalUp != want[i].TotalUp || inbound.TotalDown != want[i].TotalDown {
+			t.Errorf("inbound %d aggregates = %d/%d/%d, want %d/%d/%d", inbound.Id,
+				inbound.ActiveClientCount, inbound.TotalUp, inbound.TotalDown,
+				want[i].ActiveClientCount, want[i].TotalUp, want[i].TotalDown)
+		}
+	}
+}
+
+// seedInbounds stores count inbounds with clientsEach client stats; every second inbound is disabled.
+func seedInbounds(tb testing.TB, db *gorm.DB, count, clientsEach int) {
+	tb.Helper()
+	inbounds := make([]*model.Inbound, count)
+	stats := make([]*xray.ClientTraffic, 0, count*clientsEach)
+	for i := range inbounds {
+		id := i + 1
+		inbounds[i] = &model.Inbound{
+			Id:       id,
+			Enable:   id%2 == 1,
+			Port:     10000 + id,
+			Protocol: model.VLESS,
+			Tag:      fmt.Sprintf("inbound-%d", 10000+id),
+			Settings: `{"clients":[],"decryption":"none"}`,
+		}
+		for c := 0; c < clientsEach; c++ {
+			stats = append(stats, &xray.ClientTraffic{
+				InboundId: id,
+				Email:     fmt.Sprintf("client-%d-%d", id, c),
+				Enable:    true,
+			})
+		}
+	}
+	// SQLite prepares large multi-row inserts slowly, so batches are kept small
+	if err := db.CreateInBatches(inbounds, 10).Error; err != nil {
+		tb.Fatal(err)
+	}
+	if err := db.CreateInBatches(stats, 10).Error; err != nil {
+		tb.Fatal(err)
+	}
+}
+
+// inboundIds returns the IDs of inbounds in order.
+func inboundIds(inbounds []*model.Inbound) []int {
+	ids := make([]int, len(inbounds))
+	for i, inbound := range inbounds {
+		ids[i] = inbound.Id
+	}
+	return ids
+}
+
+func TestEnabledInboundsQuery(t *testing.T) {
+	db := memoryDB(t, &model.Inbound{}, &xray.ClientTraffic{})
+	seedInbounds(t, db, 6, 2)
+
+	var inbounds []*model.Inbound
+	if err := enabledInboundsQuery(db).Find(&inbounds).Error; err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(inboundIds(inbounds)); got != "[1 3 5]" {
+		t.Fatalf("enabled inbounds = %s, want [1 3 5]", got)
+	}
+	for _, inbound := range inbounds {
+		if !inbound.Enable {
+			t.Errorf("inbound %d is disabled", inbound.Id)
+		}
+		if len(inbound.ClientStats) != 2 {
+			t.Errorf("inbound %d has %d client stats, want 2", inbound.Id, len(inbound.ClientStats))
+		}
+	}
+
+	sql := dryRunDB(t).ToSQL(func(tx *gorm.DB) *gorm.DB {
+		return enabledInboundsQuery(tx).Find(&[]*model.Inbound{})
+	})
+	if !strings.Contains(sql, "WHERE enable = true") {
+		t.Errorf("SQL %q does not filter on enable", sql)
+	}
+}
+
+func TestInboundsPageQuery(t *testing.T) {
+	db := memoryDB(t, &model.Inbound{}, &xray.ClientTraffic{})
+	seedInbounds(t, db, 10, 1)
+
+	tests := []struct {
+		offset, limit int
+		want          string
+	}{
+		{0, 3, "[1 2 3]"},
+		{3, 3, "[4 5 6]"},
+		// The last page is short, and a page past the end is empty
+		{8, 3, "[9 10]"},
+		{9, 1, "[10]"},
+		{10, 3, "[]"},
+		{25, 3, "[]"},
+		{0, 100, "[1 2 3 4 5 6 7 8 9 10]"},
+	}
+	for _, test := range tests {
+		var inbounds []*model.Inbound
+		if err := inboundsPageQuery(db, test.offset, test.limit).Find(&inbounds).Error; err != nil {
+			t.Fatal(err)
+		}
+		if got := fmt.Sprint(inboundIds(inbounds)); got != test.want {
+			t.Errorf("page offset %d limit %d = %s, want %s", test.offset, test.limit, got, test.want)
+		}
+		for _, inbound := range inbounds {
+			if len(inbound.ClientStats) != 1 {
+				t.Errorf("inbound %d has %d client stats, want 1", inbound.Id, len(inbound.ClientStats))
+			}
+		}
+	}
+}
+
+func TestGetInboundsPagedRejectsInvalidPage(t *testing.T) {
+	s := &InboundService{}
+	for _, page := range [][2]int{{-1, 10}, {0, 0}, {0, -5}} {
+		if _, err := s.GetInboundsPaged(page[0], page[1]); err == nil {
+			t.Errorf("GetInboundsPaged(%d, %d) returned no error", page[0], page[1])
+		}
+	}
+}
+
+// BenchmarkEnabledInbounds compares loading every inbound and skipping the disabled ones in Go,
+// as config builds did before, with filtering on enable in SQL.
+func BenchmarkEnabledInbounds(b *testing.B) {
+	db := memoryDB(b, &model.Inbound{}, &xray.ClientTraffic{})
+	seedInbounds(b, db, 2000, 5)
+
+	b.Run("all filtered in Go", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			var inbounds []*model.Inbound
+			if err := db.Model(model.Inbound{}).Preload("ClientStats").Find(&inbounds).Error; err != nil {
+				b.Fatal(err)
+			}
+			enabled := 0
+			for _, inbound := range inbounds {
+				if inbound.Enable {
+					enabled++
+				}
+			}
+			if enabled != 1000 {
+				b.Fatalf("%d enabled inbounds, want 1000", enabled)
+			}
+		}
+	})
+	b.Run("filtered in SQL", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			var inbounds []*model.Inbound
+			if err := enabledInboundsQuery(db).Find(&inbounds).Error; err != nil {
+				b.Fatal(err)
+			}
+			if len(inbounds) != 1000 {
+				b.Fatalf("%d enabled inbounds, want 1000", len(inbounds))
+			}
+		}
+	})
+}
+
+// generatedInboundTags returns the tags of the inbounds that config builds include from db.
+func generatedInboundTags(t *testing.T, db *gorm.DB) []string {
+	t.Helper()
+	var inbounds []*model.Inbound
+	if err := enabledInboundsQuery(db).Find(&inbounds).Error; err != nil {
+		t.Fatal(err)
+	}
+	config := &xray.Config{}
+	if err := appendInboundConfigs(config, inbounds); err != nil {
+		t.Fatal(err)
+	}
+	tags := make([]string, 0, len(config.InboundConfigs))
+	for _, inboundConfig := range config.InboundConfigs {
+		tags = append(tags, inboundConfig.Tag)
+	}
+	return tags
+}
+
+func TestInboundEnable(t *testing.T) {
+	db := memoryDB(t, &model.Inbound{}, &xray.ClientTraffic{}, &model.ClientEntity{}, &model.ClientInboundMapping{})
+	for id := 1; id <= 2; id++ {
+		email := fmt.Sprintf("client-%d", id)
+		for _, row := range []any{
+			&model.Inbound{
+				Id:       id,
+				Enable:   true,
+				Port:     10000 + id,
+				Protocol: model.VLESS,
+				Tag:      fmt.Sprintf("inbound-%d", 10000+id),
+				Settings: fmt.Sprintf(`{"clients":[{"id":"b831381d-6324-4d53-ad4f-8cda48b3081%d","email":%q}],"decryption":"none"}`, id, email),
+			},
+			&xray.ClientTraffic{InboundId: id, Email: email, Enable: true},
+			&model.ClientEntity{Id: id, Email: email, Enable: true},
+			&model.ClientInboundMapping{ClientId: id, InboundId: id},
+		} {
+			if err := db.Create(row).Error; err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	if err := updateInboundEnable(db, []int{2}, false); err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(generatedInboundTags(t, db)); got != "[inbound-10001]" {
+		t.Fatalf("generated inbounds = %s, want only the enabled inbound-10001", got)
+	}
+	var disabled model.Inbound
+	if err := db.First(&disabled, 2).Error; err != nil {
+		t.Fatal(err)
+	}
+	if disabled.Enable || !strings.Contains(disabled.Settings, "client-2") {
+		t.Fatalf("disabled inbound = enable %v settings %s, want disabled with its clients", disabled.Enable, disabled.Settings)
+	}
+	for table, rows := range map[string]any{
+		"clients":         &model.ClientEntity{},
+		"client mappings": &model.ClientInboundMapping{},
+		"client stats":    &xray.ClientTraffic{},
+	} {
+		var count int64
+		if err := db.Model(rows).Count(&count).Error; err != nil {
+			t.Fatal(err)
+		}
+		if count != 2 {
+			t.Errorf("%d %s after disabling, want both kept", count, table)
+		}
+	}
+	// Without a running Xray the change is applied by the next restart
+	if !(&InboundService{}).applyInboundEnable(&disabled, false) {
+		t.Error("applyInboundEnable did not ask for a restart without a running Xray")
+	}
+
+	if err := updateInboundEnable(db, []int{2}, true); err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(generatedInboundTags(t, db)); got != "[inbound-10001 inbound-10002]" {
+		t.Fatalf("generated inbounds = %s, want both after re-enabling", got)
+	}
+}
+
+func TestBulkSetEnableRestartsOnce(t *testing.T) {
+	db := memoryDB(t, &model.Inbound{})
+	for id := 1; id <= 5; id++ {
+		// Inbound 4 is already disabled, inbound 5 belongs to another user
+		inbound := &model.Inbound{Id: id, UserId: 1, Enable: id != 4, Port: 10000 + id, Tag: fmt.Sprintf("inbound-%d", 10000+id)}
+		if id == 5 {
+			inbound.UserId = 2
+		}
+		if err := db.Create(inbound).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	var updates int
+	if err := db.Callback().Update().After("gorm:update").Register("test:count_updates", func(*gorm.DB) { updates++ }); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := setUserInboundsEnable(db, 1, []int{1, 5}, false); err == nil {
+		t.Fatal("disabled an inbound of another user")
+	}
+	if updates != 0 {
+		t.Fatalf("%d updates for a rejected batch, want none", updates)
+	}
+
+	changed, err := setUserInboundsEnable(db, 1, []int{1, 2, 3, 4}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(inboundIds(changed)); got != "[1 2 3]" {
+		t.Fatalf("changed inbounds = %s, want [1 2 3]", got)
+	}
+	if updates != 1 {
+		t.Fatalf("%d updates for the batch, want 1", updates)
+	}
+	var enabled int64
+	if err := db.Model(&model.Inbound{}).Where("enable = ?", true).Count(&enabled).Error; err != nil {
+		t.Fatal(err)
+	}
+	if enabled != 1 {
+		t.Fatalf("%d enabled inbounds, want only the inbound of the other user", enabled)
+	}
+
+	// The batch asks for one restart, which the restart check then runs once
+	restarts := countXrayRestarts(t)
+	x := &XrayService{}
+	if (&InboundService{}).applyInboundsEnable(changed, true) {
+		x.SetToNeedRestart()
+	}
+	for x.IsNeedRestartAndSetFalse() {
+		if err := x.RestartXray(false); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := restarts.Load(); n != 1 {
+		t.Fatalf("%d restarts for the batch, want 1", n)
+	}
+
+	// Nothing left to change, nothing to restart
+	changed, err = setUserInboundsEnable(db, 1, []int{1, 2, 3, 4}, false)
+	if err != nil || len(changed) != 0 || updates != 1 {
+		t.Fatalf("repeated batch changed %v with %d updates, err %v, want no change", inboundIds(changed), updates, err)
+	}
+}
@@ -0,0 +1,130 @@
+package service
+
+import (
+	"sync"
+	"time"
+)
+
+// loginAttempts tracks consecutive failed logins for one source IP/username pair.
+type loginAttempts struct {
+	failures    int
+	lastFailure time.Time
+	lockedUntil time.Time
+}
+
+// maxTrackedLogins bounds the number of tracked IP/username pairs before stale ones are pruned.
+const maxTrackedLogins = 10000
+
+// loginLimiter keeps failed login counters in memory.
+// Counters are lost on restart, which only shortens an active lockout.
+type loginLimiter struct {
+	mu       sync.Mutex
+	attempts map[string]*loginAttempts
+}
+
+var defaultLoginLimiter = &loginLimiter{attempts: make(map[string]*loginAttempts)}
+
+func loginLimiterKey(ip string, username string) string {
+	return ip + "|" + username
+}
+
+// lockedFor returns the remaining lockout time for key at now, or 0 if it is not locked.
+func (l *loginLimiter) lockedFor(key string, now time.Time) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	a, ok := l.attempts[key]
+	if !ok || a.lockedUntil.IsZero() {
+		return 0
+	}
+	if !now.Before(a.lockedUntil) {
+		// Cooldown expired: start counting from scratch
+		delete(l.attempts, key)
+		return 0
+	}
+	return a.lockedUntil.Sub(now)
+}
+
+// fail records a failed login for key and reports whether this failure triggered a lockout.
+func (l *loginLimiter) fail(key string, now time.Time, maxAttempts int, lockout time.Duration) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	a, ok := l.attempts[key]
+	if ok && a.lockedUntil.IsZero() && now.Sub(a.lastFailure) > lockout {
+		// Failures older than the lockout window are not consecutive attempts anymore
+		a.failures = 0
+	}
+	if !ok {
+		if len(l.attempts) >= maxTrackedLogins {
+			l.prune(now, lockout)
+		}
+		a = &loginAttempts{}
+		l.attempts[key] = a
+	}
+	a.failures++
+	a.lastFailure = now
+	if a.failures >= maxAttempts && a.lockedUntil.IsZero() {
+		a.lockedUntil = now.Add(lockout)
+		return true
+	}
+	return false
+}
+
+// prune drops entries whose lockout has expired or whose last failure is older than lockout.
+// The caller must hold l.mu.
+func (l *loginLimiter) prune(now time.Time, lockout time.Duration) {
+	for key, a := range l.attempts {
+		if a.lockedUntil.IsZero() {
+			if now.Sub(a.lastFailure) > lockout {
+				delete(l.attempts, key)
+			}
+		} else if !now.Before(a.lockedUntil) {
+			delete(l.attempts, key)
+		}
+	}
+}
+
+func (l *loginLimiter) reset(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.attempts, key)
+}
+
+// loginLimits returns the configured lockout threshold and duration.
+// A threshold of 0 disables the limiter.
+func (s *UserService) loginLimits() (int, time.Duration) {
+	maxAttempts, err := s.settingService.GetLoginMaxAttempts()
+	if err != nil || maxAttempts <= 0 {
+		return 0, 0
+	}
+	minutes, err := s.settingService.GetLoginLockoutMinutes()
+	if err != nil || minutes <= 0 {
+		return 0, 0
+	}
+	return maxAttempts, time.Duration(minutes) * time.Minute
+}
+
+// LoginLockedFor returns how long logins from ip for username remain locked out, or 0 if they are allowed.
+func (s *UserService) LoginLockedFor(ip string, username string) time.Duration {
+	if maxAttempts, _ := s.loginLimits(); maxAttempts == 0 {
+		return 0
+	}
+	return defaultLoginLimiter.lockedFor(loginLimiterKey(ip, username), time.Now())
+}
+
+// RecordLoginFailure counts a failed login from ip for username.
+// It reports whether the failure locked further attempts out, together with the threshold and lockout duration.
+func (s *UserService) RecordLoginFailure(ip string, username string) (bool, int, time.Duration) {
+	maxAttempts, lockout := s.loginLimits()
+	if maxAttempts == 0 {
+		return false, 0, 0
+	}
+	locked := defaultLoginLimiter.fail(loginLimiterKey(ip, username), time.Now(), maxAttempts, lockout)
+	return locked, maxAttempts, lockout
+}
+
+// ResetLoginFailures clears the failed login counter after a successful login.
+func (s *UserService) ResetLoginFailures(ip string, username string) {
+	defaultLoginLimiter.reset(loginLimiterKey(ip, username))
+}
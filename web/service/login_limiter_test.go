@@ -0,0 +1,99 @@
+package service
+
+import (
+	"testing"
+	"time"
+)
+
+func newTestLoginLimiter() *loginLimiter {
+	return &loginLimiter{attempts: make(map[string]*loginAttempts)}
+}
+
+func TestLoginLimiterThreshold(t *testing.T) {
+	limiter := newTestLoginLimiter()
+	key := loginLimiterKey("192.0.2.1", "admin")
+	now := time.Date(2026, time.January, 1, 12, 0, 0, 0, time.UTC)
+
+	for i := 1; i < 5; i++ {
+		if limiter.fail(key, now, 5, 15*time.Minute) {
+			t.Fatalf("failure %d of 5 triggered a lockout", i)
+		}
+		if locked := limiter.lockedFor(key, now); locked != 0 {
+			t.Fatalf("locked for %v after %d failures", locked, i)
+		}
+	}
+	if !limiter.fail(key, now, 5, 15*time.Minute) {
+		t.Fatal("fifth failure did not trigger a lockout")
+	}
+	if locked := limiter.lockedFor(key, now.Add(time.Minute)); locked != 14*time.Minute {
+		t.Fatalf("locked for %v a minute into the lockout, want 14m", locked)
+	}
+	// Failures during the lockout neither extend it nor report a new lockout
+	if limiter.fail(key, now.Add(2*time.Minute), 5, 15*time.Minute) {
+		t.Fatal("failure during the lockout reported a new lockout")
+	}
+
+	// Another IP or username is counted separately
+	if locked := limiter.lockedFor(loginLimiterKey("192.0.2.2", "admin"), now); locked != 0 {
+		t.Fatalf("other IP locked for %v", locked)
+	}
+	if locked := limiter.lockedFor(loginLimiterKey("192.0.2.1", "other"), now); locked != 0 {
+		t.Fatalf("other username locked for %v", locked)
+	}
+}
+
+func TestLoginLimiterCooldownExpiry(t *testing.T) {
+	limiter := newTestLoginLimiter()
+	key := loginLimiterKey("192.0.2.1", "admin")
+	now := time.Date(2026, time.January, 1, 12, 0, 0, 0, time.UTC)
+
+	for i := 0; i < 3; i++ {
+		limiter.fail(key, now, 3, 10*time.Minute)
+	}
+	if locked := limiter.lockedFor(key, now.Add(10*time.Minute-time.Second)); locked != time.Second {
+		t.Fatalf("locked for %v just before the cooldown ends, want 1s", locked)
+	}
+	if locked := limiter.lockedFor(key, now.Add(10*time.Minute)); locked != 0 {
+		t.Fatalf("still locked for %v after the cooldown", locked)
+	}
+	// The counter starts from scratch after the cooldown
+	later := now.Add(11 * time.Minute)
+	if limiter.fail(key, later, 3, 10*time.Minute) || limiter.fail(key, later, 3, 10*time.Minute) {
+		t.Fatal("lockout triggered before reaching the threshold again")
+	}
+	if !limiter.fail(key, later, 3, 10*time.Minute) {
+		t.Fatal("threshold reached again without a lockout")
+	}
+}
+
+func TestLoginLimiterForgetsOldFailures(t *testing.T) {
+	limiter := newTestLoginLimiter()
+	key := loginLimiterKey("192.0.2.1", "admin")
+	now := time.Date(2026, time.January, 1, 12, 0, 0, 0, time.UTC)
+
+	limiter.fail(key, now, 3, 10*time.Minute)
+	limiter.fail(key, now, 3, 10*time.Minute)
+	// Failures older than the lockout window are not consecutive anymore
+	if limiter.fail(key, now.Add(11*time.Minute), 3, 10*time.Minute) {
+		t.Fatal("old failures counted towards the threshold")
+	}
+
+	limiter.reset(key)
+	if _, ok := limiter.attempts[key]; ok {
+		t.Fatal("reset kept the failure counter")
+	}
+}
+
+func TestLoginLimiterPrune(t *testing.T) {
+	limiter := newTestLoginLimiter()
+	now := time.Date(2026, time.January, 1, 12, 0, 0, 0, time.UTC)
+	limiter.attempts["stale"] = &loginAttempts{failures: 1, lastFailure: now.Add(-time.Hour)}
+	limiter.attempts["expired"] = &loginAttempts{failures: 5, lastFailure: now.Add(-time.Hour), lockedUntil: now.Add(-time.Minute)}
+	limiter.attempts["recent"] = &loginAttempts{failures: 1, lastFailure: now.Add(-time.Minute)}
+	limiter.attempts["locked"] = &loginAttempts{failures: 5, lastFailure: now, lockedUntil: now.Add(time.Minute)}
+
+	limiter.prune(now, 10*time.Minute)
+	if len(limiter.attempts) != 2 || limiter.attempts["recent"] == nil || limiter.attempts["locked"] == nil {
+		t.Fatalf("prune kept %v, want recent and locked", limiter.attempts)
+	}
+}
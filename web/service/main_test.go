@@ -0,0 +1,106 @@
+package service
+
+import (
+	"database/sql"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/konstpic/sharx-code/v2/database/model"
+	"github.com/konstpic/sharx-code/v2/logger"
+	"github.com/konstpic/sharx-code/v2/web/cache"
+
+	"github.com/op/go-logging"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+	"gorm.io/gorm/schema"
+)
+
+func TestMain(m *testing.M) {
+	// Services log through the package logger, which only exists after InitLogger
+	logFolder, err := os.MkdirTemp("", "sharx-service-test")
+	if err != nil {
+		panic(err)
+	}
+	os.Setenv("XUI_LOG_FOLDER", logFolder)
+	logger.InitLogger(logging.ERROR)
+
+	code := m.Run()
+	os.RemoveAll(logFolder)
+	os.Exit(code)
+}
+
+// dryRunDB returns a PostgreSQL session that renders statements without connecting to a server.
+func dryRunDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(postgres.New(postgres.Config{DSN: "host=127.0.0.1 dbname=test"}), &gorm.Config{DryRun: true, DisableAutomaticPing: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// memoryDB returns a session on an in-memory SQLite database with a table for each of models.
+// Statements are still built by the PostgreSQL dialector, so the tests run the queries the panel
+// sends, on an engine that accepts their syntax. Columns are untyped and carry no constraints.
+func memoryDB(tb testing.TB, models ...any) *gorm.DB {
+	tb.Helper()
+	sqlDB, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	// Every connection opens its own in-memory database
+	sqlDB.SetMaxOpenConns(1)
+	tb.Cleanup(func() { sqlDB.Close() })
+
+	db, err := gorm.Open(postgres.New(postgres.Config{Conn: sqlDB}), &gorm.Config{Logger: gormlogger.Discard})
+	if err != nil {
+		tb.Fatal(err)
+	}
+	schemas := &sync.Map{}
+	for _, m := range models {
+		s, err := schema.Parse(m, schemas, db.NamingStrategy)
+		if err != nil {
+			tb.Fatal(err)
+		}
+		columns := make([]string, 0, len(s.DBNames))
+		for _, name := range s.DBNames {
+			if s.FieldsByDBName[name].PrimaryKey {
+				name += " INTEGER PRIMARY KEY"
+			}
+			columns = append(columns, name)
+		}
+		if err := db.Exec("CREATE TABLE " + s.Table + " (" + strings.Join(columns, ", ") + ")").Error; err != nil {
+			tb.Fatal(err)
+		}
+	}
+	return db
+}
+
+var initTestCache sync.Once
+
+// useTestCache starts the embedded Redis cache once for all tests of the package.
+func useTestCache() {
+	initTestCache.Do(func() {
+		if err := cache.InitRedis(""); err != nil {
+			panic(err)
+		}
+	})
+}
+
+// useSettings stores settings in the embedded Redis cache that SettingService reads before the
+// database, for the duration of the test.
+func useSettings(t *testing.T, settings map[string]string) {
+	t.Helper()
+	useTestCache()
+	for key, value := range settings {
+		cacheKey := cache.KeySettingPrefix + key
+		if err := cache.SetJSON(cacheKey, &model.Setting{Key: key, Value: value}, time.Hour); err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { cache.Delete(cacheKey) })
+	}
+}
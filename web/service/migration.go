@@ -409,6 +409,7 @@ var ignoredPanelSettings = map[string]bool{
 	"webListen":                    true,
 	"webDomain":                    true,
 	"sessionMaxAge":                true,
+	"sessionEpoch":                 true,
 	"pageSize":                     true,
 	"expireDiff":                   true,
 	"trafficDiff":                  true,
@@ -3,8 +3,10 @@ package service
 
 import (
 	"bytes"
+	"crypto/sha256"
 	"crypto/tls"
 	"crypto/x509"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -19,6 +21,7 @@ import (
 	"github.com/konstpic/sharx-code/v2/logger"
 	"github.com/konstpic/sharx-code/v2/util/common"
 	"github.com/konstpic/sharx-code/v2/util/random"
+	"github.com/konstpic/sharx-code/v2/web/entity"
 	"github.com/konstpic/sharx-code/v2/xray"
 
 	"gorm.io/gorm"
@@ -129,6 +132,76 @@ func (s *NodeService) RegisterNode(node *model.Node, panelURL string) (string, e
 	return apiKey, nil
 }
 
+// RotateApiKey replaces the API key of a node with a newly generated one. The new key is first
+// sent to the node, authenticated with the current key, and only stored for the node once the node
+// accepted it. If the node is unreachable or rejects the key, the old key stays in use on both sides.
+// Returns the new key.
+func (s *NodeService) RotateApiKey(nodeId int) (string, error) {
+	node, err := s.GetNode(nodeId)
+	if err != nil {
+		return "", err
+	}
+	newKey := random.Seq(32)
+	err = s.rotateNodeApiKey(node, newKey, func() error {
+		db := database.GetDB()
+		return db.Model(&model.Node{}).Where("id = ?", node.Id).Update("api_key", newKey).Error
+	})
+	if err != nil {
+		return "", err
+	}
+	return newKey, nil
+}
+
+// rotateNodeApiKey switches node from its API key to newKey and then runs save to store newKey
+// for it. If save fails, the node is switched back to its old key.
+func (s *NodeService) rotateNodeApiKey(node *model.Node, newKey string, save func() error) error {
+	oldKey := node.ApiKey
+	if err := s.pushApiKey(node, oldKey, newKey); err != nil {
+		return err
+	}
+	if err := save(); err != nil {
+		// The node already uses the new key, switch it back so that both sides match again
+		if rollbackErr := s.pushApiKey(node, newKey, oldKey); rollbackErr != nil {
+			logger.Errorf("[Node: %s] Failed to restore API key after database error, node needs re-registration: %v", node.Name, rollbackErr)
+		}
+		return err
+	}
+	logger.Infof("[Node: %s] API key rotated", node.Name)
+	return nil
+}
+
+// pushApiKey asks a node to replace its API key currentKey with newKey.
+func (s *NodeService) pushApiKey(node *model.Node, currentKey, newKey string) error {
+	client, err := s.createHTTPClient(node, 10*time.Second)
+	if err != nil {
+		return fmt.Errorf("failed to create HTTP client: %w", err)
+	}
+	jsonData, err := json.Marshal(map[string]string{"apiKey": newKey})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", fmt.Sprintf("%s/api/v1/rotate-api-key", node.Address), bytes.NewBuffer(jsonData))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", currentKey))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send API key to node: %w (check if node is accessible at %s)", err, node.Address)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusUnauthorized {
+		return &ErrNodeNeedsReregistration{NodeName: node.Name}
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("node rejected API key rotation with status %d: %s", resp.StatusCode, string(body))
+	}
+	return nil
+}
+
 // UpdateNode updates an existing node.
 // Only updates fields that are provided (non-empty for strings, non-zero for integers).
 func (s *NodeService) UpdateNode(node *model.Node) error {
@@ -168,6 +241,9 @@ func (s *NodeService) UpdateNode(node *model.Node) error {
 	if node.KeyPath != "" {
 		updates["key_path"] = node.KeyPath
 	}
+	if node.CaPath != "" {
+		updates["ca_path"] = node.CaPath
+	}
 	updates["insecure_tls"] = node.InsecureTLS
 	
 	// Update traffic limit if provided (can be 0 for unlimited)
@@ -211,6 +287,26 @@ func (s *NodeService) DeleteNode(id int) error {
 		return err
 	}
 	
+	// Delete client restrictions to this node
+	err = db.Where("node_id = ?", id).Delete(&model.ClientNodeMapping{}).Error
+	if err != nil {
+		return err
+	}
+	
+	// Delete traffic samples for this node
+	err = db.Where("node_id = ?", id).Delete(&model.NodeTrafficSample{}).Error
+	if err != nil {
+		return err
+	}
+	
+	// Delete config push history for this node
+	err = db.Where("node_id = ?", id).Delete(&model.NodeConfigHistory{}).Error
+	if err != nil {
+		return err
+	}
+	
+	forgetNodePushResult(id)
+
 	// Delete the node itself
 	return db.Delete(&model.Node{}, id).Error
 }
@@ -294,45 +390,46 @@ func (s *NodeService) notifyNodeStatusChange(node *model.Node, oldStatus, newSta
 	tgbotService.SendMsgToTgbotAdmins(msg)
 }
 
-// createHTTPClient creates an HTTP client configured for the node's TLS settings.
+// createHTTPClient creates the HTTP client for API calls to a node. With UseTLS the node certificate
+// is verified against CaPath, or against CertPath when no CaPath is set, and CertPath/KeyPath are
+// presented as client certificate for mutual TLS when both are set. Verification is only skipped
+// when InsecureTLS is explicitly enabled.
 func (s *NodeService) createHTTPClient(node *model.Node, timeout time.Duration) (*http.Client, error) {
-	transport := &http.Transport{
-		TLSClientConfig: &tls.Config{
-			InsecureSkipVerify: node.InsecureTLS,
-		},
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: node.InsecureTLS,
 	}
 
-	// If custom certificates are provided, load them
-	if node.UseTLS && node.CertPath != "" {
+	if node.UseTLS {
 		// Load custom CA certificate
-		cert, err := os.ReadFile(node.CertPath)
-		if err != nil {
-			return nil, fmt.Errorf("failed to read certificate file: %w", err)
+		caPath := node.CaPath
+		if caPath == "" {
+			caPath = node.CertPath
 		}
-
-		caCertPool := x509.NewCertPool()
-		if !caCertPool.AppendCertsFromPEM(cert) {
-			return nil, fmt.Errorf("failed to parse certificate")
+		if caPath != "" {
+			cert, err := os.ReadFile(caPath)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read CA certificate file: %w", err)
+			}
+			caCertPool := x509.NewCertPool()
+			if !caCertPool.AppendCertsFromPEM(cert) {
+				return nil, fmt.Errorf("failed to parse CA certificate %s", caPath)
+			}
+			tlsConfig.RootCAs = caCertPool
 		}
 
-		transport.TLSClientConfig.RootCAs = caCertPool
-		transport.TLSClientConfig.InsecureSkipVerify = false // Use custom CA
-	}
-
-	// If custom key is provided, load client certificate
-	if node.UseTLS && node.KeyPath != "" && node.CertPath != "" {
 		// Load client certificate (cert + key)
-		clientCert, err := tls.LoadX509KeyPair(node.CertPath, node.KeyPath)
-		if err != nil {
-			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		if node.CertPath != "" && node.KeyPath != "" {
+			clientCert, err := tls.LoadX509KeyPair(node.CertPath, node.KeyPath)
+			if err != nil {
+				return nil, fmt.Errorf("failed to load client certificate: %w", err)
+			}
+			tlsConfig.Certificates = []tls.Certificate{clientCert}
 		}
-
-		transport.TLSClientConfig.Certificates = []tls.Certificate{clientCert}
 	}
 
 	return &http.Client{
 		Timeout:   timeout,
-		Transport: transport,
+		Transport: &http.Transport{TLSClientConfig: tlsConfig},
 	}, nil
 }
 
@@ -657,15 +754,18 @@ func (s *NodeService) UpdateNodeTraffic(nodeId int, up int64, down int64) (bool,
 	}
 
 	// Update node traffic in database
-	err := db.Model(&node).Updates(map[string]interface{}{
-		"up":       newUp,
-		"down":     newDown,
-		"all_time": newAllTime,
-	}).Error
+	err := database.RetryWrite(func() error {
+		return db.Model(&node).Updates(map[string]interface{}{
+			"up":       newUp,
+			"down":     newDown,
+			"all_time": newAllTime,
+		}).Error
+	})
 
 	if err != nil {
 		return false, fmt.Errorf("failed to update node traffic: %w", err)
 	}
+	s.recordNodeTrafficSample(db, nodeId, up, down)
 
 	return trafficExceeded, nil
 }
@@ -767,6 +867,8 @@ func (s *NodeService) CollectNodeStats() error {
 	// Map to collect client traffic by email (aggregated across all nodes)
 	// email -> traffic
 	clientTrafficMap := make(map[string]*xray.ClientTraffic)
+	// Inbound traffic across all nodes, for the per-inbound traffic history
+	var inboundTraffics []*xray.Traffic
 
 	onlineClientsMap := make(map[string]bool)
 
@@ -832,7 +934,7 @@ func (s *NodeService) CollectNodeStats() error {
 			}
 
 			// Map tag to inboundId
-			inboundId, ok := tagToInboundId[nt.Tag]
+			inboundId, ok := tagToInboundId[xray.BaseInboundTag(nt.Tag)]
 			if !ok {
 				logger.Debugf("[Node: %s] Unknown tag in traffic: %s", result.node.Name, nt.Tag)
 				continue
@@ -848,6 +950,7 @@ func (s *NodeService) CollectNodeStats() error {
 			// Add to node traffic
 			nodeUp += nt.Up
 			nodeDown += nt.Down
+			inboundTraffics = append(inboundTraffics, &xray.Traffic{IsInbound: true, Tag: nt.Tag, Up: nt.Up, Down: nt.Down})
 		}
 
 		// Update node traffic
@@ -936,36 +1039,31 @@ func (s *NodeService) CollectNodeStats() error {
 		}
 	}
 
+	recordTrafficSamples(inboundTraffics, allClientTraffics)
+
 	// Update client traffic in database
 	if len(allClientTraffics) > 0 {
-		db := database.GetDB()
-		tx := db.Begin()
-		defer func() {
-			if r := recover(); r != nil {
-				tx.Rollback()
-			}
-		}()
-
-		clientsToDisable, _, err := clientService.AddClientTraffic(tx, allClientTraffics, inboundService)
+		// The whole transaction is retried on transient database errors (locks, deadlocks)
+		var clientsToDisable map[string]string
+		err := database.RetryWrite(func() error {
+			return database.GetDB().Transaction(func(tx *gorm.DB) error {
+				var err error
+				clientsToDisable, _, err = clientService.AddClientTraffic(tx, allClientTraffics, inboundService)
+				return err
+			})
+		})
 		if err != nil {
-			tx.Rollback()
 			logger.Warningf("Failed to add client traffic: %v", err)
-		} else {
-			if err := tx.Commit().Error; err != nil {
-				logger.Warningf("Failed to commit client traffic: %v", err)
-			} else {
-				// Handle clients that need to be disabled - remove them from Xray API (both local and nodes)
-				if len(clientsToDisable) > 0 {
-					logger.Infof("Traffic limit exceeded for %d clients, removing from Xray via API", len(clientsToDisable))
-					// Remove expired clients from Xray API asynchronously (don't block traffic processing)
-					go func() {
-						_, err := clientService.DisableClientsByEmail(clientsToDisable, inboundService)
-						if err != nil {
-							logger.Warningf("Failed to disable expired clients via API: %v", err)
-						}
-					}()
+		} else if len(clientsToDisable) > 0 {
+			// Handle clients that need to be disabled - remove them from Xray API (both local and nodes)
+			logger.Infof("Traffic limit exceeded for %d clients, removing from Xray via API", len(clientsToDisable))
+			// Remove expired clients from Xray API asynchronously (don't block traffic processing)
+			go func() {
+				_, err := clientService.DisableClientsByEmail(clientsToDisable, inboundService)
+				if err != nil {
+					logger.Warningf("Failed to disable expired clients via API: %v", err)
 				}
-			}
+			}()
 		}
 	}
 
@@ -1031,7 +1129,7 @@ func (s *NodeService) AssignInboundToNodes(inboundId int, nodeIds []int) error {
 			// Check if any existing inbound has the same port (excluding the current inbound)
 			for _, existingInbound := range existingInbounds {
 				if existingInbound.Id != inboundId && existingInbound.Port == inbound.Port {
-					return fmt.Errorf("node %d is already assigned to inbound %d with port %d. One node cannot be assigned to two inbounds with the same port", nodeId, existingInbound.Id, inbound.Port)
+					return common.NewCodedErrorf(common.ErrCodeInboundPortConflict, "node %d is already assigned to inbound %d with port %d. One node cannot be assigned to two inbounds with the same port", nodeId, existingInbound.Id, inbound.Port)
 				}
 			}
 		}
@@ -1196,6 +1294,58 @@ func (s *NodeService) ApplyConfigToNode(node *model.Node, xrayConfig []byte) err
 	return nil
 }
 
+// maxNodeConfigHistory is the number of config push records kept per node.
+const maxNodeConfigHistory = 50
+
+// newNodeConfigHistory builds the history record of a config push made at appliedAt (unix milliseconds).
+func newNodeConfigHistory(nodeId int, xrayConfig []byte, applyErr error, appliedAt int64) *model.NodeConfigHistory {
+	hash := sha256.Sum256(xrayConfig)
+	entry := &model.NodeConfigHistory{
+		NodeId:     nodeId,
+		ConfigHash: hex.EncodeToString(hash[:]),
+		AppliedAt:  appliedAt,
+		Success:    applyErr == nil,
+	}
+	if applyErr != nil {
+		entry.Error = applyErr.Error()
+	}
+	return entry
+}
+
+// RecordConfigPush stores the result of a config push to a node and prunes
+// records beyond maxNodeConfigHistory. Failures are logged, not returned,
+// so that auditing never affects the push itself.
+func (s *NodeService) RecordConfigPush(nodeId int, xrayConfig []byte, applyErr error) {
+	db := database.GetDB()
+	entry := newNodeConfigHistory(nodeId, xrayConfig, applyErr, time.Now().UnixMilli())
+	if err := db.Create(entry).Error; err != nil {
+		logger.Warningf("Failed to record config push for node %d: %v", nodeId, err)
+		return
+	}
+
+	// Keep only the newest maxNodeConfigHistory records for this node
+	keep := db.Model(&model.NodeConfigHistory{}).Select("id").
+		Where("node_id = ?", nodeId).
+		Order("applied_at DESC, id DESC").
+		Limit(maxNodeConfigHistory)
+	err := db.Where("node_id = ? AND id NOT IN (?)", nodeId, keep).
+		Delete(&model.NodeConfigHistory{}).Error
+	if err != nil {
+		logger.Warningf("Failed to prune config history for node %d: %v", nodeId, err)
+	}
+}
+
+// GetConfigHistory returns config push records for a node, newest first.
+func (s *NodeService) GetConfigHistory(nodeId int) ([]*model.NodeConfigHistory, error) {
+	db := database.GetDB()
+	var history []*model.NodeConfigHistory
+	err := db.Where("node_id = ?", nodeId).Order("applied_at DESC, id DESC").Find(&history).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to get node config history: %w", err)
+	}
+	return history, nil
+}
+
 // AddUserToNode adds a user to an inbound on a node via Xray API (instant, no restart).
 func (s *NodeService) AddUserToNode(node *model.Node, protocol, inboundTag string, user map[string]interface{}) error {
 	client, err := s.createHTTPClient(node, 10*time.Second)
@@ -1411,6 +1561,10 @@ func (s *NodeService) getPanelURL(nodeAddress ...string) string {
 	host := webDomain
 	if host == "" {
 		host = webListen
+		// A Unix socket is not reachable from nodes, infer the address as for a wildcard listen
+		if _, ok := entity.UnixSocketPath(host); ok {
+			host = ""
+		}
 		// If webListen is empty, 0.0.0.0, or ::, try to infer from node address
 		if host == "" || host == "0.0.0.0" || host == "::" || host == "::0" {
 			// Try to extract IP from node address if provided
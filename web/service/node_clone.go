@@ -0,0 +1,176 @@
+package service
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/konstpic/sharx-code/v2/database"
+	"github.com/konstpic/sharx-code/v2/database/model"
+	"github.com/konstpic/sharx-code/v2/util/common"
+
+	"gorm.io/gorm"
+)
+
+// CloneNode creates a copy of a node under newName and newAddress, e.g. for a replacement server.
+// The TLS settings and traffic limit are copied; traffic counters and health state start fresh.
+// The copy is registered at newAddress with a new API key, so it does not share credentials with
+// the source. With copyMappings the inbound, outbound, core config profile and client restriction
+// mappings of the node are duplicated for the copy; later changes to either node's mappings do not
+// affect the other. panelURL is passed to the node on registration as for RegisterNode.
+func (s *NodeService) CloneNode(id int, newName, newAddress string, copyMappings bool, panelURL string) (*model.Node, error) {
+	source, err := s.GetNode(id)
+	if err != nil {
+		return nil, err
+	}
+	node, err := newClonedNode(source, newName, newAddress)
+	if err != nil {
+		return nil, err
+	}
+
+	db := database.GetDB()
+	var count int64
+	if err := db.Model(&model.Node{}).Where("address = ?", node.Address).Count(&count).Error; err != nil {
+		return nil, err
+	}
+	if count > 0 {
+		return nil, common.NewErrorf("Address already used by another node: %s", node.Address)
+	}
+
+	apiKey, err := s.RegisterNode(node, panelURL)
+	if err != nil {
+		return nil, err
+	}
+	node.ApiKey = apiKey
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(node).Error; err != nil {
+			return err
+		}
+		if !copyMappings {
+			return nil
+		}
+		return copyNodeMappings(tx, source.Id, node.Id)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return node, nil
+}
+
+// newClonedNode returns an unsaved copy of source named newName at newAddress, see CloneNode.
+func newClonedNode(source *model.Node, newName, newAddress string) (*model.Node, error) {
+	newName = strings.TrimSpace(newName)
+	if newName == "" {
+		return nil, common.NewError("Node name is required")
+	}
+	if len(newName) > 50 {
+		return nil, common.NewError("Node name exceeds maximum length of 50 characters (spaces count as characters)")
+	}
+	newAddress = strings.TrimRight(strings.TrimSpace(newAddress), "/")
+	if err := validateNodeAddress(newAddress); err != nil {
+		return nil, err
+	}
+	return &model.Node{
+		Name:           newName,
+		Address:        newAddress,
+		Status:         "unknown",
+		UseTLS:         source.UseTLS,
+		CertPath:       source.CertPath,
+		KeyPath:        source.KeyPath,
+		CaPath:         source.CaPath,
+		InsecureTLS:    source.InsecureTLS,
+		TrafficLimitGB: source.TrafficLimitGB,
+	}, nil
+}
+
+// copyNodeMappings assigns node toId to everything node fromId is assigned to.
+func copyNodeMappings(tx *gorm.DB, fromId, toId int) error {
+	mappings, err := findNodeMappings(tx, fromId)
+	if err != nil {
+		return err
+	}
+	return mappings.forNode(toId).create(tx)
+}
+
+// nodeMappings are the inbound, outbound, core config profile and client restriction mappings of a node.
+type nodeMappings struct {
+	inbounds  []model.InboundNodeMapping
+	outbounds []model.OutboundNodeMapping
+	profiles  []model.ProfileNodeMapping
+	clients   []model.ClientNodeMapping
+}
+
+// findNodeMappings returns the mappings of node nodeId.
+func findNodeMappings(tx *gorm.DB, nodeId int) (*nodeMappings, error) {
+	m := &nodeMappings{}
+	if err := tx.Where("node_id = ?", nodeId).Find(&m.inbounds).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Where("node_id = ?", nodeId).Find(&m.outbounds).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Where("node_id = ?", nodeId).Find(&m.profiles).Error; err != nil {
+		return nil, err
+	}
+	// Clients restricted to the source node may use the copy as well
+	if err := tx.Where("node_id = ?", nodeId).Find(&m.clients).Error; err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// forNode returns new mappings assigning node nodeId to the same inbounds, outbounds, profiles
+// and clients as m. They have no Id yet, so creating them leaves the rows of m untouched.
+func (m *nodeMappings) forNode(nodeId int) *nodeMappings {
+	copies := &nodeMappings{}
+	for _, mapping := range m.inbounds {
+		copies.inbounds = append(copies.inbounds, model.InboundNodeMapping{InboundId: mapping.InboundId, NodeId: nodeId})
+	}
+	for _, mapping := range m.outbounds {
+		copies.outbounds = append(copies.outbounds, model.OutboundNodeMapping{OutboundId: mapping.OutboundId, NodeId: nodeId})
+	}
+	for _, mapping := range m.profiles {
+		copies.profiles = append(copies.profiles, model.ProfileNodeMapping{ProfileId: mapping.ProfileId, NodeId: nodeId})
+	}
+	for _, mapping := range m.clients {
+		copies.clients = append(copies.clients, model.ClientNodeMapping{ClientId: mapping.ClientId, NodeId: nodeId})
+	}
+	return copies
+}
+
+// create stores the mappings of m.
+func (m *nodeMappings) create(tx *gorm.DB) error {
+	for i := range m.inbounds {
+		if err := tx.Create(&m.inbounds[i]).Error; err != nil {
+			return err
+		}
+	}
+	for i := range m.outbounds {
+		if err := tx.Create(&m.outbounds[i]).Error; err != nil {
+			return err
+		}
+	}
+	for i := range m.profiles {
+		if err := tx.Create(&m.profiles[i]).Error; err != nil {
+			return err
+		}
+	}
+	for i := range m.clients {
+		if err := tx.Create(&m.clients[i]).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateNodeAddress checks that a node API address is an http or https URL with a host.
+func validateNodeAddress(address string) error {
+	if address == "" {
+		return common.NewError("Node address is required")
+	}
+	parsed, err := url.Parse(address)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return common.NewErrorf("Invalid node address %q: expected http(s)://host:port", address)
+	}
+	return nil
+}
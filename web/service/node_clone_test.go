@@ -0,0 +1,121 @@
+package service
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/konstpic/sharx-code/v2/database/model"
+
+	"gorm.io/gorm"
+)
+
+func TestNewClonedNode(t *testing.T) {
+	source := &model.Node{
+		Id:             3,
+		Name:           "de-1",
+		Address:        "https://de1.example.com:8080",
+		ApiKey:         "source-key",
+		Status:         "online",
+		LastCheck:      1700000000,
+		UseTLS:         true,
+		CertPath:       "/etc/sharx/client.crt",
+		KeyPath:        "/etc/sharx/client.key",
+		CaPath:         "/etc/sharx/ca.crt",
+		Up:             100,
+		Down:           200,
+		AllTime:        300,
+		TrafficLimitGB: 500,
+	}
+	node, err := newClonedNode(source, " de-2 ", " https://de2.example.com:8080/ ")
+	if err != nil {
+		t.Fatalf("newClonedNode() failed: %v", err)
+	}
+	want := &model.Node{
+		Name:           "de-2",
+		Address:        "https://de2.example.com:8080",
+		Status:         "unknown",
+		UseTLS:         true,
+		CertPath:       "/etc/sharx/client.crt",
+		KeyPath:        "/etc/sharx/client.key",
+		CaPath:         "/etc/sharx/ca.crt",
+		TrafficLimitGB: 500,
+	}
+	// No id, API key, health state or traffic of the source
+	if !reflect.DeepEqual(node, want) {
+		t.Fatalf("newClonedNode() = %+v, want %+v", node, want)
+	}
+}
+
+func TestNewClonedNodeValidates(t *testing.T) {
+	source := &model.Node{Id: 3, Name: "de-1", Address: "http://de1.example.com:8080"}
+	tests := []struct {
+		name    string
+		address string
+	}{
+		{"", "http://de2.example.com:8080"},
+		{strings.Repeat("n", 51), "http://de2.example.com:8080"},
+		{"de-2", ""},
+		{"de-2", "de2.example.com:8080"},
+		{"de-2", "ftp://de2.example.com"},
+		{"de-2", "http://"},
+	}
+	for _, test := range tests {
+		if _, err := newClonedNode(source, test.name, test.address); err == nil {
+			t.Errorf("newClonedNode(%q, %q) accepted an invalid node", test.name, test.address)
+		}
+	}
+}
+
+func TestNodeMappingsForNode(t *testing.T) {
+	source := &nodeMappings{
+		inbounds:  []model.InboundNodeMapping{{Id: 1, InboundId: 10, NodeId: 3}, {Id: 2, InboundId: 11, NodeId: 3}},
+		outbounds: []model.OutboundNodeMapping{{Id: 5, OutboundId: 20, NodeId: 3}},
+		profiles:  []model.ProfileNodeMapping{{Id: 7, ProfileId: 30, NodeId: 3}},
+		clients:   []model.ClientNodeMapping{{Id: 9, ClientId: 40, NodeId: 3}},
+	}
+	copies := source.forNode(8)
+	want := &nodeMappings{
+		inbounds:  []model.InboundNodeMapping{{InboundId: 10, NodeId: 8}, {InboundId: 11, NodeId: 8}},
+		outbounds: []model.OutboundNodeMapping{{OutboundId: 20, NodeId: 8}},
+		profiles:  []model.ProfileNodeMapping{{ProfileId: 30, NodeId: 8}},
+		clients:   []model.ClientNodeMapping{{ClientId: 40, NodeId: 8}},
+	}
+	if !reflect.DeepEqual(copies, want) {
+		t.Fatalf("forNode() = %+v, want %+v", copies, want)
+	}
+
+	// Changing the copy's mappings leaves the source node's alone
+	copies.inbounds[0].InboundId = 99
+	if source.inbounds[0].InboundId != 10 || source.inbounds[0].NodeId != 3 {
+		t.Fatalf("source mappings changed: %+v", source.inbounds)
+	}
+}
+
+func TestNodeMappingsCreate(t *testing.T) {
+	db := dryRunDB(t)
+	var statements []string
+	db.Callback().Create().After("gorm:create").Register("test:record", func(tx *gorm.DB) {
+		statements = append(statements, tx.Dialector.Explain(tx.Statement.SQL.String(), tx.Statement.Vars...))
+	})
+	mappings := (&nodeMappings{
+		inbounds:  []model.InboundNodeMapping{{InboundId: 10}},
+		outbounds: []model.OutboundNodeMapping{{OutboundId: 20}},
+		profiles:  []model.ProfileNodeMapping{{ProfileId: 30}},
+		clients:   []model.ClientNodeMapping{{ClientId: 40}},
+	}).forNode(8)
+	// Without the default transaction, which would need a connection
+	if err := mappings.create(db.Session(&gorm.Session{SkipDefaultTransaction: true})); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		`INSERT INTO "inbound_node_mappings" ("inbound_id","node_id") VALUES (10,8) RETURNING "id"`,
+		`INSERT INTO "outbound_node_mappings" ("outbound_id","node_id") VALUES (20,8) RETURNING "id"`,
+		`INSERT INTO "profile_node_mappings" ("profile_id","node_id") VALUES (30,8) RETURNING "id"`,
+		`INSERT INTO "client_node_mappings" ("client_id","node_id") VALUES (40,8) RETURNING "id"`,
+	}
+	if !reflect.DeepEqual(statements, want) {
+		t.Fatalf("statements = %q, want %q", statements, want)
+	}
+}
@@ -0,0 +1,131 @@
+package service
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/konstpic/sharx-code/v2/database/model"
+	"github.com/konstpic/sharx-code/v2/logger"
+)
+
+// NodePushResult is the outcome of the last config push to one node.
+type NodePushResult struct {
+	NodeId   int    `json:"nodeId"`
+	NodeName string `json:"nodeName"`
+	Success  bool   `json:"success"`
+	Error    string `json:"error,omitempty"`
+	PushedAt int64  `json:"pushedAt"` // unix milliseconds
+}
+
+var (
+	nodePushResultsMu sync.RWMutex
+	nodePushResults   = map[int]NodePushResult{}
+)
+
+// recordNodePushResult stores the outcome of a config push to a node, replacing the previous one.
+func recordNodePushResult(nodeId int, nodeName string, err error) NodePushResult {
+	result := NodePushResult{
+		NodeId:   nodeId,
+		NodeName: nodeName,
+		Success:  err == nil,
+		PushedAt: time.Now().UnixMilli(),
+	}
+	if err != nil {
+		result.Error = err.Error()
+	}
+	nodePushResultsMu.Lock()
+	nodePushResults[nodeId] = result
+	nodePushResultsMu.Unlock()
+	return result
+}
+
+// GetLastPushResults returns the outcome of the last config push to each node, ordered by node ID.
+// Nodes whose last push failed are serving a stale config.
+func (s *NodeService) GetLastPushResults() []NodePushResult {
+	nodePushResultsMu.RLock()
+	results := make([]NodePushResult, 0, len(nodePushResults))
+	for _, result := range nodePushResults {
+		results = append(results, result)
+	}
+	nodePushResultsMu.RUnlock()
+	sort.Slice(results, func(i, j int) bool { return results[i].NodeId < results[j].NodeId })
+	return results
+}
+
+// forgetNodePushResult drops the stored push outcome of a deleted node.
+func forgetNodePushResult(nodeId int) {
+	nodePushResultsMu.Lock()
+	delete(nodePushResults, nodeId)
+	nodePushResultsMu.Unlock()
+}
+
+// nodePushMaxAttempts bounds the number of times a config push to a node is tried.
+const nodePushMaxAttempts = 3
+
+// nodePushRetryDelay is the wait before the first retry; it doubles on every further retry.
+var nodePushRetryDelay = 2 * time.Second
+
+// applyConfigToNodeWithRetry pushes a config to a node and retries with exponential backoff
+// when the push fails, so a short network blip does not leave the node on a stale config.
+func (s *NodeService) applyConfigToNodeWithRetry(node *model.Node, xrayConfig []byte) error {
+	return retryNodePush(node, func() error { return s.ApplyConfigToNode(node, xrayConfig) })
+}
+
+// retryNodePush calls push up to nodePushMaxAttempts times until it succeeds and returns the last error.
+func retryNodePush(node *model.Node, push func() error) error {
+	delay := nodePushRetryDelay
+	var err error
+	for attempt := 1; attempt <= nodePushMaxAttempts; attempt++ {
+		if err = push(); err == nil {
+			if attempt > 1 {
+				logger.Infof("[Node: %s] Config applied on attempt %d", node.Name, attempt)
+			}
+			return nil
+		}
+		if attempt == nodePushMaxAttempts {
+			break
+		}
+		logger.Warningf("[Node: %s] Config push attempt %d/%d failed, retrying in %s: %v", node.Name, attempt, nodePushMaxAttempts, delay, err)
+		time.Sleep(delay)
+		delay *= 2
+	}
+	return err
+}
+
+// pushToNodes runs push for every node that has inbounds in nodeInbounds, at most concurrency
+// at a time, and records the outcome of each push (see GetLastPushResults).
+// It returns the number of nodes pushed to and the errors of the failed pushes.
+func pushToNodes(nodes []*model.Node, nodeInbounds map[int][]*model.Inbound, concurrency int, push func(*model.Node, []*model.Inbound) error) (int, []error) {
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var errs []error
+	sem := make(chan struct{}, concurrency)
+	pushed := 0
+	for _, node := range nodes {
+		inbounds, ok := nodeInbounds[node.Id]
+		if !ok {
+			// No inbounds assigned to this node, skip
+			continue
+		}
+
+		pushed++
+		wg.Add(1)
+		go func(n *model.Node, ibs []*model.Inbound) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			err := push(n, ibs)
+			recordNodePushResult(n.Id, n.Name, err)
+			if err != nil {
+				mu.Lock()
+				errs = append(errs, fmt.Errorf("node %s: %w", n.Name, err))
+				mu.Unlock()
+			}
+		}(node, inbounds)
+	}
+	wg.Wait()
+	return pushed, errs
+}
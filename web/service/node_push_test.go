@@ -0,0 +1,159 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/konstpic/sharx-code/v2/database/model"
+)
+
+// testNodes returns count nodes with IDs from 1, each assigned one inbound.
+func testNodes(count int) ([]*model.Node, map[int][]*model.Inbound) {
+	nodes := make([]*model.Node, 0, count)
+	nodeInbounds := make(map[int][]*model.Inbound, count)
+	for id := 1; id <= count; id++ {
+		nodes = append(nodes, &model.Node{Id: id, Name: fmt.Sprintf("node-%d", id)})
+		nodeInbounds[id] = []*model.Inbound{{Id: 100 + id}}
+	}
+	return nodes, nodeInbounds
+}
+
+func TestPushToNodesBoundsConcurrency(t *testing.T) {
+	nodes, nodeInbounds := testNodes(20)
+	t.Cleanup(func() {
+		for _, node := range nodes {
+			forgetNodePushResult(node.Id)
+		}
+	})
+	const limit = 3
+	var running, peak, calls atomic.Int32
+
+	pushed, errs := pushToNodes(nodes, nodeInbounds, limit, func(n *model.Node, ibs []*model.Inbound) error {
+		calls.Add(1)
+		now := running.Add(1)
+		for {
+			old := peak.Load()
+			if now <= old || peak.CompareAndSwap(old, now) {
+				break
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+		running.Add(-1)
+		return nil
+	})
+
+	if pushed != 20 || calls.Load() != 20 || len(errs) != 0 {
+		t.Fatalf("pushed %d with %d calls and errors %v, want 20 pushes without errors", pushed, calls.Load(), errs)
+	}
+	if peak.Load() > limit {
+		t.Fatalf("%d pushes ran at the same time, want at most %d", peak.Load(), limit)
+	}
+	if peak.Load() < 2 {
+		t.Fatalf("pushes did not run in parallel (peak %d)", peak.Load())
+	}
+}
+
+func TestPushToNodesSkipsNodesWithoutInbounds(t *testing.T) {
+	nodes, nodeInbounds := testNodes(3)
+	t.Cleanup(func() {
+		for _, node := range nodes {
+			forgetNodePushResult(node.Id)
+		}
+	})
+	delete(nodeInbounds, 2)
+
+	var pushedIds []int
+	pushed, _ := pushToNodes(nodes, nodeInbounds, 1, func(n *model.Node, ibs []*model.Inbound) error {
+		// A concurrency of 1 runs the pushes one at a time
+		pushedIds = append(pushedIds, n.Id)
+		if len(ibs) != 1 || ibs[0].Id != 100+n.Id {
+			t.Errorf("node %d pushed with inbounds %v", n.Id, ibs)
+		}
+		return nil
+	})
+	if pushed != 2 || len(pushedIds) != 2 {
+		t.Fatalf("pushed to %v, want nodes 1 and 3 only", pushedIds)
+	}
+}
+
+func TestPushToNodesMixedOutcome(t *testing.T) {
+	nodes, nodeInbounds := testNodes(3)
+	t.Cleanup(func() {
+		for _, node := range nodes {
+			forgetNodePushResult(node.Id)
+		}
+	})
+
+	pushed, errs := pushToNodes(nodes, nodeInbounds, 10, func(n *model.Node, ibs []*model.Inbound) error {
+		if n.Id == 2 {
+			return errors.New("node returned status 500")
+		}
+		return nil
+	})
+	if pushed != 3 || len(errs) != 1 || errs[0].Error() != "node node-2: node returned status 500" {
+		t.Fatalf("pushed %d with errors %v, want one failed node out of 3", pushed, errs)
+	}
+
+	results := (&NodeService{}).GetLastPushResults()
+	if len(results) != 3 {
+		t.Fatalf("push results = %+v, want one per node", results)
+	}
+	for i, result := range results {
+		wantSuccess := result.NodeId != 2
+		if result.NodeId != i+1 || result.NodeName != fmt.Sprintf("node-%d", i+1) || result.Success != wantSuccess || result.PushedAt == 0 {
+			t.Errorf("result %d = %+v, want success %v", i, result, wantSuccess)
+		}
+	}
+	if results[1].Error != "node returned status 500" || results[0].Error != "" {
+		t.Errorf("result errors = %q, %q, want only node 2 to report its error", results[0].Error, results[1].Error)
+	}
+
+	// A later successful push clears the stale state of the node
+	pushToNodes(nodes[1:2], nodeInbounds, 10, func(*model.Node, []*model.Inbound) error { return nil })
+	if results := (&NodeService{}).GetLastPushResults(); !results[1].Success || results[1].Error != "" {
+		t.Errorf("node 2 after a successful push = %+v", results[1])
+	}
+}
+
+// useFastNodePushRetry shortens the node push retry delay for the rest of the test.
+func useFastNodePushRetry(t *testing.T) {
+	previous := nodePushRetryDelay
+	nodePushRetryDelay = time.Millisecond
+	t.Cleanup(func() { nodePushRetryDelay = previous })
+}
+
+func TestRetryNodePushRecoversFromFailures(t *testing.T) {
+	useFastNodePushRetry(t)
+	node := &model.Node{Id: 7, Name: "flaky"}
+	attempts := 0
+
+	err := retryNodePush(node, func() error {
+		attempts++
+		if attempts <= 2 {
+			return errors.New("connection refused")
+		}
+		return nil
+	})
+	if err != nil || attempts != 3 {
+		t.Fatalf("retryNodePush() = %v after %d attempts, want success on the third", err, attempts)
+	}
+	// The history records the outcome of the push as a whole
+	if entry := newNodeConfigHistory(node.Id, []byte(`{}`), err, 1000); !entry.Success || entry.Error != "" {
+		t.Fatalf("config history = %+v, want a successful push", entry)
+	}
+}
+
+func TestRetryNodePushGivesUp(t *testing.T) {
+	useFastNodePushRetry(t)
+	attempts := 0
+	err := retryNodePush(&model.Node{Name: "down"}, func() error {
+		attempts++
+		return fmt.Errorf("attempt %d failed", attempts)
+	})
+	if attempts != nodePushMaxAttempts || err == nil || err.Error() != fmt.Sprintf("attempt %d failed", nodePushMaxAttempts) {
+		t.Fatalf("retryNodePush() = %v after %d attempts, want the last error after %d", err, attempts, nodePushMaxAttempts)
+	}
+}
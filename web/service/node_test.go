@@ -0,0 +1,318 @@
+package service
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"io"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/konstpic/sharx-code/v2/database/model"
+)
+
+func TestNewNodeConfigHistory(t *testing.T) {
+	config := []byte(`{"inbounds":[]}`)
+	// SHA-256 of config
+	const configHash = "29f62ba8e6cfc04a5e2459f66b726f8718e9a2b5a35d938805d30beff348d1fb"
+
+	first := newNodeConfigHistory(3, config, nil, 1000)
+	second := newNodeConfigHistory(3, config, errors.New("node returned status 500"), 2000)
+
+	if first.NodeId != 3 || first.AppliedAt != 1000 || !first.Success || first.Error != "" {
+		t.Errorf("successful push recorded as %+v", first)
+	}
+	if second.Success || second.Error != "node returned status 500" || second.AppliedAt != 2000 {
+		t.Errorf("failed push recorded as %+v", second)
+	}
+	for _, hash := range []string{first.ConfigHash, second.ConfigHash} {
+		if hash != configHash {
+			t.Errorf("config hash = %s, want %s", hash, configHash)
+		}
+	}
+
+	other := newNodeConfigHistory(3, []byte(`{"inbounds":[{}]}`), nil, 3000)
+	if other.ConfigHash == configHash {
+		t.Error("different configs recorded with the same hash")
+	}
+}
+
+// stubNodeKey is a node API that only answers POST /api/v1/rotate-api-key, authenticated with its current key.
+type stubNodeKey struct {
+	mu     sync.Mutex
+	key    string
+	reject bool // answer rotations with a server error
+}
+
+func (n *stubNodeKey) start(t *testing.T) *model.Node {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n.mu.Lock()
+		defer n.mu.Unlock()
+		if r.URL.Path != "/api/v1/rotate-api-key" || r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer "+n.key {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if n.reject {
+			http.Error(w, `{"error":"Failed to save API key"}`, http.StatusInternalServerError)
+			return
+		}
+		var req struct {
+			ApiKey string `json:"apiKey"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ApiKey == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		n.key = req.ApiKey
+	}))
+	t.Cleanup(server.Close)
+	return &model.Node{Id: 3, Name: "de-1", Address: server.URL, ApiKey: n.key}
+}
+
+func (n *stubNodeKey) currentKey() string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.key
+}
+
+func TestRotateNodeApiKey(t *testing.T) {
+	stub := &stubNodeKey{key: "old-key-0123456789"}
+	node := stub.start(t)
+
+	saved := ""
+	err := (&NodeService{}).rotateNodeApiKey(node, "new-key-0123456789", func() error {
+		// The node switches before the panel stores the key
+		saved = stub.currentKey()
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("rotateNodeApiKey() failed: %v", err)
+	}
+	if saved != "new-key-0123456789" || stub.currentKey() != "new-key-0123456789" {
+		t.Fatalf("node key when saved = %q, now %q, want the new key", saved, stub.currentKey())
+	}
+}
+
+func TestRotateNodeApiKeyPushFailure(t *testing.T) {
+	stub := &stubNodeKey{key: "old-key-0123456789", reject: true}
+	node := stub.start(t)
+
+	saves := 0
+	err := (&NodeService{}).rotateNodeApiKey(node, "new-key-0123456789", func() error {
+		saves++
+		return nil
+	})
+	if err == nil || !strings.Contains(err.Error(), "500") {
+		t.Fatalf("rotateNodeApiKey() error = %v, want the node's rejection", err)
+	}
+	if saves != 0 || stub.currentKey() != "old-key-0123456789" {
+		t.Fatalf("after a rejected push: %d saves, node key %q, want the old key kept on both sides", saves, stub.currentKey())
+	}
+
+	// A node that no longer knows the key has to be registered again
+	node.ApiKey = "stale-key-0123456789"
+	var reregister *ErrNodeNeedsReregistration
+	if err := (&NodeService{}).rotateNodeApiKey(node, "new-key-0123456789", func() error { return nil }); !errors.As(err, &reregister) {
+		t.Fatalf("rotateNodeApiKey() with a stale key = %v, want ErrNodeNeedsReregistration", err)
+	}
+}
+
+func TestRotateNodeApiKeySaveFailureRollsBack(t *testing.T) {
+	stub := &stubNodeKey{key: "old-key-0123456789"}
+	node := stub.start(t)
+
+	saveErr := errors.New("database is locked")
+	err := (&NodeService{}).rotateNodeApiKey(node, "new-key-0123456789", func() error { return saveErr })
+	if !errors.Is(err, saveErr) {
+		t.Fatalf("rotateNodeApiKey() error = %v, want the save error", err)
+	}
+	if stub.currentKey() != "old-key-0123456789" {
+		t.Fatalf("node key = %q, want it switched back to the old key", stub.currentKey())
+	}
+}
+
+func TestRotateNodeApiKeyUnreachable(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	node := &model.Node{Name: "de-1", Address: server.URL, ApiKey: "old-key-0123456789"}
+	server.Close()
+
+	saves := 0
+	if err := (&NodeService{}).rotateNodeApiKey(node, "new-key-0123456789", func() error { saves++; return nil }); err == nil {
+		t.Fatal("rotateNodeApiKey() succeeded without a node")
+	}
+	if saves != 0 {
+		t.Fatal("new key saved although the node was unreachable")
+	}
+}
+
+// testPKI is a CA with a server certificate for 127.0.0.1 and a client certificate, the
+// client's files written to a temporary directory.
+type testPKI struct {
+	caPool     *x509.CertPool
+	server     tls.Certificate
+	caPath     string
+	clientCert string
+	clientKey  string
+}
+
+func newTestPKI(t *testing.T) *testPKI {
+	t.Helper()
+	dir := t.TempDir()
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "sharx test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, err := x509.ParseCertificate(caDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	issue := func(serial int64, usage x509.ExtKeyUsage, certPath, keyPath string) tls.Certificate {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		template := &x509.Certificate{
+			SerialNumber: big.NewInt(serial),
+			Subject:      pkix.Name{CommonName: "sharx test"},
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(time.Hour),
+			KeyUsage:     x509.KeyUsageDigitalSignature,
+			ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+			IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		}
+		der, err := x509.CreateCertificate(rand.Reader, template, ca, &key.PublicKey, caKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+		keyPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})
+		if certPath != "" {
+			if err := os.WriteFile(certPath, certPEM, 0o600); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(keyPath, keyPEM, 0o600); err != nil {
+				t.Fatal(err)
+			}
+		}
+		cert, err := tls.X509KeyPair(certPEM, keyPEM)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cert
+	}
+
+	pki := &testPKI{
+		caPool:     x509.NewCertPool(),
+		caPath:     filepath.Join(dir, "ca.crt"),
+		clientCert: filepath.Join(dir, "client.crt"),
+		clientKey:  filepath.Join(dir, "client.key"),
+	}
+	pki.caPool.AddCert(ca)
+	if err := os.WriteFile(pki.caPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	pki.server = issue(2, x509.ExtKeyUsageServerAuth, "", "")
+	issue(3, x509.ExtKeyUsageClientAuth, pki.clientCert, pki.clientKey)
+	return pki
+}
+
+// startMTLSNode starts a node health endpoint that requires a client certificate issued by the CA of pki.
+func startMTLSNode(t *testing.T, pki *testPKI) string {
+	t.Helper()
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	server.TLS = &tls.Config{
+		Certificates: []tls.Certificate{pki.server},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    pki.caPool,
+	}
+	// Handshake failures are expected in some tests
+	server.Config.ErrorLog = log.New(io.Discard, "", 0)
+	server.StartTLS()
+	t.Cleanup(server.Close)
+	return server.URL
+}
+
+func TestCreateHTTPClientMutualTLS(t *testing.T) {
+	pki := newTestPKI(t)
+	address := startMTLSNode(t, pki)
+
+	tests := []struct {
+		name   string
+		node   model.Node
+		online bool
+	}{
+		{"client certificate and CA", model.Node{UseTLS: true, CaPath: pki.caPath, CertPath: pki.clientCert, KeyPath: pki.clientKey}, true},
+		{"no client certificate", model.Node{UseTLS: true, CaPath: pki.caPath}, false},
+		// The client certificate alone does not make the node certificate trusted
+		{"no CA", model.Node{UseTLS: true, CertPath: pki.clientCert, KeyPath: pki.clientKey}, false},
+		{"explicitly insecure", model.Node{UseTLS: true, CertPath: pki.clientCert, KeyPath: pki.clientKey, InsecureTLS: true}, true},
+		{"TLS settings ignored without UseTLS", model.Node{CaPath: pki.caPath, CertPath: pki.clientCert, KeyPath: pki.clientKey}, false},
+	}
+	for _, test := range tests {
+		node := test.node
+		node.Name = test.name
+		node.Address = address
+		status, _, err := (&NodeService{}).CheckNodeStatus(&node)
+		if online := status == "online" && err == nil; online != test.online {
+			t.Errorf("%s: status = %s, %v, want online %v", test.name, status, err, test.online)
+		}
+	}
+}
+
+func TestCreateHTTPClientRejectsBadFiles(t *testing.T) {
+	pki := newTestPKI(t)
+	missing := filepath.Join(t.TempDir(), "missing.crt")
+	tests := []struct {
+		name string
+		node model.Node
+	}{
+		{"missing CA", model.Node{UseTLS: true, CaPath: missing}},
+		{"CA that is not PEM", model.Node{UseTLS: true, CaPath: pki.clientKey}},
+		{"missing client key", model.Node{UseTLS: true, CaPath: pki.caPath, CertPath: pki.clientCert, KeyPath: missing}},
+	}
+	for _, test := range tests {
+		if _, err := (&NodeService{}).createHTTPClient(&test.node, time.Second); err == nil {
+			t.Errorf("%s: createHTTPClient() succeeded", test.name)
+		}
+	}
+}
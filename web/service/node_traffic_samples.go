@@ -0,0 +1,158 @@
+package service
+
+import (
+	"time"
+
+	"github.com/konstpic/sharx-code/v2/database"
+	"github.com/konstpic/sharx-code/v2/database/model"
+	"github.com/konstpic/sharx-code/v2/logger"
+	"github.com/konstpic/sharx-code/v2/util/common"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// trafficSampleSlot is the time slot traffic samples are recorded in.
+	trafficSampleSlot = time.Minute
+	// trafficSampleCompactSlot is the slot samples are compacted to once older than trafficSampleCompactAfter.
+	trafficSampleCompactSlot = time.Hour
+	// trafficSampleCompactAfter is the age after which minute samples are merged into hourly ones.
+	trafficSampleCompactAfter = 48 * time.Hour
+	// nodeTrafficSampleRetention is how long node traffic samples are kept.
+	nodeTrafficSampleRetention = 30 * 24 * time.Hour
+	// maxTrafficSeriesBuckets bounds the number of buckets a traffic series query returns.
+	maxTrafficSeriesBuckets = 2000
+)
+
+// TrafficBucket is the traffic within one bucket of a traffic series.
+type TrafficBucket struct {
+	Start int64 `json:"start"` // bucket start (unix milliseconds)
+	Up    int64 `json:"up"`    // bytes uploaded within the bucket
+	Down  int64 `json:"down"`  // bytes downloaded within the bucket
+}
+
+// trafficSampleRow is a sample as read back for bucketing.
+type trafficSampleRow struct {
+	Ts   int64
+	Up   int64
+	Down int64
+}
+
+// recordNodeTrafficSample adds a collection cycle's traffic delta to the node's sample of the current minute.
+func (s *NodeService) recordNodeTrafficSample(db *gorm.DB, nodeId int, up int64, down int64) {
+	if up == 0 && down == 0 {
+		return
+	}
+	slot := time.Now().Truncate(trafficSampleSlot).UnixMilli()
+	result := db.Model(&model.NodeTrafficSample{}).
+		Where("node_id = ? AND ts = ?", nodeId, slot).
+		Updates(map[string]any{
+			"up":   gorm.Expr("up + ?", up),
+			"down": gorm.Expr("down + ?", down),
+		})
+	if result.Error == nil && result.RowsAffected > 0 {
+		return
+	}
+	sample := &model.NodeTrafficSample{NodeId: nodeId, Up: up, Down: down, Ts: slot}
+	if err := db.Create(sample).Error; err != nil {
+		logger.Debugf("Failed to record traffic sample for node %d: %v", nodeId, err)
+	}
+}
+
+// GetTrafficSeries returns the traffic of a node between from and to (unix milliseconds)
+// summed into buckets of bucket length. Buckets without traffic are included with zeros.
+func (s *NodeService) GetTrafficSeries(nodeId int, from int64, to int64, bucket time.Duration) ([]TrafficBucket, error) {
+	if err := validateTrafficSeriesRange(from, to, bucket); err != nil {
+		return nil, err
+	}
+	db := database.GetDB()
+	var rows []trafficSampleRow
+	err := db.Model(&model.NodeTrafficSample{}).
+		Select("ts, up, down").
+		Where("node_id = ? AND ts >= ? AND ts < ?", nodeId, from, to).
+		Order("ts").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	return bucketTrafficSamples(rows, from, to, bucket), nil
+}
+
+// validateTrafficSeriesRange checks the time range and bucket length of a traffic series query.
+func validateTrafficSeriesRange(from int64, to int64, bucket time.Duration) error {
+	if from <= 0 || to <= from {
+		return common.NewErrorf("invalid time range: from %d, to %d", from, to)
+	}
+	if bucket < trafficSampleSlot {
+		return common.NewErrorf("bucket must be at least %s", trafficSampleSlot)
+	}
+	if (to-from)/bucket.Milliseconds() > maxTrafficSeriesBuckets {
+		return common.NewErrorf("too many buckets, at most %d are allowed", maxTrafficSeriesBuckets)
+	}
+	return nil
+}
+
+// bucketTrafficSamples sums the samples into consecutive buckets of bucket length starting at from.
+func bucketTrafficSamples(rows []trafficSampleRow, from int64, to int64, bucket time.Duration) []TrafficBucket {
+	size := bucket.Milliseconds()
+	count := (to - from + size - 1) / size
+	buckets := make([]TrafficBucket, count)
+	for i := range buckets {
+		buckets[i].Start = from + int64(i)*size
+	}
+	for _, row := range rows {
+		if row.Ts < from {
+			continue
+		}
+		index := (row.Ts - from) / size
+		if index >= count {
+			continue
+		}
+		buckets[index].Up += row.Up
+		buckets[index].Down += row.Down
+	}
+	return buckets
+}
+
+// CompactNodeTrafficSamples merges node traffic samples older than trafficSampleCompactAfter
+// into hourly samples and deletes samples older than nodeTrafficSampleRetention.
+func (s *NodeService) CompactNodeTrafficSamples() error {
+	db := database.GetDB()
+	now := time.Now()
+	if err := db.Where("ts < ?", now.Add(-nodeTrafficSampleRetention).UnixMilli()).
+		Delete(&model.NodeTrafficSample{}).Error; err != nil {
+		return err
+	}
+
+	cutoff := now.Add(-trafficSampleCompactAfter).Truncate(trafficSampleCompactSlot).UnixMilli()
+	hour := trafficSampleCompactSlot.Milliseconds()
+	var groups []struct {
+		NodeId int
+		Slot   int64
+		Up     int64
+		Down   int64
+	}
+	err := db.Model(&model.NodeTrafficSample{}).
+		Select("node_id, ts / ? * ? AS slot, SUM(up) AS up, SUM(down) AS down", hour, hour).
+		Where("ts < ?", cutoff).
+		Group("node_id, slot").
+		Having("COUNT(*) > 1 OR MIN(ts) <> MIN(ts) / ? * ?", hour, hour).
+		Scan(&groups).Error
+	if err != nil {
+		return err
+	}
+
+	for _, group := range groups {
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Where("node_id = ? AND ts >= ? AND ts < ?", group.NodeId, group.Slot, group.Slot+hour).
+				Delete(&model.NodeTrafficSample{}).Error; err != nil {
+				return err
+			}
+			return tx.Create(&model.NodeTrafficSample{NodeId: group.NodeId, Up: group.Up, Down: group.Down, Ts: group.Slot}).Error
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
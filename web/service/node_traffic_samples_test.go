@@ -0,0 +1,70 @@
+package service
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestBucketTrafficSamples(t *testing.T) {
+	from := time.Date(2026, time.January, 14, 12, 0, 0, 0, time.UTC).UnixMilli()
+	minute := time.Minute.Milliseconds()
+	// Samples hold the traffic of their minute, as recorded from the reset node counters
+	rows := []trafficSampleRow{
+		{Ts: from, Up: 100, Down: 1000},
+		{Ts: from + 2*minute, Up: 50, Down: 500},
+		{Ts: from + 5*minute, Up: 10, Down: 20},
+		{Ts: from + 14*minute, Up: 1, Down: 2},
+		// Outside the range
+		{Ts: from - minute, Up: 7, Down: 7},
+		{Ts: from + 15*minute, Up: 7, Down: 7},
+	}
+
+	got := bucketTrafficSamples(rows, from, from+15*minute, 5*time.Minute)
+	want := []TrafficBucket{
+		{Start: from, Up: 150, Down: 1500},
+		{Start: from + 5*minute, Up: 10, Down: 20},
+		{Start: from + 10*minute, Up: 1, Down: 2},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("bucketTrafficSamples() = %+v, want %+v", got, want)
+	}
+}
+
+func TestBucketTrafficSamplesEmptyAndPartialBuckets(t *testing.T) {
+	from := time.Date(2026, time.January, 14, 12, 0, 0, 0, time.UTC).UnixMilli()
+	hour := time.Hour.Milliseconds()
+
+	// A range that is not a whole number of buckets ends in a partial bucket
+	got := bucketTrafficSamples(nil, from, from+hour+time.Minute.Milliseconds(), time.Hour)
+	want := []TrafficBucket{{Start: from}, {Start: from + hour}}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("bucketTrafficSamples() = %+v, want zero buckets %+v", got, want)
+	}
+}
+
+func TestValidateTrafficSeriesRange(t *testing.T) {
+	from := time.Date(2026, time.January, 14, 0, 0, 0, 0, time.UTC).UnixMilli()
+	day := 24 * time.Hour.Milliseconds()
+	tests := []struct {
+		from   int64
+		to     int64
+		bucket time.Duration
+		valid  bool
+	}{
+		{from, from + day, time.Hour, true},
+		{from, from + day, time.Minute, true},
+		{0, day, time.Hour, false},
+		{from, from, time.Hour, false},
+		{from, from - day, time.Hour, false},
+		{from, from + day, time.Second, false},
+		// 30 days of minute buckets exceed maxTrafficSeriesBuckets
+		{from, from + 30*day, time.Minute, false},
+	}
+	for _, test := range tests {
+		err := validateTrafficSeriesRange(test.from, test.to, test.bucket)
+		if (err == nil) != test.valid {
+			t.Errorf("validateTrafficSeriesRange(%d, %d, %s) error = %v, want valid %v", test.from, test.to, test.bucket, err, test.valid)
+		}
+	}
+}
@@ -1,7 +1,9 @@
 package service
 
 import (
+	"encoding/json"
 	"fmt"
+	"net"
 
 	"github.com/konstpic/sharx-code/v2/database"
 	"github.com/konstpic/sharx-code/v2/database/model"
@@ -234,7 +236,7 @@ func (s *OutboundService) AddOutbound(outbound *model.Outbound) (*model.Outbound
 		return nil, err
 	}
 	if exist {
-		return nil, common.NewError("Outbound tag already exists:", outbound.Tag)
+		return nil, common.NewCodedError(common.ErrCodeOutboundTagExists, "Outbound tag already exists:", outbound.Tag)
 	}
 
 	// Validate required fields
@@ -244,6 +246,9 @@ func (s *OutboundService) AddOutbound(outbound *model.Outbound) (*model.Outbound
 	if outbound.Protocol == "" {
 		return nil, common.NewError("Outbound protocol is required")
 	}
+	if err := validateSendThrough(outbound.SendThrough); err != nil {
+		return nil, err
+	}
 
 	db := database.GetDB()
 	err = db.Create(outbound).Error
@@ -263,10 +268,14 @@ func (s *OutboundService) UpdateOutbound(outbound *model.Outbound) (*model.Outbo
 			return nil, err
 		}
 		if exist {
-			return nil, common.NewError("Outbound tag already exists:", outbound.Tag)
+			return nil, common.NewCodedError(common.ErrCodeOutboundTagExists, "Outbound tag already exists:", outbound.Tag)
 		}
 	}
 
+	if err := validateSendThrough(outbound.SendThrough); err != nil {
+		return nil, err
+	}
+
 	db := database.GetDB()
 	err := db.Model(model.Outbound{}).Where("id = ?", outbound.Id).Updates(outbound).Error
 	if err != nil {
@@ -277,6 +286,62 @@ func (s *OutboundService) UpdateOutbound(outbound *model.Outbound) (*model.Outbo
 	return s.GetOutbound(outbound.Id)
 }
 
+// SetEnable enables or disables an outbound.
+// Disabling an outbound that template routing rules still point to is allowed but logged.
+func (s *OutboundService) SetEnable(id int, enable bool) error {
+	outbound, err := s.GetOutbound(id)
+	if err != nil {
+		return err
+	}
+
+	// Update the single column, Updates(struct) would skip enable=false as a zero value
+	db := database.GetDB()
+	err = db.Model(model.Outbound{}).Where("id = ?", id).Update("enable", enable).Error
+	if err != nil {
+		return err
+	}
+
+	if !enable {
+		s.warnIfRoutedTo(outbound.Tag)
+	}
+	return nil
+}
+
+// warnIfRoutedTo logs a warning when routing rules in the Xray template reference the outbound tag.
+func (s *OutboundService) warnIfRoutedTo(tag string) {
+	settingService := SettingService{}
+	templateConfig, err := settingService.GetXrayConfigTemplate()
+	if err != nil {
+		return
+	}
+	if rules := countRulesRoutedTo(templateConfig, tag); rules > 0 {
+		logger.Warningf("Outbound %s disabled while %d routing rule(s) still send traffic to it", tag, rules)
+	}
+}
+
+// countRulesRoutedTo returns the number of routing rules in the Xray config JSON that send
+// traffic to the outbound tag. A config that cannot be parsed has none.
+func countRulesRoutedTo(xrayConfig string, tag string) int {
+	var config struct {
+		Routing struct {
+			Rules []struct {
+				OutboundTag string `json:"outboundTag"`
+			} `json:"rules"`
+		} `json:"routing"`
+	}
+	if err := json.Unmarshal([]byte(xrayConfig), &config); err != nil {
+		return 0
+	}
+
+	rules := 0
+	for _, rule := range config.Routing.Rules {
+		if rule.OutboundTag == tag {
+			rules++
+		}
+	}
+	return rules
+}
+
 // DeleteOutbound deletes an outbound configuration by ID.
 func (s *OutboundService) DeleteOutbound(id int) error {
 	db := database.GetDB()
@@ -312,3 +377,39 @@ func (s *OutboundService) GetOutboundsForNode(nodeId int) ([]*model.Outbound, er
 
 	return outbounds, nil
 }
+
+// validateSendThrough checks the sendThrough address of an outbound: an IP address of the server,
+// a CIDR range to pick a random source address from, or "origin" to egress from the address the
+// connection came in on. Interfaces are bound with sockopt.interface of the stream settings instead.
+func validateSendThrough(sendThrough string) error {
+	if sendThrough == "" || sendThrough == "origin" {
+		return nil
+	}
+	if net.ParseIP(sendThrough) != nil {
+		return nil
+	}
+	if _, _, err := net.ParseCIDR(sendThrough); err == nil {
+		return nil
+	}
+	return common.NewErrorf("Invalid sendThrough %q: expected an IP address, a CIDR range or \"origin\" (bind an interface with sockopt.interface)", sendThrough)
+}
+
+// validateConfigSendThrough checks the sendThrough address of every outbound of an Xray config.
+func validateConfigSendThrough(config *xray.Config) error {
+	if len(config.OutboundConfigs) == 0 || string(config.OutboundConfigs) == "null" {
+		return nil
+	}
+	var outbounds []struct {
+		Tag         string `json:"tag"`
+		SendThrough string `json:"sendThrough"`
+	}
+	if err := json.Unmarshal(config.OutboundConfigs, &outbounds); err != nil {
+		return common.NewErrorf("invalid outbounds config: %v", err)
+	}
+	for _, outbound := range outbounds {
+		if err := validateSendThrough(outbound.SendThrough); err != nil {
+			return common.NewErrorf("outbound %s: %v", outbound.Tag, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package service
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/konstpic/sharx-code/v2/xray"
+)
+
+func TestCountRulesRoutedTo(t *testing.T) {
+	const template = `{
+		"outbounds": [{"tag": "direct"}, {"tag": "warp"}, {"tag": "blocked"}],
+		"routing": {
+			"rules": [
+				{"type": "field", "inboundTag": ["api"], "outboundTag": "api"},
+				{"type": "field", "domain": ["geosite:openai"], "outboundTag": "warp"},
+				{"type": "field", "ip": ["geoip:ru"], "outboundTag": "warp"},
+				{"type": "field", "protocol": ["bittorrent"], "outboundTag": "blocked"}
+			]
+		}
+	}`
+	tests := []struct {
+		tag  string
+		want int
+	}{
+		{"warp", 2},
+		{"blocked", 1},
+		{"direct", 0},
+		{"missing", 0},
+	}
+	for _, test := range tests {
+		if got := countRulesRoutedTo(template, test.tag); got != test.want {
+			t.Errorf("countRulesRoutedTo(%q) = %d, want %d", test.tag, got, test.want)
+		}
+	}
+	if got := countRulesRoutedTo("{", "warp"); got != 0 {
+		t.Errorf("countRulesRoutedTo() of an invalid config = %d, want 0", got)
+	}
+}
+
+func TestValidateSendThrough(t *testing.T) {
+	for _, sendThrough := range []string{"", "origin", "203.0.113.10", "2001:db8::10", "203.0.113.0/28", "2001:db8::/64"} {
+		if err := validateSendThrough(sendThrough); err != nil {
+			t.Errorf("validateSendThrough(%q) = %v, want nil", sendThrough, err)
+		}
+	}
+	// Interfaces are bound with sockopt.interface, not sendThrough
+	for _, sendThrough := range []string{"eth0", "203.0.113.300", "203.0.113.0/33", "Origin", " 203.0.113.10"} {
+		if err := validateSendThrough(sendThrough); err == nil {
+			t.Errorf("validateSendThrough(%q) accepted an invalid address", sendThrough)
+		}
+	}
+}
+
+func TestCheckXrayConfigSendThrough(t *testing.T) {
+	valid := `{"outbounds":[{"tag":"direct","protocol":"freedom","sendThrough":"203.0.113.10"},{"tag":"blocked","protocol":"blackhole"}]}`
+	if err := (&XraySettingService{}).CheckXrayConfig(valid); err != nil {
+		t.Fatalf("CheckXrayConfig() = %v, want nil", err)
+	}
+	invalid := `{"outbounds":[{"tag":"direct","protocol":"freedom","sendThrough":"eth0"}]}`
+	if err := (&XraySettingService{}).CheckXrayConfig(invalid); err == nil {
+		t.Fatal("CheckXrayConfig() accepted an interface name as sendThrough")
+	}
+	if err := (&XrayCoreConfigProfileService{}).validateConfigJson(invalid); err == nil {
+		t.Fatal("validateConfigJson() accepted an interface name as sendThrough")
+	}
+	if err := (&XrayCoreConfigProfileService{}).validateConfigJson(`{"inbounds":[]}`); err != nil {
+		t.Fatalf("validateConfigJson() of a config without outbounds = %v, want nil", err)
+	}
+}
+
+func TestGeneratedConfigKeepsSendThrough(t *testing.T) {
+	t.Setenv("XUI_BIN_FOLDER", t.TempDir())
+	template := `{"outbounds":[{"tag":"direct","protocol":"freedom","sendThrough":"203.0.113.10"}]}`
+	config := &xray.Config{}
+	if err := json.Unmarshal([]byte(template), config); err != nil {
+		t.Fatal(err)
+	}
+	if err := validateConfigSendThrough(config); err != nil {
+		t.Fatal(err)
+	}
+
+	path, err := xray.WriteConfigFile(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filepath.Dir(path) != os.Getenv("XUI_BIN_FOLDER") {
+		t.Fatalf("config written to %s, want the bin folder", path)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var written struct {
+		Outbounds []struct {
+			Tag         string `json:"tag"`
+			SendThrough string `json:"sendThrough"`
+		} `json:"outbounds"`
+	}
+	if err := json.Unmarshal(data, &written); err != nil {
+		t.Fatal(err)
+	}
+	if len(written.Outbounds) != 1 || written.Outbounds[0].SendThrough != "203.0.113.10" {
+		t.Fatalf("outbounds of the generated config = %+v, want direct with sendThrough 203.0.113.10", written.Outbounds)
+	}
+}
@@ -0,0 +1,150 @@
+package service
+
+import (
+	"crypto/ecdh"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+
+	"github.com/konstpic/sharx-code/v2/database/model"
+	"github.com/konstpic/sharx-code/v2/util/common"
+)
+
+// decodeRealityKey decodes an x25519 key in the encoding Xray uses for Reality
+// (base64 URL without padding), also accepting padded and standard base64.
+func decodeRealityKey(key string) ([]byte, error) {
+	key = strings.TrimSpace(key)
+	encodings := []*base64.Encoding{base64.RawURLEncoding, base64.URLEncoding, base64.RawStdEncoding, base64.StdEncoding}
+	var err error
+	for _, encoding := range encodings {
+		var raw []byte
+		if raw, err = encoding.DecodeString(key); err == nil {
+			if len(raw) != 32 {
+				return nil, common.NewErrorf("x25519 key must be 32 bytes, got %d", len(raw))
+			}
+			return raw, nil
+		}
+	}
+	return nil, common.NewErrorf("invalid x25519 key encoding: %v", err)
+}
+
+// DeriveRealityPublicKey returns the Reality public key matching an x25519 privateKey.
+func DeriveRealityPublicKey(privateKey string) (string, error) {
+	raw, err := decodeRealityKey(privateKey)
+	if err != nil {
+		return "", err
+	}
+	key, err := ecdh.X25519().NewPrivateKey(raw)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(key.PublicKey().Bytes()), nil
+}
+
+// GenerateRealityKeypair returns a new x25519 private key and its public key, encoded for Reality.
+func GenerateRealityKeypair() (privateKey string, publicKey string, err error) {
+	key, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return "", "", err
+	}
+	privateKey = base64.RawURLEncoding.EncodeToString(key.Bytes())
+	publicKey = base64.RawURLEncoding.EncodeToString(key.PublicKey().Bytes())
+	return privateKey, publicKey, nil
+}
+
+// validateRealityKeys checks that the privateKey of a Reality inbound is a valid x25519 key
+// and that the publicKey stored for client links belongs to it. A mismatch would otherwise only
+// show up as failing handshakes on the clients.
+func validateRealityKeys(inbound *model.Inbound) error {
+	if inbound.StreamSettings == "" {
+		return nil
+	}
+	var stream struct {
+		Security        string `json:"security"`
+		RealitySettings struct {
+			PrivateKey string `json:"privateKey"`
+			Settings   struct {
+				PublicKey string `json:"publicKey"`
+			} `json:"settings"`
+		} `json:"realitySettings"`
+	}
+	if err := json.Unmarshal([]byte(inbound.StreamSettings), &stream); err != nil || stream.Security != "reality" {
+		return nil
+	}
+
+	privateKey := stream.RealitySettings.PrivateKey
+	if privateKey == "" {
+		// Reported by Xray itself when the config is loaded
+		return nil
+	}
+	derived, err := DeriveRealityPublicKey(privateKey)
+	if err != nil {
+		return common.NewErrorf("Invalid Reality privateKey of inbound %q: %v", inbound.Remark, err)
+	}
+	publicKey := stream.RealitySettings.Settings.PublicKey
+	if publicKey == "" {
+		return nil
+	}
+	raw, err := decodeRealityKey(publicKey)
+	if err != nil {
+		return common.NewErrorf("Invalid Reality publicKey of inbound %q: %v", inbound.Remark, err)
+	}
+	if base64.RawURLEncoding.EncodeToString(raw) != derived {
+		return common.NewErrorf("Reality publicKey of inbound %q does not match its privateKey (expected %s)", inbound.Remark, derived)
+	}
+	return nil
+}
+
+const (
+	// maxRealityShortIds bounds the number of shortIds generated at once.
+	maxRealityShortIds = 16
+	// maxRealityShortIdLength is the longest Reality shortId in hex characters (8 bytes).
+	maxRealityShortIdLength = 16
+)
+
+// RealityKeys is a fresh Reality key pair with shortIds for a new inbound.
+type RealityKeys struct {
+	PrivateKey string   `json:"privateKey"`
+	PublicKey  string   `json:"publicKey"`
+	ShortIds   []string `json:"shortIds"`
+}
+
+// GenerateRealityShortIds returns count random hex shortIds. A length of 0 picks a different
+// valid length for each shortId, otherwise it must be an even number of hex characters up to 16.
+func GenerateRealityShortIds(count int, length int) ([]string, error) {
+	if count < 1 || count > maxRealityShortIds {
+		return nil, common.NewErrorf("shortId count must be between 1 and %d, got %d", maxRealityShortIds, count)
+	}
+	if length < 0 || length > maxRealityShortIdLength || length%2 != 0 {
+		return nil, common.NewErrorf("shortId length must be an even number between 2 and %d, got %d", maxRealityShortIdLength, length)
+	}
+	shortIds := make([]string, 0, count)
+	for i := 0; i < count; i++ {
+		n := length
+		if n == 0 {
+			// Cycle through 16, 14, ..., 2 so the ids differ in length
+			n = maxRealityShortIdLength - 2*(i%(maxRealityShortIdLength/2))
+		}
+		raw := make([]byte, n/2)
+		if _, err := rand.Read(raw); err != nil {
+			return nil, err
+		}
+		shortIds = append(shortIds, hex.EncodeToString(raw))
+	}
+	return shortIds, nil
+}
+
+// GenerateRealityKeys returns a new Reality key pair and count shortIds of the given length.
+func GenerateRealityKeys(count int, length int) (*RealityKeys, error) {
+	shortIds, err := GenerateRealityShortIds(count, length)
+	if err != nil {
+		return nil, err
+	}
+	privateKey, publicKey, err := GenerateRealityKeypair()
+	if err != nil {
+		return nil, err
+	}
+	return &RealityKeys{PrivateKey: privateKey, PublicKey: publicKey, ShortIds: shortIds}, nil
+}
@@ -0,0 +1,128 @@
+package service
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/konstpic/sharx-code/v2/database/model"
+)
+
+// RFC 7748 section 6.1 key pair (Alice), in the base64 URL encoding Xray uses
+const (
+	testRealityPrivateKey = "dwdtCnMYpX08FsFyUbJmRd9ML4frwJkqsXf7pR25LCo"
+	testRealityPublicKey  = "hSDwCYkwp1R0i33ctD73Wg2_Og0mOBr066SpjqqbTmo"
+)
+
+func TestDeriveRealityPublicKey(t *testing.T) {
+	// Padded and standard base64 are accepted too
+	for _, privateKey := range []string{testRealityPrivateKey, testRealityPrivateKey + "=", " " + testRealityPrivateKey + " "} {
+		publicKey, err := DeriveRealityPublicKey(privateKey)
+		if err != nil {
+			t.Fatalf("DeriveRealityPublicKey(%q) failed: %v", privateKey, err)
+		}
+		if publicKey != testRealityPublicKey {
+			t.Fatalf("DeriveRealityPublicKey(%q) = %s, want %s", privateKey, publicKey, testRealityPublicKey)
+		}
+	}
+	for _, privateKey := range []string{"", "not a key!", "dwdtCnMYpX08FsFyUbJmRd9ML4frwJkq"} {
+		if _, err := DeriveRealityPublicKey(privateKey); err == nil {
+			t.Errorf("DeriveRealityPublicKey(%q) accepted an invalid key", privateKey)
+		}
+	}
+}
+
+func TestGenerateRealityKeypair(t *testing.T) {
+	privateKey, publicKey, err := GenerateRealityKeypair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if derived, err := DeriveRealityPublicKey(privateKey); err != nil || derived != publicKey {
+		t.Fatalf("public key %s does not belong to the private key (derived %s, %v)", publicKey, derived, err)
+	}
+	if other, _, _ := GenerateRealityKeypair(); other == privateKey {
+		t.Fatal("two generated private keys are equal")
+	}
+}
+
+func TestValidateRealityKeys(t *testing.T) {
+	_, otherPublicKey, err := GenerateRealityKeypair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	reality := func(privateKey, publicKey string) string {
+		return `{"security":"reality","realitySettings":{"privateKey":"` + privateKey + `","settings":{"publicKey":"` + publicKey + `"}}}`
+	}
+	tests := []struct {
+		name   string
+		stream string
+		ok     bool
+	}{
+		{"matching keys", reality(testRealityPrivateKey, testRealityPublicKey), true},
+		{"no public key", reality(testRealityPrivateKey, ""), true},
+		{"no private key", reality("", otherPublicKey), true},
+		{"not reality", `{"security":"tls","realitySettings":{"privateKey":"bad"}}`, true},
+		{"no stream settings", "", true},
+		{"mismatched public key", reality(testRealityPrivateKey, otherPublicKey), false},
+		{"invalid private key", reality("bad", testRealityPublicKey), false},
+		{"invalid public key", reality(testRealityPrivateKey, "bad"), false},
+	}
+	for _, test := range tests {
+		err := validateRealityKeys(&model.Inbound{Remark: "test", StreamSettings: test.stream})
+		if (err == nil) != test.ok {
+			t.Errorf("%s: validateRealityKeys() error = %v, want ok = %v", test.name, err, test.ok)
+		}
+	}
+}
+
+func TestGenerateRealityKeys(t *testing.T) {
+	keys, err := GenerateRealityKeys(3, 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if derived, err := DeriveRealityPublicKey(keys.PrivateKey); err != nil || derived != keys.PublicKey {
+		t.Fatalf("generated keys %+v are not a valid x25519 pair (derived %s, %v)", keys, derived, err)
+	}
+	if len(keys.ShortIds) != 3 {
+		t.Fatalf("shortIds = %q, want 3", keys.ShortIds)
+	}
+	for _, shortId := range keys.ShortIds {
+		if len(shortId) != 8 {
+			t.Errorf("shortId %q has length %d, want 8", shortId, len(shortId))
+		}
+		if _, err := hex.DecodeString(shortId); err != nil {
+			t.Errorf("shortId %q is not hex", shortId)
+		}
+	}
+}
+
+func TestGenerateRealityShortIdsMixedLengths(t *testing.T) {
+	shortIds, err := GenerateRealityShortIds(maxRealityShortIds, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lengths := map[int]bool{}
+	for _, shortId := range shortIds {
+		if _, err := hex.DecodeString(shortId); err != nil || len(shortId) < 2 || len(shortId) > maxRealityShortIdLength {
+			t.Errorf("shortId %q is not hex of an allowed length", shortId)
+		}
+		lengths[len(shortId)] = true
+	}
+	if len(lengths) != maxRealityShortIdLength/2 {
+		t.Errorf("shortId lengths = %v, want every even length from 2 to %d", lengths, maxRealityShortIdLength)
+	}
+}
+
+func TestGenerateRealityShortIdsBounds(t *testing.T) {
+	tests := []struct{ count, length int }{
+		{0, 8},
+		{maxRealityShortIds + 1, 8},
+		{1, -2},
+		{1, 7},
+		{1, maxRealityShortIdLength + 2},
+	}
+	for _, test := range tests {
+		if _, err := GenerateRealityShortIds(test.count, test.length); err == nil {
+			t.Errorf("GenerateRealityShortIds(%d, %d) accepted out of bounds input", test.count, test.length)
+		}
+	}
+}
@@ -0,0 +1,284 @@
+package service
+
+import (
+	"encoding/json"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/konstpic/sharx-code/v2/util/common"
+)
+
+// RouteRuleMatch is the routing rule that a target matched.
+type RouteRuleMatch struct {
+	Index       int    `json:"index"` // position in routing.rules, starting at 0
+	RuleTag     string `json:"ruleTag,omitempty"`
+	Matcher     string `json:"matcher"` // the domain, ip or port entry that matched
+	OutboundTag string `json:"outboundTag,omitempty"`
+	BalancerTag string `json:"balancerTag,omitempty"`
+}
+
+// RouteExplanation is the result of XrayService.ExplainRoute.
+type RouteExplanation struct {
+	Target   string          `json:"target"`
+	Kind     string          `json:"kind"` // domain or ip
+	Rule     *RouteRuleMatch `json:"rule"` // nil when no rule matched
+	Outbound string          `json:"outbound"`
+	Balancer string          `json:"balancer,omitempty"`
+	Notes    []string        `json:"notes"`
+}
+
+// routeRule is the part of an Xray routing rule that can be evaluated without a live connection.
+type routeRule struct {
+	RuleTag     string          `json:"ruleTag"`
+	Domain      []string        `json:"domain"`
+	IP          []string        `json:"ip"`
+	Port        json.RawMessage `json:"port"`
+	OutboundTag string          `json:"outboundTag"`
+	BalancerTag string          `json:"balancerTag"`
+	InboundTag  []string        `json:"inboundTag"`
+	Source      []string        `json:"source"`
+	User        []string        `json:"user"`
+	Protocol    []string        `json:"protocol"`
+	Network     string          `json:"network"`
+	Attrs       json.RawMessage `json:"attrs"`
+}
+
+// privateCIDRs are the ranges Xray's geoip:private covers.
+var privateCIDRs = []string{
+	"0.0.0.0/8", "10.0.0.0/8", "100.64.0.0/10", "127.0.0.0/8", "169.254.0.0/16", "172.16.0.0/12",
+	"192.0.0.0/24", "192.0.2.0/24", "192.88.99.0/24", "192.168.0.0/16", "198.18.0.0/15",
+	"198.51.100.0/24", "203.0.113.0/24", "224.0.0.0/3", "::/127", "fc00::/7", "fe80::/10", "ff00::/8",
+}
+
+// ExplainRoute statically evaluates the routing rules of the Xray template for a domain or IP,
+// optionally with a port (host:port), and returns the first matching rule and the resulting outbound.
+// Nothing is resolved or probed: rules that depend on the inbound, user, source or protocol are
+// skipped, and geosite/geoip lists other than geoip:private are reported as needing the data files.
+func (s *XrayService) ExplainRoute(target string) (*RouteExplanation, error) {
+	templateConfig, err := s.settingService.GetXrayConfigTemplate()
+	if err != nil {
+		return nil, err
+	}
+	return explainRoute(templateConfig, target)
+}
+
+// explainRoute evaluates the routing rules of an Xray config for target, see ExplainRoute.
+func explainRoute(xrayConfig string, target string) (*RouteExplanation, error) {
+	host, port, err := splitRouteTarget(target)
+	if err != nil {
+		return nil, err
+	}
+
+	var config struct {
+		Routing struct {
+			DomainStrategy string      `json:"domainStrategy"`
+			Rules          []routeRule `json:"rules"`
+		} `json:"routing"`
+		Outbounds []struct {
+			Tag string `json:"tag"`
+		} `json:"outbounds"`
+	}
+	if err := json.Unmarshal([]byte(xrayConfig), &config); err != nil {
+		return nil, err
+	}
+
+	explanation := &RouteExplanation{Target: target, Kind: "domain", Notes: make([]string, 0)}
+	ip := net.ParseIP(host)
+	if ip != nil {
+		explanation.Kind = "ip"
+	} else if strategy := config.Routing.DomainStrategy; strategy == "IPIfNonMatch" || strategy == "IPOnDemand" {
+		explanation.Notes = append(explanation.Notes, "domainStrategy "+strategy+" resolves the domain for ip rules at runtime; ip rules are not evaluated for domains here")
+	}
+
+	for index, rule := range config.Routing.Rules {
+		if rule.OutboundTag == "api" || (len(rule.InboundTag) > 0 && len(rule.Domain) == 0 && len(rule.IP) == 0 && len(rule.Port) == 0) {
+			// Rules selected only by inbound (like the API rule) never apply to a plain destination
+			continue
+		}
+		matcher, ok := matchRouteRule(rule, host, ip, port, index, &explanation.Notes)
+		if !ok {
+			continue
+		}
+		explanation.Rule = &RouteRuleMatch{
+			Index:       index,
+			RuleTag:     rule.RuleTag,
+			Matcher:     matcher,
+			OutboundTag: rule.OutboundTag,
+			BalancerTag: rule.BalancerTag,
+		}
+		explanation.Outbound = rule.OutboundTag
+		explanation.Balancer = rule.BalancerTag
+		return explanation, nil
+	}
+
+	// Without a matching rule Xray sends traffic to the first outbound
+	if len(config.Outbounds) > 0 {
+		explanation.Outbound = config.Outbounds[0].Tag
+	}
+	explanation.Notes = append(explanation.Notes, "no rule matched, the first outbound is used")
+	return explanation, nil
+}
+
+// splitRouteTarget splits a target into host and optional port.
+func splitRouteTarget(target string) (string, int, error) {
+	target = strings.TrimSpace(target)
+	if target == "" {
+		return "", 0, common.NewError("target is empty")
+	}
+	if host, portStr, err := net.SplitHostPort(target); err == nil {
+		port, err := strconv.Atoi(portStr)
+		if err != nil || port < 1 || port > 65535 {
+			return "", 0, common.NewErrorf("invalid port in target %q", target)
+		}
+		return strings.ToLower(host), port, nil
+	}
+	return strings.ToLower(strings.Trim(target, "[]")), 0, nil
+}
+
+// matchRouteRule reports whether rule matches the destination and which entry matched.
+// All conditions of a rule have to match; conditions that cannot be known statically make the rule not match.
+func matchRouteRule(rule routeRule, host string, ip net.IP, port int, index int, notes *[]string) (string, bool) {
+	if len(rule.InboundTag) > 0 || len(rule.Source) > 0 || len(rule.User) > 0 || len(rule.Protocol) > 0 || len(rule.Attrs) > 0 {
+		*notes = append(*notes, "rule "+strconv.Itoa(index)+" skipped: depends on inbound, source, user, protocol or attrs")
+		return "", false
+	}
+
+	matcher := ""
+	if len(rule.Domain) > 0 {
+		if ip != nil {
+			return "", false
+		}
+		m, ok := matchRouteDomains(rule.Domain, host, index, notes)
+		if !ok {
+			return "", false
+		}
+		matcher = m
+	}
+	if len(rule.IP) > 0 {
+		if ip == nil {
+			return "", false
+		}
+		m, ok := matchRouteIPs(rule.IP, ip, index, notes)
+		if !ok {
+			return "", false
+		}
+		matcher = m
+	}
+	if len(rule.Port) > 0 {
+		if port == 0 {
+			return "", false
+		}
+		m, ok := matchRoutePort(rule.Port, port)
+		if !ok {
+			return "", false
+		}
+		if matcher == "" {
+			matcher = "port:" + m
+		}
+	}
+	if matcher == "" {
+		// Only network (or nothing) is set; the network of a bare target is unknown
+		return "", false
+	}
+	return matcher, true
+}
+
+// matchRouteDomains returns the first Xray domain matcher in domains that matches host.
+func matchRouteDomains(domains []string, host string, index int, notes *[]string) (string, bool) {
+	for _, entry := range domains {
+		value := strings.ToLower(entry)
+		switch {
+		case strings.HasPrefix(value, "geosite:") || strings.HasPrefix(value, "ext:"):
+			*notes = append(*notes, "rule "+strconv.Itoa(index)+": "+entry+" requires the geosite data file and is not evaluated")
+		case strings.HasPrefix(value, "domain:"):
+			suffix := strings.TrimPrefix(value, "domain:")
+			if host == suffix || strings.HasSuffix(host, "."+suffix) {
+				return entry, true
+			}
+		case strings.HasPrefix(value, "full:"):
+			if host == strings.TrimPrefix(value, "full:") {
+				return entry, true
+			}
+		case strings.HasPrefix(value, "keyword:"):
+			if strings.Contains(host, strings.TrimPrefix(value, "keyword:")) {
+				return entry, true
+			}
+		case strings.HasPrefix(value, "regexp:"):
+			re, err := regexp.Compile(strings.TrimPrefix(entry, "regexp:"))
+			if err != nil {
+				*notes = append(*notes, "rule "+strconv.Itoa(index)+": invalid regexp "+entry)
+				continue
+			}
+			if re.MatchString(host) {
+				return entry, true
+			}
+		case strings.HasPrefix(value, "dotless:"):
+			if !strings.Contains(host, ".") && strings.Contains(host, strings.TrimPrefix(value, "dotless:")) {
+				return entry, true
+			}
+		default:
+			// A plain string is a keyword match
+			if strings.Contains(host, value) {
+				return entry, true
+			}
+		}
+	}
+	return "", false
+}
+
+// matchRouteIPs returns the first Xray ip matcher in ips that contains ip.
+func matchRouteIPs(ips []string, ip net.IP, index int, notes *[]string) (string, bool) {
+	for _, entry := range ips {
+		value := strings.ToLower(entry)
+		switch {
+		case value == "geoip:private":
+			for _, cidr := range privateCIDRs {
+				if _, network, err := net.ParseCIDR(cidr); err == nil && network.Contains(ip) {
+					return entry, true
+				}
+			}
+		case strings.HasPrefix(value, "geoip:") || strings.HasPrefix(value, "ext:"):
+			*notes = append(*notes, "rule "+strconv.Itoa(index)+": "+entry+" requires the geoip data file and is not evaluated")
+		case strings.Contains(value, "/"):
+			if _, network, err := net.ParseCIDR(value); err == nil && network.Contains(ip) {
+				return entry, true
+			}
+		default:
+			if other := net.ParseIP(value); other != nil && other.Equal(ip) {
+				return entry, true
+			}
+		}
+	}
+	return "", false
+}
+
+// matchRoutePort matches port against an Xray port condition: a number or a string like "53,443,1000-2000".
+func matchRoutePort(raw json.RawMessage, port int) (string, bool) {
+	var spec string
+	var number int
+	if err := json.Unmarshal(raw, &number); err == nil {
+		spec = strconv.Itoa(number)
+	} else if err := json.Unmarshal(raw, &spec); err != nil {
+		return "", false
+	}
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		from, to, isRange := strings.Cut(part, "-")
+		low, err := strconv.Atoi(strings.TrimSpace(from))
+		if err != nil {
+			continue
+		}
+		high := low
+		if isRange {
+			if high, err = strconv.Atoi(strings.TrimSpace(to)); err != nil {
+				continue
+			}
+		}
+		if port >= low && port <= high {
+			return part, true
+		}
+	}
+	return "", false
+}
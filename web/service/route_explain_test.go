@@ -0,0 +1,114 @@
+package service
+
+import (
+	"strings"
+	"testing"
+)
+
+const testRouteConfig = `{
+	"routing": {
+		"domainStrategy": "AsIs",
+		"rules": [
+			{"type": "field", "inboundTag": ["api"], "outboundTag": "api"},
+			{"type": "field", "outboundTag": "blocked", "ip": ["geoip:private"]},
+			{"type": "field", "ruleTag": "streaming", "outboundTag": "warp", "domain": ["geosite:netflix", "domain:example.com"]},
+			{"type": "field", "outboundTag": "office", "ip": ["8.8.8.0/24", "2001:db8::/32"], "port": "443,8000-9000"},
+			{"type": "field", "outboundTag": "by-user", "user": ["a@example.com"], "domain": ["keyword:"]},
+			{"type": "field", "balancerTag": "fast", "ip": ["1.1.1.1"]}
+		]
+	},
+	"outbounds": [{"tag": "direct"}, {"tag": "blocked"}, {"tag": "warp"}, {"tag": "office"}]
+}`
+
+func TestExplainRouteDomainSuffix(t *testing.T) {
+	for _, target := range []string{"example.com", "www.Example.com", "cdn.example.com:443"} {
+		explanation, err := explainRoute(testRouteConfig, target)
+		if err != nil {
+			t.Fatalf("explainRoute(%q) failed: %v", target, err)
+		}
+		rule := explanation.Rule
+		if explanation.Kind != "domain" || rule == nil || rule.Index != 2 || rule.RuleTag != "streaming" || rule.Matcher != "domain:example.com" {
+			t.Fatalf("explainRoute(%q) = %+v, want the domain:example.com rule", target, explanation)
+		}
+		if explanation.Outbound != "warp" {
+			t.Fatalf("explainRoute(%q) outbound = %q, want warp", target, explanation.Outbound)
+		}
+		if !containsNote(explanation.Notes, "geosite:netflix requires the geosite data file") {
+			t.Fatalf("notes = %q, want the geosite list reported", explanation.Notes)
+		}
+	}
+
+	// A suffix match needs a label boundary
+	explanation, err := explainRoute(testRouteConfig, "notexample.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if explanation.Rule != nil || explanation.Outbound != "direct" {
+		t.Fatalf("explainRoute(notexample.com) = %+v, want the first outbound", explanation)
+	}
+}
+
+func TestExplainRouteIPCIDR(t *testing.T) {
+	explanation, err := explainRoute(testRouteConfig, "8.8.8.50:8443")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if explanation.Kind != "ip" || explanation.Rule == nil || explanation.Rule.Matcher != "8.8.8.0/24" || explanation.Outbound != "office" {
+		t.Fatalf("explainRoute(8.8.8.50:8443) = %+v, want the 8.8.8.0/24 rule", explanation)
+	}
+	if explanation, _ := explainRoute(testRouteConfig, "[2001:db8::1]:443"); explanation.Rule == nil || explanation.Rule.Matcher != "2001:db8::/32" {
+		t.Fatalf("explainRoute([2001:db8::1]:443) = %+v, want the IPv6 CIDR", explanation)
+	}
+
+	// The port condition has to match as well
+	for _, target := range []string{"8.8.8.50", "8.8.8.50:80"} {
+		explanation, err := explainRoute(testRouteConfig, target)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if explanation.Rule != nil {
+			t.Fatalf("explainRoute(%q) matched rule %+v, want no match outside the ports", target, explanation.Rule)
+		}
+	}
+}
+
+func TestExplainRouteOtherRules(t *testing.T) {
+	explanation, err := explainRoute(testRouteConfig, "10.1.2.3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if explanation.Rule == nil || explanation.Rule.Matcher != "geoip:private" || explanation.Outbound != "blocked" {
+		t.Fatalf("explainRoute(10.1.2.3) = %+v, want geoip:private", explanation)
+	}
+
+	explanation, err = explainRoute(testRouteConfig, "1.1.1.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if explanation.Balancer != "fast" || explanation.Outbound != "" {
+		t.Fatalf("explainRoute(1.1.1.1) = %+v, want the fast balancer", explanation)
+	}
+
+	explanation, err = explainRoute(testRouteConfig, "other.org")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !containsNote(explanation.Notes, "rule 4 skipped") {
+		t.Fatalf("notes = %q, want the user rule reported as skipped", explanation.Notes)
+	}
+
+	for _, target := range []string{"", "example.com:0", "example.com:http"} {
+		if _, err := explainRoute(testRouteConfig, target); err == nil {
+			t.Errorf("explainRoute(%q) accepted an invalid target", target)
+		}
+	}
+}
+
+func containsNote(notes []string, text string) bool {
+	for _, note := range notes {
+		if strings.Contains(note, text) {
+			return true
+		}
+	}
+	return false
+}
@@ -22,6 +22,7 @@ import (
 
 	"github.com/konstpic/sharx-code/v2/config"
 	"github.com/konstpic/sharx-code/v2/database"
+	"github.com/konstpic/sharx-code/v2/database/model"
 	"github.com/konstpic/sharx-code/v2/logger"
 	"github.com/konstpic/sharx-code/v2/util/common"
 	"github.com/konstpic/sharx-code/v2/util/sys"
@@ -34,6 +35,7 @@ import (
 	"github.com/shirou/gopsutil/v4/load"
 	"github.com/shirou/gopsutil/v4/mem"
 	"github.com/shirou/gopsutil/v4/net"
+	"gorm.io/gorm"
 )
 
 // ProcessState represents the current state of a system process.
@@ -850,6 +852,16 @@ func (s *ServerService) GetLogs(count string, level string, syslog string) []str
 	return lines
 }
 
+// GetCoreLogs returns the most recent lines of Xray output kept in memory by the panel.
+// count is clamped to the buffer size.
+func (s *ServerService) GetCoreLogs(count string) []string {
+	c, err := strconv.Atoi(count)
+	if err != nil || c < 1 || c > xray.RecentLogsSize {
+		c = xray.RecentLogsSize
+	}
+	return s.xrayService.GetRecentXrayLogs(c)
+}
+
 func (s *ServerService) GetXrayLogs(
 	count string,
 	filter string,
@@ -1027,7 +1039,79 @@ func logEntryContains(line string, suffixes []string) bool {
 	return false
 }
 
-func (s *ServerService) GetConfigJson() (any, error) {
+// redactedConfigValue replaces secrets in configs returned with redaction.
+const redactedConfigValue = "<redacted>"
+
+// configSecretKeys are the config keys whose values are credentials or private keys.
+var configSecretKeys = map[string]bool{
+	"privateKey":   true,
+	"password":     true,
+	"pass":         true, // SOCKS and HTTP accounts
+	"key":          true,
+	"secretKey":    true,
+	"mldsa65Seed":  true,
+	"preSharedKey": true, // WireGuard peers
+}
+
+// redactConfigSecrets replaces secret values in a decoded config in place: private and
+// pre-shared keys, passwords, certificate keys, client IDs and VLESS decryption keys.
+func redactConfigSecrets(data any, parentKey string) {
+	switch value := data.(type) {
+	case map[string]any:
+		for key, child := range value {
+			switch {
+			case configSecretKeys[key]:
+				value[key] = redactedConfigValue
+			case key == "id" && (parentKey == "clients" || parentKey == "users"):
+				value[key] = redactedConfigValue
+			case key == "decryption" && child != "none":
+				value[key] = redactedConfigValue
+			default:
+				redactConfigSecrets(child, key)
+			}
+		}
+	case []any:
+		for _, child := range value {
+			redactConfigSecrets(child, parentKey)
+		}
+	}
+}
+
+// RedactInboundSecrets returns a copy of inbound without its server secrets: the private keys
+// of the stream settings and the server password and decryption key of the settings. Client
+// credentials are kept, as the clients of the inbound are shown from them.
+func RedactInboundSecrets(inbound *model.Inbound) *model.Inbound {
+	redacted := *inbound
+	var stream any
+	if err := json.Unmarshal([]byte(inbound.StreamSettings), &stream); err == nil {
+		redactConfigSecrets(stream, "")
+		if data, err := json.Marshal(stream); err == nil {
+			redacted.StreamSettings = string(data)
+		}
+	}
+	var settings map[string]any
+	if err := json.Unmarshal([]byte(inbound.Settings), &settings); err == nil {
+		changed := false
+		if _, ok := settings["password"]; ok {
+			settings["password"] = redactedConfigValue
+			changed = true
+		}
+		if decryption, ok := settings["decryption"]; ok && decryption != "none" {
+			settings["decryption"] = redactedConfigValue
+			changed = true
+		}
+		if changed {
+			if data, err := json.Marshal(settings); err == nil {
+				redacted.Settings = string(data)
+			}
+		}
+	}
+	return &redacted
+}
+
+// GetConfigJson returns the effective Xray config: the template merged with the enabled inbounds,
+// exactly as it would be fed to the core. With redact, secrets are masked.
+func (s *ServerService) GetConfigJson(redact bool) (any, error) {
 	config, err := s.xrayService.GetXrayConfig()
 	if err != nil {
 		return nil, err
@@ -1042,6 +1126,9 @@ func (s *ServerService) GetConfigJson() (any, error) {
 	if err != nil {
 		return nil, err
 	}
+	if redact {
+		redactConfigSecrets(jsonData, "")
+	}
 
 	return jsonData, nil
 }
@@ -1654,14 +1741,32 @@ func (s *ServerService) UpdateGeofile(fileName string) error {
 		}
 		defer resp.Body.Close()
 
-		file, err := os.Create(destPath)
+		if resp.StatusCode != http.StatusOK {
+			return common.NewErrorf("Failed to download Geofile from %s: bad status %d", url, resp.StatusCode)
+		}
+
+		// Download into a temporary file first so a bad body never replaces the existing Geofile
+		tmpPath := destPath + ".tmp"
+		file, err := os.Create(tmpPath)
 		if err != nil {
 			return common.NewErrorf("Failed to create Geofile %s: %v", destPath, err)
 		}
-		defer file.Close()
 
 		_, err = io.Copy(file, resp.Body)
+		file.Close()
 		if err != nil {
+			os.Remove(tmpPath)
+			return common.NewErrorf("Failed to save Geofile %s: %v", destPath, err)
+		}
+
+		if err := xray.ValidateGeoFile(tmpPath); err != nil {
+			os.Remove(tmpPath)
+			logger.Warningf("Rejected corrupt Geofile download %s: %v", destPath, err)
+			return common.NewErrorf("Downloaded Geofile %s is corrupt: %v", destPath, err)
+		}
+
+		if err := os.Rename(tmpPath, destPath); err != nil {
+			os.Remove(tmpPath)
 			return common.NewErrorf("Failed to save Geofile %s: %v", destPath, err)
 		}
 
@@ -1947,3 +2052,77 @@ func (s *ServerService) GetNewmlkem768() (any, error) {
 
 	return keyPair, nil
 }
+
+// OrphanedMappings lists client/host inbound mappings that reference rows which no longer exist.
+type OrphanedMappings struct {
+	ClientInbound []model.ClientInboundMapping `json:"clientInbound"` // Mappings with a missing client or inbound
+	HostInbound   []model.HostInboundMapping   `json:"hostInbound"`   // Mappings with a missing host or inbound
+}
+
+// PrunedMappings reports how many orphaned mappings were deleted.
+type PrunedMappings struct {
+	ClientInbound int64 `json:"clientInbound"`
+	HostInbound   int64 `json:"hostInbound"`
+}
+
+const (
+	orphanedClientInboundCond = "NOT EXISTS (SELECT 1 FROM client_entities c WHERE c.id = client_inbound_mappings.client_id) " +
+		"OR NOT EXISTS (SELECT 1 FROM inbounds i WHERE i.id = client_inbound_mappings.inbound_id)"
+	orphanedHostInboundCond = "NOT EXISTS (SELECT 1 FROM hosts h WHERE h.id = host_inbound_mappings.host_id) " +
+		"OR NOT EXISTS (SELECT 1 FROM inbounds i WHERE i.id = host_inbound_mappings.inbound_id)"
+)
+
+// GetOrphanedMappings returns client and host inbound mappings whose client, host
+// or inbound has been deleted. It does not modify the database.
+func (s *ServerService) GetOrphanedMappings() (*OrphanedMappings, error) {
+	return findOrphanedMappings(database.GetDB())
+}
+
+// findOrphanedMappings returns the orphaned client and host inbound mappings in db.
+func findOrphanedMappings(db *gorm.DB) (*OrphanedMappings, error) {
+	result := &OrphanedMappings{
+		ClientInbound: []model.ClientInboundMapping{},
+		HostInbound:   []model.HostInboundMapping{},
+	}
+
+	if err := db.Where(orphanedClientInboundCond).Order("id").Find(&result.ClientInbound).Error; err != nil {
+		return nil, fmt.Errorf("failed to find orphaned client mappings: %w", err)
+	}
+	if err := db.Where(orphanedHostInboundCond).Order("id").Find(&result.HostInbound).Error; err != nil {
+		return nil, fmt.Errorf("failed to find orphaned host mappings: %w", err)
+	}
+	return result, nil
+}
+
+// PruneOrphanedMappings deletes client and host inbound mappings whose client, host
+// or inbound has been deleted. Valid mappings are left untouched.
+func (s *ServerService) PruneOrphanedMappings() (*PrunedMappings, error) {
+	return pruneOrphanedMappings(database.GetDB())
+}
+
+// pruneOrphanedMappings deletes the orphaned client and host inbound mappings in db in one transaction.
+func pruneOrphanedMappings(db *gorm.DB) (*PrunedMappings, error) {
+	result := &PrunedMappings{}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		res := tx.Where(orphanedClientInboundCond).Delete(&model.ClientInboundMapping{})
+		if res.Error != nil {
+			return fmt.Errorf("failed to prune orphaned client mappings: %w", res.Error)
+		}
+		result.ClientInbound = res.RowsAffected
+
+		res = tx.Where(orphanedHostInboundCond).Delete(&model.HostInboundMapping{})
+		if res.Error != nil {
+			return fmt.Errorf("failed to prune orphaned host mappings: %w", res.Error)
+		}
+		result.HostInbound = res.RowsAffected
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if result.ClientInbound > 0 || result.HostInbound > 0 {
+		logger.Infof("Pruned orphaned mappings: %d client-inbound, %d host-inbound", result.ClientInbound, result.HostInbound)
+	}
+	return result, nil
+}
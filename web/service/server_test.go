@@ -0,0 +1,152 @@
+package service
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/konstpic/sharx-code/v2/database/model"
+	"github.com/konstpic/sharx-code/v2/xray"
+)
+
+func TestRedactConfigSecrets(t *testing.T) {
+	inbound := &model.Inbound{
+		Port:           443,
+		Protocol:       model.VLESS,
+		Tag:            "inbound-443",
+		Settings:       `{"clients":[{"id":"b831381d-6324-4d53-ad4f-8cda48b30811","email":"user@example.com"}],"decryption":"none"}`,
+		StreamSettings: `{"network":"tcp","security":"reality","realitySettings":{"privateKey":"server-private-key","shortIds":["6ba85179e30d4fc2"]}}`,
+	}
+	config := &xray.Config{
+		InboundConfigs: []xray.InboundConfig{*inbound.GenXrayInboundConfig()},
+		OutboundConfigs: []byte(`[
+			{"tag":"socks-out","protocol":"socks","settings":{"servers":[{"users":[{"user":"admin","pass":"socks-pass"}]}]}},
+			{"tag":"warp","protocol":"wireguard","settings":{"secretKey":"warp-secret","peers":[{"publicKey":"peer-public","preSharedKey":"psk"}]}}
+		]`),
+	}
+	contents, err := json.Marshal(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var data any
+	if err := json.Unmarshal(contents, &data); err != nil {
+		t.Fatal(err)
+	}
+
+	redactConfigSecrets(data, "")
+	redacted, err := json.Marshal(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	output := string(redacted)
+	for _, secret := range []string{"server-private-key", "b831381d-6324-4d53-ad4f-8cda48b30811", "socks-pass", "warp-secret", `"psk"`} {
+		if strings.Contains(output, secret) {
+			t.Errorf("redacted config still contains %s: %s", secret, output)
+		}
+	}
+	// The inbound is still in the config, with everything that is not a secret
+	for _, kept := range []string{`"tag":"inbound-443"`, "user@example.com", "6ba85179e30d4fc2", "peer-public", `"decryption":"none"`, `"user":"admin"`} {
+		if !strings.Contains(output, kept) {
+			t.Errorf("redacted config lost %s: %s", kept, output)
+		}
+	}
+}
+
+func TestRedactInboundSecrets(t *testing.T) {
+	inbound := &model.Inbound{
+		Settings:       `{"clients":[{"password":"client-pass","email":"user@example.com"}],"password":"server-pass","decryption":"mlkem768x25519plus.key"}`,
+		StreamSettings: `{"security":"reality","realitySettings":{"privateKey":"server-private-key"}}`,
+	}
+	redacted := RedactInboundSecrets(inbound)
+
+	for _, secret := range []string{"server-pass", "mlkem768x25519plus.key", "server-private-key"} {
+		if strings.Contains(redacted.Settings+redacted.StreamSettings, secret) {
+			t.Errorf("redacted inbound still contains %s", secret)
+		}
+	}
+	// Client credentials are kept, the clients of the inbound are shown from them
+	if !strings.Contains(redacted.Settings, "client-pass") {
+		t.Errorf("client password removed: %s", redacted.Settings)
+	}
+	if !strings.Contains(inbound.StreamSettings, "server-private-key") {
+		t.Error("RedactInboundSecrets modified the original inbound")
+	}
+}
+
+func TestOrphanedMappings(t *testing.T) {
+	db := memoryDB(t, &model.ClientEntity{}, &model.Inbound{}, &model.Host{},
+		&model.ClientInboundMapping{}, &model.HostInboundMapping{})
+	for _, row := range []any{
+		&model.ClientEntity{Id: 1, Email: "alice"},
+		&model.ClientEntity{Id: 2, Email: "bob"},
+		&model.Inbound{Id: 10, Tag: "inbound-10"},
+		&model.Inbound{Id: 11, Tag: "inbound-11"},
+		&model.Host{Id: 20, Name: "cdn"},
+		&model.Host{Id: 21, Name: "edge"},
+		// Valid mappings
+		&model.ClientInboundMapping{Id: 100, ClientId: 1, InboundId: 10},
+		&model.HostInboundMapping{Id: 200, HostId: 20, InboundId: 10},
+		// Mappings of the client, inbound and host deleted below
+		&model.ClientInboundMapping{Id: 101, ClientId: 2, InboundId: 11},
+		&model.ClientInboundMapping{Id: 102, ClientId: 2, InboundId: 10},
+		&model.ClientInboundMapping{Id: 103, ClientId: 1, InboundId: 11},
+		&model.HostInboundMapping{Id: 201, HostId: 21, InboundId: 10},
+		&model.HostInboundMapping{Id: 202, HostId: 20, InboundId: 11},
+	} {
+		if err := db.Create(row).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Delete rows directly, as removals that did not clean up their mappings did
+	for _, row := range []any{&model.ClientEntity{Id: 2}, &model.Inbound{Id: 11}, &model.Host{Id: 21}} {
+		if err := db.Delete(row).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 101 lost both sides, 102 its client, 103 and 202 their inbound and 201 its host
+	wantClient, wantHost := []int{101, 102, 103}, []int{201, 202}
+
+	orphaned, err := findOrphanedMappings(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var clientIds, hostIds []int
+	for _, m := range orphaned.ClientInbound {
+		clientIds = append(clientIds, m.Id)
+	}
+	for _, m := range orphaned.HostInbound {
+		hostIds = append(hostIds, m.Id)
+	}
+	if !reflect.DeepEqual(clientIds, wantClient) || !reflect.DeepEqual(hostIds, wantHost) {
+		t.Fatalf("orphaned mappings = client %v host %v, want client %v host %v", clientIds, hostIds, wantClient, wantHost)
+	}
+
+	pruned, err := pruneOrphanedMappings(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pruned.ClientInbound != 3 || pruned.HostInbound != 2 {
+		t.Fatalf("pruned %d client and %d host mappings, want 3 and 2", pruned.ClientInbound, pruned.HostInbound)
+	}
+
+	var clientMappings []model.ClientInboundMapping
+	var hostMappings []model.HostInboundMapping
+	if err := db.Order("id").Find(&clientMappings).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Order("id").Find(&hostMappings).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(clientMappings) != 1 || clientMappings[0].Id != 100 || len(hostMappings) != 1 || hostMappings[0].Id != 200 {
+		t.Fatalf("remaining mappings = client %+v host %+v, want only the valid mappings 100 and 200", clientMappings, hostMappings)
+	}
+
+	orphaned, err = findOrphanedMappings(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(orphaned.ClientInbound) != 0 || len(orphaned.HostInbound) != 0 {
+		t.Fatalf("orphaned mappings left after pruning: %+v", orphaned)
+	}
+}
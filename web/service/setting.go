@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"math"
 	"net/url"
 	"os"
 	"reflect"
@@ -17,6 +18,7 @@ import (
 	"github.com/konstpic/sharx-code/v2/database/model"
 	"github.com/konstpic/sharx-code/v2/logger"
 	"github.com/konstpic/sharx-code/v2/util/common"
+	ldaputil "github.com/konstpic/sharx-code/v2/util/ldap"
 	"github.com/konstpic/sharx-code/v2/util/random"
 	"github.com/konstpic/sharx-code/v2/util/reflect_util"
 	"github.com/konstpic/sharx-code/v2/web/cache"
@@ -46,6 +48,7 @@ var defaultValueMap = map[string]string{
 	"secret":                      random.Seq(32),
 	"webBasePath":                 "/",
 	"sessionMaxAge":               "360",
+	"sessionEpoch":                "0",
 	"pageSize":                    "25",
 	"expireDiff":                  "0",
 	"trafficDiff":                 "0",
@@ -60,9 +63,12 @@ var defaultValueMap = map[string]string{
 	"tgBotBackup":                 "false",
 	"tgBotLoginNotify":            "true",
 	"tgCpu":                       "80",
+	"tgExpiringDigestDays":        "0",
 	"tgLang":                      "en-US",
 	"twoFactorEnable":             "false",
 	"twoFactorToken":              "",
+	"loginMaxAttempts":            "5",
+	"loginLockoutMinutes":         "15",
 	"subEnable":                   "true",
 	"subJsonEnable":               "false",
 	"subTitle":                    "",
@@ -98,6 +104,7 @@ var defaultValueMap = map[string]string{
 	"warp":                        "",
 	"externalTrafficInformEnable": "false",
 	"externalTrafficInformURI":    "",
+	"externalTrafficInformSecret": "",
 	// LDAP defaults
 	"ldapEnable":            "false",
 	"ldapHost":              "",
@@ -121,6 +128,7 @@ var defaultValueMap = map[string]string{
 	"ldapDefaultLimitIP":    "0",
 	// Multi-node mode
 	"multiNodeMode": "false", // "true" for multi-mode, "false" for single-mode
+	"nodePushConcurrency": "10", // Max nodes receiving a config push at the same time
 	// HWID tracking mode
 	"hwidMode": "client_header", // "off" = disabled, "client_header" = use x-hwid header (default), "legacy_fingerprint" = deprecated fingerprint-based (deprecated)
 	// Grafana integration
@@ -129,6 +137,17 @@ var defaultValueMap = map[string]string{
 	"grafanaEnable":         "false",
 	// Panel log level (overrides XUI_LOG_LEVEL env var)
 	"panelLogLevel": "info", // Valid values: "debug", "info", "notice", "warning", "error"
+	// Sniffing JSON applied to new inbounds created without sniffing (empty = no default)
+	"defaultSniffing": "",
+	"xrayBinaryPath":  "",
+	// Xray log level override applied to the live config (empty = keep the template's log level)
+	"coreLogLevel": "", // Valid values: "none", "error", "warn", "info", "debug"
+	// Port of the local Xray API inbound (0 = keep the port from the template)
+	"coreApiPort": "0",
+	// Days of per-inbound and per-client traffic history kept for charts (0 = disabled)
+	"trafficHistoryDays": "30",
+	// Seconds without traffic after which a client is shown offline (0 = offline on the first idle check)
+	"clientOfflineTimeout": "60",
 }
 
 // SettingService provides business logic for application settings management.
@@ -300,16 +319,20 @@ func (s *SettingService) saveSetting(key string, value string) error {
 	setting, err := s.getSetting(key)
 	db := database.GetDB()
 	if database.IsNotFound(err) {
-		err = db.Create(&model.Setting{
-			Key:   key,
-			Value: value,
-		}).Error
+		err = database.RetryWrite(func() error {
+			return db.Create(&model.Setting{
+				Key:   key,
+				Value: value,
+			}).Error
+		})
 	} else if err != nil {
 		return err
 	} else {
 		setting.Key = key
 		setting.Value = value
-		err = db.Save(setting).Error
+		err = database.RetryWrite(func() error {
+			return db.Save(setting).Error
+		})
 	}
 	
 	if err == nil {
@@ -467,6 +490,11 @@ func (s *SettingService) GetTgCpu() (int, error) {
 	return s.getInt("tgCpu")
 }
 
+// GetTgExpiringDigestDays returns the look-ahead of the daily expiring-clients digest in days (0 = disabled).
+func (s *SettingService) GetTgExpiringDigestDays() (int, error) {
+	return s.getInt("tgExpiringDigestDays")
+}
+
 func (s *SettingService) GetTgLang() (string, error) {
 	return s.getString("tgLang")
 }
@@ -479,6 +507,14 @@ func (s *SettingService) SetTwoFactorEnable(value bool) error {
 	return s.setBool("twoFactorEnable", value)
 }
 
+func (s *SettingService) GetLoginMaxAttempts() (int, error) {
+	return s.getInt("loginMaxAttempts")
+}
+
+func (s *SettingService) GetLoginLockoutMinutes() (int, error) {
+	return s.getInt("loginLockoutMinutes")
+}
+
 func (s *SettingService) GetTwoFactorToken() (string, error) {
 	return s.getString("twoFactorToken")
 }
@@ -487,7 +523,13 @@ func (s *SettingService) SetTwoFactorToken(value string) error {
 	return s.setString("twoFactorToken", value)
 }
 
+// GetPort returns the web panel port. It is 0 when the panel listens on a Unix socket (see GetListen).
 func (s *SettingService) GetPort() (int, error) {
+	if listen, err := s.GetListen(); err == nil {
+		if _, ok := entity.UnixSocketPath(listen); ok {
+			return 0, nil
+		}
+	}
 	// Check environment variable first
 	if envValue := os.Getenv("XUI_WEB_PORT"); envValue != "" {
 		port, err := strconv.Atoi(envValue)
@@ -499,10 +541,31 @@ func (s *SettingService) GetPort() (int, error) {
 	return s.getInt("webPort")
 }
 
+// SetPort stores the web panel port. While the panel listens on a Unix socket the port is kept
+// but not used until the panel listens on TCP again.
 func (s *SettingService) SetPort(port int) error {
+	if listen, err := s.GetListen(); err == nil {
+		if path, ok := entity.UnixSocketPath(listen); ok {
+			logger.Warningf("Web panel listens on unix socket %s, port %d is used once it listens on TCP again", path, port)
+		}
+	}
 	return s.setInt("webPort", port)
 }
 
+// GetListenSocketMode returns the file permissions of the web panel Unix socket from
+// XUI_WEB_SOCKET_MODE (octal, e.g. "0660"), 0660 by default.
+func (s *SettingService) GetListenSocketMode() (os.FileMode, error) {
+	envValue := os.Getenv("XUI_WEB_SOCKET_MODE")
+	if envValue == "" {
+		return 0o660, nil
+	}
+	mode, err := strconv.ParseUint(envValue, 8, 32)
+	if err != nil || mode > 0o777 {
+		return 0, common.NewErrorf("invalid XUI_WEB_SOCKET_MODE value: %v", envValue)
+	}
+	return os.FileMode(mode), nil
+}
+
 func (s *SettingService) SetCertFile(webCertFile string) error {
 	return s.setString("webCertFile", webCertFile)
 }
@@ -539,6 +602,25 @@ func (s *SettingService) GetSessionMaxAge() (int, error) {
 	return s.getInt("sessionMaxAge")
 }
 
+// GetSessionEpoch returns the current session epoch. Login sessions issued in an older epoch are rejected.
+func (s *SettingService) GetSessionEpoch() (int, error) {
+	return s.getInt("sessionEpoch")
+}
+
+// BumpSessionEpoch increments the session epoch, invalidating every previously issued login session.
+// It returns the new epoch.
+func (s *SettingService) BumpSessionEpoch() (int, error) {
+	epoch, err := s.GetSessionEpoch()
+	if err != nil {
+		return 0, err
+	}
+	epoch++
+	if err := s.setInt("sessionEpoch", epoch); err != nil {
+		return 0, err
+	}
+	return epoch, nil
+}
+
 func (s *SettingService) GetRemarkModel() (string, error) {
 	return s.getString("remarkModel")
 }
@@ -554,39 +636,45 @@ func (s *SettingService) GetSecret() ([]byte, error) {
 	return []byte(secret), err
 }
 
+// SetBasePath validates and saves the web base path, see entity.NormalizeBasePath.
 func (s *SettingService) SetBasePath(basePath string) error {
-	if !strings.HasPrefix(basePath, "/") {
-		basePath = "/" + basePath
-	}
-	if !strings.HasSuffix(basePath, "/") {
-		basePath += "/"
+	basePath, err := entity.NormalizeBasePath(basePath)
+	if err != nil {
+		return err
 	}
 	return s.setString("webBasePath", basePath)
 }
 
+// GetBasePath returns the web base path from XUI_WEB_BASE_PATH or the settings, normalized
+// with entity.NormalizeBasePath. A value that does not pass validation, such as a path saved
+// by an older version, is not rejected here so the panel still starts: it only gets a leading
+// and trailing slash, as before, and a warning is logged.
 func (s *SettingService) GetBasePath() (string, error) {
 	// Check environment variable first
 	if envValue := os.Getenv("XUI_WEB_BASE_PATH"); envValue != "" {
-		basePath := envValue
-		if !strings.HasPrefix(basePath, "/") {
-			basePath = "/" + basePath
-		}
-		if !strings.HasSuffix(basePath, "/") {
-			basePath += "/"
-		}
-		return basePath, nil
+		return legacyBasePath("XUI_WEB_BASE_PATH", envValue), nil
 	}
 	basePath, err := s.getString("webBasePath")
 	if err != nil {
 		return "", err
 	}
+	return legacyBasePath("webBasePath", basePath), nil
+}
+
+// legacyBasePath normalizes basePath, falling back to adding the slashes only when it is invalid.
+func legacyBasePath(source string, basePath string) string {
+	normalized, err := entity.NormalizeBasePath(basePath)
+	if err == nil {
+		return normalized
+	}
+	logger.Warningf("%s: %v; using it unvalidated, set a valid base path to fix this", source, err)
 	if !strings.HasPrefix(basePath, "/") {
 		basePath = "/" + basePath
 	}
 	if !strings.HasSuffix(basePath, "/") {
 		basePath += "/"
 	}
-	return basePath, nil
+	return basePath
 }
 
 func (s *SettingService) GetTimeLocation() (*time.Location, error) {
@@ -861,6 +949,64 @@ func (s *SettingService) GetDatepicker() (string, error) {
 	return s.getString("datepicker")
 }
 
+// GetXrayBinaryPath returns the explicit Xray binary path (empty = automatic discovery).
+func (s *SettingService) GetXrayBinaryPath() (string, error) {
+	return s.getString("xrayBinaryPath")
+}
+
+// GetCoreLogLevel returns the core log level override (empty = keep the template's log level).
+func (s *SettingService) GetCoreLogLevel() (string, error) {
+	return s.getString("coreLogLevel")
+}
+
+// GetCoreAPIPort returns the port of the local Xray API inbound (0 = the template's port).
+func (s *SettingService) GetCoreAPIPort() (int, error) {
+	return s.getInt("coreApiPort")
+}
+
+// GetTrafficHistoryDays returns how many days of per-inbound and per-client traffic history are kept (0 = disabled).
+func (s *SettingService) GetTrafficHistoryDays() (int, error) {
+	return s.getInt("trafficHistoryDays")
+}
+
+// GetClientOfflineTimeout returns the seconds without traffic after which a client is reported offline.
+func (s *SettingService) GetClientOfflineTimeout() (int, error) {
+	return s.getInt("clientOfflineTimeout")
+}
+
+// GetDefaultSniffing returns the sniffing JSON applied to new inbounds
+// that are created without sniffing settings. Empty means no default.
+func (s *SettingService) GetDefaultSniffing() (string, error) {
+	return s.getString("defaultSniffing")
+}
+
+// SetDefaultSniffing validates and saves the default sniffing JSON.
+func (s *SettingService) SetDefaultSniffing(sniffing string) error {
+	if err := validateSniffingJSON(sniffing); err != nil {
+		return err
+	}
+	return s.setString("defaultSniffing", sniffing)
+}
+
+// validateSniffingJSON checks that sniffing is empty or a JSON object
+// in Xray sniffing format ("enabled" bool, "destOverride" string array).
+func validateSniffingJSON(sniffing string) error {
+	if strings.TrimSpace(sniffing) == "" {
+		return nil
+	}
+	var parsed struct {
+		Enabled      *bool    `json:"enabled"`
+		DestOverride []string `json:"destOverride"`
+	}
+	if err := json.Unmarshal([]byte(sniffing), &parsed); err != nil {
+		return common.NewErrorf("default sniffing is not valid JSON: %v", err)
+	}
+	if parsed.Enabled == nil {
+		return common.NewError("default sniffing must contain the \"enabled\" field")
+	}
+	return nil
+}
+
 func (s *SettingService) GetWarp() (string, error) {
 	return s.getString("warp")
 }
@@ -885,6 +1031,14 @@ func (s *SettingService) SetExternalTrafficInformURI(InformURI string) error {
 	return s.setString("externalTrafficInformURI", InformURI)
 }
 
+func (s *SettingService) GetExternalTrafficInformSecret() (string, error) {
+	return s.getString("externalTrafficInformSecret")
+}
+
+func (s *SettingService) SetExternalTrafficInformSecret(secret string) error {
+	return s.setString("externalTrafficInformSecret", secret)
+}
+
 
 // LDAP exported getters
 func (s *SettingService) GetLdapEnable() (bool, error) {
@@ -967,11 +1121,59 @@ func (s *SettingService) GetLdapDefaultLimitIP() (int, error) {
 	return s.getInt("ldapDefaultLimitIP")
 }
 
+// TestLdapConnection dials the LDAP server, binds and runs the user filter search,
+// returning the number of matched entries. Connection fields left empty in form
+// fall back to the saved settings, so unsaved values can be tested before saving.
+func (s *SettingService) TestLdapConnection(form *entity.AllSetting) (int, error) {
+	cfg := ldaputil.Config{
+		Host:       form.LdapHost,
+		Port:       form.LdapPort,
+		UseTLS:     form.LdapUseTLS,
+		BindDN:     form.LdapBindDN,
+		Password:   form.LdapPassword,
+		BaseDN:     form.LdapBaseDN,
+		UserFilter: form.LdapUserFilter,
+	}
+	if cfg.Host == "" {
+		cfg.Host, _ = s.GetLdapHost()
+		cfg.UseTLS, _ = s.GetLdapUseTLS()
+	}
+	if cfg.Port == 0 {
+		cfg.Port, _ = s.GetLdapPort()
+	}
+	if cfg.BindDN == "" {
+		cfg.BindDN, _ = s.GetLdapBindDN()
+	}
+	if cfg.Password == "" {
+		cfg.Password, _ = s.GetLdapPassword()
+	}
+	if cfg.BaseDN == "" {
+		cfg.BaseDN, _ = s.GetLdapBaseDN()
+	}
+	if cfg.UserFilter == "" {
+		cfg.UserFilter, _ = s.GetLdapUserFilter()
+	}
+
+	if cfg.Host == "" {
+		return 0, common.NewError("LDAP host is not set")
+	}
+	if cfg.Port <= 0 || cfg.Port > math.MaxUint16 {
+		return 0, common.NewErrorf("LDAP port is not valid: %d", cfg.Port)
+	}
+
+	return ldaputil.TestConnection(cfg)
+}
+
 // GetMultiNodeMode returns whether multi-node mode is enabled.
 func (s *SettingService) GetMultiNodeMode() (bool, error) {
 	return s.getBool("multiNodeMode")
 }
 
+// GetNodePushConcurrency returns the maximum number of nodes a config is pushed to at the same time.
+func (s *SettingService) GetNodePushConcurrency() (int, error) {
+	return s.getInt("nodePushConcurrency")
+}
+
 // SetMultiNodeMode sets the multi-node mode setting.
 func (s *SettingService) SetMultiNodeMode(enabled bool) error {
 	return s.setBool("multiNodeMode", enabled)
@@ -1015,6 +1217,15 @@ func (s *SettingService) UpdateAllSetting(allSetting *entity.AllSetting) error {
 	if err := allSetting.CheckValid(); err != nil {
 		return err
 	}
+	if err := validateSniffingJSON(allSetting.DefaultSniffing); err != nil {
+		return err
+	}
+	allSetting.XrayBinaryPath = strings.TrimSpace(allSetting.XrayBinaryPath)
+	if allSetting.XrayBinaryPath != "" {
+		if err := xray.ValidateBinaryPath(allSetting.XrayBinaryPath); err != nil {
+			return common.NewError(err)
+		}
+	}
 
 	// Settings that should only be configured via environment variables
 	// These are ignored when saving from web UI
@@ -1069,6 +1280,8 @@ func (s *SettingService) UpdateAllSetting(allSetting *entity.AllSetting) error {
 	
 	// Force clear cache after all settings are updated to ensure fresh data on next request
 	cache.InvalidateAllSettings()
+
+	xray.SetBinaryPathOverride(allSetting.XrayBinaryPath)
 	
 	// Reinitialize logger and metrics exporter if Grafana settings changed
 	if allSetting.GrafanaEnable && allSetting.GrafanaLokiUrl != "" {
@@ -0,0 +1,106 @@
+package service
+
+import (
+	"os"
+	"testing"
+
+	"github.com/konstpic/sharx-code/v2/web/entity"
+)
+
+func TestValidateSniffingJSON(t *testing.T) {
+	valid := []string{
+		"",
+		"  ",
+		`{"enabled":true,"destOverride":["http","tls","quic"]}`,
+		`{"enabled":false}`,
+	}
+	for _, sniffing := range valid {
+		if err := validateSniffingJSON(sniffing); err != nil {
+			t.Errorf("validateSniffingJSON(%q) = %v, want nil", sniffing, err)
+		}
+	}
+
+	invalid := []string{
+		`{"enabled":true`,
+		`{"destOverride":["http"]}`,
+		`{"enabled":true,"destOverride":"http"}`,
+		`[]`,
+	}
+	for _, sniffing := range invalid {
+		if err := validateSniffingJSON(sniffing); err == nil {
+			t.Errorf("validateSniffingJSON(%q) = nil, want an error", sniffing)
+		}
+	}
+}
+
+func TestTestLdapConnectionRejectsPort(t *testing.T) {
+	for _, port := range []int{-1, 65536} {
+		form := &entity.AllSetting{
+			LdapHost:       "ldap.example.com",
+			LdapPort:       port,
+			LdapBindDN:     "cn=admin,dc=example,dc=com",
+			LdapPassword:   "secret",
+			LdapBaseDN:     "dc=example,dc=com",
+			LdapUserFilter: "(objectClass=person)",
+		}
+		if _, err := (&SettingService{}).TestLdapConnection(form); err == nil {
+			t.Errorf("TestLdapConnection() accepted port %d", port)
+		}
+	}
+}
+
+func TestGetBasePathFromEnv(t *testing.T) {
+	tests := map[string]string{
+		"panel":           "/panel/",
+		"/panel//admin//": "/panel/admin/",
+		// A path that fails validation, e.g. set for an older version, still starts the panel
+		"/my@panel": "/my@panel/",
+	}
+	for basePath, want := range tests {
+		t.Setenv("XUI_WEB_BASE_PATH", basePath)
+		got, err := (&SettingService{}).GetBasePath()
+		if err != nil || got != want {
+			t.Errorf("GetBasePath() with XUI_WEB_BASE_PATH=%q = %q, %v, want %q", basePath, got, err, want)
+		}
+	}
+}
+
+func TestSetBasePathRejectsInvalidPath(t *testing.T) {
+	for _, basePath := range []string{"/../", "//example.com/", "/my panel/"} {
+		if err := (&SettingService{}).SetBasePath(basePath); err == nil {
+			t.Errorf("SetBasePath(%q) accepted an invalid path", basePath)
+		}
+	}
+}
+
+func TestGetPortInSocketMode(t *testing.T) {
+	t.Setenv("XUI_WEB_PORT", "2053")
+	t.Setenv("XUI_WEB_LISTEN", "unix:/run/sharx.sock")
+	if port, err := (&SettingService{}).GetPort(); err != nil || port != 0 {
+		t.Fatalf("GetPort() on a unix socket = %d, %v, want 0", port, err)
+	}
+	t.Setenv("XUI_WEB_LISTEN", "127.0.0.1")
+	if port, err := (&SettingService{}).GetPort(); err != nil || port != 2053 {
+		t.Fatalf("GetPort() on TCP = %d, %v, want 2053", port, err)
+	}
+}
+
+func TestGetListenSocketMode(t *testing.T) {
+	tests := map[string]os.FileMode{
+		"":     0o660,
+		"0600": 0o600,
+		"666":  0o666,
+	}
+	for value, want := range tests {
+		t.Setenv("XUI_WEB_SOCKET_MODE", value)
+		if mode, err := (&SettingService{}).GetListenSocketMode(); err != nil || mode != want {
+			t.Errorf("GetListenSocketMode() with %q = %o, %v, want %o", value, mode, err, want)
+		}
+	}
+	for _, value := range []string{"0999", "rw-rw----", "01777"} {
+		t.Setenv("XUI_WEB_SOCKET_MODE", value)
+		if _, err := (&SettingService{}).GetListenSocketMode(); err == nil {
+			t.Errorf("GetListenSocketMode() accepted %q", value)
+		}
+	}
+}
@@ -2957,6 +2957,20 @@ func (t *Tgbot) NotifyClientCreated(client *model.ClientEntity) {
 	t.SendMsgToTgbotAdmins(msg)
 }
 
+// NotifyClientsImported sends one notification for a client import instead of one per client.
+// This is called from ClientService.ImportClientsCSV and sends notifications to admins only.
+func (t *Tgbot) NotifyClientsImported(created int, failed int) {
+	if !t.IsRunning() {
+		return
+	}
+
+	msg := t.I18nBot("tgbot.messages.clientsImported")
+	msg += t.I18nBot("tgbot.messages.importedCount", "Created=="+strconv.Itoa(created), "Failed=="+strconv.Itoa(failed))
+	msg += t.I18nBot("tgbot.messages.time", "Time=="+time.Now().Format("2006-01-02 15:04:05"))
+
+	t.SendMsgToTgbotAdmins(msg)
+}
+
 // NotifyClientUpdated sends a notification when a client is updated.
 func (t *Tgbot) NotifyClientUpdated(client *model.ClientEntity, oldClient *model.ClientEntity) {
 	if !t.IsRunning() {
@@ -3344,6 +3358,42 @@ func (t *Tgbot) SendReport() {
 	}
 }
 
+// SendExpiringDigest sends admins the list of clients expiring within the configured number of days.
+// Nothing is sent when the digest is disabled or no client is about to expire.
+func (t *Tgbot) SendExpiringDigest() {
+	if !t.IsRunning() {
+		return
+	}
+	days, err := t.settingService.GetTgExpiringDigestDays()
+	if err != nil || days <= 0 {
+		return
+	}
+	clientService := ClientService{}
+	clients, err := clientService.GetExpiringClients(0, days)
+	if err != nil {
+		logger.Warning("Unable to load expiring clients:", err)
+		return
+	}
+	if len(clients) == 0 {
+		return
+	}
+	t.SendMsgToTgbotAdmins(t.formatExpiringDigest(clients, days))
+}
+
+// formatExpiringDigest formats the expiring-clients digest, one client per block.
+func (t *Tgbot) formatExpiringDigest(clients []*model.ClientEntity, days int) string {
+	output := t.I18nBot("tgbot.messages.expiringClients", "Count=="+strconv.Itoa(len(clients)), "Days=="+strconv.Itoa(days))
+	for _, client := range clients {
+		output += "\r\n"
+		output += t.I18nBot("tgbot.messages.email", "Email=="+client.Email)
+		output += t.I18nBot("tgbot.messages.expire", "Time=="+time.UnixMilli(client.ExpiryTime).Format("2006-01-02 15:04:05"))
+		if client.Comment != "" {
+			output += t.I18nBot("tgbot.messages.comment", "Comment=="+client.Comment) + "\r\n"
+		}
+	}
+	return output
+}
+
 // SendBackupToAdmins sends a database backup to admin chats.
 func (t *Tgbot) SendBackupToAdmins() {
 	if !t.IsRunning() {
@@ -3488,6 +3538,26 @@ func (t *Tgbot) UserLoginNotify(username string, password string, ip string, tim
 	t.SendMsgToTgbotAdmins(msg)
 }
 
+// UserLoginLockoutNotify notifies admins that logins from ip for username were locked out
+// after too many consecutive failed attempts.
+func (t *Tgbot) UserLoginLockoutNotify(username string, ip string, time string, attempts int, minutes int) {
+	if !t.IsRunning() {
+		return
+	}
+
+	loginNotifyEnabled, err := t.settingService.GetTgBotLoginNotify()
+	if err != nil || !loginNotifyEnabled {
+		return
+	}
+
+	msg := t.I18nBot("tgbot.messages.loginLocked", "Attempts=="+strconv.Itoa(attempts), "Minutes=="+strconv.Itoa(minutes))
+	msg += t.I18nBot("tgbot.messages.hostname", "Hostname=="+hostname)
+	msg += t.I18nBot("tgbot.messages.username", "Username=="+username)
+	msg += t.I18nBot("tgbot.messages.ip", "IP=="+ip)
+	msg += t.I18nBot("tgbot.messages.time", "Time=="+time)
+	t.SendMsgToTgbotAdmins(msg)
+}
+
 // getInboundUsages retrieves and formats inbound usage information.
 func (t *Tgbot) getInboundUsages() string {
 	info := ""
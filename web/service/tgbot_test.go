@@ -0,0 +1,54 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/konstpic/sharx-code/v2/database/model"
+	"github.com/konstpic/sharx-code/v2/web/locale"
+
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+	"github.com/pelletier/go-toml/v2"
+	"golang.org/x/text/language"
+)
+
+// useBotLocale loads the English bot messages from the translation files for the rest of the test.
+func useBotLocale(t *testing.T) {
+	t.Helper()
+	bundle := i18n.NewBundle(language.MustParse("en-US"))
+	bundle.RegisterUnmarshalFunc("toml", toml.Unmarshal)
+	if _, err := bundle.LoadMessageFile("../translation/translate.en_US.toml"); err != nil {
+		t.Fatal(err)
+	}
+	previous := locale.LocalizerBot
+	locale.LocalizerBot = i18n.NewLocalizer(bundle, "en-US")
+	t.Cleanup(func() { locale.LocalizerBot = previous })
+}
+
+func TestFormatExpiringDigest(t *testing.T) {
+	useBotLocale(t)
+	first := time.Date(2026, time.January, 15, 9, 30, 0, 0, time.Local)
+	second := time.Date(2026, time.January, 17, 18, 0, 0, 0, time.Local)
+	clients := []*model.ClientEntity{
+		{Email: "soon@example.com", ExpiryTime: first.UnixMilli()},
+		{Email: "later@example.com", ExpiryTime: second.UnixMilli(), Comment: "VIP"},
+	}
+
+	digest := (&Tgbot{}).formatExpiringDigest(clients, 3)
+
+	want := "⏳ 2 client(s) expire within 3 day(s):\r\n" +
+		"\r\n📧 Email: soon@example.com\r\n📅 Expire Date: 2026-01-15 09:30:00\r\n" +
+		"\r\n📧 Email: later@example.com\r\n📅 Expire Date: 2026-01-17 18:00:00\r\n<b>Comment:</b> VIP\r\n"
+	if digest != want {
+		t.Fatalf("digest =\n%q\nwant\n%q", digest, want)
+	}
+}
+
+func TestGetExpiringClientsRejectsEmptyWindow(t *testing.T) {
+	s := &ClientService{}
+	for _, days := range []int{0, -1} {
+		if _, err := s.GetExpiringClients(0, days); err == nil {
+			t.Errorf("GetExpiringClients(%d days) accepted an empty window", days)
+		}
+	}
+}
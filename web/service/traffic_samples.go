@@ -0,0 +1,185 @@
+package service
+
+import (
+	"strings"
+	"time"
+
+	"github.com/konstpic/sharx-code/v2/database"
+	"github.com/konstpic/sharx-code/v2/database/model"
+	"github.com/konstpic/sharx-code/v2/logger"
+	"github.com/konstpic/sharx-code/v2/xray"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Scopes of traffic samples.
+const (
+	TrafficScopeInbound = "inbound"
+	TrafficScopeClient  = "client"
+)
+
+// trafficSampleBatchSize is the number of samples written per insert statement.
+const trafficSampleBatchSize = 500
+
+// trafficSampleKey identifies the series a sample belongs to.
+type trafficSampleKey struct {
+	scope string
+	key   string
+}
+
+// recordTrafficSamples adds the traffic of a collection cycle to the current minute samples of
+// each inbound and client, in batched upserts. Up and down follow the totals of the inbound and
+// of the ClientEntity. Samples are written outside the traffic transaction, so a failure never
+// rolls back the traffic itself.
+func recordTrafficSamples(inboundTraffics []*xray.Traffic, clientTraffics []*xray.ClientTraffic) {
+	settingService := SettingService{}
+	days, err := settingService.GetTrafficHistoryDays()
+	if err != nil || days <= 0 {
+		return
+	}
+
+	samples := trafficSampleTotals(inboundTraffics, clientTraffics, time.Now())
+	if len(samples) == 0 {
+		return
+	}
+
+	db := database.GetDB()
+	err = db.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "scope"}, {Name: "key"}, {Name: "ts"}},
+		DoUpdates: clause.Assignments(map[string]any{
+			"up":   gorm.Expr("traffic_samples.up + excluded.up"),
+			"down": gorm.Expr("traffic_samples.down + excluded.down"),
+		}),
+	}).CreateInBatches(samples, trafficSampleBatchSize).Error
+	if err != nil {
+		logger.Debugf("Failed to record traffic samples: %v", err)
+	}
+}
+
+// trafficSampleTotals sums the traffic of a collection cycle into one sample per inbound and client,
+// all in the minute slot of now. Inbound tags of listen aliases count towards their base inbound.
+func trafficSampleTotals(inboundTraffics []*xray.Traffic, clientTraffics []*xray.ClientTraffic, now time.Time) []*model.TrafficSample {
+	slot := now.Truncate(trafficSampleSlot).UnixMilli()
+	totals := make(map[trafficSampleKey]*model.TrafficSample)
+	samples := make([]*model.TrafficSample, 0)
+	add := func(scope string, key string, up int64, down int64) {
+		k := trafficSampleKey{scope: scope, key: key}
+		sample, ok := totals[k]
+		if !ok {
+			sample = &model.TrafficSample{Scope: scope, Key: key, Ts: slot}
+			totals[k] = sample
+			samples = append(samples, sample)
+		}
+		sample.Up += up
+		sample.Down += down
+	}
+	for _, traffic := range inboundTraffics {
+		if !traffic.IsInbound || (traffic.Up == 0 && traffic.Down == 0) {
+			continue
+		}
+		add(TrafficScopeInbound, xray.BaseInboundTag(traffic.Tag), traffic.Up, traffic.Down)
+	}
+	for _, traffic := range clientTraffics {
+		if traffic.Up == 0 && traffic.Down == 0 {
+			continue
+		}
+		// ClientEntity stores the downlink as the client's upload, see ClientService.AddClientTraffic
+		add(TrafficScopeClient, strings.ToLower(traffic.Email), traffic.Down, traffic.Up)
+	}
+	return samples
+}
+
+// trafficSampleRetentionCutoff returns the timestamp (unix milliseconds) before which samples
+// are deleted when history is kept for days.
+func trafficSampleRetentionCutoff(now time.Time, days int) int64 {
+	return now.AddDate(0, 0, -days).UnixMilli()
+}
+
+// GetInboundTrafficSeries returns the traffic of an inbound between from and to (unix milliseconds)
+// summed into buckets of bucket length. Buckets without traffic are included with zeros.
+// Samples are kept per inbound tag, so history recorded before a tag change is not included.
+func (s *InboundService) GetInboundTrafficSeries(inboundId int, from int64, to int64, bucket time.Duration) ([]TrafficBucket, error) {
+	inbound, err := s.GetInbound(inboundId)
+	if err != nil {
+		return nil, err
+	}
+	return getTrafficSeries(TrafficScopeInbound, inbound.Tag, from, to, bucket)
+}
+
+// GetClientTrafficSeries returns the traffic of a client between from and to (unix milliseconds)
+// summed into buckets of bucket length. Buckets without traffic are included with zeros.
+func (s *ClientService) GetClientTrafficSeries(email string, from int64, to int64, bucket time.Duration) ([]TrafficBucket, error) {
+	return getTrafficSeries(TrafficScopeClient, strings.ToLower(email), from, to, bucket)
+}
+
+// getTrafficSeries reads the samples of one series and sums them into buckets.
+func getTrafficSeries(scope string, key string, from int64, to int64, bucket time.Duration) ([]TrafficBucket, error) {
+	if err := validateTrafficSeriesRange(from, to, bucket); err != nil {
+		return nil, err
+	}
+	db := database.GetDB()
+	var rows []trafficSampleRow
+	err := db.Model(&model.TrafficSample{}).
+		Select("ts, up, down").
+		Where("scope = ? AND key = ? AND ts >= ? AND ts < ?", scope, key, from, to).
+		Order("ts").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	return bucketTrafficSamples(rows, from, to, bucket), nil
+}
+
+// CompactTrafficSamples merges inbound and client traffic samples older than trafficSampleCompactAfter
+// into hourly samples and deletes samples older than the trafficHistoryDays setting.
+// With the setting at 0 all samples are deleted.
+func (s *InboundService) CompactTrafficSamples() error {
+	settingService := SettingService{}
+	days, err := settingService.GetTrafficHistoryDays()
+	if err != nil {
+		return err
+	}
+	db := database.GetDB()
+	now := time.Now()
+	if err := db.Where("ts < ?", trafficSampleRetentionCutoff(now, days)).
+		Delete(&model.TrafficSample{}).Error; err != nil {
+		return err
+	}
+	if days <= 0 {
+		return nil
+	}
+
+	cutoff := now.Add(-trafficSampleCompactAfter).Truncate(trafficSampleCompactSlot).UnixMilli()
+	hour := trafficSampleCompactSlot.Milliseconds()
+	var groups []struct {
+		Scope string
+		Key   string
+		Slot  int64
+		Up    int64
+		Down  int64
+	}
+	err = db.Model(&model.TrafficSample{}).
+		Select("scope, key, ts / ? * ? AS slot, SUM(up) AS up, SUM(down) AS down", hour, hour).
+		Where("ts < ?", cutoff).
+		Group("scope, key, slot").
+		Having("COUNT(*) > 1 OR MIN(ts) <> MIN(ts) / ? * ?", hour, hour).
+		Scan(&groups).Error
+	if err != nil {
+		return err
+	}
+
+	for _, group := range groups {
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Where("scope = ? AND key = ? AND ts >= ? AND ts < ?", group.Scope, group.Key, group.Slot, group.Slot+hour).
+				Delete(&model.TrafficSample{}).Error; err != nil {
+				return err
+			}
+			return tx.Create(&model.TrafficSample{Scope: group.Scope, Key: group.Key, Up: group.Up, Down: group.Down, Ts: group.Slot}).Error
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
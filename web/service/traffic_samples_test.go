@@ -0,0 +1,62 @@
+package service
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/konstpic/sharx-code/v2/database/model"
+	"github.com/konstpic/sharx-code/v2/xray"
+)
+
+func TestTrafficSampleTotals(t *testing.T) {
+	now := time.Date(2026, time.January, 14, 12, 30, 45, 0, time.UTC)
+	slot := time.Date(2026, time.January, 14, 12, 30, 0, 0, time.UTC).UnixMilli()
+	inboundTraffics := []*xray.Traffic{
+		{IsInbound: true, Tag: "inbound-443", Up: 100, Down: 1000},
+		// A second listen address counts towards its inbound
+		{IsInbound: true, Tag: xray.ListenAliasTag("inbound-443", 1), Up: 10, Down: 20},
+		{IsInbound: true, Tag: "inbound-8443", Up: 0, Down: 0},
+		{IsOutbound: true, Tag: "direct", Up: 5, Down: 5},
+	}
+	clientTraffics := []*xray.ClientTraffic{
+		{Email: "User@Example.com", Up: 30, Down: 300},
+		{Email: "user@example.com", Up: 1, Down: 2},
+		{Email: "idle@example.com"},
+	}
+
+	got := trafficSampleTotals(inboundTraffics, clientTraffics, now)
+	want := []*model.TrafficSample{
+		{Scope: TrafficScopeInbound, Key: "inbound-443", Up: 110, Down: 1020, Ts: slot},
+		// Client up and down are swapped to match ClientEntity
+		{Scope: TrafficScopeClient, Key: "user@example.com", Up: 302, Down: 31, Ts: slot},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("trafficSampleTotals() = %+v, want %+v", got, want)
+	}
+}
+
+func TestTrafficSampleTotalsIdleCycle(t *testing.T) {
+	got := trafficSampleTotals([]*xray.Traffic{{IsInbound: true, Tag: "inbound-443"}}, []*xray.ClientTraffic{{Email: "a@example.com"}}, time.Now())
+	if len(got) != 0 {
+		t.Fatalf("trafficSampleTotals() = %+v, want no samples for an idle cycle", got)
+	}
+}
+
+func TestTrafficSampleRetentionCutoff(t *testing.T) {
+	now := time.Date(2026, time.March, 10, 8, 0, 0, 0, time.UTC)
+	tests := []struct {
+		days int
+		want time.Time
+	}{
+		{30, time.Date(2026, time.February, 8, 8, 0, 0, 0, time.UTC)},
+		{1, time.Date(2026, time.March, 9, 8, 0, 0, 0, time.UTC)},
+		// With history disabled every sample up to now is pruned
+		{0, now},
+	}
+	for _, test := range tests {
+		if got := trafficSampleRetentionCutoff(now, test.days); got != test.want.UnixMilli() {
+			t.Errorf("trafficSampleRetentionCutoff(%d) = %v, want %v", test.days, time.UnixMilli(got).UTC(), test.want)
+		}
+	}
+}
@@ -2,10 +2,12 @@ package service
 
 import (
 	"errors"
+	"time"
 
 	"github.com/konstpic/sharx-code/v2/database"
 	"github.com/konstpic/sharx-code/v2/database/model"
 	"github.com/konstpic/sharx-code/v2/logger"
+	"github.com/konstpic/sharx-code/v2/util/common"
 	"github.com/konstpic/sharx-code/v2/util/crypto"
 	ldaputil "github.com/konstpic/sharx-code/v2/util/ldap"
 	"github.com/xlzd/gotp"
@@ -96,7 +98,7 @@ func (s *UserService) CheckUser(username string, password string, twoFactorCode
 			return nil
 		}
 
-		if gotp.NewDefaultTOTP(twoFactorToken).Now() != twoFactorCode {
+		if !verifyTOTP(twoFactorToken, twoFactorCode, time.Now()) {
 			return nil
 		}
 	}
@@ -104,6 +106,79 @@ func (s *UserService) CheckUser(username string, password string, twoFactorCode
 	return user
 }
 
+const (
+	// twoFactorIssuer and twoFactorAccount match the labels used by the settings page QR code.
+	twoFactorIssuer  = "SharX"
+	twoFactorAccount = "Administrator"
+	// twoFactorSkewSteps is the number of 30s time steps accepted before/after the current one.
+	twoFactorSkewSteps = 1
+)
+
+// verifyTOTP checks code against the TOTP of secret at now and the adjacent time windows,
+// tolerating small clock differences between the server and the authenticator app.
+func verifyTOTP(secret string, code string, now time.Time) bool {
+	if secret == "" || code == "" {
+		return false
+	}
+	totp := gotp.NewDefaultTOTP(secret)
+	for step := -twoFactorSkewSteps; step <= twoFactorSkewSteps; step++ {
+		if totp.AtTime(now.Add(time.Duration(step)*30*time.Second)) == code {
+			return true
+		}
+	}
+	return false
+}
+
+// GenerateTwoFactorSecret creates a new TOTP secret, stores it in twoFactorToken and returns
+// the secret with its otpauth:// URI for QR display. Two-factor authentication stays disabled
+// until the secret is confirmed with EnableTwoFactor.
+func (s *UserService) GenerateTwoFactorSecret() (string, string, error) {
+	twoFactorEnable, err := s.settingService.GetTwoFactorEnable()
+	if err != nil {
+		return "", "", err
+	}
+	if twoFactorEnable {
+		return "", "", common.NewError("two-factor authentication is already enabled, disable it first")
+	}
+
+	secret, uri := newTwoFactorSecret()
+	if err := s.settingService.SetTwoFactorToken(secret); err != nil {
+		return "", "", err
+	}
+	return secret, uri, nil
+}
+
+// newTwoFactorSecret returns a random TOTP secret and its otpauth:// provisioning URI.
+func newTwoFactorSecret() (string, string) {
+	secret := gotp.RandomSecret(16)
+	return secret, gotp.NewDefaultTOTP(secret).ProvisioningUri(twoFactorAccount, twoFactorIssuer)
+}
+
+// VerifyTwoFactor checks a TOTP code against the stored twoFactorToken,
+// accepting the current and adjacent time windows.
+func (s *UserService) VerifyTwoFactor(code string) (bool, error) {
+	twoFactorToken, err := s.settingService.GetTwoFactorToken()
+	if err != nil {
+		return false, err
+	}
+	if twoFactorToken == "" {
+		return false, common.NewError("two-factor secret is not set")
+	}
+	return verifyTOTP(twoFactorToken, code, time.Now()), nil
+}
+
+// EnableTwoFactor turns on two-factor authentication after verifying code against the stored secret.
+func (s *UserService) EnableTwoFactor(code string) error {
+	ok, err := s.VerifyTwoFactor(code)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return common.NewError("invalid two-factor code")
+	}
+	return s.settingService.SetTwoFactorEnable(true)
+}
+
 func (s *UserService) UpdateUser(id int, username string, password string) error {
 	db := database.GetDB()
 	hashedPassword, err := crypto.HashPasswordAsBcrypt(password)
@@ -0,0 +1,149 @@
+package service
+
+import (
+	"strings"
+
+	"github.com/konstpic/sharx-code/v2/database"
+	"github.com/konstpic/sharx-code/v2/database/model"
+	"github.com/konstpic/sharx-code/v2/util/common"
+	"github.com/konstpic/sharx-code/v2/util/crypto"
+)
+
+// UserInfo describes a panel user for user management, without the password hash.
+type UserInfo struct {
+	Id       int    `json:"id"`
+	Username string `json:"username"`
+	Role     string `json:"role"`
+	Primary  bool   `json:"primary"` // Whether this is the primary admin, which owns the panel data
+}
+
+// IsValidUserRole reports whether role is a known user role.
+func IsValidUserRole(role string) bool {
+	return role == model.UserRoleAdmin || role == model.UserRoleReadOnly
+}
+
+// GetRequestUsers returns the stored user with the given ID and the user its requests act on.
+// The panel data belongs to the primary admin (the first user), so requests of any other user
+// act on the data of the primary admin; for the primary admin both are the same user.
+// Users stored before roles were introduced are admins.
+func (s *UserService) GetRequestUsers(id int) (*model.User, *model.User, error) {
+	primary, err := s.GetFirstUser()
+	if err != nil {
+		return nil, nil, err
+	}
+	if primary.Role == "" {
+		primary.Role = model.UserRoleAdmin
+	}
+	if primary.Id == id {
+		return primary, primary, nil
+	}
+	user := &model.User{}
+	if err := database.GetDB().Where("id = ?", id).First(user).Error; err != nil {
+		return nil, nil, err
+	}
+	if user.Role == "" {
+		user.Role = model.UserRoleAdmin
+	}
+	return user, primary, nil
+}
+
+// GetUsers returns all panel users ordered by ID, the primary admin first.
+func (s *UserService) GetUsers() ([]UserInfo, error) {
+	var users []model.User
+	if err := database.GetDB().Order("id").Find(&users).Error; err != nil {
+		return nil, err
+	}
+	infos := make([]UserInfo, 0, len(users))
+	for i, user := range users {
+		role := user.Role
+		if role == "" {
+			role = model.UserRoleAdmin
+		}
+		infos = append(infos, UserInfo{Id: user.Id, Username: user.Username, Role: role, Primary: i == 0})
+	}
+	return infos, nil
+}
+
+// CreateUser adds a panel user with the given role, e.g. a read-only account for support staff.
+// The new user works on the data of the primary admin.
+func (s *UserService) CreateUser(username string, password string, role string) (*UserInfo, error) {
+	username = strings.TrimSpace(username)
+	if username == "" {
+		return nil, common.NewError("username can not be empty")
+	}
+	if password == "" {
+		return nil, common.NewError("password can not be empty")
+	}
+	if !IsValidUserRole(role) {
+		return nil, common.NewErrorf("invalid role %q: expected %s or %s", role, model.UserRoleAdmin, model.UserRoleReadOnly)
+	}
+
+	db := database.GetDB()
+	var count int64
+	if err := db.Model(model.User{}).Where("username = ?", username).Count(&count).Error; err != nil {
+		return nil, err
+	}
+	if count > 0 {
+		return nil, common.NewErrorf("username already exists: %s", username)
+	}
+	hashedPassword, err := crypto.HashPasswordAsBcrypt(password)
+	if err != nil {
+		return nil, err
+	}
+	user := &model.User{Username: username, Password: hashedPassword, Role: role}
+	if err := db.Create(user).Error; err != nil {
+		return nil, err
+	}
+	return &UserInfo{Id: user.Id, Username: user.Username, Role: user.Role}, nil
+}
+
+// UpdateUserRole changes the role of a user other than the primary admin.
+// The change applies to the next request of the user, including open sessions.
+func (s *UserService) UpdateUserRole(id int, role string) error {
+	if !IsValidUserRole(role) {
+		return common.NewErrorf("invalid role %q: expected %s or %s", role, model.UserRoleAdmin, model.UserRoleReadOnly)
+	}
+	if err := s.checkNotPrimary(id); err != nil {
+		return err
+	}
+	result := database.GetDB().Model(model.User{}).Where("id = ?", id).Update("role", role)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return common.NewCodedErrorf(common.ErrCodeNotFound, "User not found: %d", id)
+	}
+	return nil
+}
+
+// DeleteUser removes a user other than the primary admin together with its API tokens.
+// Open sessions of the user are rejected from the next request on.
+func (s *UserService) DeleteUser(id int) error {
+	if err := s.checkNotPrimary(id); err != nil {
+		return err
+	}
+	db := database.GetDB()
+	if err := db.Where("user_id = ?", id).Delete(&model.ApiToken{}).Error; err != nil {
+		return err
+	}
+	result := db.Where("id = ?", id).Delete(&model.User{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return common.NewCodedErrorf(common.ErrCodeNotFound, "User not found: %d", id)
+	}
+	return nil
+}
+
+// checkNotPrimary rejects changes to the primary admin, which must keep full access.
+func (s *UserService) checkNotPrimary(id int) error {
+	primary, err := s.GetFirstUser()
+	if err != nil {
+		return err
+	}
+	if primary.Id == id {
+		return common.NewError("the primary admin can not be changed or deleted")
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package service
+
+import (
+	"encoding/base32"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/xlzd/gotp"
+)
+
+func TestNewTwoFactorSecret(t *testing.T) {
+	secret, uri := newTwoFactorSecret()
+	if key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(secret); err != nil || len(key) != 16 {
+		t.Fatalf("secret %q is not 16 base32-encoded bytes: %v", secret, err)
+	}
+	if other, _ := newTwoFactorSecret(); other == secret {
+		t.Fatal("two provisioned secrets are equal")
+	}
+
+	parsed, err := url.Parse(uri)
+	if err != nil {
+		t.Fatalf("provisioning URI %q does not parse: %v", uri, err)
+	}
+	if parsed.Scheme != "otpauth" || parsed.Host != "totp" {
+		t.Errorf("provisioning URI %q is not an otpauth://totp URI", uri)
+	}
+	if query := parsed.Query(); query.Get("secret") != secret || query.Get("issuer") != twoFactorIssuer {
+		t.Errorf("provisioning URI %q does not carry the secret and issuer", uri)
+	}
+
+	// An authenticator app set up from the URI produces codes the server accepts
+	now := time.Now()
+	if !verifyTOTP(secret, gotp.NewDefaultTOTP(secret).AtTime(now), now) {
+		t.Error("code of the provisioned secret rejected")
+	}
+}
+
+func TestVerifyTOTPClockSkew(t *testing.T) {
+	const secret = "JBSWY3DPEHPK3PXP"
+	totp := gotp.NewDefaultTOTP(secret)
+	// Middle of a 30s time step, so ±30s lands in the adjacent steps
+	now := time.Unix(1767225615, 0)
+
+	tests := []struct {
+		name   string
+		offset time.Duration
+		want   bool
+	}{
+		{"current step", 0, true},
+		{"authenticator one step behind", -30 * time.Second, true},
+		{"authenticator one step ahead", 30 * time.Second, true},
+		{"authenticator two steps behind", -60 * time.Second, false},
+		{"authenticator two steps ahead", 60 * time.Second, false},
+	}
+	for _, test := range tests {
+		code := totp.AtTime(now.Add(test.offset))
+		if got := verifyTOTP(secret, code, now); got != test.want {
+			t.Errorf("%s: verifyTOTP() = %v, want %v", test.name, got, test.want)
+		}
+	}
+
+	if verifyTOTP(secret, "", now) || verifyTOTP("", totp.AtTime(now), now) {
+		t.Error("verifyTOTP() accepted an empty code or secret")
+	}
+	if verifyTOTP(secret, "12345a", now) {
+		t.Error("verifyTOTP() accepted a wrong code")
+	}
+}
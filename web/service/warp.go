@@ -2,6 +2,9 @@ package service
 
 import (
 	"bytes"
+	"crypto/ecdh"
+	"crypto/rand"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -12,6 +15,9 @@ import (
 	"github.com/konstpic/sharx-code/v2/util/common"
 )
 
+// warpAPIURL is the base URL of the Cloudflare Warp client API.
+var warpAPIURL = "https://api.cloudflareclient.com/v0a2158"
+
 // WarpService provides business logic for Cloudflare WARP integration.
 // It manages WARP configuration and connectivity settings.
 type WarpService struct {
@@ -45,7 +51,7 @@ func (s *WarpService) GetWarpConfig() (string, error) {
 		return "", err
 	}
 
-	url := fmt.Sprintf("https://api.cloudflareclient.com/v0a2158/reg/%s", warpData["device_id"])
+	url := fmt.Sprintf("%s/reg/%s", warpAPIURL, warpData["device_id"])
 
 	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
@@ -69,15 +75,30 @@ func (s *WarpService) GetWarpConfig() (string, error) {
 }
 
 func (s *WarpService) RegWarp(secretKey string, publicKey string) (string, error) {
+	warpData, config, err := registerWarpDevice(secretKey, publicKey)
+	if err != nil {
+		return "", err
+	}
+
+	s.SettingService.SetWarp(warpData)
+
+	result := fmt.Sprintf("{\n  \"data\": %s,\n  \"config\": %s\n}", warpData, config)
+
+	return result, nil
+}
+
+// registerWarpDevice registers a device with the wireguard public key at Cloudflare. It returns
+// the Warp data to store (credentials, license and secretKey) and the account config.
+func registerWarpDevice(secretKey string, publicKey string) (string, string, error) {
 	tos := time.Now().UTC().Format("2006-01-02T15:04:05.000Z")
 	hostName, _ := os.Hostname()
 	data := fmt.Sprintf(`{"key":"%s","tos":"%s","type": "PC","model": "x-ui", "name": "%s"}`, publicKey, tos, hostName)
 
-	url := "https://api.cloudflareclient.com/v0a2158/reg"
+	url := warpAPIURL + "/reg"
 
 	req, err := http.NewRequest("POST", url, bytes.NewBuffer([]byte(data)))
 	if err != nil {
-		return "", err
+		return "", "", err
 	}
 
 	req.Header.Add("CF-Client-Version", "a-7.21-0721")
@@ -86,51 +107,96 @@ func (s *WarpService) RegWarp(secretKey string, publicKey string) (string, error
 	client := &http.Client{}
 	resp, err := client.Do(req)
 	if err != nil {
-		return "", err
+		return "", "", err
 	}
 	defer resp.Body.Close()
 	buffer := &bytes.Buffer{}
 	_, err = buffer.ReadFrom(resp.Body)
 	if err != nil {
-		return "", err
+		return "", "", err
 	}
 
 	var rspData map[string]any
 	err = json.Unmarshal(buffer.Bytes(), &rspData)
 	if err != nil {
-		return "", err
+		return "", "", err
 	}
 
-	deviceId := rspData["id"].(string)
-	token := rspData["token"].(string)
-	license, ok := rspData["account"].(map[string]any)["license"].(string)
+	deviceId, ok := rspData["id"].(string)
+	if !ok {
+		return "", "", common.NewError("warp registration failed:", buffer.String())
+	}
+	token, ok := rspData["token"].(string)
+	if !ok {
+		return "", "", common.NewError("warp registration failed:", buffer.String())
+	}
+	account, _ := rspData["account"].(map[string]any)
+	license, ok := account["license"].(string)
 	if !ok {
 		logger.Debug("Error accessing license value.")
-		return "", err
+		return "", "", common.NewError("warp registration failed:", buffer.String())
 	}
 
 	warpData := fmt.Sprintf("{\n  \"access_token\": \"%s\",\n  \"device_id\": \"%s\",", token, deviceId)
 	warpData += fmt.Sprintf("\n  \"license_key\": \"%s\",\n  \"private_key\": \"%s\"\n}", license, secretKey)
 
-	s.SettingService.SetWarp(warpData)
+	return warpData, buffer.String(), nil
+}
 
-	result := fmt.Sprintf("{\n  \"data\": %s,\n  \"config\": %s\n}", warpData, buffer.String())
+// Register creates a new Warp account with a server-generated wireguard key pair and stores
+// the credentials. When licenseKey is not empty the account is upgraded to WARP+ with it.
+// It returns the stored data and the account config in the same format as RegWarp.
+func (s *WarpService) Register(licenseKey string) (string, error) {
+	privateKey, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return "", err
+	}
+	secretKey := base64.StdEncoding.EncodeToString(privateKey.Bytes())
+	publicKey := base64.StdEncoding.EncodeToString(privateKey.PublicKey().Bytes())
 
-	return result, nil
+	result, err := s.RegWarp(secretKey, publicKey)
+	if err != nil {
+		return "", err
+	}
+	if licenseKey == "" {
+		return result, nil
+	}
+
+	warpData, err := s.SetWarpLicense(licenseKey)
+	if err != nil {
+		return "", err
+	}
+	config, err := s.GetWarpConfig()
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("{\n  \"data\": %s,\n  \"config\": %s\n}", warpData, config), nil
 }
 
 func (s *WarpService) SetWarpLicense(license string) (string, error) {
-	var warpData map[string]string
 	warp, err := s.SettingService.GetWarp()
 	if err != nil {
 		return "", err
 	}
-	err = json.Unmarshal([]byte(warp), &warpData)
+	newWarpData, err := applyWarpLicense(warp, license)
 	if err != nil {
 		return "", err
 	}
+	s.SettingService.SetWarp(newWarpData)
 
-	url := fmt.Sprintf("https://api.cloudflareclient.com/v0a2158/reg/%s/account", warpData["device_id"])
+	return newWarpData, nil
+}
+
+// applyWarpLicense upgrades the Warp account of the stored warpData to WARP+ with license
+// and returns the Warp data to store with the new license key.
+func applyWarpLicense(warp string, license string) (string, error) {
+	var warpData map[string]string
+	err := json.Unmarshal([]byte(warp), &warpData)
+	if err != nil {
+		return "", err
+	}
+
+	url := fmt.Sprintf("%s/reg/%s/account", warpAPIURL, warpData["device_id"])
 	data := fmt.Sprintf(`{"license": "%s"}`, license)
 
 	req, err := http.NewRequest("PUT", url, bytes.NewBuffer([]byte(data)))
@@ -158,7 +224,10 @@ func (s *WarpService) SetWarpLicense(license string) (string, error) {
 	}
 	if response["success"] == false {
 		errorArr, _ := response["errors"].([]any)
-		errorObj := errorArr[0].(map[string]any)
+		if len(errorArr) == 0 {
+			return "", common.NewError("warp license rejected:", buffer.String())
+		}
+		errorObj, _ := errorArr[0].(map[string]any)
 		return "", common.NewError(errorObj["code"], errorObj["message"])
 	}
 
@@ -167,7 +236,196 @@ func (s *WarpService) SetWarpLicense(license string) (string, error) {
 	if err != nil {
 		return "", err
 	}
-	s.SettingService.SetWarp(string(newWarpData))
-
 	return string(newWarpData), nil
 }
+
+// warpOutboundTag is the tag of the wireguard outbound generated from the stored Warp credentials.
+const warpOutboundTag = "warp"
+
+// warpRegistration is the part of the Cloudflare registration response needed to build the outbound.
+type warpRegistration struct {
+	Config struct {
+		ClientId  string `json:"client_id"`
+		Interface struct {
+			Addresses struct {
+				V4 string `json:"v4"`
+				V6 string `json:"v6"`
+			} `json:"addresses"`
+		} `json:"interface"`
+		Peers []struct {
+			PublicKey string `json:"public_key"`
+			Endpoint  struct {
+				Host string `json:"host"`
+			} `json:"endpoint"`
+		} `json:"peers"`
+	} `json:"config"`
+}
+
+// BuildWarpOutbound builds the Xray wireguard outbound (tagged "warp") from the stored
+// Warp data (private key) and the Cloudflare registration response (addresses, peer, reserved).
+func (s *WarpService) BuildWarpOutbound(warpData string, registration string) (map[string]any, error) {
+	var data map[string]string
+	if err := json.Unmarshal([]byte(warpData), &data); err != nil {
+		return nil, common.NewError("invalid warp data:", err)
+	}
+	if data["private_key"] == "" {
+		return nil, common.NewError("warp data has no private key")
+	}
+
+	var reg warpRegistration
+	if err := json.Unmarshal([]byte(registration), &reg); err != nil {
+		return nil, common.NewError("invalid warp config:", err)
+	}
+	if len(reg.Config.Peers) == 0 {
+		return nil, common.NewError("warp config has no peers")
+	}
+
+	addresses := make([]string, 0, 2)
+	if reg.Config.Interface.Addresses.V4 != "" {
+		addresses = append(addresses, reg.Config.Interface.Addresses.V4+"/32")
+	}
+	if reg.Config.Interface.Addresses.V6 != "" {
+		addresses = append(addresses, reg.Config.Interface.Addresses.V6+"/128")
+	}
+	if len(addresses) == 0 {
+		return nil, common.NewError("warp config has no interface addresses")
+	}
+
+	clientId, err := base64.StdEncoding.DecodeString(reg.Config.ClientId)
+	if err != nil {
+		return nil, common.NewError("invalid warp client id:", err)
+	}
+	reserved := make([]int, len(clientId))
+	for i, b := range clientId {
+		reserved[i] = int(b)
+	}
+
+	peer := reg.Config.Peers[0]
+	return map[string]any{
+		"tag":      warpOutboundTag,
+		"protocol": "wireguard",
+		"settings": map[string]any{
+			"mtu":            1420,
+			"secretKey":      data["private_key"],
+			"address":        addresses,
+			"reserved":       reserved,
+			"domainStrategy": "ForceIP",
+			"peers": []any{
+				map[string]any{
+					"publicKey": peer.PublicKey,
+					"endpoint":  peer.Endpoint.Host,
+				},
+			},
+			"noKernelTun": false,
+		},
+	}, nil
+}
+
+// EnableWarp injects the Warp wireguard outbound into the Xray template config and routes
+// the given domains (e.g. "geosite:openai") through it. An existing "warp" outbound and its
+// routing rules are replaced.
+func (s *WarpService) EnableWarp(domains []string) error {
+	warpData, err := s.SettingService.GetWarp()
+	if err != nil {
+		return err
+	}
+	if warpData == "" {
+		return common.NewError("warp is not registered")
+	}
+	registration, err := s.GetWarpConfig()
+	if err != nil {
+		return err
+	}
+	outbound, err := s.BuildWarpOutbound(warpData, registration)
+	if err != nil {
+		return err
+	}
+
+	config, err := s.getTemplateConfig()
+	if err != nil {
+		return err
+	}
+	outbounds := removeWarpOutbound(config)
+	config["outbounds"] = append(outbounds, outbound)
+
+	rules := removeWarpRules(config)
+	if len(domains) > 0 {
+		rules = append(rules, map[string]any{
+			"type":        "field",
+			"outboundTag": warpOutboundTag,
+			"domain":      domains,
+		})
+	}
+	setRoutingRules(config, rules)
+
+	return s.saveTemplateConfig(config)
+}
+
+// DisableWarp removes the Warp outbound and every routing rule pointing to it from the Xray template config.
+// The stored Warp credentials are kept.
+func (s *WarpService) DisableWarp() error {
+	config, err := s.getTemplateConfig()
+	if err != nil {
+		return err
+	}
+	config["outbounds"] = removeWarpOutbound(config)
+	setRoutingRules(config, removeWarpRules(config))
+	return s.saveTemplateConfig(config)
+}
+
+func (s *WarpService) getTemplateConfig() (map[string]any, error) {
+	templateConfig, err := s.SettingService.GetXrayConfigTemplate()
+	if err != nil {
+		return nil, err
+	}
+	config := map[string]any{}
+	if err := json.Unmarshal([]byte(templateConfig), &config); err != nil {
+		return nil, common.NewError("xray template config invalid:", err)
+	}
+	return config, nil
+}
+
+func (s *WarpService) saveTemplateConfig(config map[string]any) error {
+	newConfig, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return err
+	}
+	xraySettingService := XraySettingService{}
+	return xraySettingService.SaveXraySetting(string(newConfig))
+}
+
+// removeWarpOutbound returns the template outbounds without the "warp" outbound.
+func removeWarpOutbound(config map[string]any) []any {
+	outbounds, _ := config["outbounds"].([]any)
+	result := make([]any, 0, len(outbounds))
+	for _, o := range outbounds {
+		if ob, ok := o.(map[string]any); ok && ob["tag"] == warpOutboundTag {
+			continue
+		}
+		result = append(result, o)
+	}
+	return result
+}
+
+// removeWarpRules returns the template routing rules without the rules sending traffic to "warp".
+func removeWarpRules(config map[string]any) []any {
+	routing, _ := config["routing"].(map[string]any)
+	rules, _ := routing["rules"].([]any)
+	result := make([]any, 0, len(rules))
+	for _, r := range rules {
+		if rule, ok := r.(map[string]any); ok && rule["outboundTag"] == warpOutboundTag {
+			continue
+		}
+		result = append(result, r)
+	}
+	return result
+}
+
+func setRoutingRules(config map[string]any, rules []any) {
+	routing, ok := config["routing"].(map[string]any)
+	if !ok {
+		routing = map[string]any{}
+		config["routing"] = routing
+	}
+	routing["rules"] = rules
+}
@@ -0,0 +1,195 @@
+package service
+
+import (
+	"crypto/ecdh"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/xtls/xray-core/infra/conf"
+)
+
+// testWarpData returns stored Warp data with a fresh private key.
+func testWarpData(t *testing.T) string {
+	t.Helper()
+	key, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return `{"access_token":"token","device_id":"device","license_key":"license","private_key":"` +
+		base64.StdEncoding.EncodeToString(key.Bytes()) + `"}`
+}
+
+// testWarpRegistration is a Cloudflare registration response as returned by GetWarpConfig.
+const testWarpRegistration = `{
+	"id": "device",
+	"config": {
+		"client_id": "AQID",
+		"interface": {"addresses": {"v4": "172.16.0.2", "v6": "2606:4700:110:8a36::2"}},
+		"peers": [{
+			"public_key": "bmXOC+F1FxEMF9dyiK2H5/1SUtzH0JuVo51h2wPfgyo=",
+			"endpoint": {"host": "engage.cloudflareclient.com:2408"}
+		}]
+	}
+}`
+
+func TestBuildWarpOutbound(t *testing.T) {
+	outbound, err := (&WarpService{}).BuildWarpOutbound(testWarpData(t), testWarpRegistration)
+	if err != nil {
+		t.Fatalf("BuildWarpOutbound() failed: %v", err)
+	}
+
+	raw, err := json.Marshal(outbound)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The outbound must be accepted by Xray itself
+	detour := &conf.OutboundDetourConfig{}
+	if err := json.Unmarshal(raw, detour); err != nil {
+		t.Fatalf("outbound %s is not an Xray outbound: %v", raw, err)
+	}
+	if _, err := detour.Build(); err != nil {
+		t.Fatalf("Xray rejected outbound %s: %v", raw, err)
+	}
+
+	settings := outbound["settings"].(map[string]any)
+	if outbound["tag"] != "warp" || outbound["protocol"] != "wireguard" {
+		t.Fatalf("outbound = %s, want a wireguard outbound tagged warp", raw)
+	}
+	if want := []string{"172.16.0.2/32", "2606:4700:110:8a36::2/128"}; !reflect.DeepEqual(settings["address"], want) {
+		t.Errorf("address = %v, want %v", settings["address"], want)
+	}
+	// client_id "AQID" is the base64 of the reserved bytes 1, 2, 3
+	if want := []int{1, 2, 3}; !reflect.DeepEqual(settings["reserved"], want) {
+		t.Errorf("reserved = %v, want %v", settings["reserved"], want)
+	}
+}
+
+func TestBuildWarpOutboundRejectsIncompleteData(t *testing.T) {
+	tests := []struct {
+		name         string
+		warpData     string
+		registration string
+	}{
+		{"no private key", `{"device_id":"device"}`, testWarpRegistration},
+		{"invalid data", `{`, testWarpRegistration},
+		{"no peers", testWarpData(t), `{"config":{"client_id":"AQID","interface":{"addresses":{"v4":"172.16.0.2"}}}}`},
+		{"no addresses", testWarpData(t), `{"config":{"client_id":"AQID","peers":[{"public_key":"key"}]}}`},
+		{"invalid client id", testWarpData(t), `{"config":{"client_id":"!","interface":{"addresses":{"v4":"172.16.0.2"}},"peers":[{"public_key":"key"}]}}`},
+	}
+	for _, test := range tests {
+		if _, err := (&WarpService{}).BuildWarpOutbound(test.warpData, test.registration); err == nil {
+			t.Errorf("%s: BuildWarpOutbound() succeeded", test.name)
+		}
+	}
+}
+
+func TestRemoveWarpOutboundAndRules(t *testing.T) {
+	config := map[string]any{}
+	if err := json.Unmarshal([]byte(`{
+		"outbounds": [{"tag": "direct"}, {"tag": "warp"}],
+		"routing": {"rules": [
+			{"outboundTag": "warp", "domain": ["geosite:openai"]},
+			{"outboundTag": "blocked", "protocol": ["bittorrent"]}
+		]}
+	}`), &config); err != nil {
+		t.Fatal(err)
+	}
+
+	outbounds := removeWarpOutbound(config)
+	if len(outbounds) != 1 || outbounds[0].(map[string]any)["tag"] != "direct" {
+		t.Errorf("outbounds = %v, want only direct", outbounds)
+	}
+	rules := removeWarpRules(config)
+	if len(rules) != 1 || rules[0].(map[string]any)["outboundTag"] != "blocked" {
+		t.Errorf("rules = %v, want only the blocked rule", rules)
+	}
+
+	empty := map[string]any{}
+	setRoutingRules(empty, removeWarpRules(empty))
+	if rules := empty["routing"].(map[string]any)["rules"].([]any); len(rules) != 0 {
+		t.Errorf("rules of a config without routing = %v, want none", rules)
+	}
+}
+
+// stubWarpAPI serves a fake Cloudflare Warp API for the rest of the test. A device registration
+// returns a free account; a license other than "WARP-PLUS" is rejected.
+func stubWarpAPI(t *testing.T) {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		var payload map[string]string
+		json.Unmarshal(body, &payload)
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/reg":
+			io.WriteString(w, `{"id":"device-1","token":"token-1","account":{"license":"free-license","warp_plus":false},`+
+				`"config":{"client_id":"AQID","peers":[{"public_key":"peer-key"}]},"key":"`+payload["key"]+`"}`)
+		case r.Method == http.MethodPut && r.URL.Path == "/reg/device-1/account":
+			if r.Header.Get("Authorization") != "Bearer token-1" || payload["license"] != "WARP-PLUS" {
+				io.WriteString(w, `{"success":false,"errors":[{"code":1001,"message":"Invalid license"}]}`)
+				return
+			}
+			io.WriteString(w, `{"success":true,"result":{"warp_plus":true}}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	previous := warpAPIURL
+	warpAPIURL = server.URL
+	t.Cleanup(func() { warpAPIURL = previous })
+}
+
+func TestRegisterWarpDevice(t *testing.T) {
+	stubWarpAPI(t)
+
+	warpData, config, err := registerWarpDevice("secret-key", "public-key")
+	if err != nil {
+		t.Fatalf("registerWarpDevice() failed: %v", err)
+	}
+	var stored map[string]string
+	if err := json.Unmarshal([]byte(warpData), &stored); err != nil {
+		t.Fatalf("stored warp data %q is not JSON: %v", warpData, err)
+	}
+	want := map[string]string{
+		"access_token": "token-1",
+		"device_id":    "device-1",
+		"license_key":  "free-license",
+		"private_key":  "secret-key",
+	}
+	if !reflect.DeepEqual(stored, want) {
+		t.Fatalf("stored warp data = %v, want %v", stored, want)
+	}
+	// The registration sends the public key only
+	if !strings.Contains(config, `"key":"public-key"`) {
+		t.Fatalf("registration did not send the public key: %s", config)
+	}
+}
+
+func TestApplyWarpLicense(t *testing.T) {
+	stubWarpAPI(t)
+	free := `{"access_token":"token-1","device_id":"device-1","license_key":"free-license","private_key":"secret-key"}`
+
+	warpData, err := applyWarpLicense(free, "WARP-PLUS")
+	if err != nil {
+		t.Fatalf("applyWarpLicense() failed: %v", err)
+	}
+	var stored map[string]string
+	if err := json.Unmarshal([]byte(warpData), &stored); err != nil {
+		t.Fatal(err)
+	}
+	if stored["license_key"] != "WARP-PLUS" || stored["private_key"] != "secret-key" || stored["device_id"] != "device-1" {
+		t.Fatalf("stored warp data = %v, want the WARP+ license and the original credentials", stored)
+	}
+
+	if _, err := applyWarpLicense(free, "bogus"); err == nil || !strings.Contains(err.Error(), "Invalid license") {
+		t.Fatalf("applyWarpLicense() with a rejected license = %v, want the API error", err)
+	}
+}
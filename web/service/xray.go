@@ -4,11 +4,16 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"net"
 	"runtime"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/konstpic/sharx-code/v2/database/model"
 	"github.com/konstpic/sharx-code/v2/logger"
+	"github.com/konstpic/sharx-code/v2/util/common"
+	"github.com/konstpic/sharx-code/v2/util/json_util"
 	"github.com/konstpic/sharx-code/v2/xray"
 
 	"go.uber.org/atomic"
@@ -23,8 +28,15 @@ var (
 	// API connection pool: map[apiPort]*xray.XrayAPI
 	apiConnectionPool sync.Map
 	apiPoolLock       sync.Mutex
+	// Pending debounced restart of RestartXrayAsync
+	restartDebounceLock  sync.Mutex
+	restartDebounceTimer *time.Timer
 )
 
+// restartDebounceDelay is how long RestartXrayAsync waits for further restart requests
+// before restarting Xray.
+var restartDebounceDelay = 2 * time.Second
+
 // XrayService provides business logic for Xray process management.
 // It handles starting, stopping, restarting Xray, and managing its configuration.
 // In multi-node mode, it sends configurations to nodes instead of running Xray locally.
@@ -144,6 +156,14 @@ func (s *XrayService) GetXrayErr() error {
 	return err
 }
 
+// GetRecentXrayLogs returns up to count of the most recent lines of Xray output, oldest first.
+func (s *XrayService) GetRecentXrayLogs(count int) []string {
+	if p == nil {
+		return []string{}
+	}
+	return p.GetRecentLogs(count)
+}
+
 // GetXrayResult returns the result string from the Xray process.
 func (s *XrayService) GetXrayResult() string {
 	if result != "" {
@@ -175,10 +195,154 @@ func (s *XrayService) GetXrayVersion() string {
 	return p.GetVersion()
 }
 
-// RemoveIndex removes an element at the specified index from a slice.
-// Returns a new slice with the element removed.
-func RemoveIndex(s []any, index int) []any {
-	return append(s[:index], s[index+1:]...)
+// removeDisabledClients returns the clients whose traffic record is not disabled
+// (expired or over the traffic limit). The input slice is left untouched.
+func removeDisabledClients(clients []any, clientStats []xray.ClientTraffic, logRemoved bool) []any {
+	disabled := make(map[string]bool, len(clientStats))
+	for _, clientTraffic := range clientStats {
+		if !clientTraffic.Enable {
+			disabled[clientTraffic.Email] = true
+		}
+	}
+	if len(disabled) == 0 {
+		return clients
+	}
+
+	filtered := make([]any, 0, len(clients))
+	for _, client := range clients {
+		c, ok := client.(map[string]any)
+		if ok {
+			if email, _ := c["email"].(string); disabled[email] {
+				if logRemoved {
+					logger.Infof("Remove Inbound User %s due to expiration or traffic limit", email)
+				}
+				continue
+			}
+		}
+		filtered = append(filtered, client)
+	}
+	return filtered
+}
+
+// coreLogLevels maps the coreLogLevel setting to Xray log levels.
+var coreLogLevels = map[string]string{
+	"none":    "none",
+	"error":   "error",
+	"warn":    "warning",
+	"warning": "warning",
+	"info":    "info",
+	"debug":   "debug",
+}
+
+// applyCoreLogLevel overrides the log level of config with the coreLogLevel setting.
+// An empty setting keeps the template's level; unknown values fall back to warning.
+func (s *XrayService) applyCoreLogLevel(config *xray.Config) error {
+	level, err := s.settingService.GetCoreLogLevel()
+	if err != nil || level == "" {
+		return err
+	}
+	return setCoreLogLevel(config, level)
+}
+
+// setCoreLogLevel sets the log level of config to the Xray name of level.
+func setCoreLogLevel(config *xray.Config, level string) error {
+	xrayLevel, ok := coreLogLevels[strings.ToLower(strings.TrimSpace(level))]
+	if !ok {
+		logger.Warningf("Invalid coreLogLevel %q, falling back to warning", level)
+		xrayLevel = "warning"
+	}
+
+	logConfig := map[string]any{}
+	if len(config.LogConfig) > 0 {
+		if err := json.Unmarshal(config.LogConfig, &logConfig); err != nil {
+			return err
+		}
+	}
+	logConfig["loglevel"] = xrayLevel
+	raw, err := json.Marshal(logConfig)
+	if err != nil {
+		return err
+	}
+	config.LogConfig = raw
+	return nil
+}
+
+// applyCoreAPIPort moves the API inbound of config to the coreApiPort setting, adding the
+// api section, API inbound and routing rule when the template lacks them. A setting of 0 keeps
+// the template's API inbound. Whether the port is free is only checked when the core is
+// started, see checkCoreAPIPort.
+func (s *XrayService) applyCoreAPIPort(config *xray.Config) error {
+	port, err := s.settingService.GetCoreAPIPort()
+	if err != nil || port == 0 {
+		return err
+	}
+	return setCoreAPIPort(config, port)
+}
+
+// setCoreAPIPort moves the API inbound of config to port, see applyCoreAPIPort.
+func setCoreAPIPort(config *xray.Config, port int) error {
+	if port < 0 || port > 65535 {
+		return common.NewErrorf("invalid core API port: %d", port)
+	}
+
+	found := false
+	for i := range config.InboundConfigs {
+		if config.InboundConfigs[i].Tag == "api" {
+			config.InboundConfigs[i].Port = port
+			found = true
+		}
+	}
+	if !found {
+		config.InboundConfigs = append([]xray.InboundConfig{{
+			Listen:   json_util.RawMessage(`"127.0.0.1"`),
+			Port:     port,
+			Protocol: "tunnel",
+			Settings: json_util.RawMessage(`{"address":"127.0.0.1"}`),
+			Tag:      "api",
+		}}, config.InboundConfigs...)
+	}
+
+	if len(config.API) == 0 || string(config.API) == "null" {
+		config.API = json_util.RawMessage(`{"tag":"api","services":["HandlerService","LoggerService","StatsService"]}`)
+	}
+
+	routing := map[string]any{}
+	if len(config.RouterConfig) > 0 {
+		if err := json.Unmarshal(config.RouterConfig, &routing); err != nil {
+			return err
+		}
+	}
+	rules, _ := routing["rules"].([]any)
+	for _, rule := range rules {
+		if r, ok := rule.(map[string]any); ok && r["outboundTag"] == "api" {
+			return nil
+		}
+	}
+	apiRule := map[string]any{"type": "field", "inboundTag": []any{"api"}, "outboundTag": "api"}
+	routing["rules"] = append([]any{apiRule}, rules...)
+	raw, err := json.Marshal(routing)
+	if err != nil {
+		return err
+	}
+	config.RouterConfig = raw
+	return nil
+}
+
+// checkCoreAPIPort checks that the coreApiPort setting is free before the core is started,
+// unless the running Xray already uses it.
+func (s *XrayService) checkCoreAPIPort() error {
+	port, err := s.settingService.GetCoreAPIPort()
+	if err != nil || port <= 0 {
+		return err
+	}
+	if p != nil && p.IsRunning() && p.GetAPIPort() == port {
+		return nil
+	}
+	listener, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+	if err != nil {
+		return common.NewErrorf("core API port %d is not available: %v", port, err)
+	}
+	return listener.Close()
 }
 
 // GetXrayConfig retrieves and builds the Xray configuration from settings and inbounds.
@@ -203,37 +367,36 @@ func (s *XrayService) GetXrayConfig() (*xray.Config, error) {
 		logger.Debugf("[DEBUG-AGENT] GetXrayConfig: failed to unmarshal template JSON: %v", err)
 		return nil, err
 	}
+	if err := s.applyCoreLogLevel(xrayConfig); err != nil {
+		logger.Warning("Failed to apply core log level:", err)
+	}
+	if err := s.applyCoreAPIPort(xrayConfig); err != nil {
+		return nil, err
+	}
 
 	s.inboundService.AddTraffic(nil, nil)
 
-	inbounds, err := s.inboundService.GetAllInbounds()
+	inbounds, err := s.inboundService.GetEnabledInbounds()
 	if err != nil {
 		return nil, err
 	}
+	if err := appendInboundConfigs(xrayConfig, inbounds); err != nil {
+		return nil, err
+	}
+	return xrayConfig, nil
+}
+
+// appendInboundConfigs adds the Xray configs of inbounds to config, stripped of disabled clients
+// and panel-only stream settings, along with their source country rules.
+func appendInboundConfigs(config *xray.Config, inbounds []*model.Inbound) error {
 	for _, inbound := range inbounds {
-		if !inbound.Enable {
-			continue
-		}
 		// get settings clients
 		settings := map[string]any{}
 		json.Unmarshal([]byte(inbound.Settings), &settings)
 		clients, ok := settings["clients"].([]any)
 		if ok {
 			// check users active or not
-			clientStats := inbound.ClientStats
-			for _, clientTraffic := range clientStats {
-				indexDecrease := 0
-				for index, client := range clients {
-					c := client.(map[string]any)
-					if c["email"] == clientTraffic.Email {
-						if !clientTraffic.Enable {
-							clients = RemoveIndex(clients, index-indexDecrease)
-							indexDecrease++
-							logger.Infof("Remove Inbound User %s due to expiration or traffic limit", c["email"])
-						}
-					}
-				}
-			}
+			clients = removeDisabledClients(clients, inbound.ClientStats, true)
 
 			// clear client config for additional parameters
 			var final_clients []any
@@ -258,7 +421,7 @@ func (s *XrayService) GetXrayConfig() (*xray.Config, error) {
 			settings["clients"] = final_clients
 			modifiedSettings, err := json.MarshalIndent(settings, "", "  ")
 			if err != nil {
-				return nil, err
+				return err
 			}
 
 			inbound.Settings = string(modifiedSettings)
@@ -284,15 +447,16 @@ func (s *XrayService) GetXrayConfig() (*xray.Config, error) {
 
 			newStream, err := json.MarshalIndent(stream, "", "  ")
 			if err != nil {
-				return nil, err
+				return err
 			}
 			inbound.StreamSettings = string(newStream)
 		}
 
-		inboundConfig := inbound.GenXrayInboundConfig()
-		xrayConfig.InboundConfigs = append(xrayConfig.InboundConfigs, *inboundConfig)
+		for _, inboundConfig := range inbound.GenXrayInboundConfigs() {
+			config.InboundConfigs = append(config.InboundConfigs, *inboundConfig)
+		}
 	}
-	return xrayConfig, nil
+	return applySourceCountryRules(config, inbounds)
 }
 
 // GetXrayTraffic fetches the current traffic statistics from the running Xray process.
@@ -319,11 +483,22 @@ func (s *XrayService) GetXrayTraffic() ([]*xray.Traffic, []*xray.ClientTraffic,
 
 // RestartXray restarts the Xray process, optionally forcing a restart even if config unchanged.
 // In multi-node mode, it sends configurations to nodes instead of restarting local Xray.
+// While restarts are deferred (see DeferRestarts), a non-forced restart is only remembered.
 func (s *XrayService) RestartXray(isForce bool) error {
+	if s.deferRestart(isForce) {
+		return nil
+	}
+	return runXrayRestart(s, isForce)
+}
+
+// restartXray restarts the Xray process regardless of a deferred restart window.
+func (s *XrayService) restartXray(isForce bool) error {
 	lock.Lock()
 	defer lock.Unlock()
 	logger.Debug("restart Xray, force:", isForce)
 	isManuallyStopped.Store(false)
+	// This restart applies everything requested during a deferred restart window
+	isRestartPending.Store(false)
 
 	// Check if multi-node mode is enabled
 	multiMode, err := s.settingService.GetMultiNodeMode()
@@ -346,6 +521,12 @@ func (s *XrayService) RestartXray(isForce bool) error {
 			logger.Debug("It does not need to restart Xray")
 			return nil
 		}
+	}
+	if err := s.checkCoreAPIPort(); err != nil {
+		return err
+	}
+
+	if s.IsXrayRunning() {
 		// Close API connections before stopping Xray
 		s.CloseAPIConnections()
 		p.Stop()
@@ -363,19 +544,68 @@ func (s *XrayService) RestartXray(isForce bool) error {
 
 // RestartXrayAsync restarts Xray asynchronously in a goroutine.
 // This is useful when you don't want to block the HTTP response waiting for configs to be sent to nodes.
-// Errors are logged but not returned.
+// Non-forced restarts are debounced: requests arriving within restartDebounceDelay of each other
+// collapse into a single restart once they settle. A forced restart runs immediately and
+// replaces a pending debounced one. Errors are logged but not returned.
 func (s *XrayService) RestartXrayAsync(isForce bool) {
-	go func() {
-		if err := s.RestartXray(isForce); err != nil {
-			logger.Warningf("Failed to restart Xray asynchronously: %v", err)
-		} else {
-			logger.Debug("Xray restarted asynchronously")
+	restartDebounceLock.Lock()
+	defer restartDebounceLock.Unlock()
+	if restartDebounceTimer != nil {
+		restartDebounceTimer.Stop()
+		restartDebounceTimer = nil
+	}
+	if isForce {
+		go s.runAsyncRestart(true)
+		return
+	}
+	var timer *time.Timer
+	timer = time.AfterFunc(restartDebounceDelay, func() {
+		restartDebounceLock.Lock()
+		if restartDebounceTimer != timer {
+			// Replaced by a later request
+			restartDebounceLock.Unlock()
+			return
 		}
-	}()
+		restartDebounceTimer = nil
+		restartDebounceLock.Unlock()
+		s.runAsyncRestart(false)
+	})
+	restartDebounceTimer = timer
+}
+
+// runAsyncRestart restarts Xray and logs the outcome.
+func (s *XrayService) runAsyncRestart(isForce bool) {
+	if err := s.RestartXray(isForce); err != nil {
+		logger.Warningf("Failed to restart Xray asynchronously: %v", err)
+	} else {
+		logger.Debug("Xray restarted asynchronously")
+	}
 }
 
 // restartXrayMultiMode handles Xray restart in multi-node mode by sending configs to nodes.
 func (s *XrayService) restartXrayMultiMode(isForce bool) error {
+	return s.pushConfigToNodes(0)
+}
+
+// ResyncNode rebuilds the latest config of a single node and pushes it to that node on demand,
+// e.g. after the node missed a push while it was unreachable.
+func (s *XrayService) ResyncNode(nodeId int) error {
+	lock.Lock()
+	defer lock.Unlock()
+
+	multiMode, err := s.settingService.GetMultiNodeMode()
+	if err != nil {
+		return err
+	}
+	if !multiMode {
+		return errors.New("resync is only available in multi-node mode")
+	}
+	return s.pushConfigToNodes(nodeId)
+}
+
+// pushConfigToNodes builds the config of every node from its assigned inbounds and sends it to the nodes.
+// When onlyNodeId is set, only that node gets its config and the push error is returned as is.
+func (s *XrayService) pushConfigToNodes(onlyNodeId int) error {
 	// Initialize nodeService if not already initialized
 	if s.nodeService == (NodeService{}) {
 		s.nodeService = NodeService{}
@@ -389,7 +619,7 @@ func (s *XrayService) restartXrayMultiMode(isForce bool) error {
 
 	// Group inbounds by node
 	nodeInbounds := make(map[int][]*model.Inbound)
-	allInbounds, err := s.inboundService.GetAllInbounds()
+	allInbounds, err := s.inboundService.GetEnabledInbounds()
 	if err != nil {
 		return fmt.Errorf("failed to get inbounds: %w", err)
 	}
@@ -412,10 +642,6 @@ func (s *XrayService) restartXrayMultiMode(isForce bool) error {
 
 	// Group inbounds by their assigned nodes
 	for _, inbound := range allInbounds {
-		if !inbound.Enable {
-			continue
-		}
-
 		// Get all nodes assigned to this inbound (multi-node support)
 		nodes, err := s.nodeService.GetNodesForInbound(inbound.Id)
 		if err != nil || len(nodes) == 0 {
@@ -430,11 +656,6 @@ func (s *XrayService) restartXrayMultiMode(isForce bool) error {
 		}
 	}
 
-	// Send config to each node in parallel for better performance
-	var wg sync.WaitGroup
-	var mu sync.Mutex
-	var errors []error
-
 	// Helper function to build config for a node
 	buildNodeConfig := func(node *model.Node, inbounds []*model.Inbound) ([]byte, error) {
 		// Determine which core config profile to use
@@ -495,6 +716,15 @@ func (s *XrayService) restartXrayMultiMode(isForce bool) error {
 				break
 			}
 		}
+		if err := s.applyCoreLogLevel(&nodeConfig); err != nil {
+			logger.Warningf("Failed to apply core log level for node %s: %v", node.Name, err)
+		}
+		// Clients restricted to other nodes are left out of this node's inbounds
+		clientService := ClientService{}
+		excludedEmails, err := clientService.getClientEmailsExcludedFromNode(node.Id)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get client node restrictions: %w", err)
+		}
 		nodeConfig.InboundConfigs = []xray.InboundConfig{}
 		// Add API inbound first if it exists
 		if hasAPIInbound {
@@ -502,68 +732,12 @@ func (s *XrayService) restartXrayMultiMode(isForce bool) error {
 		}
 
 		for _, inbound := range inbounds {
-			// Process clients (same logic as GetXrayConfig)
-			settings := map[string]any{}
-			json.Unmarshal([]byte(inbound.Settings), &settings)
-			clients, ok := settings["clients"].([]any)
-			if ok {
-				clientStats := inbound.ClientStats
-				for _, clientTraffic := range clientStats {
-					indexDecrease := 0
-					for index, client := range clients {
-						c := client.(map[string]any)
-						if c["email"] == clientTraffic.Email {
-							if !clientTraffic.Enable {
-								clients = RemoveIndex(clients, index-indexDecrease)
-								indexDecrease++
-							}
-						}
-					}
-				}
-
-				var final_clients []any
-				for _, client := range clients {
-					c := client.(map[string]any)
-					if c["enable"] != nil {
-						if enable, ok := c["enable"].(bool); ok && !enable {
-							continue
-						}
-					}
-					for key := range c {
-						if key != "email" && key != "id" && key != "password" && key != "flow" && key != "method" {
-							delete(c, key)
-						}
-						if c["flow"] == "xtls-rprx-vision-udp443" {
-							c["flow"] = "xtls-rprx-vision"
-						}
-					}
-					final_clients = append(final_clients, any(c))
-				}
-
-				settings["clients"] = final_clients
-				modifiedSettings, _ := json.MarshalIndent(settings, "", "  ")
-				inbound.Settings = string(modifiedSettings)
-			}
-
-			if len(inbound.StreamSettings) > 0 {
-				var stream map[string]any
-				json.Unmarshal([]byte(inbound.StreamSettings), &stream)
-				tlsSettings, ok1 := stream["tlsSettings"].(map[string]any)
-				realitySettings, ok2 := stream["realitySettings"].(map[string]any)
-				if ok1 || ok2 {
-					if ok1 {
-						delete(tlsSettings, "settings")
-					} else if ok2 {
-						delete(realitySettings, "settings")
-					}
-				}
-				delete(stream, "externalProxy")
-				newStream, _ := json.MarshalIndent(stream, "", "  ")
-				inbound.StreamSettings = string(newStream)
+			for _, inboundConfig := range nodeInbound(inbound, excludedEmails).GenXrayInboundConfigs() {
+				nodeConfig.InboundConfigs = append(nodeConfig.InboundConfigs, *inboundConfig)
 			}
-
-			inboundConfig := inbound.GenXrayInboundConfig()
-			nodeConfig.InboundConfigs = append(nodeConfig.InboundConfigs, *inboundConfig)
+		}
+		if err := applySourceCountryRules(&nodeConfig, inbounds); err != nil {
+			return nil, err
 		}
 
 		// Note: Outbounds are now included in the profile's ConfigJson
@@ -573,60 +747,127 @@ func (s *XrayService) restartXrayMultiMode(isForce bool) error {
 		return json.MarshalIndent(&nodeConfig, "", "  ")
 	}
 
-	// Send configs to all nodes in parallel
-	for _, node := range nodes {
-		inbounds, ok := nodeInbounds[node.Id]
-		if !ok {
-			// No inbounds assigned to this node, skip
-			continue
+	// Send configs to the nodes in parallel, at most nodePushConcurrency at a time
+	concurrency, err := s.settingService.GetNodePushConcurrency()
+	if err != nil || concurrency < 1 {
+		concurrency = 10
+	}
+	if onlyNodeId > 0 {
+		var only []*model.Node
+		for _, node := range nodes {
+			if node.Id == onlyNodeId {
+				only = append(only, node)
+			}
+		}
+		nodes = only
+	}
+	pushed, errors := pushToNodes(nodes, nodeInbounds, concurrency, func(n *model.Node, ibs []*model.Inbound) error {
+		// Build config for this node
+		configJSON, err := buildNodeConfig(n, ibs)
+		if err != nil {
+			logger.Errorf("[Node: %s] Failed to marshal config: %v", n.Name, err)
+			return fmt.Errorf("failed to marshal config: %w", err)
 		}
 
-		wg.Add(1)
-		go func(n *model.Node, ibs []*model.Inbound) {
-			defer wg.Done()
-
-			// Build config for this node
-			configJSON, err := buildNodeConfig(n, ibs)
-			if err != nil {
-				logger.Errorf("[Node: %s] Failed to marshal config: %v", n.Name, err)
-				mu.Lock()
-				errors = append(errors, fmt.Errorf("node %s: failed to marshal config: %w", n.Name, err))
-				mu.Unlock()
-				return
-			}
+		// Send to node, retrying transient failures
+		applyErr := s.nodeService.applyConfigToNodeWithRetry(n, configJSON)
+		s.nodeService.RecordConfigPush(n.Id, configJSON, applyErr)
+		if applyErr != nil {
+			logger.Errorf("[Node: %s] Failed to apply config: %v", n.Name, applyErr)
+			return applyErr
+		}
+		logger.Infof("[Node: %s] Successfully applied config", n.Name)
+		return nil
+	})
 
-			// Send to node
-			if err := s.nodeService.ApplyConfigToNode(n, configJSON); err != nil {
-				logger.Errorf("[Node: %s] Failed to apply config: %v", n.Name, err)
-				mu.Lock()
-				errors = append(errors, fmt.Errorf("node %s: %w", n.Name, err))
-				mu.Unlock()
-			} else {
-				logger.Infof("[Node: %s] Successfully applied config", n.Name)
-			}
-		}(node, inbounds)
+	if onlyNodeId > 0 {
+		if pushed == 0 {
+			return fmt.Errorf("node %d not found or has no inbounds assigned", onlyNodeId)
+		}
+		if len(errors) > 0 {
+			return errors[0]
+		}
+		return nil
 	}
 
-	// Wait for all goroutines to complete
-	wg.Wait()
-
 	// Log summary
 	if len(errors) > 0 {
-		logger.Warningf("Failed to apply config to %d node(s) out of %d", len(errors), len(nodes))
+		// The nodes that failed keep running their previous config until the next successful push;
+		// their state is available from NodeService.GetLastPushResults
+		logger.Warningf("Failed to apply config to %d node(s) out of %d, they are out of sync", len(errors), pushed)
 		for _, err := range errors {
 			logger.Warningf("  - %v", err)
 		}
 		// Return error only if all nodes failed
-		if len(errors) == len(nodes) {
+		if len(errors) == pushed {
 			return fmt.Errorf("failed to apply config to all nodes: %d errors", len(errors))
 		}
 	} else {
-		logger.Infof("Successfully applied config to all %d node(s)", len(nodes))
+		logger.Infof("Successfully applied config to all %d node(s)", pushed)
 	}
 
 	return nil
 }
 
+// nodeInbound returns a copy of inbound stripped down to what a node core needs: clients that are
+// disabled or in excludedEmails (lowercased) are dropped, along with the panel-only client and
+// stream fields. inbound itself is left alone, as it is shared by the configs of all its nodes.
+func nodeInbound(source *model.Inbound, excludedEmails map[string]bool) *model.Inbound {
+	copied := *source
+	inbound := &copied
+	// Process clients (same logic as GetXrayConfig)
+	settings := map[string]any{}
+	json.Unmarshal([]byte(inbound.Settings), &settings)
+	clients, ok := settings["clients"].([]any)
+	if ok {
+		clients = removeDisabledClients(clients, inbound.ClientStats, false)
+
+		var final_clients []any
+		for _, client := range clients {
+			c := client.(map[string]any)
+			if c["enable"] != nil {
+				if enable, ok := c["enable"].(bool); ok && !enable {
+					continue
+				}
+			}
+			if email, ok := c["email"].(string); ok && excludedEmails[strings.ToLower(email)] {
+				continue
+			}
+			for key := range c {
+				if key != "email" && key != "id" && key != "password" && key != "flow" && key != "method" {
+					delete(c, key)
+				}
+				if c["flow"] == "xtls-rprx-vision-udp443" {
+					c["flow"] = "xtls-rprx-vision"
+				}
+			}
+			final_clients = append(final_clients, any(c))
+		}
+
+		settings["clients"] = final_clients
+		modifiedSettings, _ := json.MarshalIndent(settings, "", "  ")
+		inbound.Settings = string(modifiedSettings)
+	}
+
+	if len(inbound.StreamSettings) > 0 {
+		var stream map[string]any
+		json.Unmarshal([]byte(inbound.StreamSettings), &stream)
+		tlsSettings, ok1 := stream["tlsSettings"].(map[string]any)
+		realitySettings, ok2 := stream["realitySettings"].(map[string]any)
+		if ok1 || ok2 {
+			if ok1 {
+				delete(tlsSettings, "settings")
+			} else if ok2 {
+				delete(realitySettings, "settings")
+			}
+		}
+		delete(stream, "externalProxy")
+		newStream, _ := json.MarshalIndent(stream, "", "  ")
+		inbound.StreamSettings = string(newStream)
+	}
+	return inbound
+}
+
 // EnsureXrayConfigFile generates and saves the Xray configuration file from database.
 // This ensures the config file is ready before Xray starts, even if Xray is not yet running.
 // The configuration is built from xrayTemplateConfig in database and current inbounds.
@@ -650,6 +891,17 @@ func (s *XrayService) EnsureXrayConfigFile() error {
 	return nil
 }
 
+// ValidateCurrentConfig assembles the live Xray config (template plus inbounds) and
+// runs the Xray binary's config check against it without touching the running core.
+// It returns the binary's diagnostics output; the error is non-nil when the config is invalid.
+func (s *XrayService) ValidateCurrentConfig() (string, error) {
+	cfg, err := s.GetXrayConfig()
+	if err != nil {
+		return "", err
+	}
+	return xray.TestConfig(cfg)
+}
+
 // StopXray stops the running Xray process.
 func (s *XrayService) StopXray() error {
 	lock.Lock()
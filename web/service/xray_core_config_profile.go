@@ -278,6 +278,9 @@ func (s *XrayCoreConfigProfileService) validateConfigJson(configJson string) err
 	if err != nil {
 		return fmt.Errorf("invalid JSON: %w", err)
 	}
+	if err := validateConfigSendThrough(xrayConfig); err != nil {
+		return err
+	}
 
 	return nil
 }
@@ -0,0 +1,113 @@
+package service
+
+import (
+	"sync"
+	"time"
+
+	"github.com/konstpic/sharx-code/v2/logger"
+	"github.com/konstpic/sharx-code/v2/util/common"
+
+	"go.uber.org/atomic"
+)
+
+// maxRestartDeferral bounds the length of a deferred restart window.
+const maxRestartDeferral = 24 * time.Hour
+
+var (
+	deferLock         sync.Mutex
+	deferTimer        *time.Timer
+	restartDeferredTo atomic.Int64 // End of the deferred restart window in unix milliseconds, 0 when not deferred
+	isRestartPending  atomic.Bool  // Indicates that a restart was requested during the window
+)
+
+// runXrayRestart runs the restart behind RestartXray and ApplyDeferredRestart.
+// Tests replace it to count restarts without a running Xray.
+var runXrayRestart func(s *XrayService, isForce bool) error
+
+func init() {
+	// Assigned here, as restartXray indirectly refers back to RestartXray
+	runXrayRestart = (*XrayService).restartXray
+}
+
+// DeferredRestartStatus describes the deferred restart window.
+type DeferredRestartStatus struct {
+	Deferred bool  `json:"deferred"` // Whether restarts are currently deferred
+	Until    int64 `json:"until"`    // End of the window in unix milliseconds (0 when not deferred)
+	Pending  bool  `json:"pending"`  // Whether a restart was requested during the window
+}
+
+// DeferRestarts starts a maintenance window of the given length in which non-forced Xray restarts
+// are not run but only remembered. When the window ends, or on ApplyDeferredRestart, the changes
+// made in it are applied with a single restart. Calling it again moves the end of the window.
+func (s *XrayService) DeferRestarts(window time.Duration) error {
+	if window <= 0 || window > maxRestartDeferral {
+		return common.NewErrorf("invalid restart deferral window: %v (max %v)", window, maxRestartDeferral)
+	}
+	deferLock.Lock()
+	defer deferLock.Unlock()
+	if deferTimer != nil {
+		deferTimer.Stop()
+	}
+	restartDeferredTo.Store(time.Now().Add(window).UnixMilli())
+	deferTimer = time.AfterFunc(window, func() {
+		if err := s.EndRestartDeferral(); err != nil {
+			logger.Warningf("Failed to apply deferred Xray restart: %v", err)
+		}
+	})
+	logger.Infof("Xray restarts deferred for %v", window)
+	return nil
+}
+
+// EndRestartDeferral ends the deferred restart window and restarts Xray if a restart was requested in it.
+func (s *XrayService) EndRestartDeferral() error {
+	deferLock.Lock()
+	if deferTimer != nil {
+		deferTimer.Stop()
+		deferTimer = nil
+	}
+	wasDeferred := restartDeferredTo.Swap(0) != 0
+	deferLock.Unlock()
+	if wasDeferred {
+		logger.Info("Xray restart deferral ended")
+	}
+	return s.ApplyDeferredRestart()
+}
+
+// ApplyDeferredRestart runs the restart requested while restarts were deferred, if any.
+// The window, when active, stays open.
+func (s *XrayService) ApplyDeferredRestart() error {
+	if !isRestartPending.Load() && !isNeedXrayRestart.Load() {
+		return nil
+	}
+	return runXrayRestart(s, false)
+}
+
+// IsRestartDeferred reports whether non-forced Xray restarts are currently deferred.
+func (s *XrayService) IsRestartDeferred() bool {
+	return restartDeferredTo.Load() != 0
+}
+
+// GetDeferredRestartStatus returns the state of the deferred restart window.
+func (s *XrayService) GetDeferredRestartStatus() DeferredRestartStatus {
+	until := restartDeferredTo.Load()
+	return DeferredRestartStatus{
+		Deferred: until != 0,
+		Until:    until,
+		Pending:  isRestartPending.Load() || (until != 0 && isNeedXrayRestart.Load()),
+	}
+}
+
+// deferRestart remembers a non-forced restart requested while restarts are deferred.
+// Returns false when the restart should run now: restarts are not deferred, or local Xray is
+// not running (e.g. after a crash), so there is no running instance to spare.
+func (s *XrayService) deferRestart(isForce bool) bool {
+	if isForce || restartDeferredTo.Load() == 0 {
+		return false
+	}
+	if multiMode, err := s.settingService.GetMultiNodeMode(); err == nil && !multiMode && !s.IsXrayRunning() {
+		return false
+	}
+	isRestartPending.Store(true)
+	logger.Debug("Xray restart deferred until the end of the maintenance window")
+	return true
+}
@@ -0,0 +1,120 @@
+package service
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countXrayRestarts replaces the Xray restart for the duration of the test and returns the
+// number of restarts run. Like restartXray, a restart applies what was pending.
+func countXrayRestarts(t *testing.T) *atomic.Int32 {
+	t.Helper()
+	restarts := &atomic.Int32{}
+	saved := runXrayRestart
+	runXrayRestart = func(s *XrayService, isForce bool) error {
+		isRestartPending.Store(false)
+		restarts.Add(1)
+		return nil
+	}
+	isNeedXrayRestart.Store(false)
+	t.Cleanup(func() {
+		(&XrayService{}).EndRestartDeferral()
+		runXrayRestart = saved
+		isRestartPending.Store(false)
+	})
+	return restarts
+}
+
+func TestDeferredRestartsCoalesce(t *testing.T) {
+	// In multi-node mode restarts are deferred without checking for a local Xray
+	useSettings(t, map[string]string{"multiNodeMode": "true"})
+	restarts := countXrayRestarts(t)
+	s := &XrayService{}
+
+	if err := s.DeferRestarts(time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		if err := s.RestartXray(false); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := restarts.Load(); n != 0 {
+		t.Fatalf("%d restarts during the deferred window, want 0", n)
+	}
+	if status := s.GetDeferredRestartStatus(); !status.Deferred || !status.Pending || status.Until == 0 {
+		t.Fatalf("status = %+v, want deferred with a pending restart", status)
+	}
+
+	// Ending the window applies all edits with one restart
+	if err := s.EndRestartDeferral(); err != nil {
+		t.Fatal(err)
+	}
+	if n := restarts.Load(); n != 1 {
+		t.Fatalf("%d restarts at the end of the window, want 1", n)
+	}
+	if status := s.GetDeferredRestartStatus(); status.Deferred || status.Pending {
+		t.Fatalf("status = %+v, want not deferred and nothing pending", status)
+	}
+
+	// With nothing pending, ending again does not restart
+	if err := s.EndRestartDeferral(); err != nil || restarts.Load() != 1 {
+		t.Fatalf("EndRestartDeferral() = %v with %d restarts, want no further restart", err, restarts.Load())
+	}
+}
+
+func TestDeferredRestartWindowExpires(t *testing.T) {
+	useSettings(t, map[string]string{"multiNodeMode": "true"})
+	restarts := countXrayRestarts(t)
+	s := &XrayService{}
+
+	if err := s.DeferRestarts(50 * time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	s.RestartXray(false)
+	s.RestartXray(false)
+	deadline := time.Now().Add(2 * time.Second)
+	for restarts.Load() == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := restarts.Load(); n != 1 {
+		t.Fatalf("%d restarts after the window expired, want 1", n)
+	}
+	if s.IsRestartDeferred() {
+		t.Fatal("restarts still deferred after the window expired")
+	}
+}
+
+func TestDeferredRestartForceAndApply(t *testing.T) {
+	useSettings(t, map[string]string{"multiNodeMode": "true"})
+	restarts := countXrayRestarts(t)
+	s := &XrayService{}
+
+	if err := s.DeferRestarts(time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	// A forced restart is not deferred
+	s.RestartXray(true)
+	if n := restarts.Load(); n != 1 {
+		t.Fatalf("%d restarts after a forced restart, want 1", n)
+	}
+
+	// Restart now applies pending edits and keeps the window open
+	s.RestartXray(false)
+	if err := s.ApplyDeferredRestart(); err != nil {
+		t.Fatal(err)
+	}
+	if n := restarts.Load(); n != 2 || !s.IsRestartDeferred() {
+		t.Fatalf("%d restarts, deferred %v, want 2 with the window still open", n, s.IsRestartDeferred())
+	}
+}
+
+func TestDeferRestartsRejectsInvalidWindow(t *testing.T) {
+	for _, window := range []time.Duration{0, -time.Minute, 25 * time.Hour} {
+		if err := (&XrayService{}).DeferRestarts(window); err == nil {
+			t.Errorf("DeferRestarts(%v) accepted an invalid window", window)
+			(&XrayService{}).EndRestartDeferral()
+		}
+	}
+}
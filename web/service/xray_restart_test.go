@@ -0,0 +1,67 @@
+package service
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// useFastRestartDebounce shortens the debounce delay of RestartXrayAsync for the duration of the test.
+func useFastRestartDebounce(t *testing.T) {
+	t.Helper()
+	saved := restartDebounceDelay
+	restartDebounceDelay = 100 * time.Millisecond
+	t.Cleanup(func() { restartDebounceDelay = saved })
+}
+
+// waitForRestarts waits until restarts reaches want or a second has passed, then lets
+// a stray late restart show up before returning the count.
+func waitForRestarts(restarts *atomic.Int32, want int32) int32 {
+	deadline := time.Now().Add(time.Second)
+	for restarts.Load() < want && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	time.Sleep(2 * restartDebounceDelay)
+	return restarts.Load()
+}
+
+func TestRestartXrayAsyncDebounces(t *testing.T) {
+	useFastRestartDebounce(t)
+	restarts := countXrayRestarts(t)
+	s := &XrayService{}
+
+	for i := 0; i < 10; i++ {
+		s.RestartXrayAsync(false)
+		time.Sleep(2 * time.Millisecond)
+	}
+	if n := restarts.Load(); n != 0 {
+		t.Fatalf("%d restarts while requests were still arriving, want 0", n)
+	}
+	if n := waitForRestarts(restarts, 1); n != 1 {
+		t.Fatalf("%d restarts for 10 requests, want 1", n)
+	}
+}
+
+func TestRestartXrayAsyncForceBypassesDebounce(t *testing.T) {
+	useFastRestartDebounce(t)
+	restarts := &atomic.Int32{}
+	forced := &atomic.Int32{}
+	saved := runXrayRestart
+	runXrayRestart = func(s *XrayService, isForce bool) error {
+		if isForce {
+			forced.Add(1)
+		}
+		restarts.Add(1)
+		return nil
+	}
+	t.Cleanup(func() { runXrayRestart = saved })
+	s := &XrayService{}
+
+	// The forced restart replaces the pending debounced one
+	s.RestartXrayAsync(false)
+	s.RestartXrayAsync(false)
+	s.RestartXrayAsync(true)
+	if n := waitForRestarts(restarts, 1); n != 1 || forced.Load() != 1 {
+		t.Fatalf("%d restarts, %d forced, want the single forced restart", n, forced.Load())
+	}
+}
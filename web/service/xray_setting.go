@@ -27,5 +27,8 @@ func (s *XraySettingService) CheckXrayConfig(XrayTemplateConfig string) error {
 	if err != nil {
 		return common.NewError("xray template config invalid:", err)
 	}
+	if err := validateConfigSendThrough(xrayConfig); err != nil {
+		return common.NewError("xray template config invalid:", err)
+	}
 	return nil
 }
@@ -0,0 +1,151 @@
+package service
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/konstpic/sharx-code/v2/xray"
+)
+
+func TestRemoveDisabledClients(t *testing.T) {
+	clients := []any{
+		map[string]any{"email": "a"},
+		map[string]any{"email": "b"},
+		map[string]any{"email": "c"},
+		map[string]any{"email": "d"},
+		map[string]any{"email": "e"},
+	}
+	// Adjacent and trailing disabled clients were the cases the old index arithmetic got wrong
+	stats := []xray.ClientTraffic{
+		{Email: "a", Enable: true},
+		{Email: "b", Enable: false},
+		{Email: "c", Enable: false},
+		{Email: "d", Enable: true},
+		{Email: "e", Enable: false},
+	}
+
+	got := removeDisabledClients(clients, stats, false)
+	want := []any{
+		map[string]any{"email": "a"},
+		map[string]any{"email": "d"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("removeDisabledClients() = %v, want %v", got, want)
+	}
+	if len(clients) != 5 || clients[1].(map[string]any)["email"] != "b" {
+		t.Fatalf("input clients modified: %v", clients)
+	}
+}
+
+func TestRemoveDisabledClientsKeepsClientsWithoutStats(t *testing.T) {
+	clients := []any{
+		map[string]any{"email": "a"},
+		map[string]any{"email": "new"},
+	}
+	got := removeDisabledClients(clients, []xray.ClientTraffic{{Email: "a", Enable: true}}, false)
+	if !reflect.DeepEqual(got, clients) {
+		t.Fatalf("removeDisabledClients() = %v, want %v", got, clients)
+	}
+}
+
+func TestSetCoreLogLevel(t *testing.T) {
+	tests := []struct {
+		level string
+		want  string
+	}{
+		{"none", "none"},
+		{"error", "error"},
+		{"warn", "warning"},
+		{" Debug ", "debug"},
+		{"info", "info"},
+		// Unknown values fall back to warning
+		{"verbose", "warning"},
+	}
+	for _, test := range tests {
+		config := &xray.Config{LogConfig: []byte(`{"access":"none","loglevel":"info"}`)}
+		if err := setCoreLogLevel(config, test.level); err != nil {
+			t.Fatalf("setCoreLogLevel(%q) failed: %v", test.level, err)
+		}
+		var logConfig map[string]any
+		if err := json.Unmarshal(config.LogConfig, &logConfig); err != nil {
+			t.Fatal(err)
+		}
+		if logConfig["loglevel"] != test.want || logConfig["access"] != "none" {
+			t.Errorf("setCoreLogLevel(%q) log = %s, want loglevel %q and the template's other fields", test.level, config.LogConfig, test.want)
+		}
+	}
+}
+
+func TestSetCoreLogLevelWithoutLogSection(t *testing.T) {
+	config := &xray.Config{}
+	if err := setCoreLogLevel(config, "debug"); err != nil {
+		t.Fatal(err)
+	}
+	if string(config.LogConfig) != `{"loglevel":"debug"}` {
+		t.Fatalf("log = %s, want a log section with the level", config.LogConfig)
+	}
+}
+
+func TestSetCoreAPIPortMovesTemplateInbound(t *testing.T) {
+	config := &xray.Config{
+		InboundConfigs: []xray.InboundConfig{
+			{Tag: "api", Port: 62789, Protocol: "tunnel"},
+			{Tag: "inbound-443", Port: 443, Protocol: "vless"},
+		},
+		API:          []byte(`{"tag":"api","services":["StatsService"]}`),
+		RouterConfig: []byte(`{"rules":[{"type":"field","inboundTag":["api"],"outboundTag":"api"}]}`),
+	}
+	if err := setCoreAPIPort(config, 10085); err != nil {
+		t.Fatal(err)
+	}
+	if len(config.InboundConfigs) != 2 || config.InboundConfigs[0].Port != 10085 || config.InboundConfigs[1].Port != 443 {
+		t.Fatalf("inbounds = %+v, want the API inbound on 10085", config.InboundConfigs)
+	}
+	if string(config.API) != `{"tag":"api","services":["StatsService"]}` {
+		t.Fatalf("api section = %s, want the template's", config.API)
+	}
+	if string(config.RouterConfig) != `{"rules":[{"type":"field","inboundTag":["api"],"outboundTag":"api"}]}` {
+		t.Fatalf("routing = %s, want the template's API rule only", config.RouterConfig)
+	}
+}
+
+func TestSetCoreAPIPortAddsMissingAPI(t *testing.T) {
+	config := &xray.Config{
+		InboundConfigs: []xray.InboundConfig{{Tag: "inbound-443", Port: 443}},
+		RouterConfig:   []byte(`{"domainStrategy":"AsIs","rules":[{"type":"field","outboundTag":"blocked","ip":["geoip:private"]}]}`),
+	}
+	if err := setCoreAPIPort(config, 10085); err != nil {
+		t.Fatal(err)
+	}
+
+	api := config.InboundConfigs[0]
+	if api.Tag != "api" || api.Port != 10085 || api.Protocol != "tunnel" || string(api.Listen) != `"127.0.0.1"` {
+		t.Fatalf("first inbound = %+v, want a local API inbound on 10085", api)
+	}
+	var apiSection struct {
+		Tag      string   `json:"tag"`
+		Services []string `json:"services"`
+	}
+	if err := json.Unmarshal(config.API, &apiSection); err != nil || apiSection.Tag != "api" || len(apiSection.Services) == 0 {
+		t.Fatalf("api section = %s, want one with the api tag", config.API)
+	}
+	var routing struct {
+		DomainStrategy string           `json:"domainStrategy"`
+		Rules          []map[string]any `json:"rules"`
+	}
+	if err := json.Unmarshal(config.RouterConfig, &routing); err != nil {
+		t.Fatal(err)
+	}
+	if routing.DomainStrategy != "AsIs" || len(routing.Rules) != 2 || routing.Rules[0]["outboundTag"] != "api" || routing.Rules[1]["outboundTag"] != "blocked" {
+		t.Fatalf("routing = %s, want the API rule ahead of the template's rules", config.RouterConfig)
+	}
+}
+
+func TestSetCoreAPIPortRejectsInvalidPort(t *testing.T) {
+	for _, port := range []int{-1, 65536} {
+		if err := setCoreAPIPort(&xray.Config{}, port); err == nil {
+			t.Errorf("setCoreAPIPort(%d) accepted an invalid port", port)
+		}
+	}
+}
@@ -13,8 +13,10 @@ import (
 )
 
 const (
-	loginUserKey = "LOGIN_USER"
-	defaultPath  = "/"
+	loginUserKey    = "LOGIN_USER"
+	sessionEpochKey = "SESSION_EPOCH"
+	requestUserKey  = "REQUEST_USER"
+	defaultPath     = "/"
 )
 
 func init() {
@@ -43,9 +45,28 @@ func SetMaxAge(c *gin.Context, maxAge int) {
 	})
 }
 
-// GetLoginUser retrieves the authenticated user from the session.
+// SetRequestUser authenticates the current request only (e.g. by API token) without touching the session.
+func SetRequestUser(c *gin.Context, user *model.User) {
+	if user == nil {
+		return
+	}
+	c.Set(requestUserKey, user)
+}
+
+// IsRequestUser reports whether the current request was authenticated by SetRequestUser instead of a session.
+func IsRequestUser(c *gin.Context) bool {
+	_, ok := c.Get(requestUserKey)
+	return ok
+}
+
+// GetLoginUser retrieves the authenticated user from the request or the session.
 // Returns nil if no user is logged in or if the session data is invalid.
 func GetLoginUser(c *gin.Context) *model.User {
+	if obj, ok := c.Get(requestUserKey); ok {
+		if user, ok := obj.(*model.User); ok {
+			return user
+		}
+	}
 	s := sessions.Default(c)
 	obj := s.Get(loginUserKey)
 	if obj == nil {
@@ -60,6 +81,20 @@ func GetLoginUser(c *gin.Context) *model.User {
 	return &user
 }
 
+// SetSessionEpoch stores the session epoch the login session was issued in.
+func SetSessionEpoch(c *gin.Context, epoch int) {
+	s := sessions.Default(c)
+	s.Set(sessionEpochKey, epoch)
+}
+
+// GetSessionEpoch returns the session epoch the login session was issued in.
+// Sessions created before epochs were introduced report epoch 0.
+func GetSessionEpoch(c *gin.Context) int {
+	s := sessions.Default(c)
+	epoch, _ := s.Get(sessionEpochKey).(int)
+	return epoch
+}
+
 // IsLogin checks if a user is currently authenticated in the session.
 // Returns true if a valid user session exists, false otherwise.
 func IsLogin(c *gin.Context) bool {
@@ -21,12 +21,14 @@ import (
 	"github.com/konstpic/sharx-code/v2/logger"
 	"github.com/konstpic/sharx-code/v2/util/common"
 	"github.com/konstpic/sharx-code/v2/web/controller"
+	"github.com/konstpic/sharx-code/v2/web/entity"
 	"github.com/konstpic/sharx-code/v2/web/job"
 	"github.com/konstpic/sharx-code/v2/web/locale"
 	"github.com/konstpic/sharx-code/v2/web/middleware"
 	"github.com/konstpic/sharx-code/v2/web/network"
 	"github.com/konstpic/sharx-code/v2/web/service"
 	"github.com/konstpic/sharx-code/v2/web/websocket"
+	"github.com/konstpic/sharx-code/v2/xray"
 
 	"github.com/gin-contrib/gzip"
 	"github.com/gin-contrib/sessions"
@@ -303,6 +305,12 @@ func (s *Server) initRouter() (*gin.Engine, error) {
 		c.String(http.StatusOK, metrics)
 	})
 
+	// Health/readiness endpoint for container orchestration (no auth, no secrets)
+	g.GET("/health", func(c *gin.Context) {
+		health := service.GetHealth()
+		c.JSON(health.StatusCode(), health)
+	})
+
 	s.index = controller.NewIndexController(g)
 	s.panel = controller.NewXUIController(g)
 	s.api = controller.NewAPIController(g)
@@ -367,13 +375,13 @@ func (s *Server) startTask() {
 	// check client ips from log file every day
 	s.cron.AddJob("@daily", job.NewClearLogsJob())
 
-	// Inbound traffic reset jobs
-	// Run once a day, midnight
-	s.cron.AddJob("@daily", job.NewPeriodicTrafficResetJob("daily"))
-	// Run once a week, midnight between Sat/Sun
-	s.cron.AddJob("@weekly", job.NewPeriodicTrafficResetJob("weekly"))
-	// Run once a month, midnight, first of month
-	s.cron.AddJob("@monthly", job.NewPeriodicTrafficResetJob("monthly"))
+	// Inbound traffic reset job (daily/weekly/monthly schedules)
+	// Runs every 10 minutes and resets inbounds whose period has elapsed since their last reset
+	s.cron.AddJob("@every 10m", job.NewPeriodicTrafficResetJob())
+	// Client traffic reset job (per-client reset period in days)
+	s.cron.AddJob("@every 10m", job.NewClientTrafficResetJob())
+	// Remove expired/disabled clients from and re-add renewed clients to the running Xray via API
+	s.cron.AddJob("@every 30s", job.NewClientStateEnforceJob())
 
 	// LDAP sync scheduling
 	if ldapEnabled, _ := s.settingService.GetLdapEnable(); ldapEnabled {
@@ -390,6 +398,10 @@ func (s *Server) startTask() {
 	s.cron.AddJob("@every 1s", job.NewCheckNodeHealthJob())
 	// Collect node statistics (traffic and online clients) every 1 second for real-time updates
 	s.cron.AddJob("@every 1s", job.NewCollectNodeStatsJob())
+	// Compact and prune node, inbound and client traffic history hourly
+	s.cron.AddJob("@hourly", job.NewTrafficSamplesJob())
+	// Prune expired audit log entries daily
+	s.cron.AddJob("@daily", job.NewAuditLogPruneJob())
 
 	// Client keys rotation job (runs before subscription update interval)
 	// Schedule dynamically based on subscription update interval
@@ -460,6 +472,9 @@ func (s *Server) startTask() {
 			return
 		}
 
+		// Daily digest of clients about to expire (no-op while tgExpiringDigestDays is 0)
+		s.cron.AddJob("@daily", job.NewExpiringClientsNotifyJob())
+
 		// check for Telegram bot callback query hash storage reset
 		s.cron.AddJob("@every 2m", job.NewCheckHashStorageJob())
 
@@ -489,6 +504,10 @@ func (s *Server) Start() (err error) {
 	s.cron = cron.New(cron.WithLocation(loc), cron.WithSeconds())
 	s.cron.Start()
 
+	if xrayBinaryPath, err := s.settingService.GetXrayBinaryPath(); err == nil {
+		xray.SetBinaryPathOverride(xrayBinaryPath)
+	}
+
 	engine, err := s.initRouter()
 	if err != nil {
 		return err
@@ -502,16 +521,7 @@ func (s *Server) Start() (err error) {
 	if err != nil {
 		return err
 	}
-	listen, err := s.settingService.GetListen()
-	if err != nil {
-		return err
-	}
-	port, err := s.settingService.GetPort()
-	if err != nil {
-		return err
-	}
-	listenAddr := net.JoinHostPort(listen, strconv.Itoa(port))
-	listener, err := net.Listen("tcp", listenAddr)
+	listener, err := s.listenWeb()
 	if err != nil {
 		return err
 	}
@@ -552,6 +562,52 @@ func (s *Server) Start() (err error) {
 	return nil
 }
 
+// listenWeb opens the listener of the web panel: a Unix domain socket when webListen has the
+// form "unix:<path>", otherwise a TCP listener on webListen and webPort.
+func (s *Server) listenWeb() (net.Listener, error) {
+	listen, err := s.settingService.GetListen()
+	if err != nil {
+		return nil, err
+	}
+	if path, ok := entity.UnixSocketPath(listen); ok {
+		return s.listenWebUnix(path)
+	}
+	port, err := s.settingService.GetPort()
+	if err != nil {
+		return nil, err
+	}
+	return net.Listen("tcp", net.JoinHostPort(listen, strconv.Itoa(port)))
+}
+
+// listenWebUnix listens on the Unix domain socket at path with the permissions of
+// XUI_WEB_SOCKET_MODE. A socket file left behind by a previous run is removed first.
+func (s *Server) listenWebUnix(path string) (net.Listener, error) {
+	if path == "" {
+		return nil, common.NewError("web listen unix socket path is empty")
+	}
+	mode, err := s.settingService.GetListenSocketMode()
+	if err != nil {
+		return nil, err
+	}
+	if info, err := os.Lstat(path); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, common.NewErrorf("web listen path %s exists and is not a socket", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, mode); err != nil {
+		listener.Close()
+		return nil, err
+	}
+	return listener, nil
+}
+
 // Stop gracefully shuts down the web server, stops Xray, cron jobs, and Telegram bot.
 func (s *Server) Stop() error {
 	s.cancel()
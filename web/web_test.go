@@ -0,0 +1,68 @@
+package web
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestListenWebUnixSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sharx.sock")
+	t.Setenv("XUI_WEB_LISTEN", "unix:"+path)
+	t.Setenv("XUI_WEB_SOCKET_MODE", "0600")
+
+	listener, err := (&Server{}).listenWeb()
+	if err != nil {
+		t.Fatalf("listenWeb() failed: %v", err)
+	}
+	if listener.Addr().Network() != "unix" || listener.Addr().String() != path {
+		t.Fatalf("listener on %s %s, want unix %s", listener.Addr().Network(), listener.Addr(), path)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode()&os.ModeSocket == 0 || info.Mode().Perm() != 0o600 {
+		t.Fatalf("socket mode = %v, want a socket with 0600", info.Mode())
+	}
+
+	// A socket left behind by a previous run does not block the next start
+	listener.(*net.UnixListener).SetUnlinkOnClose(false)
+	listener.Close()
+	listener, err = (&Server{}).listenWeb()
+	if err != nil {
+		t.Fatalf("listenWeb() over a stale socket failed: %v", err)
+	}
+	listener.Close()
+}
+
+func TestListenWebUnixSocketKeepsOtherFiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sharx.sock")
+	if err := os.WriteFile(path, []byte("data"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("XUI_WEB_LISTEN", "unix:"+path)
+
+	if listener, err := (&Server{}).listenWeb(); err == nil {
+		listener.Close()
+		t.Fatal("listenWeb() replaced a regular file with a socket")
+	}
+	if data, err := os.ReadFile(path); err != nil || string(data) != "data" {
+		t.Fatalf("regular file at the socket path changed: %q, %v", data, err)
+	}
+}
+
+func TestListenWebTCP(t *testing.T) {
+	t.Setenv("XUI_WEB_LISTEN", "127.0.0.1")
+	t.Setenv("XUI_WEB_PORT", "0")
+
+	listener, err := (&Server{}).listenWeb()
+	if err != nil {
+		t.Fatalf("listenWeb() failed: %v", err)
+	}
+	defer listener.Close()
+	if listener.Addr().Network() != "tcp" {
+		t.Fatalf("listener on %s %s, want tcp", listener.Addr().Network(), listener.Addr())
+	}
+}
@@ -99,12 +99,19 @@ func (x *XrayAPI) AddInbound(inbound []byte) error {
 }
 
 // DelInbound removes an inbound configuration from the Xray core by tag.
+// The inbounds of additional listen addresses of tag are removed as well.
 func (x *XrayAPI) DelInbound(tag string) error {
 	client := *x.HandlerServiceClient
-	_, err := client.RemoveInbound(context.Background(), &command.RemoveInboundRequest{
-		Tag: tag,
-	})
-	return err
+	var firstErr error
+	for _, t := range inboundTagWithAliases(tag) {
+		_, err := client.RemoveInbound(context.Background(), &command.RemoveInboundRequest{
+			Tag: t,
+		})
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
 }
 
 // AddUser adds a user to an inbound in the Xray core using the specified protocol and user data.
@@ -179,16 +186,23 @@ func (x *XrayAPI) AddUser(Protocol string, inboundTag string, user map[string]an
 
 	client := *x.HandlerServiceClient
 
-	_, err := client.AlterInbound(context.Background(), &command.AlterInboundRequest{
-		Tag: inboundTag,
-		Operation: serial.ToTypedMessage(&command.AddUserOperation{
-			User: &protocol.User{
-				Email:   user["email"].(string),
-				Account: account,
-			},
-		}),
-	})
-	return err
+	// Apply to the inbounds of all listen addresses of the tag
+	var firstErr error
+	for _, tag := range inboundTagWithAliases(inboundTag) {
+		_, err := client.AlterInbound(context.Background(), &command.AlterInboundRequest{
+			Tag: tag,
+			Operation: serial.ToTypedMessage(&command.AddUserOperation{
+				User: &protocol.User{
+					Email:   user["email"].(string),
+					Account: account,
+				},
+			}),
+		})
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
 }
 
 // RemoveUser removes a user from an inbound in the Xray core by email.
@@ -197,17 +211,61 @@ func (x *XrayAPI) RemoveUser(inboundTag, email string) error {
 	defer cancel()
 
 	op := &command.RemoveUserOperation{Email: email}
-	req := &command.AlterInboundRequest{
-		Tag:       inboundTag,
-		Operation: serial.ToTypedMessage(op),
+	// Apply to the inbounds of all listen addresses of the tag
+	for _, tag := range inboundTagWithAliases(inboundTag) {
+		req := &command.AlterInboundRequest{
+			Tag:       tag,
+			Operation: serial.ToTypedMessage(op),
+		}
+
+		_, err := (*x.HandlerServiceClient).AlterInbound(ctx, req)
+		if err != nil {
+			return fmt.Errorf("failed to remove user: %w", err)
+		}
 	}
 
-	_, err := (*x.HandlerServiceClient).AlterInbound(ctx, req)
+	return nil
+}
+
+// HasInboundUser reports whether the running Xray inbound with the given tag has a user with the given email.
+func (x *XrayAPI) HasInboundUser(inboundTag, email string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	resp, err := (*x.HandlerServiceClient).GetInboundUsers(ctx, &command.GetInboundUserRequest{
+		Tag:   inboundTag,
+		Email: email,
+	})
 	if err != nil {
-		return fmt.Errorf("failed to remove user: %w", err)
+		return false, fmt.Errorf("failed to get inbound users: %w", err)
 	}
+	// An unknown email comes back as a single nil user
+	for _, user := range resp.GetUsers() {
+		if user != nil && user.GetEmail() == email {
+			return true, nil
+		}
+	}
+	return false, nil
+}
 
-	return nil
+// GetInboundUserEmails returns the emails of all users of the running Xray inbound with the given tag.
+func (x *XrayAPI) GetInboundUserEmails(inboundTag string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	resp, err := (*x.HandlerServiceClient).GetInboundUsers(ctx, &command.GetInboundUserRequest{
+		Tag: inboundTag,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get inbound users: %w", err)
+	}
+	emails := make([]string, 0, len(resp.GetUsers()))
+	for _, user := range resp.GetUsers() {
+		if user != nil && user.GetEmail() != "" {
+			emails = append(emails, user.GetEmail())
+		}
+	}
+	return emails, nil
 }
 
 // UpdateConfigFileAfterUserRemoval updates the Xray config file after removing a user via API.
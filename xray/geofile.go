@@ -0,0 +1,55 @@
+package xray
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/xtls/xray-core/app/router"
+	"google.golang.org/protobuf/proto"
+)
+
+// minGeoFileSize is the smallest size a real geoip/geosite data file can have.
+// Anything smaller is almost certainly an error page or a truncated download.
+const minGeoFileSize = 1024
+
+// ValidateGeoFile checks that the file at path is a usable geoip/geosite data file.
+// The file must be non-trivially sized and parse as a GeoIPList or GeoSiteList
+// (chosen by the "geoip"/"geosite" file name prefix) with at least one entry.
+func ValidateGeoFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read geo file: %w", err)
+	}
+	if len(data) < minGeoFileSize {
+		return fmt.Errorf("geo file is too small (%d bytes)", len(data))
+	}
+
+	name := strings.ToLower(filepath.Base(path))
+	switch {
+	case strings.HasPrefix(name, "geoip"):
+		list := &router.GeoIPList{}
+		if err := proto.Unmarshal(data, list); err != nil {
+			return fmt.Errorf("invalid geoip data: %w", err)
+		}
+		if len(list.Entry) == 0 {
+			return fmt.Errorf("geoip data contains no entries")
+		}
+	case strings.HasPrefix(name, "geosite"):
+		list := &router.GeoSiteList{}
+		if err := proto.Unmarshal(data, list); err != nil {
+			return fmt.Errorf("invalid geosite data: %w", err)
+		}
+		if len(list.Entry) == 0 {
+			return fmt.Errorf("geosite data contains no entries")
+		}
+	default:
+		// Unknown kind of dat file: only the wire format can be checked.
+		// Both list messages start with a length-delimited field 1 (tag 0x0a).
+		if data[0] != 0x0a {
+			return fmt.Errorf("unrecognized geo file header")
+		}
+	}
+	return nil
+}
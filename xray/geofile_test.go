@@ -0,0 +1,87 @@
+package xray
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/xtls/xray-core/app/router"
+	"google.golang.org/protobuf/proto"
+)
+
+// writeGeoFile writes data to a file called name in a temporary directory and returns its path.
+func writeGeoFile(t *testing.T, name string, data []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// testGeoIPList returns a marshalled GeoIPList padded with CIDRs to at least minGeoFileSize bytes.
+func testGeoIPList(t *testing.T) []byte {
+	t.Helper()
+	entry := &router.GeoIP{CountryCode: "TEST"}
+	for i := 0; i < 256; i++ {
+		entry.Cidr = append(entry.Cidr, &router.CIDR{Ip: []byte{10, 0, byte(i), 0}, Prefix: 24})
+	}
+	data, err := proto.Marshal(&router.GeoIPList{Entry: []*router.GeoIP{entry}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestValidateGeoFileAcceptsGeoIPList(t *testing.T) {
+	path := writeGeoFile(t, "geoip.dat", testGeoIPList(t))
+	if err := ValidateGeoFile(path); err != nil {
+		t.Fatalf("valid geoip file rejected: %v", err)
+	}
+}
+
+func TestValidateGeoFileAcceptsGeoSiteList(t *testing.T) {
+	entry := &router.GeoSite{CountryCode: "TEST"}
+	for i := 0; i < 128; i++ {
+		entry.Domain = append(entry.Domain, &router.Domain{Type: router.Domain_Domain, Value: strings.Repeat("a", 8) + ".example.com"})
+	}
+	data, err := proto.Marshal(&router.GeoSiteList{Entry: []*router.GeoSite{entry}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := writeGeoFile(t, "geosite_custom.dat", data)
+	if err := ValidateGeoFile(path); err != nil {
+		t.Fatalf("valid geosite file rejected: %v", err)
+	}
+}
+
+func TestValidateGeoFileRejectsBogusBody(t *testing.T) {
+	page := []byte("<html><body>" + strings.Repeat("Service temporarily unavailable. ", 64) + "</body></html>")
+	tests := []struct {
+		name string
+		file string
+		data []byte
+	}{
+		{"error page as geoip", "geoip.dat", page},
+		{"error page as geosite", "geosite.dat", page},
+		{"error page as other dat", "custom.dat", page},
+		{"truncated download", "geoip.dat", testGeoIPList(t)[:100]},
+		{"empty list", "geoip.dat", bytes.Repeat([]byte{0}, minGeoFileSize)},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := writeGeoFile(t, test.file, test.data)
+			if err := ValidateGeoFile(path); err == nil {
+				t.Fatal("bogus geo file accepted")
+			}
+		})
+	}
+}
+
+func TestValidateGeoFileMissingFile(t *testing.T) {
+	if err := ValidateGeoFile(filepath.Join(t.TempDir(), "geoip.dat")); err == nil {
+		t.Fatal("missing geo file accepted")
+	}
+}
@@ -0,0 +1,61 @@
+package xray
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Xray binds an inbound to a single address, so an inbound with several listen addresses is
+// expanded into one Xray inbound per address. The first keeps the panel tag, the others get
+// "<tag>-listen<N>" (N starting at 2). Traffic of alias tags is accounted to the base tag and
+// API user operations on the base tag are applied to every alias. Only tags generated as
+// aliases are treated as such, so any other tag that ends in "-listen<N>" keeps its own traffic.
+
+// ListenAliasTag returns the Xray tag of the inbound bound to the index-th (0-based) listen address of tag.
+func ListenAliasTag(tag string, index int) string {
+	if index == 0 {
+		return tag
+	}
+	alias := fmt.Sprintf("%s-listen%d", tag, index+1)
+	listenAliasesMu.Lock()
+	listenAliasBases[alias] = tag
+	listenAliasesMu.Unlock()
+	return alias
+}
+
+// BaseInboundTag returns the panel inbound tag for an Xray inbound tag: the base tag of an alias
+// generated by ListenAliasTag, the tag itself otherwise.
+func BaseInboundTag(tag string) string {
+	listenAliasesMu.RLock()
+	defer listenAliasesMu.RUnlock()
+	if base, ok := listenAliasBases[tag]; ok {
+		return base
+	}
+	return tag
+}
+
+var (
+	listenAliasesMu  sync.RWMutex
+	listenAliasBases = map[string]string{}   // alias tags generated by ListenAliasTag -> base tag
+	listenAliases    = map[string][]string{} // base tag -> alias tags of the running config
+)
+
+// registerListenAliases records the alias tags present in the inbounds of a running config.
+func registerListenAliases(inbounds []InboundConfig) {
+	aliases := map[string][]string{}
+	for _, inbound := range inbounds {
+		if base := BaseInboundTag(inbound.Tag); base != inbound.Tag {
+			aliases[base] = append(aliases[base], inbound.Tag)
+		}
+	}
+	listenAliasesMu.Lock()
+	listenAliases = aliases
+	listenAliasesMu.Unlock()
+}
+
+// inboundTagWithAliases returns tag followed by the alias tags of its additional listen addresses.
+func inboundTagWithAliases(tag string) []string {
+	listenAliasesMu.RLock()
+	defer listenAliasesMu.RUnlock()
+	return append([]string{tag}, listenAliases[tag]...)
+}
@@ -0,0 +1,58 @@
+package xray
+
+import "testing"
+
+func TestListenAliasTag(t *testing.T) {
+	tests := []struct {
+		index int
+		want  string
+	}{
+		{0, "inbound-443"},
+		{1, "inbound-443-listen2"},
+		{2, "inbound-443-listen3"},
+	}
+	for _, test := range tests {
+		tag := ListenAliasTag("inbound-443", test.index)
+		if tag != test.want {
+			t.Errorf("ListenAliasTag(%d) = %q, want %q", test.index, tag, test.want)
+		}
+		if base := BaseInboundTag(tag); base != "inbound-443" {
+			t.Errorf("BaseInboundTag(%q) = %q, want inbound-443", tag, base)
+		}
+	}
+	// Tags that were not generated as aliases are kept, whatever they end in
+	for _, tag := range []string{"inbound-listen2-a", "vpn-listen2", "inbound-443-listen9"} {
+		if base := BaseInboundTag(tag); base != tag {
+			t.Errorf("BaseInboundTag(%q) = %q, want the tag itself", tag, base)
+		}
+	}
+}
+
+func TestInboundTagWithAliases(t *testing.T) {
+	t.Cleanup(func() { registerListenAliases(nil) })
+	registerListenAliases([]InboundConfig{
+		{Tag: "inbound-443"},
+		{Tag: ListenAliasTag("inbound-443", 1)},
+		{Tag: ListenAliasTag("inbound-443", 2)},
+		{Tag: "inbound-80"},
+		// A user inbound whose tag only looks like an alias
+		{Tag: "vpn"},
+		{Tag: "vpn-listen2"},
+	})
+
+	got := inboundTagWithAliases("inbound-443")
+	want := []string{"inbound-443", "inbound-443-listen2", "inbound-443-listen3"}
+	if len(got) != len(want) {
+		t.Fatalf("inboundTagWithAliases() = %q, want %q", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("inboundTagWithAliases() = %q, want %q", got, want)
+		}
+	}
+	for _, tag := range []string{"inbound-80", "vpn", "vpn-listen2"} {
+		if got := inboundTagWithAliases(tag); len(got) != 1 || got[0] != tag {
+			t.Fatalf("inboundTagWithAliases(%s) = %q, want only the tag", tag, got)
+		}
+	}
+}
@@ -4,10 +4,50 @@ import (
 	"regexp"
 	"runtime"
 	"strings"
+	"sync"
 
 	"github.com/konstpic/sharx-code/v2/logger"
 )
 
+// RecentLogsSize is the number of core output lines kept in memory for GetRecentLogs.
+const RecentLogsSize = 200
+
+// logRing is a fixed-size ring buffer of the most recent core output lines.
+// It is shared by all processes, so the output of a crashed core survives its restart.
+type logRing struct {
+	mu    sync.Mutex
+	lines [RecentLogsSize]string
+	next  int
+	count int
+}
+
+var recentLogs = &logRing{}
+
+func (r *logRing) add(line string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.lines[r.next] = line
+	r.next = (r.next + 1) % RecentLogsSize
+	if r.count < RecentLogsSize {
+		r.count++
+	}
+}
+
+// last returns up to n of the most recent lines, oldest first.
+func (r *logRing) last(n int) []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if n <= 0 || n > r.count {
+		n = r.count
+	}
+	lines := make([]string, n)
+	start := (r.next - n + RecentLogsSize) % RecentLogsSize
+	for i := range n {
+		lines[i] = r.lines[(start+i)%RecentLogsSize]
+	}
+	return lines
+}
+
 // NewLogWriter returns a new LogWriter for processing Xray log output.
 func NewLogWriter() *LogWriter {
 	return &LogWriter{}
@@ -31,6 +71,12 @@ func (lw *LogWriter) Write(m []byte) (n int, err error) {
 		return len(m), nil
 	}
 
+	for line := range strings.SplitSeq(message, "\n") {
+		if line = strings.TrimRight(line, "\r"); line != "" {
+			recentLogs.add(line)
+		}
+	}
+
 	// Check if the message contains a crash
 	if crashRegex.MatchString(message) {
 		logger.Debug("Core crash detected:\n", message)
@@ -0,0 +1,65 @@
+package xray
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestLogRingLast(t *testing.T) {
+	ring := &logRing{}
+	if lines := ring.last(10); len(lines) != 0 {
+		t.Fatalf("empty ring returned %q", lines)
+	}
+	for i := range 3 {
+		ring.add(fmt.Sprint("line ", i))
+	}
+	if lines := ring.last(0); !reflect.DeepEqual(lines, []string{"line 0", "line 1", "line 2"}) {
+		t.Fatalf("last(0) = %q, want every line oldest first", lines)
+	}
+	if lines := ring.last(2); !reflect.DeepEqual(lines, []string{"line 1", "line 2"}) {
+		t.Fatalf("last(2) = %q, want the two newest lines", lines)
+	}
+}
+
+func TestLogRingWrapsAround(t *testing.T) {
+	ring := &logRing{}
+	total := RecentLogsSize + 50
+	for i := range total {
+		ring.add(fmt.Sprint("line ", i))
+	}
+
+	lines := ring.last(-1)
+	if len(lines) != RecentLogsSize {
+		t.Fatalf("ring holds %d lines, want %d", len(lines), RecentLogsSize)
+	}
+	for i, line := range lines {
+		if want := fmt.Sprint("line ", total-RecentLogsSize+i); line != want {
+			t.Fatalf("line %d = %q, want %q", i, line, want)
+		}
+	}
+	if lines := ring.last(3); !reflect.DeepEqual(lines, []string{
+		fmt.Sprint("line ", total-3), fmt.Sprint("line ", total-2), fmt.Sprint("line ", total-1),
+	}) {
+		t.Fatalf("last(3) = %q, want the three newest lines in order", lines)
+	}
+}
+
+func TestLogWriterKeepsRecentLines(t *testing.T) {
+	previous := recentLogs
+	recentLogs = &logRing{}
+	t.Cleanup(func() { recentLogs = previous })
+
+	writer := NewLogWriter()
+	writer.Write([]byte("2026/01/14 10:00:00.000000 [Info] core: Xray started\r\n\n"))
+	writer.Write([]byte("2026/01/14 10:00:01.000000 [Warning] first\n2026/01/14 10:00:01.000001 [Warning] second\n"))
+
+	want := []string{
+		"2026/01/14 10:00:00.000000 [Info] core: Xray started",
+		"2026/01/14 10:00:01.000000 [Warning] first",
+		"2026/01/14 10:00:01.000001 [Warning] second",
+	}
+	if lines := recentLogs.last(10); !reflect.DeepEqual(lines, want) {
+		t.Fatalf("recent logs = %q, want %q", lines, want)
+	}
+}
@@ -11,6 +11,7 @@ import (
 	"path/filepath"
 	"runtime"
 	"strings"
+	"sync/atomic"
 	"syscall"
 	"time"
 
@@ -24,9 +25,51 @@ func GetBinaryName() string {
 	return fmt.Sprintf("xray-%s-%s", runtime.GOOS, runtime.GOARCH)
 }
 
+// binaryPathOverride is the explicit Xray binary path from the panel settings (empty = not set).
+var binaryPathOverride atomic.Value
+
+// SetBinaryPathOverride sets an explicit Xray binary path that takes precedence over
+// XUI_XRAY_BIN and the bin folder convention. An empty path removes the override.
+func SetBinaryPathOverride(path string) {
+	binaryPathOverride.Store(strings.TrimSpace(path))
+}
+
+// ValidateBinaryPath checks that path is an existing executable file.
+func ValidateBinaryPath(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("xray binary %s: %w", path, err)
+	}
+	if info.IsDir() {
+		return fmt.Errorf("xray binary %s is a directory", path)
+	}
+	if runtime.GOOS != "windows" && info.Mode().Perm()&0o111 == 0 {
+		return fmt.Errorf("xray binary %s is not executable", path)
+	}
+	return nil
+}
+
+// GetDefaultBinaryPath returns the path of the Xray binary shipped in the bin folder.
+func GetDefaultBinaryPath() string {
+	return config.GetBinFolderPath() + "/" + GetBinaryName()
+}
+
 // GetBinaryPath returns the full path to the Xray binary executable.
+// An explicit path (panel setting, then the XUI_XRAY_BIN environment variable) wins over the
+// bin folder convention; an explicit path that is not an executable file is ignored with a warning.
 func GetBinaryPath() string {
-	return config.GetBinFolderPath() + "/" + GetBinaryName()
+	override, _ := binaryPathOverride.Load().(string)
+	for _, path := range []string{override, strings.TrimSpace(os.Getenv("XUI_XRAY_BIN"))} {
+		if path == "" {
+			continue
+		}
+		if err := ValidateBinaryPath(path); err != nil {
+			logger.Warning("ignoring explicit xray binary path:", err)
+			continue
+		}
+		return path
+	}
+	return GetDefaultBinaryPath()
 }
 
 // GetConfigPath returns the path to the Xray configuration file in the binary folder.
@@ -175,6 +218,12 @@ func (p *process) GetResult() string {
 	return p.logWriter.lastLine
 }
 
+// GetRecentLogs returns up to n of the most recent lines of core output, oldest first.
+// The buffer holds at most RecentLogsSize lines; n <= 0 returns all of them.
+func (p *process) GetRecentLogs(n int) []string {
+	return recentLogs.last(n)
+}
+
 // GetVersion returns the version string of the Xray process.
 func (p *process) GetVersion() string {
 	return p.version
@@ -253,6 +302,7 @@ func (p *process) Start() (err error) {
 	if err != nil {
 		return err
 	}
+	registerListenAliases(p.config.InboundConfigs)
 
 	cmd := exec.Command(GetBinaryPath(), "-c", configPath)
 	p.cmd = cmd
@@ -333,6 +383,41 @@ func WriteConfigFile(xrayConfig *Config) (string, error) {
 	return configPath, nil
 }
 
+// TestConfig checks xrayConfig with the Xray binary ("-test") without starting a core.
+// The config is written to a temporary file so the live config file is left untouched.
+// On failure it returns the binary's output, which contains Xray's diagnostics.
+func TestConfig(xrayConfig *Config) (string, error) {
+	data, err := json.MarshalIndent(xrayConfig, "", "  ")
+	if err != nil {
+		return "", common.NewErrorf("Failed to generate XRAY configuration: %v", err)
+	}
+
+	tmpFile, err := os.CreateTemp("", "xray-check-*.json")
+	if err != nil {
+		return "", common.NewErrorf("Failed to create temporary config file: %v", err)
+	}
+	defer os.Remove(tmpFile.Name())
+
+	_, err = tmpFile.Write(data)
+	tmpFile.Close()
+	if err != nil {
+		return "", common.NewErrorf("Failed to write temporary config file: %v", err)
+	}
+
+	cmd := exec.Command(GetBinaryPath(), "-test", "-c", tmpFile.Name())
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	if err := cmd.Run(); err != nil {
+		output := strings.TrimSpace(out.String())
+		if output == "" {
+			output = err.Error()
+		}
+		return output, common.NewErrorf("xray config check failed: %v", err)
+	}
+	return strings.TrimSpace(out.String()), nil
+}
+
 // Stop terminates the running Xray process.
 func (p *process) Stop() error {
 	if !p.IsRunning() {
@@ -0,0 +1,102 @@
+package xray
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// writeStubBinary writes an executable shell script standing in for the Xray binary.
+func writeStubBinary(t *testing.T, script string) string {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("stub binaries are shell scripts")
+	}
+	path := filepath.Join(t.TempDir(), "xray")
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// useBinary makes path the Xray binary for the rest of the test.
+func useBinary(t *testing.T, path string) {
+	t.Helper()
+	SetBinaryPathOverride(path)
+	t.Cleanup(func() { SetBinaryPathOverride("") })
+}
+
+func TestTestConfigReturnsDiagnostics(t *testing.T) {
+	useBinary(t, writeStubBinary(t, `echo "Failed to start: main: failed to load config files: unknown protocol: bogus" >&2
+exit 23
+`))
+	output, err := TestConfig(&Config{})
+	if err == nil {
+		t.Fatal("broken config passed the check")
+	}
+	if !strings.Contains(output, "unknown protocol: bogus") {
+		t.Fatalf("output %q does not contain the binary's diagnostics", output)
+	}
+}
+
+func TestTestConfigPassesConfigFile(t *testing.T) {
+	// The stub accepts the config only if it was given a readable -c file
+	useBinary(t, writeStubBinary(t, `[ "$1" = "-test" ] && [ "$2" = "-c" ] && [ -r "$3" ] || exit 1
+echo "Configuration OK."
+`))
+	output, err := TestConfig(&Config{})
+	if err != nil {
+		t.Fatalf("valid config failed the check: %v (%s)", err, output)
+	}
+	if output != "Configuration OK." {
+		t.Fatalf("output = %q, want %q", output, "Configuration OK.")
+	}
+}
+
+func TestGetBinaryPathResolution(t *testing.T) {
+	binFolder := t.TempDir()
+	t.Setenv("XUI_BIN_FOLDER", binFolder)
+	defaultPath := binFolder + "/" + GetBinaryName()
+	setting := writeStubBinary(t, "exit 0\n")
+	env := writeStubBinary(t, "exit 0\n")
+
+	tests := []struct {
+		name     string
+		override string
+		env      string
+		want     string
+	}{
+		{"fallback to the bin folder", "", "", defaultPath},
+		{"environment variable", "", env, env},
+		{"setting wins over the environment", setting, env, setting},
+		{"setting without environment", setting, "", setting},
+		{"invalid setting falls back to the environment", filepath.Join(binFolder, "missing"), env, env},
+		{"invalid setting and environment fall back to the bin folder", binFolder, filepath.Join(binFolder, "missing"), defaultPath},
+	}
+	for _, test := range tests {
+		useBinary(t, test.override)
+		t.Setenv("XUI_XRAY_BIN", test.env)
+		if got := GetBinaryPath(); got != test.want {
+			t.Errorf("%s: GetBinaryPath() = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestValidateBinaryPath(t *testing.T) {
+	if err := ValidateBinaryPath(writeStubBinary(t, "exit 0\n")); err != nil {
+		t.Errorf("executable rejected: %v", err)
+	}
+
+	dir := t.TempDir()
+	plain := filepath.Join(dir, "xray")
+	if err := os.WriteFile(plain, []byte("not a binary"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{plain, dir, filepath.Join(dir, "missing")} {
+		if err := ValidateBinaryPath(path); err == nil {
+			t.Errorf("ValidateBinaryPath(%q) accepted a path that is not an executable file", path)
+		}
+	}
+}